@@ -0,0 +1,67 @@
+// Package cache stores AI responses so that identical deterministic requests can be
+// answered without calling the provider again.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"st-novel-go/src/config"
+	"sync"
+	"time"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+
+	defaultTTL        = 24 * time.Hour
+	defaultMaxEntries = 1000
+	keyPrefix         = "stnovel:ai-cache:"
+)
+
+// Store is a key-value store with expiring entries.
+type Store interface {
+	// Get returns the value of key and whether it was found.
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+}
+
+var (
+	store     Store
+	storeOnce sync.Once
+)
+
+// Enabled reports whether response caching is switched on in the configuration.
+func Enabled() bool {
+	return config.AppConfig.AICache.Enabled
+}
+
+// TTL returns how long cached responses are kept.
+func TTL() time.Duration {
+	if seconds := config.AppConfig.AICache.TTLSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultTTL
+}
+
+// Default returns the store selected by the configuration, creating it on first use.
+func Default() Store {
+	storeOnce.Do(func() {
+		cfg := config.AppConfig.AICache
+		switch cfg.Backend {
+		case BackendRedis:
+			redisCfg := config.AppConfig.Redis
+			store = NewRedisStore(fmt.Sprintf("%s:%d", redisCfg.Host, redisCfg.Port), redisCfg.Password, redisCfg.DB)
+			log.Printf("AI response cache uses Redis at %s:%d", redisCfg.Host, redisCfg.Port)
+		default:
+			maxEntries := cfg.MaxEntries
+			if maxEntries <= 0 {
+				maxEntries = defaultMaxEntries
+			}
+			store = NewMemoryStore(maxEntries)
+			log.Printf("AI response cache uses memory (max %d entries)", maxEntries)
+		}
+	})
+	return store
+}
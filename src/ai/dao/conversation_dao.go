@@ -1,17 +1,31 @@
 package dao
 
 import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"st-novel-go/src/ai/model"
 	"st-novel-go/src/database"
+	"time"
 )
 
 func CreateConversation(conv *model.Conversation) error {
 	return database.DB.Create(conv).Error
 }
 
-func GetConversationsByUserID(userID uint) ([]model.Conversation, error) {
+// GetConversationsByUserID returns the user's conversations, optionally limited to
+// those linked to a novel and/or chapter (empty strings disable the filter).
+func GetConversationsByUserID(userID uint, novelID string, chapterID string) ([]model.Conversation, error) {
 	var conversations []model.Conversation
-	err := database.DB.Where("user_id = ?", userID).Order("updated_at DESC").Find(&conversations).Error
+	query := database.DB.Where("user_id = ?", userID)
+	if novelID != "" {
+		query = query.Where("novel_id = ?", novelID)
+	}
+	if chapterID != "" {
+		query = query.Where("chapter_id = ?", chapterID)
+	}
+	err := query.Order("updated_at DESC").Find(&conversations).Error
 	return conversations, err
 }
 
@@ -29,12 +43,129 @@ func UpdateConversation(conv *model.Conversation) error {
 }
 
 func DeleteConversation(id string, userID uint) error {
-	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&model.Conversation{})
-	if result.Error != nil {
-		return result.Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&model.Conversation{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("conversation not found")
+		}
+		return tx.Where("conversation_id = ?", id).Delete(&model.ConversationMessage{}).Error
+	})
+}
+
+// AppendConversationBranch appends messages as a chain under parentID (nil for a new
+// root) and makes the last of them the new active leaf. Sequence numbers and parent
+// links are assigned here. The conversation row is locked for the duration of the
+// transaction so that concurrent turns cannot interleave.
+func AppendConversationBranch(conversationID uuid.UUID, parentID *uuid.UUID, messages []model.ConversationMessage) error {
+	if len(messages) == 0 {
+		return nil
 	}
-	if result.RowsAffected == 0 {
-		return database.DB.Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var conv model.Conversation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&conv, "id = ?", conversationID).Error; err != nil {
+			return err
+		}
+		var maxSeq int
+		if err := tx.Model(&model.ConversationMessage{}).
+			Where("conversation_id = ?", conversationID).
+			Select("COALESCE(MAX(seq), 0)").
+			Scan(&maxSeq).Error; err != nil {
+			return err
+		}
+
+		for i := range messages {
+			if messages[i].ID == uuid.Nil {
+				messages[i].ID = uuid.New()
+			}
+			messages[i].ConversationID = conversationID
+			messages[i].Seq = maxSeq + i + 1
+			messages[i].ParentID = parentID
+			id := messages[i].ID
+			parentID = &id
+		}
+		if err := tx.Create(&messages).Error; err != nil {
+			return err
+		}
+
+		// 刷新会话的 updated_at，保持会话列表按最近活跃排序
+		return tx.Model(&conv).Updates(map[string]interface{}{
+			"active_leaf_id": parentID,
+			"updated_at":     time.Now(),
+		}).Error
+	})
+}
+
+func GetMessagesForConversations(conversationIDs []uuid.UUID) ([]model.ConversationMessage, error) {
+	var messages []model.ConversationMessage
+	if len(conversationIDs) == 0 {
+		return messages, nil
 	}
-	return nil
+	err := database.DB.Where("conversation_id IN ?", conversationIDs).Order("conversation_id, seq ASC").Find(&messages).Error
+	return messages, err
+}
+
+func UpdateConversationContextSummary(conversationID uuid.UUID, summary string, upToSeq int) error {
+	return database.DB.Model(&model.Conversation{}).Where("id = ?", conversationID).UpdateColumns(map[string]interface{}{
+		"context_summary":     summary,
+		"context_summary_seq": upToSeq,
+	}).Error
+}
+
+// UpdateConversationColumns updates the given columns without touching updated_at,
+// so background updates do not reorder the conversation list.
+func UpdateConversationColumns(conversationID uuid.UUID, columns map[string]interface{}) error {
+	return database.DB.Model(&model.Conversation{}).Where("id = ?", conversationID).UpdateColumns(columns).Error
+}
+
+// GetConversationMessageNodes returns the tree structure of a conversation (id,
+// parent and seq only) ordered by seq.
+func GetConversationMessageNodes(conversationID uuid.UUID) ([]model.ConversationMessage, error) {
+	var nodes []model.ConversationMessage
+	err := database.DB.Select("id", "parent_id", "seq", "role").
+		Where("conversation_id = ?", conversationID).
+		Order("seq ASC").
+		Find(&nodes).Error
+	return nodes, err
+}
+
+// GetConversationMessagesByIDs returns the given messages ordered by seq.
+func GetConversationMessagesByIDs(conversationID uuid.UUID, ids []uuid.UUID) ([]model.ConversationMessage, error) {
+	var messages []model.ConversationMessage
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := database.DB.Where("conversation_id = ? AND id IN ?", conversationID, ids).Order("seq ASC").Find(&messages).Error
+	return messages, err
+}
+
+func FindConversationMessageByID(conversationID uuid.UUID, messageID string) (*model.ConversationMessage, error) {
+	var msg model.ConversationMessage
+	if err := database.DB.Where("conversation_id = ? AND id = ?", conversationID, messageID).First(&msg).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func UpdateConversationActiveLeaf(conversationID uuid.UUID, leafID uuid.UUID) error {
+	return database.DB.Model(&model.Conversation{}).Where("id = ?", conversationID).UpdateColumn("active_leaf_id", leafID).Error
+}
+
+// ImportConversation inserts a conversation together with its messages. Timestamps
+// already set on the records are kept.
+func ImportConversation(conv *model.Conversation, messages []model.ConversationMessage) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(conv).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		for i := range messages {
+			messages[i].ConversationID = conv.ID
+		}
+		return tx.CreateInBatches(&messages, 200).Error
+	})
 }
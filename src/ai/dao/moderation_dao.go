@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/database"
+)
+
+func CreateModerationLog(entry *model.ModerationLog) error {
+	return database.DB.Create(entry).Error
+}
+
+// GetModerationLogs returns moderation logs, newest first. A userID of 0 returns the
+// logs of all users and an empty action returns every action.
+func GetModerationLogs(userID uint, action string, offset, limit int) ([]model.ModerationLog, int64, error) {
+	query := database.DB.Model(&model.ModerationLog{})
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []model.ModerationLog
+	err := query.Order("created_at DESC").Offset(offset).Limit(limit).Find(&logs).Error
+	return logs, total, err
+}
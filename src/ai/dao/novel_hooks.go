@@ -0,0 +1,35 @@
+package dao
+
+import (
+	"gorm.io/gorm"
+	"st-novel-go/src/ai/model"
+	novelDao "st-novel-go/src/novel/dao"
+	"time"
+)
+
+// RegisterNovelHooks keeps the AI conversations linked to novels and chapters in
+// step with them: they follow a novel into and out of the trash, are deleted with
+// it, and stay linked to the novel only when their chapter is deleted.
+func RegisterNovelHooks() {
+	novelDao.RegisterNovelHooks(novelDao.NovelHooks{
+		NovelTrashed: func(tx *gorm.DB, novelID string, userID uint) error {
+			return tx.Where("novel_id = ? AND user_id = ?", novelID, userID).Delete(&model.Conversation{}).Error
+		},
+		NovelRestored: func(tx *gorm.DB, novelID string, userID uint, trashedAt time.Time) error {
+			// 只恢复随小说一起移入回收站的对话；在此之前已单独删除的对话保持删除状态
+			return tx.Unscoped().Model(&model.Conversation{}).
+				Where("novel_id = ? AND user_id = ? AND deleted_at >= ?", novelID, userID, trashedAt).
+				Update("deleted_at", nil).Error
+		},
+		NovelDeleted: func(tx *gorm.DB, novelID string) error {
+			convIDs := tx.Unscoped().Model(&model.Conversation{}).Select("id").Where("novel_id = ?", novelID)
+			if err := tx.Unscoped().Where("conversation_id IN (?)", convIDs).Delete(&model.ConversationMessage{}).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Where("novel_id = ?", novelID).Delete(&model.Conversation{}).Error
+		},
+		ChapterDeleted: func(tx *gorm.DB, chapterID string) error {
+			return tx.Unscoped().Model(&model.Conversation{}).Where("chapter_id = ?", chapterID).UpdateColumn("chapter_id", nil).Error
+		},
+	})
+}
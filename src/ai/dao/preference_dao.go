@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/database"
+)
+
+// GetAIPreference returns the user's preference, or the defaults when none has been saved yet.
+func GetAIPreference(userID uint) (*model.AIPreference, error) {
+	var pref model.AIPreference
+	err := database.DB.Where("user_id = ?", userID).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.AIPreference{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pref, nil
+}
+
+func SaveAIPreference(pref *model.AIPreference) error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"auto_title_disabled", "auto_title_model", "updated_at"}),
+	}).Create(pref).Error
+}
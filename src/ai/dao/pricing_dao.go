@@ -0,0 +1,56 @@
+package dao
+
+import (
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/database"
+)
+
+// GetGlobalModelPrices returns the catalogue without per-key overrides.
+func GetGlobalModelPrices() ([]model.ModelPrice, error) {
+	var prices []model.ModelPrice
+	err := database.DB.Where("api_key_id = 0").Order("provider, model").Find(&prices).Error
+	return prices, err
+}
+
+func GetModelPricesForKey(apiKeyID uint) ([]model.ModelPrice, error) {
+	var prices []model.ModelPrice
+	err := database.DB.Where("api_key_id = ?", apiKeyID).Order("model").Find(&prices).Error
+	return prices, err
+}
+
+// GetPriceCandidates returns the global and key-specific prices of a provider.
+func GetPriceCandidates(provider string, apiKeyID uint) ([]model.ModelPrice, error) {
+	var prices []model.ModelPrice
+	err := database.DB.Where("provider = ? AND api_key_id IN ?", provider, []uint{0, apiKeyID}).Find(&prices).Error
+	return prices, err
+}
+
+func FindModelPriceByID(id uint) (*model.ModelPrice, error) {
+	var price model.ModelPrice
+	if err := database.DB.First(&price, id).Error; err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// UpsertModelPrice creates the price or updates the existing entry with the same
+// provider, model and key.
+func UpsertModelPrice(price *model.ModelPrice) error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider"}, {Name: "model"}, {Name: "api_key_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"input_price", "output_price", "updated_at"}),
+	}).Create(price).Error
+}
+
+func UpdateModelPrice(price *model.ModelPrice) error {
+	return database.DB.Save(price).Error
+}
+
+func DeleteModelPrice(id uint) error {
+	return database.DB.Delete(&model.ModelPrice{}, id).Error
+}
+
+func DeleteKeyModelPrice(apiKeyID uint, modelName string) error {
+	return database.DB.Where("api_key_id = ? AND model = ?", apiKeyID, modelName).Delete(&model.ModelPrice{}).Error
+}
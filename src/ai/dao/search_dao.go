@@ -0,0 +1,85 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/database"
+	"strings"
+	"time"
+)
+
+// ConversationHit is a conversation whose title or summary matches a search.
+type ConversationHit struct {
+	ID        uuid.UUID
+	Title     string
+	Summary   string
+	UpdatedAt time.Time
+	Score     float64
+}
+
+// MessageHit is a message that matches a search.
+type MessageHit struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	Role           string
+	Content        string
+	CreatedAt      time.Time
+	Score          float64
+}
+
+// SearchConversationHits matches titles and summaries of the user's conversations.
+// With useFulltext the ngram full-text index is used; otherwise every term must
+// appear as a substring and all hits get the same score.
+func SearchConversationHits(userID uint, booleanQuery string, terms []string, useFulltext bool, limit int) ([]ConversationHit, error) {
+	var hits []ConversationHit
+	query := database.DB.Model(&model.Conversation{}).Where("user_id = ?", userID)
+	if useFulltext {
+		query = query.Select("id, title, summary, updated_at, MATCH(title, summary) AGAINST(? IN BOOLEAN MODE) AS score", booleanQuery).
+			Where("MATCH(title, summary) AGAINST(? IN BOOLEAN MODE)", booleanQuery).
+			Order("score DESC")
+	} else {
+		query = query.Select("id, title, summary, updated_at, 1 AS score")
+		for _, term := range terms {
+			pattern := "%" + escapeLike(term) + "%"
+			query = query.Where("(title LIKE ? OR summary LIKE ?)", pattern, pattern)
+		}
+		query = query.Order("updated_at DESC")
+	}
+	err := query.Limit(limit).Scan(&hits).Error
+	return hits, err
+}
+
+// SearchMessageHits matches message bodies of the user's conversations, on every
+// branch. See SearchConversationHits for the meaning of useFulltext.
+func SearchMessageHits(userID uint, booleanQuery string, terms []string, useFulltext bool, limit int) ([]MessageHit, error) {
+	var hits []MessageHit
+	query := database.DB.Table("conversation_messages AS m").
+		Joins("JOIN conversations AS c ON c.id = m.conversation_id AND c.deleted_at IS NULL").
+		Where("c.user_id = ? AND m.deleted_at IS NULL", userID)
+	if useFulltext {
+		query = query.Select("m.id, m.conversation_id, m.role, m.content, m.created_at, MATCH(m.content) AGAINST(? IN BOOLEAN MODE) AS score", booleanQuery).
+			Where("MATCH(m.content) AGAINST(? IN BOOLEAN MODE)", booleanQuery).
+			Order("score DESC")
+	} else {
+		query = query.Select("m.id, m.conversation_id, m.role, m.content, m.created_at, 1 AS score")
+		for _, term := range terms {
+			query = query.Where("m.content LIKE ?", "%"+escapeLike(term)+"%")
+		}
+		query = query.Order("m.created_at DESC")
+	}
+	err := query.Limit(limit).Scan(&hits).Error
+	return hits, err
+}
+
+func GetConversationsByIDs(userID uint, ids []uuid.UUID) ([]model.Conversation, error) {
+	var conversations []model.Conversation
+	if len(ids) == 0 {
+		return conversations, nil
+	}
+	err := database.DB.Where("user_id = ? AND id IN ?", userID, ids).Find(&conversations).Error
+	return conversations, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
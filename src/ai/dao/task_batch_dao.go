@@ -0,0 +1,128 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/database"
+)
+
+func CreateTaskBatch(batch *model.TaskBatch, items []model.TaskBatchItem) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].BatchID = batch.ID
+		}
+		return tx.CreateInBatches(&items, 200).Error
+	})
+}
+
+func FindTaskBatchByID(id string, userID uint) (*model.TaskBatch, error) {
+	var batch model.TaskBatch
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&batch).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetTaskBatchesByUserID(userID uint) ([]model.TaskBatch, error) {
+	var batches []model.TaskBatch
+	err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&batches).Error
+	return batches, err
+}
+
+func GetTaskBatchItems(batchID uuid.UUID) ([]model.TaskBatchItem, error) {
+	var items []model.TaskBatchItem
+	err := database.DB.Where("batch_id = ?", batchID).Order("seq ASC").Find(&items).Error
+	return items, err
+}
+
+func GetTaskBatchItemsByStatus(batchID uuid.UUID, status string) ([]model.TaskBatchItem, error) {
+	var items []model.TaskBatchItem
+	err := database.DB.Where("batch_id = ? AND status = ?", batchID, status).Order("seq ASC").Find(&items).Error
+	return items, err
+}
+
+func UpdateTaskBatchItemColumns(itemID uuid.UUID, columns map[string]interface{}) error {
+	return database.DB.Model(&model.TaskBatchItem{}).Where("id = ?", itemID).Updates(columns).Error
+}
+
+// ResetUnfinishedTaskBatchItems puts the items of a batch that failed or never
+// finished back into the queue and returns how many there are.
+func ResetUnfinishedTaskBatchItems(batchID uuid.UUID) (int64, error) {
+	result := database.DB.Model(&model.TaskBatchItem{}).
+		Where("batch_id = ? AND status IN ?", batchID, []string{model.TaskStatusFailed, model.TaskStatusRunning, model.TaskStatusPending}).
+		Updates(map[string]interface{}{"status": model.TaskStatusPending, "error": ""})
+	return result.RowsAffected, result.Error
+}
+
+// RequeueInterruptedTaskBatches puts the items that were running when the server
+// stopped back into the queue and returns the IDs of the batches that still have
+// queued items.
+func RequeueInterruptedTaskBatches() ([]uuid.UUID, error) {
+	if err := database.DB.Model(&model.TaskBatchItem{}).
+		Where("status = ?", model.TaskStatusRunning).
+		Update("status", model.TaskStatusPending).Error; err != nil {
+		return nil, err
+	}
+	var batchIDs []uuid.UUID
+	err := database.DB.Model(&model.TaskBatchItem{}).
+		Distinct("batch_id").
+		Where("status = ?", model.TaskStatusPending).
+		Pluck("batch_id", &batchIDs).Error
+	return batchIDs, err
+}
+
+// RefreshTaskBatchCounts recomputes the counters of a batch from its items and
+// derives the batch status from them.
+func RefreshTaskBatchCounts(batchID uuid.UUID) (*model.TaskBatch, error) {
+	var batch model.TaskBatch
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var counts []struct {
+			Status string
+			Count  int
+		}
+		if err := tx.Model(&model.TaskBatchItem{}).Select("status, COUNT(*) AS count").
+			Where("batch_id = ?", batchID).Group("status").Scan(&counts).Error; err != nil {
+			return err
+		}
+
+		total, succeeded, failed := 0, 0, 0
+		for _, c := range counts {
+			total += c.Count
+			switch c.Status {
+			case model.TaskStatusSucceeded:
+				succeeded = c.Count
+			case model.TaskStatusFailed:
+				failed = c.Count
+			}
+		}
+		status := model.TaskStatusRunning
+		if succeeded+failed == total {
+			switch {
+			case failed == 0:
+				status = model.TaskStatusSucceeded
+			case succeeded == 0:
+				status = model.TaskStatusFailed
+			default:
+				status = model.TaskStatusPartial
+			}
+		}
+
+		if err := tx.Model(&model.TaskBatch{}).Where("id = ?", batchID).Updates(map[string]interface{}{
+			"total":     total,
+			"succeeded": succeeded,
+			"failed":    failed,
+			"status":    status,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", batchID).First(&batch).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
@@ -0,0 +1,87 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/database"
+	"time"
+)
+
+// UsageTotals is the aggregated usage of a user over a period.
+type UsageTotals struct {
+	Requests         int64
+	CacheHits        int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+func CreateUsageRecord(record *model.AIUsageRecord) error {
+	return database.DB.Create(record).Error
+}
+
+func SumUsageSince(userID uint, since time.Time) (*UsageTotals, error) {
+	var totals UsageTotals
+	err := database.DB.Model(&model.AIUsageRecord{}).
+		Select("COUNT(*) AS requests, COALESCE(SUM(cache_hit), 0) AS cache_hits, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cost), 0) AS cost").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Scan(&totals).Error
+	return &totals, err
+}
+
+// GetAIQuotaOverride returns the user's quota override, or nil when there is none.
+func GetAIQuotaOverride(userID uint) (*model.AIQuotaOverride, error) {
+	var override model.AIQuotaOverride
+	err := database.DB.Where("user_id = ?", userID).First(&override).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+func SaveAIQuotaOverride(override *model.AIQuotaOverride) error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"daily_tokens", "monthly_tokens", "requests_per_minute", "daily_cost", "monthly_cost", "updated_at"}),
+	}).Create(override).Error
+}
+
+func DeleteAIQuotaOverride(userID uint) error {
+	return database.DB.Where("user_id = ?", userID).Delete(&model.AIQuotaOverride{}).Error
+}
+
+// SumUsageByProvider returns the user's all-time usage per provider.
+func SumUsageByProvider(userID uint) (map[string]UsageTotals, error) {
+	var rows []struct {
+		Provider string
+		UsageTotals
+	}
+	err := database.DB.Model(&model.AIUsageRecord{}).
+		Select("provider, COUNT(*) AS requests, COALESCE(SUM(cache_hit), 0) AS cache_hits, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, COALESCE(SUM(cost), 0) AS cost").
+		Where("user_id = ?", userID).
+		Group("provider").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]UsageTotals, len(rows))
+	for _, row := range rows {
+		totals[row.Provider] = row.UsageTotals
+	}
+	return totals, nil
+}
+
+// GetUsageRecords returns one page of the user's usage records, newest first.
+func GetUsageRecords(userID uint, offset, limit int) ([]model.AIUsageRecord, error) {
+	var records []model.AIUsageRecord
+	err := database.DB.Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Offset(offset).Limit(limit).
+		Find(&records).Error
+	return records, err
+}
@@ -0,0 +1,44 @@
+package dto
+
+type CreateConversationPayload struct {
+	NovelID   string `json:"novelId"`
+	ChapterID string `json:"chapterId"`
+}
+
+// UpdateConversationPayload updates only the fields that are present. An empty
+// NovelID or ChapterID removes the link.
+type UpdateConversationPayload struct {
+	Title     *string `json:"title"`
+	NovelID   *string `json:"novelId"`
+	ChapterID *string `json:"chapterId"`
+}
+
+// ConversationExport is the JSON export format of a conversation. It contains the
+// whole message tree, so importing it restores every branch.
+type ConversationExport struct {
+	Version      int               `json:"version"`
+	Title        string            `json:"title"`
+	Summary      string            `json:"summary"`
+	NovelID      string            `json:"novelId,omitempty"`
+	ChapterID    string            `json:"chapterId,omitempty"`
+	CreatedAt    string            `json:"createdAt"`
+	UpdatedAt    string            `json:"updatedAt"`
+	ActiveLeafID string            `json:"activeLeafId,omitempty"`
+	Messages     []ExportedMessage `json:"messages"`
+}
+
+type ExportedMessage struct {
+	ID               string `json:"id"`
+	ParentID         string `json:"parentId,omitempty"`
+	Role             string `json:"role"`
+	Content          string `json:"content"`
+	Model            string `json:"model,omitempty"`
+	PromptTokens     int    `json:"promptTokens,omitempty"`
+	CompletionTokens int    `json:"completionTokens,omitempty"`
+	Timestamp        string `json:"timestamp"`
+}
+
+type SaveConversationAsNotePayload struct {
+	NovelID string `json:"novelId" binding:"required"`
+	Title   string `json:"title"`
+}
@@ -0,0 +1,43 @@
+package dto
+
+// InlineEditPayload asks the AI to edit Content[Start:End] of a chapter. Offsets
+// count Unicode code points in the stored chapter HTML.
+type InlineEditPayload struct {
+	ChapterID   string `json:"chapterId" binding:"required"`
+	APIKeyID    uint   `json:"apiKeyId" binding:"required"`
+	Operation   string `json:"operation" binding:"required"` // rewrite / expand / shorten / tone
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Tone        string `json:"tone"`        // operation 为 tone 时必填，例如 "更紧张"
+	Instruction string `json:"instruction"` // 可选的补充要求
+}
+
+// ChapterEditDiffDTO is the result of an inline edit. Hunks are the changed parts
+// of the selection with offsets into the whole chapter content; BaseHash identifies
+// the content they were computed against.
+type ChapterEditDiffDTO struct {
+	ChapterID   string        `json:"chapterId"`
+	BaseHash    string        `json:"baseHash"`
+	Operation   string        `json:"operation"`
+	Start       int           `json:"start"`
+	End         int           `json:"end"`
+	Original    string        `json:"original"`
+	Replacement string        `json:"replacement"`
+	Hunks       []DiffHunkDTO `json:"hunks"`
+}
+
+type DiffHunkDTO struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+}
+
+// AcceptInlineEditPayload applies the accepted hunks of an inline edit. Sending
+// only some of the hunks accepts the edit partially.
+type AcceptInlineEditPayload struct {
+	ChapterID string        `json:"chapterId" binding:"required"`
+	BaseHash  string        `json:"baseHash" binding:"required"`
+	Operation string        `json:"operation"`
+	Hunks     []DiffHunkDTO `json:"hunks" binding:"required"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+type AIPreferenceDTO struct {
+	AutoTitleEnabled bool   `json:"autoTitleEnabled"`
+	AutoTitleModel   string `json:"autoTitleModel"`
+}
+
+type UpdateAIPreferencePayload struct {
+	AutoTitleEnabled *bool   `json:"autoTitleEnabled"`
+	AutoTitleModel   *string `json:"autoTitleModel"`
+}
@@ -0,0 +1,66 @@
+package dto
+
+import "st-novel-go/src/config"
+
+type QuotaUsageDTO struct {
+	DailyTokens       int64   `json:"dailyTokens"`
+	MonthlyTokens     int64   `json:"monthlyTokens"`
+	RequestsPerMinute int64   `json:"requestsPerMinute"`
+	DailyCost         float64 `json:"dailyCost"`
+	MonthlyCost       float64 `json:"monthlyCost"`
+}
+
+// QuotaStatusDTO describes a user's AI quota. In Limits zero means unlimited; in
+// Remaining -1 does.
+type QuotaStatusDTO struct {
+	Plan      string             `json:"plan"`
+	Limits    config.QuotaLimits `json:"limits"`
+	Usage     QuotaUsageDTO      `json:"usage"`
+	Remaining QuotaUsageDTO      `json:"remaining"`
+}
+
+// UpdateQuotaOverridePayload sets per-user limits. Omitted fields use the plan limits.
+type UpdateQuotaOverridePayload struct {
+	DailyTokens       *int64   `json:"dailyTokens"`
+	MonthlyTokens     *int64   `json:"monthlyTokens"`
+	RequestsPerMinute *int     `json:"requestsPerMinute"`
+	DailyCost         *float64 `json:"dailyCost"`
+	MonthlyCost       *float64 `json:"monthlyCost"`
+}
+
+type ModelPriceDTO struct {
+	ID          uint    `json:"id"`
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model"` // 模型名前缀，为空表示该提供商的默认价格
+	APIKeyID    uint    `json:"apiKeyId,omitempty"`
+	InputPrice  float64 `json:"inputPrice"`  // 美元 / 百万输入 token
+	OutputPrice float64 `json:"outputPrice"` // 美元 / 百万输出 token
+}
+
+// ModelPricePayload creates or updates a catalogue entry. Provider is ignored for
+// per-key prices, which always use the key's provider.
+type ModelPricePayload struct {
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model"`
+	InputPrice  float64 `json:"inputPrice"`
+	OutputPrice float64 `json:"outputPrice"`
+}
+
+type ModerationLogDTO struct {
+	ID        uint   `json:"id"`
+	UserID    uint   `json:"userId"`
+	Stage     string `json:"stage"`
+	Action    string `json:"action"`
+	Category  string `json:"category"`
+	Source    string `json:"source"`
+	Reason    string `json:"reason"`
+	Excerpt   string `json:"excerpt"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type ModerationLogPageDTO struct {
+	Items    []ModerationLogDTO `json:"items"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"pageSize"`
+}
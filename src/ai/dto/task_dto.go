@@ -1,13 +1,15 @@
 // st-novel-go/src/ai/dto/task_dto.go
 package dto
 
+import "st-novel-go/src/ai/model"
+
 type AIProviderConfigDTO struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Model       string  `json:"model"`
-	Temperature float32 `json:"temperature"`
-	MaxTokens   int     `json:"maxTokens"`
-	Description string  `json:"description"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Model       string   `json:"model"`
+	Temperature *float32 `json:"temperature"`
+	MaxTokens   int      `json:"maxTokens"`
+	Description string   `json:"description"`
 }
 
 type StreamAITaskPayload struct {
@@ -18,7 +20,43 @@ type StreamAITaskPayload struct {
 }
 
 type TaskStreamEvent struct {
-	Event   string `json:"event"`
-	Content string `json:"content,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Event      string                  `json:"event"`
+	Content    string                  `json:"content,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	Moderation *model.ModerationResult `json:"moderation,omitempty"`
+}
+
+// BatchAITaskPayload runs PromptTemplate once per chapter. Volumes expand to their
+// chapters. The templates may use {{novelTitle}}, {{title}} and {{content}}; when
+// PromptTemplate has no {{content}} the chapter text is appended to it.
+type BatchAITaskPayload struct {
+	Config         AIProviderConfigDTO `json:"config" binding:"required"`
+	ChapterIDs     []string            `json:"chapterIds"`
+	VolumeIDs      []string            `json:"volumeIds"`
+	TaskType       string              `json:"taskType" binding:"required"`
+	TitleTemplate  string              `json:"titleTemplate"`
+	PromptTemplate string              `json:"promptTemplate" binding:"required"`
+}
+
+type TaskBatchDTO struct {
+	ID        string             `json:"id"`
+	NovelID   string             `json:"novelId"`
+	TaskType  string             `json:"taskType"`
+	Model     string             `json:"model"`
+	Status    string             `json:"status"`
+	Total     int                `json:"total"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	CreatedAt string             `json:"createdAt"`
+	Items     []TaskBatchItemDTO `json:"items,omitempty"`
+}
+
+type TaskBatchItemDTO struct {
+	ID               string `json:"id"`
+	SourceID         string `json:"sourceId"`
+	SourceTitle      string `json:"sourceTitle"`
+	Status           string `json:"status"`
+	Attempts         int    `json:"attempts"`
+	Error            string `json:"error,omitempty"`
+	DerivedContentID string `json:"derivedContentId,omitempty"`
 }
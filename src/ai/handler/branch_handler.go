@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/service"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/utils"
+)
+
+type RegeneratePayload struct {
+	APIKeyID        uint   `json:"api_key_id" binding:"required"`
+	ContextStrategy string `json:"context_strategy"`
+}
+
+type EditMessagePayload struct {
+	APIKeyID        uint   `json:"api_key_id" binding:"required"`
+	Content         string `json:"content" binding:"required"`
+	ContextStrategy string `json:"context_strategy"`
+}
+
+type SwitchBranchPayload struct {
+	MessageID string `json:"messageId" binding:"required"`
+}
+
+func GetActiveBranchHandler(c *gin.Context) {
+	convID := c.Param("id")
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	branch, err := service.GetActiveBranch(convID, userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch branch: "+err.Error())
+		return
+	}
+	utils.Success(c, branch)
+}
+
+func SwitchBranchHandler(c *gin.Context) {
+	convID := c.Param("id")
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	var payload SwitchBranchPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	branch, err := service.SwitchBranch(convID, userClaims.UserID, payload.MessageID)
+	if err != nil {
+		utils.Fail(c, "Failed to switch branch: "+err.Error())
+		return
+	}
+	utils.Success(c, branch)
+}
+
+func RegenerateMessageHandler(c *gin.Context) {
+	var payload RegeneratePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	streamChan, err := service.RegenerateMessage(c.Request.Context(), c.Param("id"), c.Param("messageId"), payload.APIKeyID, userClaims.UserID, payload.ContextStrategy)
+	if err != nil {
+		failStream(c, err)
+		return
+	}
+	writeEventStream(c, streamChan)
+}
+
+func EditMessageHandler(c *gin.Context) {
+	var payload EditMessagePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	streamChan, err := service.EditMessage(c.Request.Context(), c.Param("id"), c.Param("messageId"), payload.APIKeyID, userClaims.UserID, payload.Content, payload.ContextStrategy)
+	if err != nil {
+		failStream(c, err)
+		return
+	}
+	writeEventStream(c, streamChan)
+}
+
+// writeEventStream forwards stream responses to the client as SSE. Persistence is
+// handled by the service, so nothing needs to happen when the stream ends.
+func writeEventStream(c *gin.Context, streamChan <-chan model.StreamResponse) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case chunk, ok := <-streamChan:
+			if !ok {
+				return false
+			}
+			jsonData, err := json.Marshal(chunk)
+			if err != nil {
+				errorChunk := model.StreamResponse{Event: "error", Error: "Failed to marshal stream data"}
+				errorData, _ := json.Marshal(errorChunk)
+				fmt.Fprintf(w, "data: %s\n\n", errorData)
+				return true
+			}
+			fmt.Fprintf(w, "data: %s\n\n", jsonData)
+			return true
+		}
+	})
+}
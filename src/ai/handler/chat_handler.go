@@ -2,26 +2,35 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"io"
+	"log"
+	"st-novel-go/src/ai/dto"
 	"st-novel-go/src/ai/model"
 	"st-novel-go/src/ai/service"
 	"st-novel-go/src/middleware"
 	"st-novel-go/src/utils"
+	"strconv"
 )
 
+// ChatPayload supports two modes. In client mode the full history is sent in
+// Messages. In server mode Messages is empty and only the new user Message is
+// sent together with ConversationID; the history is then loaded on the server.
 type ChatPayload struct {
-	APIKeyID       uint                `json:"api_key_id" binding:"required"`
-	Messages       []model.ChatMessage `json:"messages" binding:"required"`
-	ConversationID string              `json:"conversation_id"`
+	APIKeyID        uint                `json:"api_key_id" binding:"required"`
+	Messages        []model.ChatMessage `json:"messages"`
+	ConversationID  string              `json:"conversation_id"`
+	Message         string              `json:"message"`
+	ContextStrategy string              `json:"context_strategy"` // "truncate"（默认）或 "summarize"
 }
 
 func GetConversationsHandler(c *gin.Context) {
 	claims, _ := c.Get(middleware.UserClaimsKey)
 	userClaims := claims.(*utils.Claims)
 
-	conversations, err := service.GetConversations(userClaims.UserID)
+	conversations, err := service.GetConversations(userClaims.UserID, c.Query("novelId"), c.Query("chapterId"))
 	if err != nil {
 		utils.Fail(c, "Failed to fetch conversations: "+err.Error())
 		return
@@ -34,15 +43,13 @@ func UpdateConversationHandler(c *gin.Context) {
 	claims, _ := c.Get(middleware.UserClaimsKey)
 	userClaims := claims.(*utils.Claims)
 
-	var payload struct {
-		Title string `json:"title"`
-	}
+	var payload dto.UpdateConversationPayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
 		utils.FailWithBadRequest(c, err.Error())
 		return
 	}
 
-	conv, err := service.UpdateConversationTitle(convID, userClaims.UserID, payload.Title)
+	conv, err := service.UpdateConversation(convID, userClaims.UserID, payload)
 	if err != nil {
 		utils.Fail(c, "Failed to update conversation: "+err.Error())
 		return
@@ -66,7 +73,14 @@ func CreateConversationHandler(c *gin.Context) {
 	claims, _ := c.Get(middleware.UserClaimsKey)
 	userClaims := claims.(*utils.Claims)
 
-	conversation, err := service.CreateConversation(userClaims.UserID)
+	// 请求体可选：不带请求体时创建未关联小说的对话
+	var payload dto.CreateConversationPayload
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	conversation, err := service.CreateConversation(userClaims.UserID, payload)
 	if err != nil {
 		utils.Fail(c, "Failed to create conversation: "+err.Error())
 		return
@@ -81,6 +95,12 @@ func StreamChatHandler(c *gin.Context) {
 		return
 	}
 
+	serverMode := len(payload.Messages) == 0
+	if serverMode && (payload.Message == "" || payload.ConversationID == "") {
+		utils.FailWithBadRequest(c, "either messages, or message with conversation_id, is required")
+		return
+	}
+
 	claims, _ := c.Get(middleware.UserClaimsKey)
 	userClaims := claims.(*utils.Claims)
 
@@ -89,33 +109,50 @@ func StreamChatHandler(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	streamChan, err := service.StreamChat(c.Request.Context(), payload.APIKeyID, userClaims.UserID, payload.Messages)
+	var streamChan <-chan model.StreamResponse
+	var err error
+	if serverMode {
+		// 服务端历史模式下由 service 负责保存本轮消息
+		streamChan, err = service.StreamConversationChat(c.Request.Context(), payload.ConversationID, payload.APIKeyID, userClaims.UserID, payload.Message, payload.ContextStrategy)
+	} else {
+		streamChan, err = service.StreamChat(c.Request.Context(), payload.APIKeyID, userClaims.UserID, payload.ConversationID, payload.Messages)
+	}
 	if err != nil {
-		utils.Fail(c, err.Error())
+		failStream(c, err)
 		return
 	}
+	saveOnFinish := !serverMode && payload.ConversationID != ""
 
 	var fullResponse string
+	var usage *model.TokenUsage
+	// 回复被审核拦截时不保存已发出的部分
+	blocked := false
 
 	c.Stream(func(w io.Writer) bool {
 		select {
 		case <-c.Request.Context().Done():
 			// 流被中断时，保存已收到的部分消息
-			if payload.ConversationID != "" && fullResponse != "" {
-				saveChatMessages(payload, userClaims.UserID, fullResponse)
+			if saveOnFinish && !blocked && fullResponse != "" {
+				saveChatMessages(payload, userClaims.UserID, fullResponse, usage)
 			}
 			return false
 		case chunk, ok := <-streamChan:
 			if !ok {
 				// 流正常结束，保存完整回复
-				if payload.ConversationID != "" && fullResponse != "" {
-					saveChatMessages(payload, userClaims.UserID, fullResponse)
+				if saveOnFinish && !blocked && fullResponse != "" {
+					saveChatMessages(payload, userClaims.UserID, fullResponse, usage)
 				}
 				return false
 			}
+			if chunk.Event == "moderation" && chunk.Moderation != nil && chunk.Moderation.Action == model.ModerationBlock {
+				blocked = true
+			}
 			if chunk.Event == "chunk" {
 				fullResponse += chunk.Content
 			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
 			jsonData, err := json.Marshal(chunk)
 			if err != nil {
 				errorChunk := model.StreamResponse{Event: "error", Error: "Failed to marshal stream data"}
@@ -129,7 +166,7 @@ func StreamChatHandler(c *gin.Context) {
 	})
 }
 
-func saveChatMessages(payload ChatPayload, userID uint, aiResponse string) {
+func saveChatMessages(payload ChatPayload, userID uint, aiResponse string, usage *model.TokenUsage) {
 	msgs := make([]service.ChatMessageDTO, 0, len(payload.Messages)+1)
 	for _, m := range payload.Messages {
 		msgs = append(msgs, service.ChatMessageDTO{
@@ -137,9 +174,51 @@ func saveChatMessages(payload ChatPayload, userID uint, aiResponse string) {
 			Content: m.Content,
 		})
 	}
-	msgs = append(msgs, service.ChatMessageDTO{
-		Role:    "ai",
-		Content: aiResponse,
-	})
-	_ = service.SaveConversationMessages(payload.ConversationID, userID, msgs)
+	aiMsg := service.ChatMessageDTO{
+		Role:     "ai",
+		Content:  aiResponse,
+		APIKeyID: payload.APIKeyID,
+	}
+	if usage != nil {
+		aiMsg.PromptTokens = usage.PromptTokens
+		aiMsg.CompletionTokens = usage.CompletionTokens
+	}
+	msgs = append(msgs, aiMsg)
+	if err := service.SaveConversationMessages(payload.ConversationID, userID, msgs); err != nil {
+		log.Printf("[chat_handler] Failed to save messages for conversation %s: %v", payload.ConversationID, err)
+	}
+}
+
+func GetConversationMessagesHandler(c *gin.Context) {
+	convID := c.Param("id")
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	page, err := service.GetConversationMessages(convID, userClaims.UserID, c.Query("cursor"), limit)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch messages: "+err.Error())
+		return
+	}
+	utils.Success(c, page)
+}
+
+// SearchConversationsHandler GET /api/ai/chat/conversations/search?q=&limit=
+func SearchConversationsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	q := c.Query("q")
+	if q == "" {
+		utils.FailWithBadRequest(c, "Query parameter 'q' is required")
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	results, err := service.SearchConversations(userClaims.UserID, q, limit)
+	if err != nil {
+		utils.Fail(c, "Failed to search conversations: "+err.Error())
+		return
+	}
+	utils.Success(c, results)
 }
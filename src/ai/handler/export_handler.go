@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/service"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/utils"
+)
+
+// ExportConversationHandler GET /api/ai/chat/conversations/:id/export?format=md|json
+func ExportConversationHandler(c *gin.Context) {
+	convID := c.Param("id")
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	format := c.DefaultQuery("format", service.ExportFormatMarkdown)
+	filename, data, err := service.ExportConversation(convID, userClaims.UserID, format)
+	if err != nil {
+		utils.Fail(c, "Failed to export conversation: "+err.Error())
+		return
+	}
+
+	contentType := "text/markdown; charset=utf-8"
+	if format == service.ExportFormatJSON {
+		contentType = "application/json; charset=utf-8"
+	}
+	// 标题中的引号、换行和非 ASCII 字符按 RFC 2231 编码（filename*）
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ImportConversationHandler POST /api/ai/chat/conversations/import?format=md|json
+// 请求体为导出文件的原始内容
+func ImportConversationHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		utils.FailWithBadRequest(c, "Request body must contain the exported conversation")
+		return
+	}
+
+	conversation, err := service.ImportConversation(userClaims.UserID, c.DefaultQuery("format", service.ExportFormatJSON), data)
+	if err != nil {
+		utils.Fail(c, "Failed to import conversation: "+err.Error())
+		return
+	}
+	utils.Success(c, conversation)
+}
+
+// SaveConversationAsNoteHandler POST /api/ai/chat/conversations/:id/note
+func SaveConversationAsNoteHandler(c *gin.Context) {
+	convID := c.Param("id")
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	var payload dto.SaveConversationAsNotePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	note, err := service.SaveConversationAsNote(convID, userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to save conversation as note: "+err.Error())
+		return
+	}
+	utils.Success(c, note)
+}
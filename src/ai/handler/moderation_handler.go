@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/ai/service"
+	"st-novel-go/src/utils"
+	"strconv"
+)
+
+// GetModerationLogsHandler GET /api/ai/admin/moderation-logs?userId=&action=&page=&pageSize=
+func GetModerationLogsHandler(c *gin.Context) {
+	var userID uint64
+	if raw := c.Query("userId"); raw != "" {
+		var err error
+		userID, err = strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			utils.FailWithBadRequest(c, "Invalid user ID")
+			return
+		}
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+
+	logs, err := service.GetModerationLogs(uint(userID), c.Query("action"), page, pageSize)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch moderation logs: "+err.Error())
+		return
+	}
+	utils.Success(c, logs)
+}
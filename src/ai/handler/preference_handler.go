@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/service"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/utils"
+)
+
+func GetAIPreferenceHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	pref, err := service.GetAIPreference(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch AI preferences: "+err.Error())
+		return
+	}
+	utils.Success(c, pref)
+}
+
+func UpdateAIPreferenceHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	var payload dto.UpdateAIPreferencePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	pref, err := service.UpdateAIPreference(userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to update AI preferences: "+err.Error())
+		return
+	}
+	utils.Success(c, pref)
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/service"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/utils"
+	"strconv"
+)
+
+// GetModelPricesHandler GET /api/ai/pricing — 全局价格表
+func GetModelPricesHandler(c *gin.Context) {
+	prices, err := service.GetModelPrices()
+	if err != nil {
+		utils.Fail(c, "Failed to fetch model prices: "+err.Error())
+		return
+	}
+	utils.Success(c, prices)
+}
+
+// CreateModelPriceHandler POST /api/ai/admin/pricing
+func CreateModelPriceHandler(c *gin.Context) {
+	var payload dto.ModelPricePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+	price, err := service.CreateModelPrice(payload)
+	if err != nil {
+		utils.Fail(c, "Failed to create model price: "+err.Error())
+		return
+	}
+	utils.Success(c, price)
+}
+
+// UpdateModelPriceHandler PUT /api/ai/admin/pricing/:id
+func UpdateModelPriceHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid price ID")
+		return
+	}
+	var payload dto.ModelPricePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+	price, err := service.UpdateModelPrice(uint(id), payload)
+	if err != nil {
+		utils.Fail(c, "Failed to update model price: "+err.Error())
+		return
+	}
+	utils.Success(c, price)
+}
+
+// DeleteModelPriceHandler DELETE /api/ai/admin/pricing/:id
+func DeleteModelPriceHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid price ID")
+		return
+	}
+	if err := service.DeleteModelPrice(uint(id)); err != nil {
+		utils.Fail(c, "Failed to delete model price: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Model price deleted")
+}
+
+// GetKeyModelPricesHandler GET /api/ai/pricing/keys/:keyId — 某个 API Key 的价格覆盖
+func GetKeyModelPricesHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid API key ID")
+		return
+	}
+
+	prices, err := service.GetKeyModelPrices(uint(keyID), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch key prices: "+err.Error())
+		return
+	}
+	utils.Success(c, prices)
+}
+
+// SetKeyModelPriceHandler PUT /api/ai/pricing/keys/:keyId
+func SetKeyModelPriceHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid API key ID")
+		return
+	}
+	var payload dto.ModelPricePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	price, err := service.SetKeyModelPrice(uint(keyID), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to set key price: "+err.Error())
+		return
+	}
+	utils.Success(c, price)
+}
+
+// DeleteKeyModelPriceHandler DELETE /api/ai/pricing/keys/:keyId?model=
+func DeleteKeyModelPriceHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid API key ID")
+		return
+	}
+
+	if err := service.DeleteKeyModelPrice(uint(keyID), userClaims.UserID, c.Query("model")); err != nil {
+		utils.Fail(c, "Failed to delete key price: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Key price deleted")
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/service"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/utils"
+	"strconv"
+)
+
+// GetQuotaHandler GET /api/ai/quota — 当前用户的配额、已用量与剩余量
+func GetQuotaHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	status, err := service.GetQuotaStatus(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch quota: "+err.Error())
+		return
+	}
+	utils.Success(c, status)
+}
+
+// GetUserQuotaHandler GET /api/ai/admin/quotas/:userId
+func GetUserQuotaHandler(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid user ID")
+		return
+	}
+
+	status, err := service.GetQuotaStatus(uint(userID))
+	if err != nil {
+		utils.Fail(c, "Failed to fetch quota: "+err.Error())
+		return
+	}
+	utils.Success(c, status)
+}
+
+// UpdateUserQuotaHandler PUT /api/ai/admin/quotas/:userId
+func UpdateUserQuotaHandler(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid user ID")
+		return
+	}
+	var payload dto.UpdateQuotaOverridePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	status, err := service.SetQuotaOverride(uint(userID), payload)
+	if err != nil {
+		utils.Fail(c, "Failed to update quota: "+err.Error())
+		return
+	}
+	utils.Success(c, status)
+}
+
+// DeleteUserQuotaHandler DELETE /api/ai/admin/quotas/:userId — 恢复为套餐默认配额
+func DeleteUserQuotaHandler(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		utils.FailWithBadRequest(c, "Invalid user ID")
+		return
+	}
+	if err := service.DeleteQuotaOverride(uint(userID)); err != nil {
+		utils.Fail(c, "Failed to reset quota: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Quota override removed")
+}
+
+// failStream reports an error that occurred before streaming started. Quota and
+// moderation errors are sent as "quota_exceeded" and "moderation" events so that
+// stream clients can show them.
+func failStream(c *gin.Context, err error) {
+	var quotaErr *service.QuotaExceededError
+	var blockedErr *service.ModerationBlockedError
+	var status int
+	var event model.StreamResponse
+	switch {
+	case errors.As(err, &quotaErr):
+		status = http.StatusTooManyRequests
+		event = model.StreamResponse{Event: "quota_exceeded", Error: quotaErr.Error(), Done: true}
+	case errors.As(err, &blockedErr):
+		status = http.StatusUnprocessableEntity
+		event = model.StreamResponse{Event: "moderation", Error: blockedErr.Error(), Done: true, Moderation: blockedErr.Result}
+	default:
+		utils.Fail(c, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(status)
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+}
@@ -42,7 +42,7 @@ func StreamAITaskHandler(c *gin.Context) {
 	eventChan, err := service.StreamAITask(c.Request.Context(), payload, userClaims.UserID)
 	if err != nil {
 		// Before streaming starts, we can send a normal error
-		utils.Fail(c, err.Error())
+		failStream(c, err)
 		return
 	}
 
@@ -71,3 +71,98 @@ func StreamAITaskHandler(c *gin.Context) {
 		}
 	})
 }
+
+// InlineEditHandler POST /api/ai/tasks/inline-edit
+func InlineEditHandler(c *gin.Context) {
+	var payload dto.InlineEditPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	diff, err := service.InlineEditChapter(c.Request.Context(), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to edit chapter: "+err.Error())
+		return
+	}
+	utils.Success(c, diff)
+}
+
+// AcceptInlineEditHandler POST /api/ai/tasks/inline-edit/accept
+func AcceptInlineEditHandler(c *gin.Context) {
+	var payload dto.AcceptInlineEditPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	chapter, err := service.AcceptInlineEdit(userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to apply edit: "+err.Error())
+		return
+	}
+	utils.Success(c, chapter)
+}
+
+// CreateTaskBatchHandler POST /api/ai/tasks/batch
+func CreateTaskBatchHandler(c *gin.Context) {
+	var payload dto.BatchAITaskPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	batch, err := service.CreateTaskBatch(userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to create task batch: "+err.Error())
+		return
+	}
+	utils.Success(c, batch)
+}
+
+func GetTaskBatchesHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	batches, err := service.GetTaskBatches(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch task batches: "+err.Error())
+		return
+	}
+	utils.Success(c, batches)
+}
+
+// GetTaskBatchHandler GET /api/ai/tasks/batch/:id — 返回批次及每个条目的进度
+func GetTaskBatchHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	batch, err := service.GetTaskBatch(c.Param("id"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch task batch: "+err.Error())
+		return
+	}
+	utils.Success(c, batch)
+}
+
+// RetryTaskBatchHandler POST /api/ai/tasks/batch/:id/retry — 重新执行失败的条目
+func RetryTaskBatchHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	batch, err := service.RetryTaskBatch(c.Param("id"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to retry task batch: "+err.Error())
+		return
+	}
+	utils.Success(c, batch)
+}
@@ -12,6 +12,8 @@ type ChatConfig struct {
 	Temperature float32 `json:"temperature"`
 	MaxTokens   int     `json:"max_tokens"`
 	Stream      bool    `json:"stream"`
+	// TemperatureSet 表示调用方显式指定了 Temperature，未指定时 0 表示使用服务商默认值
+	TemperatureSet bool `json:"-"`
 }
 
 // ChatResponse is the structure for a non-streaming response.
@@ -19,11 +21,21 @@ type ChatResponse struct {
 	Content string `json:"content"`
 }
 
+// TokenUsage holds the token counts reported by a provider for a single call.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
 // StreamResponse is the structure for a chunk in a streaming response.
 // Event 字段用于前端 SSE 解析：前端根据 "chunk"/"done"/"error" 区分事件类型。
+// Usage 仅在 "done" 事件上携带，且只有在提供商返回用量时才有值。
+// Moderation 仅在 "moderation" 事件上携带。
 type StreamResponse struct {
-	Event   string `json:"event,omitempty"`
-	Content string `json:"content,omitempty"`
-	Done    bool   `json:"done"`
-	Error   string `json:"error,omitempty"`
+	Event      string            `json:"event,omitempty"`
+	Content    string            `json:"content,omitempty"`
+	Done       bool              `json:"done"`
+	Error      string            `json:"error,omitempty"`
+	Usage      *TokenUsage       `json:"usage,omitempty"`
+	Moderation *ModerationResult `json:"moderation,omitempty"`
 }
@@ -1,14 +1,29 @@
 package model
 
 import (
+	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	base_model "st-novel-go/src/novel/model"
 )
 
 type Conversation struct {
 	base_model.BaseModel
-	UserID   uint           `gorm:"not null;index" json:"user_id"`
-	Title    string         `gorm:"type:varchar(255);not null" json:"title"`
-	Summary  string         `gorm:"type:text" json:"summary"`
-	Messages datatypes.JSON `gorm:"type:json" json:"messages"`
+	UserID uint `gorm:"not null;index" json:"user_id"`
+	// NovelID/ChapterID 为可选关联，关联后对话时会自动附带小说和章节的上下文
+	NovelID   *uuid.UUID `gorm:"type:char(36);index" json:"novel_id"`
+	ChapterID *uuid.UUID `gorm:"type:char(36);index" json:"chapter_id"`
+	Title     string     `gorm:"type:varchar(255);not null" json:"title"`
+	Summary   string     `gorm:"type:text" json:"summary"`
+	// TitleLocked 在用户手动重命名后置为 true，此后不再自动生成标题；
+	// SummarySeq 记录 Summary 最后一次自动生成时覆盖到的消息 seq。
+	TitleLocked bool `gorm:"default:false" json:"-"`
+	SummarySeq  int  `gorm:"default:0" json:"-"`
+	// ActiveLeafID 指向当前选中分支的最后一条消息，活动分支即从根到该消息的路径
+	ActiveLeafID *uuid.UUID `gorm:"type:char(36)" json:"-"`
+	// ContextSummary 是服务端历史模式下被移出上下文窗口的旧消息的滚动摘要，
+	// ContextSummarySeq 记录摘要覆盖到的最后一条消息的 seq。
+	ContextSummary    string `gorm:"type:text" json:"-"`
+	ContextSummarySeq int    `gorm:"default:0" json:"-"`
+	// Messages 为旧版的整段 JSON 存储，启动时会迁移到 ConversationMessage 表并清空，新数据不再写入此列。
+	Messages datatypes.JSON `gorm:"type:json" json:"-"`
 }
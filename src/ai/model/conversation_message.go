@@ -0,0 +1,25 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	base_model "st-novel-go/src/novel/model"
+)
+
+// ConversationMessage is a single turn of a conversation, stored as its own row
+// so that appending a turn does not rewrite the whole history.
+// Messages form a tree through ParentID: regenerating an answer or editing a
+// user message adds a sibling under the same parent instead of overwriting.
+// Seq is the insertion order within the conversation, so a child always has a
+// larger Seq than its parent.
+type ConversationMessage struct {
+	base_model.BaseModel
+	ConversationID   uuid.UUID  `gorm:"type:char(36);not null;uniqueIndex:idx_conversation_seq,priority:1" json:"conversation_id"`
+	ParentID         *uuid.UUID `gorm:"type:char(36);index" json:"parent_id"`
+	Seq              int        `gorm:"not null;uniqueIndex:idx_conversation_seq,priority:2" json:"seq"`
+	Role             string     `gorm:"type:varchar(20);not null" json:"role"` // "user", "ai" or "system"
+	Content          string     `gorm:"type:longtext" json:"content"`
+	PromptTokens     int        `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int        `gorm:"default:0" json:"completion_tokens"`
+	Model            string     `gorm:"type:varchar(100)" json:"model"`
+	APIKeyID         uint       `gorm:"index" json:"api_key_id"`
+}
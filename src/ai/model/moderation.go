@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// Moderation actions, from least to most severe.
+const (
+	ModerationAllow    = "allow"
+	ModerationAnnotate = "annotate" // 放行，仅在流中附带 moderation 事件
+	ModerationWarn     = "warn"     // 放行，前端应提示用户
+	ModerationBlock    = "block"
+)
+
+// Moderation stages.
+const (
+	ModerationStagePrompt     = "prompt"
+	ModerationStageCompletion = "completion"
+)
+
+// ModerationResult is the outcome of checking a prompt or a completion.
+type ModerationResult struct {
+	Action   string   `json:"action"`
+	Stage    string   `json:"stage"`
+	Category string   `json:"category,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Source   string   `json:"source,omitempty"` // 产生该结果的审核器，例如 "rules" 或 "provider"
+	Matches  []string `json:"matches,omitempty"`
+}
+
+// ModerationLog records every moderation result other than allow.
+type ModerationLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	APIKeyID  uint      `json:"api_key_id"`
+	Stage     string    `gorm:"type:varchar(20)" json:"stage"`
+	Action    string    `gorm:"type:varchar(20);index" json:"action"`
+	Category  string    `gorm:"type:varchar(100)" json:"category"`
+	Source    string    `gorm:"type:varchar(50)" json:"source"`
+	Reason    string    `gorm:"type:varchar(500)" json:"reason"`
+	Excerpt   string    `gorm:"type:text" json:"excerpt"` // 命中位置附近的文本
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// AIPreference holds per-user switches for background AI features.
+// 字段以 "Disabled" 表示，使零值即为默认开启，避免 GORM 对 bool 默认值的覆盖问题。
+type AIPreference struct {
+	ID                uint      `gorm:"primarykey" json:"id"`
+	UserID            uint      `gorm:"not null;uniqueIndex" json:"user_id"`
+	AutoTitleDisabled bool      `gorm:"default:false" json:"auto_title_disabled"`
+	AutoTitleModel    string    `gorm:"type:varchar(100)" json:"auto_title_model"` // 为空时按提供商使用默认的低价模型
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// ModelPrice is an entry of the pricing catalogue, in US dollars per million
+// tokens. Model is matched as a prefix of the model name and an empty Model is the
+// fallback for the whole provider. Entries with an APIKeyID override the global
+// catalogue (APIKeyID 0) for that key only.
+type ModelPrice struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Provider    string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_model_price,priority:1" json:"provider"`
+	Model       string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_model_price,priority:2" json:"model"`
+	APIKeyID    uint      `gorm:"not null;default:0;uniqueIndex:idx_model_price,priority:3" json:"api_key_id"`
+	InputPrice  float64   `json:"input_price"`
+	OutputPrice float64   `json:"output_price"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultModelPrices seed the catalogue when it is empty.
+var DefaultModelPrices = []ModelPrice{
+	{Provider: "OpenAI", Model: "", InputPrice: 2.5, OutputPrice: 10},
+	{Provider: "OpenAI", Model: "gpt-4o", InputPrice: 2.5, OutputPrice: 10},
+	{Provider: "OpenAI", Model: "gpt-4o-mini", InputPrice: 0.15, OutputPrice: 0.6},
+	{Provider: "OpenAI", Model: "gpt-4.1", InputPrice: 2, OutputPrice: 8},
+	{Provider: "OpenAI", Model: "gpt-4.1-mini", InputPrice: 0.4, OutputPrice: 1.6},
+	{Provider: "OpenAI", Model: "gpt-3.5-turbo", InputPrice: 0.5, OutputPrice: 1.5},
+	{Provider: "Claude", Model: "", InputPrice: 3, OutputPrice: 15},
+	{Provider: "Claude", Model: "claude-3-haiku", InputPrice: 0.25, OutputPrice: 1.25},
+	{Provider: "Claude", Model: "claude-3-5-haiku", InputPrice: 0.8, OutputPrice: 4},
+	{Provider: "Claude", Model: "claude-3-5-sonnet", InputPrice: 3, OutputPrice: 15},
+	{Provider: "Claude", Model: "claude-sonnet-4", InputPrice: 3, OutputPrice: 15},
+	{Provider: "Claude", Model: "claude-opus-4", InputPrice: 15, OutputPrice: 75},
+	{Provider: "Gemini", Model: "", InputPrice: 1.25, OutputPrice: 5},
+	{Provider: "Gemini", Model: "gemini-1.5-flash", InputPrice: 0.075, OutputPrice: 0.3},
+	{Provider: "Gemini", Model: "gemini-1.5-pro", InputPrice: 1.25, OutputPrice: 5},
+	{Provider: "Gemini", Model: "gemini-2.0-flash", InputPrice: 0.1, OutputPrice: 0.4},
+}
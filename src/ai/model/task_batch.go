@@ -0,0 +1,46 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	base_model "st-novel-go/src/novel/model"
+)
+
+const (
+	TaskStatusPending   = "pending"
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+	// TaskStatusPartial 仅用于批次：部分条目失败
+	TaskStatusPartial = "partial"
+)
+
+// TaskBatch runs the same AI task template over many chapters. Each chapter is a
+// TaskBatchItem; the result of a successful item is stored as DerivedContent.
+type TaskBatch struct {
+	base_model.BaseModel
+	UserID         uint      `gorm:"not null;index" json:"user_id"`
+	NovelID        uuid.UUID `gorm:"type:char(36);not null;index" json:"novel_id"`
+	APIKeyID       uint      `gorm:"not null" json:"api_key_id"`
+	Model          string    `gorm:"type:varchar(100)" json:"model"`
+	Temperature    *float32  `json:"temperature"`
+	MaxTokens      int       `json:"max_tokens"`
+	TaskType       string    `gorm:"type:varchar(50);not null" json:"task_type"` // 写入 DerivedContent.Type，例如 "plot" 或 "analysis"
+	TitleTemplate  string    `gorm:"type:varchar(255)" json:"title_template"`
+	PromptTemplate string    `gorm:"type:longtext" json:"prompt_template"`
+	Status         string    `gorm:"type:varchar(20);not null;index" json:"status"`
+	Total          int       `json:"total"`
+	Succeeded      int       `json:"succeeded"`
+	Failed         int       `json:"failed"`
+}
+
+type TaskBatchItem struct {
+	base_model.BaseModel
+	BatchID          uuid.UUID  `gorm:"type:char(36);not null;index" json:"batch_id"`
+	Seq              int        `json:"seq"`
+	SourceID         string     `gorm:"type:varchar(255);not null" json:"source_id"` // 章节 ID
+	SourceTitle      string     `gorm:"type:varchar(255)" json:"source_title"`
+	Status           string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	Attempts         int        `json:"attempts"`
+	Error            string     `gorm:"type:text" json:"error"`
+	DerivedContentID *uuid.UUID `gorm:"type:char(36)" json:"derived_content_id"`
+}
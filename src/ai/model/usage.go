@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// AIUsageRecord is one AI call. Token counts come from the provider when it reports
+// them and are estimated otherwise (Estimated is then true). Calls answered from the
+// response cache are recorded with CacheHit set and no tokens or cost.
+type AIUsageRecord struct {
+	ID               uint      `gorm:"primarykey" json:"id"`
+	UserID           uint      `gorm:"not null;index:idx_usage_user_created,priority:1" json:"user_id"`
+	APIKeyID         uint      `gorm:"index" json:"api_key_id"`
+	Provider         string    `gorm:"type:varchar(50)" json:"provider"`
+	Model            string    `gorm:"type:varchar(100)" json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"` // 估算费用（美元）
+	Estimated        bool      `gorm:"default:false" json:"estimated"`
+	CacheHit         bool      `gorm:"default:false" json:"cache_hit"`
+	CreatedAt        time.Time `gorm:"index:idx_usage_user_created,priority:2" json:"created_at"`
+}
+
+// AIQuotaOverride replaces individual plan limits for one user. Nil fields fall
+// back to the plan; zero means unlimited.
+type AIQuotaOverride struct {
+	ID                uint      `gorm:"primarykey" json:"id"`
+	UserID            uint      `gorm:"not null;uniqueIndex" json:"user_id"`
+	DailyTokens       *int64    `json:"daily_tokens"`
+	MonthlyTokens     *int64    `json:"monthly_tokens"`
+	RequestsPerMinute *int      `json:"requests_per_minute"`
+	DailyCost         *float64  `json:"daily_cost"`
+	MonthlyCost       *float64  `json:"monthly_cost"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
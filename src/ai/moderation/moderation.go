@@ -0,0 +1,104 @@
+// Package moderation checks prompts and completions against content rules. The
+// built-in moderator is a keyword and regular expression rule engine; an
+// OpenAI-compatible moderation endpoint can be added in the configuration.
+package moderation
+
+import (
+	"context"
+	"log"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/config"
+	"sync"
+)
+
+// Moderator checks one piece of text. It returns nil when the text is allowed.
+type Moderator interface {
+	Name() string
+	Check(ctx context.Context, stage string, text string) (*model.ModerationResult, error)
+}
+
+var severity = map[string]int{
+	model.ModerationAllow:    0,
+	model.ModerationAnnotate: 1,
+	model.ModerationWarn:     2,
+	model.ModerationBlock:    3,
+}
+
+// Incremental is implemented by moderators cheap enough to run repeatedly while a
+// completion is streaming. The others only see the finished completion.
+type Incremental interface {
+	Incremental() bool
+}
+
+// Chain runs several moderators and keeps the most severe result.
+type Chain []Moderator
+
+func (c Chain) Check(ctx context.Context, stage string, text string) *model.ModerationResult {
+	var worst *model.ModerationResult
+	for _, moderator := range c {
+		result, err := moderator.Check(ctx, stage, text)
+		if err != nil {
+			// 审核服务故障时放行，避免影响正常创作
+			log.Printf("[moderation] %s failed: %v", moderator.Name(), err)
+			continue
+		}
+		if result == nil || result.Action == model.ModerationAllow {
+			continue
+		}
+		result.Stage = stage
+		if result.Source == "" {
+			result.Source = moderator.Name()
+		}
+		if worst == nil || severity[result.Action] > severity[worst.Action] {
+			worst = result
+		}
+		if worst.Action == model.ModerationBlock {
+			break
+		}
+	}
+	return worst
+}
+
+// Incremental returns the moderators of c that can check partial completions.
+func (c Chain) Incremental() Chain {
+	var incremental Chain
+	for _, moderator := range c {
+		if m, ok := moderator.(Incremental); ok && m.Incremental() {
+			incremental = append(incremental, moderator)
+		}
+	}
+	return incremental
+}
+
+var (
+	defaultChain Chain
+	chainOnce    sync.Once
+)
+
+// Default returns the moderators enabled in the configuration. It is empty when
+// moderation is disabled.
+func Default() Chain {
+	chainOnce.Do(func() {
+		cfg := config.AppConfig.Moderation
+		if !cfg.Enabled {
+			return
+		}
+		rules, err := NewRuleModerator(cfg.Rules)
+		if err != nil {
+			log.Fatalf("Invalid moderation rules: %v", err)
+		}
+		defaultChain = append(defaultChain, rules)
+		if cfg.Provider.Enabled {
+			defaultChain = append(defaultChain, NewProviderModerator(cfg.Provider))
+		}
+	})
+	return defaultChain
+}
+
+// normalizeAction maps unknown or empty actions to fallback.
+func normalizeAction(action, fallback string) string {
+	if _, ok := severity[action]; ok && action != model.ModerationAllow {
+		return action
+	}
+	return fallback
+}
@@ -0,0 +1,107 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/config"
+	"strings"
+	"time"
+)
+
+const defaultProviderTimeout = 10 * time.Second
+
+// ProviderModerator calls an OpenAI-compatible /moderations endpoint.
+type ProviderModerator struct {
+	cfg    config.ModerationProviderConf
+	action string
+	client *http.Client
+}
+
+func NewProviderModerator(cfg config.ModerationProviderConf) *ProviderModerator {
+	timeout := defaultProviderTimeout
+	if cfg.TimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return &ProviderModerator{
+		cfg:    cfg,
+		action: normalizeAction(cfg.Action, model.ModerationBlock),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (m *ProviderModerator) Name() string {
+	return "provider"
+}
+
+type moderationRequest struct {
+	Model string `json:"model,omitempty"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+func (m *ProviderModerator) Check(ctx context.Context, _ string, text string) (*model.ModerationResult, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	body, err := json.Marshal(moderationRequest{Model: m.cfg.Model, Input: text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.cfg.APIKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("moderation endpoint returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var parsed moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+	flagged := false
+	var categories []string
+	for _, result := range parsed.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+		for category, flagged := range result.Categories {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+	}
+	if !flagged {
+		return nil, nil
+	}
+	sort.Strings(categories)
+	return &model.ModerationResult{
+		Action:   m.action,
+		Category: strings.Join(categories, ","),
+		Reason:   "flagged by moderation endpoint",
+	}, nil
+}
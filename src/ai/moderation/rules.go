@@ -0,0 +1,94 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/config"
+	"strings"
+)
+
+// RuleModerator is the built-in keyword and regular expression rule engine.
+type RuleModerator struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	name     string
+	category string
+	action   string
+	stages   map[string]bool
+	keywords []string
+	patterns []*regexp.Regexp
+}
+
+func NewRuleModerator(rules []config.ModerationRule) (*RuleModerator, error) {
+	moderator := &RuleModerator{}
+	for _, rule := range rules {
+		compiled := compiledRule{
+			name:     rule.Name,
+			category: rule.Category,
+			action:   normalizeAction(rule.Action, model.ModerationWarn),
+			stages:   make(map[string]bool),
+		}
+		for _, stage := range rule.Stages {
+			compiled.stages[stage] = true
+		}
+		for _, keyword := range rule.Keywords {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				compiled.keywords = append(compiled.keywords, strings.ToLower(keyword))
+			}
+		}
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+			compiled.patterns = append(compiled.patterns, re)
+		}
+		moderator.rules = append(moderator.rules, compiled)
+	}
+	return moderator, nil
+}
+
+func (m *RuleModerator) Name() string {
+	return "rules"
+}
+
+func (m *RuleModerator) Incremental() bool {
+	return true
+}
+
+func (m *RuleModerator) Check(_ context.Context, stage string, text string) (*model.ModerationResult, error) {
+	lower := strings.ToLower(text)
+	var worst *model.ModerationResult
+	for _, rule := range m.rules {
+		if len(rule.stages) > 0 && !rule.stages[stage] {
+			continue
+		}
+		var matches []string
+		for _, keyword := range rule.keywords {
+			if strings.Contains(lower, keyword) {
+				matches = append(matches, keyword)
+			}
+		}
+		for _, re := range rule.patterns {
+			if match := re.FindString(text); match != "" {
+				matches = append(matches, match)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if worst == nil || severity[rule.action] > severity[worst.Action] {
+			worst = &model.ModerationResult{
+				Action:   rule.action,
+				Category: rule.category,
+				Reason:   "matched rule " + rule.name,
+				Matches:  matches,
+			}
+		}
+	}
+	return worst, nil
+}
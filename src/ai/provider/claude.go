@@ -39,6 +39,21 @@ type claudeStreamContentBlockDelta struct {
 	Delta claudeStreamDelta `json:"delta"`
 }
 
+type claudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type claudeStreamMessageStart struct {
+	Message struct {
+		Usage claudeUsage `json:"usage"`
+	} `json:"message"`
+}
+
+type claudeStreamMessageDelta struct {
+	Usage claudeUsage `json:"usage"`
+}
+
 // ClaudeAdapter is an adapter for the Anthropic Claude API.
 type ClaudeAdapter struct {
 	apiKey     string
@@ -122,6 +137,7 @@ func (a *ClaudeAdapter) processStream(resp *http.Response, outChan chan<- model.
 	defer resp.Body.Close()
 	defer close(outChan)
 
+	var usage *model.TokenUsage
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -140,7 +156,21 @@ func (a *ClaudeAdapter) processStream(resp *http.Response, outChan chan<- model.
 			continue
 		}
 
-		if eventType == "content_block_delta" {
+		if eventType == "message_start" {
+			var start claudeStreamMessageStart
+			if json.Unmarshal([]byte(data), &start) == nil {
+				usage = &model.TokenUsage{PromptTokens: start.Message.Usage.InputTokens}
+			}
+		} else if eventType == "message_delta" {
+			// message_delta 中的 output_tokens 为累计值
+			var delta claudeStreamMessageDelta
+			if json.Unmarshal([]byte(data), &delta) == nil {
+				if usage == nil {
+					usage = &model.TokenUsage{}
+				}
+				usage.CompletionTokens = delta.Usage.OutputTokens
+			}
+		} else if eventType == "content_block_delta" {
 			deltaBytes, _ := json.Marshal(eventData)
 			var contentDelta claudeStreamContentBlockDelta
 			if json.Unmarshal(deltaBytes, &contentDelta) == nil {
@@ -160,6 +190,6 @@ func (a *ClaudeAdapter) processStream(resp *http.Response, outChan chan<- model.
 	if err := scanner.Err(); err != nil {
 		outChan <- model.StreamResponse{Event: "error", Error: "stream reading error: " + err.Error(), Done: true}
 	} else {
-		outChan <- model.StreamResponse{Event: "done", Done: true}
+		outChan <- model.StreamResponse{Event: "done", Done: true, Usage: usage}
 	}
 }
@@ -35,6 +35,10 @@ type geminiResponse struct {
 			Parts []geminiPart `json:"parts"`
 		} `json:"content"`
 	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
 }
 
 // GeminiAdapter is an adapter for the Google Gemini API.
@@ -126,6 +130,7 @@ func (a *GeminiAdapter) processStream(resp *http.Response, outChan chan<- model.
 	defer resp.Body.Close()
 	defer close(outChan)
 
+	var usage *model.TokenUsage
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -139,6 +144,14 @@ func (a *GeminiAdapter) processStream(resp *http.Response, outChan chan<- model.
 			continue
 		}
 
+		// usageMetadata 在每个 chunk 中都会出现，以最后一次为准
+		if streamResp.UsageMetadata != nil {
+			usage = &model.TokenUsage{
+				PromptTokens:     streamResp.UsageMetadata.PromptTokenCount,
+				CompletionTokens: streamResp.UsageMetadata.CandidatesTokenCount,
+			}
+		}
+
 		if len(streamResp.Candidates) > 0 && len(streamResp.Candidates[0].Content.Parts) > 0 {
 			outChan <- model.StreamResponse{
 				Event:   "chunk",
@@ -150,6 +163,6 @@ func (a *GeminiAdapter) processStream(resp *http.Response, outChan chan<- model.
 	if err := scanner.Err(); err != nil {
 		outChan <- model.StreamResponse{Event: "error", Error: "stream reading error: " + err.Error(), Done: true}
 	} else {
-		outChan <- model.StreamResponse{Event: "done", Done: true}
+		outChan <- model.StreamResponse{Event: "done", Done: true, Usage: usage}
 	}
 }
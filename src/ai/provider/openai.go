@@ -16,12 +16,22 @@ import (
 )
 
 // OpenAI-specific request/response structures
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
 type openAIRequest struct {
-	Model       string              `json:"model"`
-	Messages    []model.ChatMessage `json:"messages"`
-	Stream      bool                `json:"stream"`
-	Temperature float32             `json:"temperature,omitempty"`
-	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	Model         string               `json:"model"`
+	Messages      []model.ChatMessage  `json:"messages"`
+	Stream        bool                 `json:"stream"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Temperature   float32              `json:"temperature,omitempty"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
 type openAIResponse struct {
@@ -40,6 +50,7 @@ type openAIStreamChoice struct {
 
 type openAIStreamResponse struct {
 	Choices []openAIStreamChoice `json:"choices"`
+	Usage   *openAIUsage         `json:"usage"`
 }
 
 // OpenAIAdapter is an adapter for the OpenAI API.
@@ -69,9 +80,10 @@ func (o *OpenAIAdapter) Chat(ctx context.Context, messages []model.ChatMessage,
 
 func (o *OpenAIAdapter) StreamChat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (<-chan model.StreamResponse, error) {
 	reqBody := openAIRequest{
-		Model:    config.Model,
-		Messages: messages,
-		Stream:   true,
+		Model:         config.Model,
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
 	}
 
 	bodyBytes, err := json.Marshal(reqBody)
@@ -108,6 +120,7 @@ func (o *OpenAIAdapter) processStream(resp *http.Response, outChan chan<- model.
 	defer resp.Body.Close()
 	defer close(outChan)
 
+	var usage *model.TokenUsage
 	scanner := bufio.NewScanner(resp.Body)
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -125,6 +138,14 @@ func (o *OpenAIAdapter) processStream(resp *http.Response, outChan chan<- model.
 			continue
 		}
 
+		// 开启 include_usage 后，最后一个 chunk 的 choices 为空，只携带 usage
+		if streamResp.Usage != nil {
+			usage = &model.TokenUsage{
+				PromptTokens:     streamResp.Usage.PromptTokens,
+				CompletionTokens: streamResp.Usage.CompletionTokens,
+			}
+		}
+
 		if len(streamResp.Choices) > 0 {
 			outChan <- model.StreamResponse{
 				Event:   "chunk",
@@ -138,6 +159,6 @@ func (o *OpenAIAdapter) processStream(resp *http.Response, outChan chan<- model.
 		// handle scanner error
 		outChan <- model.StreamResponse{Event: "error", Error: "stream reading error: " + err.Error(), Done: true}
 	} else {
-		outChan <- model.StreamResponse{Event: "done", Done: true}
+		outChan <- model.StreamResponse{Event: "done", Done: true, Usage: usage}
 	}
 }
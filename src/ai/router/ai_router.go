@@ -14,16 +14,50 @@ func RegisterAIRoutes(router *gin.RouterGroup) {
 		{
 			chatGroup.GET("/conversations", handler.GetConversationsHandler)
 			chatGroup.POST("/conversations", handler.CreateConversationHandler)
+			chatGroup.POST("/conversations/import", handler.ImportConversationHandler)
+			chatGroup.GET("/conversations/search", handler.SearchConversationsHandler)
 			chatGroup.PUT("/conversations/:id", handler.UpdateConversationHandler)
 			chatGroup.DELETE("/conversations/:id", handler.DeleteConversationHandler)
+			chatGroup.GET("/conversations/:id/messages", handler.GetConversationMessagesHandler)
+			chatGroup.GET("/conversations/:id/branch", handler.GetActiveBranchHandler)
+			chatGroup.PUT("/conversations/:id/branch", handler.SwitchBranchHandler)
+			chatGroup.POST("/conversations/:id/messages/:messageId/regenerate", handler.RegenerateMessageHandler)
+			chatGroup.POST("/conversations/:id/messages/:messageId/edit", handler.EditMessageHandler)
+			chatGroup.GET("/conversations/:id/export", handler.ExportConversationHandler)
+			chatGroup.POST("/conversations/:id/note", handler.SaveConversationAsNoteHandler)
 		}
 
 		aiGroup.POST("/stream-chat", handler.StreamChatHandler)
 
 		aiGroup.GET("/providers", handler.GetAIProvidersHandler)
+		aiGroup.GET("/preferences", handler.GetAIPreferenceHandler)
+		aiGroup.PUT("/preferences", handler.UpdateAIPreferenceHandler)
+		aiGroup.GET("/quota", handler.GetQuotaHandler)
+		aiGroup.GET("/pricing", handler.GetModelPricesHandler)
+		aiGroup.GET("/pricing/keys/:keyId", handler.GetKeyModelPricesHandler)
+		aiGroup.PUT("/pricing/keys/:keyId", handler.SetKeyModelPriceHandler)
+		aiGroup.DELETE("/pricing/keys/:keyId", handler.DeleteKeyModelPriceHandler)
+
+		adminGroup := aiGroup.Group("/admin")
+		adminGroup.Use(middleware.AdminMiddleware())
+		{
+			adminGroup.GET("/quotas/:userId", handler.GetUserQuotaHandler)
+			adminGroup.PUT("/quotas/:userId", handler.UpdateUserQuotaHandler)
+			adminGroup.DELETE("/quotas/:userId", handler.DeleteUserQuotaHandler)
+			adminGroup.POST("/pricing", handler.CreateModelPriceHandler)
+			adminGroup.PUT("/pricing/:id", handler.UpdateModelPriceHandler)
+			adminGroup.DELETE("/pricing/:id", handler.DeleteModelPriceHandler)
+			adminGroup.GET("/moderation-logs", handler.GetModerationLogsHandler)
+		}
 		taskGroup := aiGroup.Group("/tasks")
 		{
 			taskGroup.POST("/stream", handler.StreamAITaskHandler)
+			taskGroup.POST("/inline-edit", handler.InlineEditHandler)
+			taskGroup.POST("/inline-edit/accept", handler.AcceptInlineEditHandler)
+			taskGroup.POST("/batch", handler.CreateTaskBatchHandler)
+			taskGroup.GET("/batch", handler.GetTaskBatchesHandler)
+			taskGroup.GET("/batch/:id", handler.GetTaskBatchHandler)
+			taskGroup.POST("/batch/:id/retry", handler.RetryTaskBatchHandler)
 		}
 	}
 }
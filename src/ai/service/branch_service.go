@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/model"
+)
+
+// ConversationBranchDTO is the active branch of a conversation. Each message
+// carries the IDs of its siblings (including itself, oldest first) so the client
+// can offer switching between alternatives.
+type ConversationBranchDTO struct {
+	ActiveLeafID string           `json:"activeLeafId"`
+	Messages     []ChatMessageDTO `json:"messages"`
+}
+
+// messageTree is the in-memory structure of a conversation's messages.
+type messageTree struct {
+	nodes    map[uuid.UUID]model.ConversationMessage
+	children map[uuid.UUID][]uuid.UUID // 根消息以 uuid.Nil 为键；子节点按 seq 升序
+}
+
+func buildMessageTree(messages []model.ConversationMessage) *messageTree {
+	tree := &messageTree{
+		nodes:    make(map[uuid.UUID]model.ConversationMessage, len(messages)),
+		children: make(map[uuid.UUID][]uuid.UUID),
+	}
+	// messages 已按 seq 升序，children 因此也保持升序
+	for _, msg := range messages {
+		tree.nodes[msg.ID] = msg
+		parent := uuid.Nil
+		if msg.ParentID != nil {
+			parent = *msg.ParentID
+		}
+		tree.children[parent] = append(tree.children[parent], msg.ID)
+	}
+	return tree
+}
+
+func loadMessageTree(conversationID uuid.UUID) (*messageTree, error) {
+	nodes, err := dao.GetConversationMessageNodes(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return buildMessageTree(nodes), nil
+}
+
+// pathTo returns the message IDs from the root down to leafID.
+func (t *messageTree) pathTo(leafID *uuid.UUID) []uuid.UUID {
+	var path []uuid.UUID
+	for current := leafID; current != nil; {
+		node, ok := t.nodes[*current]
+		if !ok {
+			break
+		}
+		path = append(path, node.ID)
+		current = node.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// activePath returns the path to the conversation's active leaf, falling back to
+// the most recent message when no leaf has been recorded.
+func (t *messageTree) activePath(conv *model.Conversation) []uuid.UUID {
+	leaf := conv.ActiveLeafID
+	if leaf == nil || t.nodes[*leaf].ID == uuid.Nil {
+		var latest *model.ConversationMessage
+		for id := range t.nodes {
+			node := t.nodes[id]
+			if latest == nil || node.Seq > latest.Seq {
+				latest = &node
+			}
+		}
+		if latest == nil {
+			return nil
+		}
+		leaf = &latest.ID
+	}
+	return t.pathTo(leaf)
+}
+
+// latestLeafFrom follows the most recent child from id down to a leaf.
+func (t *messageTree) latestLeafFrom(id uuid.UUID) uuid.UUID {
+	for {
+		children := t.children[id]
+		if len(children) == 0 {
+			return id
+		}
+		id = children[len(children)-1]
+	}
+}
+
+func (t *messageTree) siblingsOf(id uuid.UUID) []uuid.UUID {
+	parent := uuid.Nil
+	if p := t.nodes[id].ParentID; p != nil {
+		parent = *p
+	}
+	return t.children[parent]
+}
+
+// loadActiveBranch returns the full messages on the active branch in order.
+func loadActiveBranch(conv *model.Conversation) ([]model.ConversationMessage, *messageTree, error) {
+	tree, err := loadMessageTree(conv.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, err := dao.GetConversationMessagesByIDs(conv.ID, tree.activePath(conv))
+	if err != nil {
+		return nil, nil, err
+	}
+	return messages, tree, nil
+}
+
+func GetActiveBranch(id string, userID uint) (*ConversationBranchDTO, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, tree, err := loadActiveBranch(conv)
+	if err != nil {
+		return nil, err
+	}
+	return mapBranchToDTO(messages, tree), nil
+}
+
+// SwitchBranch makes the branch through messageID active. The newest descendant
+// of that message becomes the active leaf, so selecting a sibling shows the
+// conversation as it continued from there.
+func SwitchBranch(id string, userID uint, messageID string) (*ConversationBranchDTO, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := dao.FindConversationMessageByID(conv.ID, messageID)
+	if err != nil {
+		return nil, errors.New("message not found in conversation")
+	}
+	tree, err := loadMessageTree(conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	leaf := tree.latestLeafFrom(msg.ID)
+	if err := dao.UpdateConversationActiveLeaf(conv.ID, leaf); err != nil {
+		return nil, err
+	}
+	conv.ActiveLeafID = &leaf
+
+	messages, err := dao.GetConversationMessagesByIDs(conv.ID, tree.pathTo(&leaf))
+	if err != nil {
+		return nil, err
+	}
+	return mapBranchToDTO(messages, tree), nil
+}
+
+// RegenerateMessage streams a new answer as a sibling of the given assistant message.
+func RegenerateMessage(ctx context.Context, id string, messageID string, apiKeyID uint, userID uint, strategy string) (<-chan model.StreamResponse, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return nil, errors.New("conversation not found")
+	}
+	target, err := dao.FindConversationMessageByID(conv.ID, messageID)
+	if err != nil {
+		return nil, errors.New("message not found in conversation")
+	}
+	if target.Role != "ai" || target.ParentID == nil {
+		return nil, errors.New("only assistant replies can be regenerated")
+	}
+
+	history, err := loadPath(conv.ID, target.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	return streamConversationTurn(ctx, conv, apiKeyID, userID, history, "", strategy)
+}
+
+// EditMessage stores an edited copy of a user message as its sibling and streams a
+// new answer to it. The original message and its replies are kept in their branch.
+func EditMessage(ctx context.Context, id string, messageID string, apiKeyID uint, userID uint, content string, strategy string) (<-chan model.StreamResponse, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return nil, errors.New("conversation not found")
+	}
+	target, err := dao.FindConversationMessageByID(conv.ID, messageID)
+	if err != nil {
+		return nil, errors.New("message not found in conversation")
+	}
+	if target.Role != "user" {
+		return nil, errors.New("only user messages can be edited")
+	}
+
+	history, err := loadPath(conv.ID, target.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	return streamConversationTurn(ctx, conv, apiKeyID, userID, history, content, strategy)
+}
+
+// loadPath returns the full messages from the root down to leafID (empty for nil).
+func loadPath(conversationID uuid.UUID, leafID *uuid.UUID) ([]model.ConversationMessage, error) {
+	if leafID == nil {
+		return nil, nil
+	}
+	tree, err := loadMessageTree(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return dao.GetConversationMessagesByIDs(conversationID, tree.pathTo(leafID))
+}
+
+func mapBranchToDTO(messages []model.ConversationMessage, tree *messageTree) *ConversationBranchDTO {
+	branch := &ConversationBranchDTO{Messages: make([]ChatMessageDTO, len(messages))}
+	for i, msg := range messages {
+		msgDTO := mapMessageToDTO(msg)
+		siblings := tree.siblingsOf(msg.ID)
+		msgDTO.SiblingIDs = make([]string, len(siblings))
+		for j, sibling := range siblings {
+			msgDTO.SiblingIDs[j] = sibling.String()
+		}
+		branch.Messages[i] = msgDTO
+	}
+	if len(messages) > 0 {
+		branch.ActiveLeafID = messages[len(messages)-1].ID.String()
+	}
+	return branch
+}
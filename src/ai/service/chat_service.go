@@ -3,26 +3,50 @@ package service
 import (
 	"context"
 	"errors"
+	"github.com/google/uuid"
+	"log"
+	"st-novel-go/src/ai/dao"
 	"st-novel-go/src/ai/model"
 	"st-novel-go/src/ai/provider"
 	settingsDao "st-novel-go/src/settings/dao"
+	settingsModel "st-novel-go/src/settings/model"
+	"strings"
 )
 
-// Chat performs a non-streaming chat completion.
-func Chat(ctx context.Context, apiKeyID uint, userID uint, messages []model.ChatMessage) (*model.ChatResponse, error) {
-	// 1. Get API Key configuration and verify ownership
-	apiKey, err := settingsDao.GetAPIKeyByID(apiKeyID, userID)
+// resolveProvider loads the API key, verifies ownership and builds its provider adapter.
+func resolveProvider(apiKeyID uint, userID uint) (*settingsModel.APIKey, provider.AIProvider, error) {
+	apiKey, aiProvider, err := resolveUnmeteredProvider(apiKeyID, userID)
 	if err != nil {
-		return nil, errors.New("invalid API key ID or permission denied")
+		return nil, nil, err
+	}
+	if err := checkQuota(userID); err != nil {
+		return nil, nil, err
 	}
+	return apiKey, withModeration(newMeteredProvider(aiProvider, userID, apiKey), userID, apiKey), nil
+}
 
-	// 2. Get the provider instance from the factory
+// resolveUnmeteredProvider returns the user's API key and a provider for it that
+// neither checks nor counts towards the user's quota. It is used to validate keys
+// and for background calls such as conversation titles.
+func resolveUnmeteredProvider(apiKeyID uint, userID uint) (*settingsModel.APIKey, provider.AIProvider, error) {
+	apiKey, err := settingsDao.GetAPIKeyByID(apiKeyID, userID)
+	if err != nil {
+		return nil, nil, errors.New("invalid API key ID or permission denied")
+	}
 	aiProvider, err := provider.GetProvider(apiKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return apiKey, aiProvider, nil
+}
+
+// Chat performs a non-streaming chat completion.
+func Chat(ctx context.Context, apiKeyID uint, userID uint, messages []model.ChatMessage) (*model.ChatResponse, error) {
+	apiKey, aiProvider, err := resolveProvider(apiKeyID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. Prepare the chat configuration
 	chatConfig := model.ChatConfig{
 		Model: apiKey.DefaultModel,
 		// TODO: Allow user to override these in the request payload
@@ -31,30 +55,163 @@ func Chat(ctx context.Context, apiKeyID uint, userID uint, messages []model.Chat
 		Stream:      false,
 	}
 
-	// 4. Call the provider's Chat method
 	return aiProvider.Chat(ctx, messages, chatConfig)
 }
 
-// StreamChat performs a streaming chat completion.
-func StreamChat(ctx context.Context, apiKeyID uint, userID uint, messages []model.ChatMessage) (<-chan model.StreamResponse, error) {
-	// 1. Get API Key configuration and verify ownership
-	apiKey, err := settingsDao.GetAPIKeyByID(apiKeyID, userID)
+// StreamChat performs a streaming chat completion. If conversationID refers to a
+// conversation linked to a novel, the novel context is prepended to messages.
+func StreamChat(ctx context.Context, apiKeyID uint, userID uint, conversationID string, messages []model.ChatMessage) (<-chan model.StreamResponse, error) {
+	apiKey, aiProvider, err := resolveProvider(apiKeyID, userID)
 	if err != nil {
-		return nil, errors.New("invalid API key ID or permission denied")
+		return nil, err
 	}
 
-	// 2. Get the provider instance from the factory
-	aiProvider, err := provider.GetProvider(apiKey)
+	if conversationID != "" {
+		if conv, err := dao.FindConversationByID(conversationID, userID); err == nil {
+			messages = withNovelContext(conv, messages)
+		}
+	}
+
+	chatConfig := model.ChatConfig{
+		Model:  apiKey.DefaultModel,
+		Stream: true,
+	}
+
+	return aiProvider.StreamChat(ctx, messages, chatConfig)
+}
+
+// StreamConversationChat streams a reply to a single new user message. The history
+// is the active branch of the conversation, fitted into the context window with the
+// given strategy.
+func StreamConversationChat(ctx context.Context, conversationID string, apiKeyID uint, userID uint, content string, strategy string) (<-chan model.StreamResponse, error) {
+	conv, err := dao.FindConversationByID(conversationID, userID)
+	if err != nil {
+		return nil, errors.New("conversation not found")
+	}
+
+	history, _, err := loadActiveBranch(conv)
+	if err != nil {
+		return nil, err
+	}
+	return streamConversationTurn(ctx, conv, apiKeyID, userID, history, content, strategy)
+}
+
+// streamConversationTurn generates a reply that continues history. When content is
+// non-empty it is sent as a new user message first; when empty the last message of
+// history is the prompt (regeneration). The new messages are appended under the last
+// message of history once the stream ends, including a partial reply if the client
+// disconnects, and become the active branch. The user message is kept even when
+// no reply was generated; a reply blocked by moderation is not saved.
+func streamConversationTurn(ctx context.Context, conv *model.Conversation, apiKeyID uint, userID uint, history []model.ConversationMessage, content string, strategy string) (<-chan model.StreamResponse, error) {
+	apiKey, aiProvider, err := resolveProvider(apiKeyID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. Prepare the chat configuration
 	chatConfig := model.ChatConfig{
 		Model:  apiKey.DefaultModel,
 		Stream: true,
 	}
 
-	// 4. Call the provider's StreamChat method
-	return aiProvider.StreamChat(ctx, messages, chatConfig)
+	messages, err := buildConversationContext(ctx, conv, aiProvider, chatConfig, history, content, strategy)
+	if err != nil {
+		return nil, err
+	}
+	messages = withNovelContext(conv, messages)
+
+	providerChan, err := aiProvider.StreamChat(ctx, messages, chatConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var parentID *uuid.UUID
+	if len(history) > 0 {
+		parentID = &history[len(history)-1].ID
+	}
+
+	outChan := make(chan model.StreamResponse)
+	go func() {
+		defer close(outChan)
+		var reply strings.Builder
+		var usage *model.TokenUsage
+		blocked := false
+		for chunk := range providerChan {
+			if chunk.Event == "moderation" && chunk.Moderation != nil && chunk.Moderation.Action == model.ModerationBlock {
+				blocked = true
+			}
+			if chunk.Event == "chunk" {
+				reply.WriteString(chunk.Content)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			select {
+			case outChan <- chunk:
+			case <-ctx.Done():
+				// 客户端已断开：继续读完上游，保证提供商的 goroutine 能退出，并保存已生成的部分
+			}
+		}
+		// 用户消息无论是否得到回复都要保存；回复为空时只保存用户消息
+		var turn []model.ConversationMessage
+		if content != "" {
+			turn = append(turn, model.ConversationMessage{Role: "user", Content: content})
+		}
+		if blocked {
+			reply.Reset()
+		}
+		if reply.Len() > 0 {
+			aiMsg := model.ConversationMessage{
+				Role:     "ai",
+				Content:  reply.String(),
+				Model:    apiKey.DefaultModel,
+				APIKeyID: apiKey.ID,
+			}
+			if usage != nil {
+				aiMsg.PromptTokens = usage.PromptTokens
+				aiMsg.CompletionTokens = usage.CompletionTokens
+			}
+			turn = append(turn, aiMsg)
+		}
+		if len(turn) == 0 {
+			return
+		}
+		if err := dao.AppendConversationBranch(conv.ID, parentID, turn); err != nil {
+			log.Printf("[chat_service] Failed to append turn to conversation %s: %v", conv.ID, err)
+			return
+		}
+		if reply.Len() > 0 {
+			RefreshConversationMetaAsync(conv.ID.String(), userID, apiKey.ID)
+		}
+	}()
+
+	return outChan, nil
+}
+
+// collectCompletion runs a streaming request to completion and returns the full
+// text. It is used for internal calls such as summaries, since not every adapter
+// implements the non-streaming Chat method.
+func collectCompletion(ctx context.Context, aiProvider provider.AIProvider, messages []model.ChatMessage, config model.ChatConfig) (string, *model.TokenUsage, error) {
+	config.Stream = true
+	streamChan, err := aiProvider.StreamChat(ctx, messages, config)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	var usage *model.TokenUsage
+	for chunk := range streamChan {
+		if chunk.Error != "" {
+			// 读完剩余事件，避免提供商 goroutine 阻塞
+			for range streamChan {
+			}
+			return "", nil, errors.New(chunk.Error)
+		}
+		if chunk.Event == "chunk" {
+			sb.WriteString(chunk.Content)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	return strings.TrimSpace(sb.String()), usage, nil
 }
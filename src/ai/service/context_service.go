@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/provider"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ContextStrategyTruncate drops the oldest messages that do not fit into the context window.
+	ContextStrategyTruncate = "truncate"
+	// ContextStrategySummarize folds the messages that do not fit into a rolling summary.
+	ContextStrategySummarize = "summarize"
+
+	// contextTokenBudget 是发送给模型的历史消息的估算 token 上限（不含新消息和摘要）
+	contextTokenBudget = 6000
+	// maxTruncateHistory 是截断模式下最多参与计算的历史消息数
+	maxTruncateHistory = 200
+)
+
+const contextSummaryPrompt = `请将下面的对话内容压缩为一段简洁的中文摘要，保留人物、设定、已做出的决定和尚未解决的问题，不要添加评论。`
+
+// buildConversationContext assembles the messages sent to the provider from history
+// (a branch path in chronological order) and an optional new user message: the
+// history is fitted into contextTokenBudget and, with the summarize strategy,
+// preceded by a summary of the older turns.
+func buildConversationContext(ctx context.Context, conv *model.Conversation, aiProvider provider.AIProvider, config model.ChatConfig, history []model.ConversationMessage, content string, strategy string) ([]model.ChatMessage, error) {
+	if strategy == "" {
+		strategy = ContextStrategyTruncate
+	}
+
+	previousSummary := ""
+	switch strategy {
+	case ContextStrategyTruncate:
+		if len(history) > maxTruncateHistory {
+			history = history[len(history)-maxTruncateHistory:]
+		}
+	case ContextStrategySummarize:
+		// 摘要只在其覆盖的消息仍位于当前分支上时有效；切换到其他分支后需重新生成
+		for i, msg := range history {
+			if conv.ContextSummarySeq > 0 && msg.Seq == conv.ContextSummarySeq {
+				previousSummary = conv.ContextSummary
+				history = history[i+1:]
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported context strategy: %s", strategy)
+	}
+
+	// 从最新的消息开始向前累计，直到超出预算
+	cut := len(history)
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		used += estimateTokens(history[i].Content)
+		if used > contextTokenBudget {
+			break
+		}
+		cut = i
+	}
+	kept := history[cut:]
+	dropped := history[:cut]
+
+	var messages []model.ChatMessage
+	if strategy == ContextStrategySummarize {
+		summary := previousSummary
+		if len(dropped) > 0 {
+			newSummary, err := summarizeMessages(ctx, aiProvider, config, previousSummary, dropped)
+			if err != nil {
+				// 摘要失败时退化为截断，不阻塞对话
+				log.Printf("[context_service] Failed to summarize conversation %s: %v", conv.ID, err)
+			} else {
+				summary = newSummary
+				upTo := dropped[len(dropped)-1].Seq
+				if err := dao.UpdateConversationContextSummary(conv.ID, summary, upTo); err != nil {
+					log.Printf("[context_service] Failed to save context summary for conversation %s: %v", conv.ID, err)
+				}
+			}
+		}
+		if summary != "" {
+			messages = append(messages, model.ChatMessage{Role: "system", Content: "以下是此前对话的摘要：\n" + summary})
+		}
+	}
+
+	for _, msg := range kept {
+		messages = append(messages, toProviderMessage(msg))
+	}
+	if content != "" {
+		messages = append(messages, model.ChatMessage{Role: "user", Content: content})
+	}
+	return messages, nil
+}
+
+// summarizeMessages merges the previous summary and the given messages into a new summary.
+func summarizeMessages(ctx context.Context, aiProvider provider.AIProvider, config model.ChatConfig, previous string, messages []model.ConversationMessage) (string, error) {
+	var sb strings.Builder
+	if previous != "" {
+		sb.WriteString("【已有摘要】\n")
+		sb.WriteString(previous)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("【对话】\n")
+	for _, msg := range messages {
+		sb.WriteString(roleLabel(msg.Role))
+		sb.WriteString("：")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+
+	summaryMessages := []model.ChatMessage{
+		{Role: "system", Content: contextSummaryPrompt},
+		{Role: "user", Content: sb.String()},
+	}
+	summary, _, err := collectCompletion(ctx, aiProvider, summaryMessages, config)
+	return summary, err
+}
+
+// toProviderMessage converts a stored message to the role names expected by providers.
+// 前端以 "ai" 表示助手消息，提供商需要 "assistant"。
+func toProviderMessage(msg model.ConversationMessage) model.ChatMessage {
+	role := msg.Role
+	if role == "ai" {
+		role = "assistant"
+	}
+	return model.ChatMessage{Role: role, Content: msg.Content}
+}
+
+func roleLabel(role string) string {
+	switch role {
+	case "user":
+		return "用户"
+	case "system":
+		return "系统"
+	default:
+		return "AI"
+	}
+}
+
+// estimateTokens gives a rough token count without a tokenizer: one token per CJK
+// character and roughly one token per four other characters.
+func estimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || r > 0x3000 {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	settingsModel "st-novel-go/src/settings/model"
+	"strings"
+	"time"
+)
+
+const (
+	defaultConversationTitle   = "新的对话"
+	defaultConversationSummary = "开始一段新的对话..."
+
+	// summaryRefreshMessages 为两次自动摘要之间至少新增的消息数
+	summaryRefreshMessages = 6
+	// metaRecentMessages 为生成标题和摘要时参考的最近消息数
+	metaRecentMessages = 20
+	metaTimeout        = 60 * time.Second
+)
+
+// cheapModels 为自动标题/摘要默认使用的低价模型，仅用于未自定义 BaseURL 的官方接口
+var cheapModels = map[settingsModel.ProviderType]string{
+	settingsModel.OpenAI: "gpt-4o-mini",
+	settingsModel.Claude: "claude-3-5-haiku-latest",
+	settingsModel.Gemini: "gemini-1.5-flash",
+}
+
+const conversationMetaPrompt = `你是对话整理助手。根据提供的对话（以及可能存在的旧摘要），输出一个 JSON 对象，格式为 {"title": "...", "summary": "..."}。
+title：不超过 15 个字的中文标题，概括对话主题，不要使用引号或标点结尾。
+summary：不超过 100 字的中文摘要，合并旧摘要与新内容。
+只输出 JSON，不要输出其他内容。`
+
+type conversationMeta struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+func GetAIPreference(userID uint) (*dto.AIPreferenceDTO, error) {
+	pref, err := dao.GetAIPreference(userID)
+	if err != nil {
+		return nil, err
+	}
+	return mapPreferenceToDTO(pref), nil
+}
+
+func UpdateAIPreference(userID uint, payload dto.UpdateAIPreferencePayload) (*dto.AIPreferenceDTO, error) {
+	pref, err := dao.GetAIPreference(userID)
+	if err != nil {
+		return nil, err
+	}
+	if payload.AutoTitleEnabled != nil {
+		pref.AutoTitleDisabled = !*payload.AutoTitleEnabled
+	}
+	if payload.AutoTitleModel != nil {
+		pref.AutoTitleModel = strings.TrimSpace(*payload.AutoTitleModel)
+	}
+	if err := dao.SaveAIPreference(pref); err != nil {
+		return nil, err
+	}
+	return mapPreferenceToDTO(pref), nil
+}
+
+// RefreshConversationMetaAsync generates the title and rolling summary of a
+// conversation in the background after a turn has been stored.
+func RefreshConversationMetaAsync(conversationID string, userID uint, apiKeyID uint) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metaTimeout)
+		defer cancel()
+		if err := refreshConversationMeta(ctx, conversationID, userID, apiKeyID); err != nil {
+			log.Printf("[conversation_meta] Failed to refresh title/summary of conversation %s: %v", conversationID, err)
+		}
+	}()
+}
+
+func refreshConversationMeta(ctx context.Context, conversationID string, userID uint, apiKeyID uint) error {
+	pref, err := dao.GetAIPreference(userID)
+	if err != nil {
+		return err
+	}
+	if pref.AutoTitleDisabled {
+		return nil
+	}
+
+	conv, err := dao.FindConversationByID(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	recent, _, err := loadActiveBranch(conv)
+	if err != nil {
+		return err
+	}
+	// 至少需要一问一答
+	if len(recent) < 2 {
+		return nil
+	}
+	if len(recent) > metaRecentMessages {
+		recent = recent[len(recent)-metaRecentMessages:]
+	}
+	latestSeq := recent[len(recent)-1].Seq
+
+	needTitle := !conv.TitleLocked && conv.Title == defaultConversationTitle
+	needSummary := conv.SummarySeq == 0 || latestSeq-conv.SummarySeq >= summaryRefreshMessages
+	if !needTitle && !needSummary {
+		return nil
+	}
+
+	// 后台生成不占用用户的请求频率和额度
+	apiKey, aiProvider, err := resolveUnmeteredProvider(apiKeyID, userID)
+	if err != nil {
+		return err
+	}
+	metaModel := pref.AutoTitleModel
+	if metaModel == "" && apiKey.BaseURL == "" {
+		metaModel = cheapModels[apiKey.Provider]
+	}
+	if metaModel == "" {
+		metaModel = apiKey.DefaultModel
+	}
+
+	var sb strings.Builder
+	if conv.Summary != "" && conv.Summary != defaultConversationSummary {
+		sb.WriteString("【旧摘要】\n")
+		sb.WriteString(conv.Summary)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("【对话】\n")
+	for _, msg := range recent {
+		sb.WriteString(roleLabel(msg.Role))
+		sb.WriteString("：")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+
+	messages := []model.ChatMessage{
+		{Role: "system", Content: conversationMetaPrompt},
+		{Role: "user", Content: sb.String()},
+	}
+	config := model.ChatConfig{Model: metaModel, Temperature: 0.3, MaxTokens: 300}
+	output, _, err := collectCompletion(ctx, aiProvider, messages, config)
+	if err != nil && metaModel != apiKey.DefaultModel {
+		// 低价模型不可用（如兼容接口不支持该模型名）时改用密钥的默认模型
+		log.Printf("[conversation_meta] Model %s failed for conversation %s, falling back to %s: %v", metaModel, conversationID, apiKey.DefaultModel, err)
+		config.Model = apiKey.DefaultModel
+		output, _, err = collectCompletion(ctx, aiProvider, messages, config)
+	}
+	if err != nil {
+		return err
+	}
+	meta, err := parseConversationMeta(output)
+	if err != nil {
+		return err
+	}
+
+	columns := map[string]interface{}{}
+	// 重新读取，避免覆盖生成期间用户手动修改的标题
+	current, err := dao.FindConversationByID(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if needTitle && meta.Title != "" && !current.TitleLocked && current.Title == defaultConversationTitle {
+		columns["title"] = meta.Title
+	}
+	if needSummary && meta.Summary != "" {
+		columns["summary"] = meta.Summary
+		columns["summary_seq"] = latestSeq
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return dao.UpdateConversationColumns(conv.ID, columns)
+}
+
+// parseConversationMeta extracts the JSON object from the model output, tolerating
+// surrounding text or markdown code fences.
+func parseConversationMeta(output string) (*conversationMeta, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end <= start {
+		return nil, errors.New("model output does not contain a JSON object")
+	}
+	var meta conversationMeta
+	if err := json.Unmarshal([]byte(output[start:end+1]), &meta); err != nil {
+		return nil, err
+	}
+	meta.Title = strings.Trim(strings.TrimSpace(meta.Title), "\"“”《》。")
+	if len([]rune(meta.Title)) > 30 {
+		meta.Title = string([]rune(meta.Title)[:30])
+	}
+	meta.Summary = strings.TrimSpace(meta.Summary)
+	return &meta, nil
+}
+
+func mapPreferenceToDTO(pref *model.AIPreference) *dto.AIPreferenceDTO {
+	return &dto.AIPreferenceDTO{
+		AutoTitleEnabled: !pref.AutoTitleDisabled,
+		AutoTitleModel:   pref.AutoTitleModel,
+	}
+}
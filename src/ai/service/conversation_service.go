@@ -1,96 +1,328 @@
 package service
 
 import (
-	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
 	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
 	"st-novel-go/src/ai/model"
+	settingsDao "st-novel-go/src/settings/dao"
+	"strconv"
 	"time"
 )
 
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 200
+)
+
 type ChatMessageDTO struct {
-	ID        string `json:"id"`
-	Role      string `json:"role"`
-	Content   string `json:"content"`
-	Timestamp string `json:"timestamp"`
+	ID               string   `json:"id"`
+	ParentID         string   `json:"parentId,omitempty"`
+	Seq              int      `json:"seq"`
+	Role             string   `json:"role"`
+	Content          string   `json:"content"`
+	Timestamp        string   `json:"timestamp"`
+	Model            string   `json:"model,omitempty"`
+	APIKeyID         uint     `json:"apiKeyId,omitempty"`
+	PromptTokens     int      `json:"promptTokens,omitempty"`
+	CompletionTokens int      `json:"completionTokens,omitempty"`
+	SiblingIDs       []string `json:"siblingIds,omitempty"`
 }
 
 type ConversationDTO struct {
 	ID        string           `json:"id"`
+	NovelID   string           `json:"novelId,omitempty"`
+	ChapterID string           `json:"chapterId,omitempty"`
 	Title     string           `json:"title"`
 	Summary   string           `json:"summary"`
 	CreatedAt string           `json:"createdAt"`
 	Messages  []ChatMessageDTO `json:"messages"`
 }
 
-func CreateConversation(userID uint) (*ConversationDTO, error) {
-	emptyMessages, _ := json.Marshal([]ChatMessageDTO{})
+// ConversationMessagePageDTO is one page of the active branch of a conversation in
+// chronological order. NextCursor is passed back as ?cursor= to load older messages.
+type ConversationMessagePageDTO struct {
+	Messages   []ChatMessageDTO `json:"messages"`
+	NextCursor string           `json:"nextCursor"`
+	HasMore    bool             `json:"hasMore"`
+}
+
+func CreateConversation(userID uint, payload dto.CreateConversationPayload) (*ConversationDTO, error) {
+	novelID, chapterID, err := resolveConversationLinks(userID, payload.NovelID, payload.ChapterID)
+	if err != nil {
+		return nil, err
+	}
 
 	conv := &model.Conversation{
-		UserID:   userID,
-		Title:    "新的对话",
-		Summary:  "开始一段新的对话...",
-		Messages: emptyMessages,
+		UserID:    userID,
+		NovelID:   novelID,
+		ChapterID: chapterID,
+		Title:     defaultConversationTitle,
+		Summary:   defaultConversationSummary,
 	}
 
 	if err := dao.CreateConversation(conv); err != nil {
 		return nil, err
 	}
 
-	return mapConversationToDTO(*conv), nil
+	return mapConversationToDTO(*conv, nil), nil
 }
 
-func GetConversations(userID uint) ([]ConversationDTO, error) {
-	convs, err := dao.GetConversationsByUserID(userID)
+func GetConversations(userID uint, novelID string, chapterID string) ([]ConversationDTO, error) {
+	convs, err := dao.GetConversationsByUserID(userID, novelID, chapterID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(convs))
+	for i, conv := range convs {
+		ids[i] = conv.ID
+	}
+	messages, err := dao.GetMessagesForConversations(ids)
 	if err != nil {
 		return nil, err
 	}
+	messagesByConv := make(map[uuid.UUID][]model.ConversationMessage)
+	for _, msg := range messages {
+		messagesByConv[msg.ConversationID] = append(messagesByConv[msg.ConversationID], msg)
+	}
 
+	// 列表中只返回每个会话当前活动分支上的消息
 	var dtoList []ConversationDTO
 	for _, conv := range convs {
-		dtoList = append(dtoList, *mapConversationToDTO(conv))
+		convMessages := messagesByConv[conv.ID]
+		tree := buildMessageTree(convMessages)
+		var branch []model.ConversationMessage
+		for _, msgID := range tree.activePath(&conv) {
+			branch = append(branch, tree.nodes[msgID])
+		}
+		dtoList = append(dtoList, *mapConversationToDTO(conv, branch))
 	}
 
 	return dtoList, nil
 }
 
-func UpdateConversationTitle(id string, userID uint, title string) (*ConversationDTO, error) {
+// GetConversationMessages returns a page of messages older than cursor (a message
+// seq); an empty cursor starts from the most recent message.
+func GetConversationMessages(id string, userID uint, cursor string, limit int) (*ConversationMessagePageDTO, error) {
 	conv, err := dao.FindConversationByID(id, userID)
 	if err != nil {
 		return nil, err
 	}
-	conv.Title = title
+
+	beforeSeq := 0
+	if cursor != "" {
+		beforeSeq, err = strconv.Atoi(cursor)
+		if err != nil || beforeSeq < 0 {
+			return nil, errors.New("invalid cursor")
+		}
+	}
+	if limit <= 0 {
+		limit = defaultMessagePageSize
+	}
+	if limit > maxMessagePageSize {
+		limit = maxMessagePageSize
+	}
+
+	tree, err := loadMessageTree(conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	// 活动分支上的 seq 单调递增，因此可以直接用 seq 作为游标
+	path := tree.activePath(conv)
+	end := len(path)
+	if beforeSeq > 0 {
+		for end > 0 && tree.nodes[path[end-1]].Seq >= beforeSeq {
+			end--
+		}
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	hasMore := start > 0
+
+	messages, err := dao.GetConversationMessagesByIDs(conv.ID, path[start:end])
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ConversationMessagePageDTO{
+		Messages: make([]ChatMessageDTO, len(messages)),
+		HasMore:  hasMore,
+	}
+	for i, msg := range messages {
+		page.Messages[i] = mapMessageToDTO(msg)
+	}
+	if hasMore && len(messages) > 0 {
+		page.NextCursor = strconv.Itoa(messages[0].Seq)
+	}
+	return page, nil
+}
+
+// UpdateConversation renames a conversation and/or changes the novel and chapter it
+// is linked to. An empty novelId or chapterId removes the link.
+func UpdateConversation(id string, userID uint, payload dto.UpdateConversationPayload) (*ConversationDTO, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Title != nil {
+		conv.Title = *payload.Title
+		conv.TitleLocked = true
+	}
+	if payload.NovelID != nil || payload.ChapterID != nil {
+		novelID, chapterID := "", ""
+		if payload.NovelID != nil {
+			novelID = *payload.NovelID
+		} else if conv.NovelID != nil {
+			novelID = conv.NovelID.String()
+		}
+		if payload.ChapterID != nil {
+			chapterID = *payload.ChapterID
+		} else if conv.ChapterID != nil && payload.NovelID == nil {
+			chapterID = conv.ChapterID.String()
+		}
+		conv.NovelID, conv.ChapterID, err = resolveConversationLinks(userID, novelID, chapterID)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if err := dao.UpdateConversation(conv); err != nil {
 		return nil, err
 	}
-	return mapConversationToDTO(*conv), nil
+	return mapConversationToDTO(*conv, nil), nil
 }
 
+// SaveConversationMessages persists the messages of a turn. The client sends the
+// full history, which is matched against the stored tree from the root by role and
+// content. The messages after the last match are appended under it and become the
+// active branch, so a history that diverged on another device or after a branch
+// switch starts a sibling branch. Existing rows are never rewritten.
 func SaveConversationMessages(id string, userID uint, messages []ChatMessageDTO) error {
 	conv, err := dao.FindConversationByID(id, userID)
 	if err != nil {
 		return err
 	}
-	msgBytes, _ := json.Marshal(messages)
-	conv.Messages = msgBytes
-	return dao.UpdateConversation(conv)
+	stored, err := dao.GetMessagesForConversations([]uuid.UUID{conv.ID})
+	if err != nil {
+		return err
+	}
+	tree := buildMessageTree(stored)
+
+	var parentID *uuid.UUID
+	matched := 0
+	for ; matched < len(messages); matched++ {
+		parent := uuid.Nil
+		if parentID != nil {
+			parent = *parentID
+		}
+		// 同一位置有多条相同的消息时取最新的一条
+		var next *uuid.UUID
+		children := tree.children[parent]
+		for i := len(children) - 1; i >= 0; i-- {
+			if sameChatMessage(tree.nodes[children[i]], messages[matched]) {
+				childID := children[i]
+				next = &childID
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		parentID = next
+	}
+	if matched == len(messages) {
+		return nil
+	}
+
+	newMessages := mapDTOsToMessages(messages[matched:])
+	for i := range newMessages {
+		if newMessages[i].APIKeyID != 0 && newMessages[i].Model == "" {
+			if apiKey, err := settingsDao.GetAPIKeyByID(newMessages[i].APIKeyID, userID); err == nil {
+				newMessages[i].Model = apiKey.DefaultModel
+			}
+		}
+	}
+	if err := dao.AppendConversationBranch(conv.ID, parentID, newMessages); err != nil {
+		return err
+	}
+
+	last := newMessages[len(newMessages)-1]
+	if last.APIKeyID != 0 {
+		RefreshConversationMetaAsync(id, userID, last.APIKeyID)
+	}
+	return nil
+}
+
+// sameChatMessage reports whether a stored message is the one the client sent. The
+// client may name the assistant either "ai" or "assistant".
+func sameChatMessage(stored model.ConversationMessage, sent ChatMessageDTO) bool {
+	role := sent.Role
+	if role == "ai" {
+		role = "assistant"
+	}
+	providerMsg := toProviderMessage(stored)
+	return providerMsg.Role == role && providerMsg.Content == sent.Content
 }
 
 func DeleteConversation(id string, userID uint) error {
 	return dao.DeleteConversation(id, userID)
 }
 
-func mapConversationToDTO(conv model.Conversation) *ConversationDTO {
-	var messages []ChatMessageDTO
-	_ = json.Unmarshal(conv.Messages, &messages)
-	if messages == nil {
-		messages = []ChatMessageDTO{}
+func mapDTOsToMessages(dtos []ChatMessageDTO) []model.ConversationMessage {
+	messages := make([]model.ConversationMessage, len(dtos))
+	for i, m := range dtos {
+		messages[i] = model.ConversationMessage{
+			Role:             m.Role,
+			Content:          m.Content,
+			Model:            m.Model,
+			APIKeyID:         m.APIKeyID,
+			PromptTokens:     m.PromptTokens,
+			CompletionTokens: m.CompletionTokens,
+		}
 	}
+	return messages
+}
 
-	return &ConversationDTO{
+func mapMessageToDTO(msg model.ConversationMessage) ChatMessageDTO {
+	parentID := ""
+	if msg.ParentID != nil {
+		parentID = msg.ParentID.String()
+	}
+	return ChatMessageDTO{
+		ID:               msg.ID.String(),
+		ParentID:         parentID,
+		Seq:              msg.Seq,
+		Role:             msg.Role,
+		Content:          msg.Content,
+		Timestamp:        msg.CreatedAt.Format(time.RFC3339),
+		Model:            msg.Model,
+		APIKeyID:         msg.APIKeyID,
+		PromptTokens:     msg.PromptTokens,
+		CompletionTokens: msg.CompletionTokens,
+	}
+}
+
+func mapConversationToDTO(conv model.Conversation, messages []model.ConversationMessage) *ConversationDTO {
+	messageDTOs := make([]ChatMessageDTO, len(messages))
+	for i, msg := range messages {
+		messageDTOs[i] = mapMessageToDTO(msg)
+	}
+
+	convDTO := &ConversationDTO{
 		ID:        conv.ID.String(),
 		Title:     conv.Title,
 		Summary:   conv.Summary,
 		CreatedAt: conv.CreatedAt.Format(time.RFC3339),
-		Messages:  messages,
+		Messages:  messageDTOs,
+	}
+	if conv.NovelID != nil {
+		convDTO.NovelID = conv.NovelID.String()
+	}
+	if conv.ChapterID != nil {
+		convDTO.ChapterID = conv.ChapterID.String()
 	}
+	return convDTO
 }
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"html"
+	"regexp"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	novelDto "st-novel-go/src/novel/dto"
+	novelModel "st-novel-go/src/novel/model"
+	novelService "st-novel-go/src/novel/service"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatMarkdown = "md"
+	ExportFormatJSON     = "json"
+
+	conversationExportVersion = 1
+)
+
+// markdownMessageHeading 匹配 Markdown 导出中每条消息的标题行，例如 "### 用户 · 2024-01-02T15:04:05Z"
+var markdownMessageHeading = regexp.MustCompile(`^### (用户|AI|系统) · (\S+)\s*$`)
+
+// ExportConversation renders a conversation as Markdown (the active branch only) or
+// JSON (the whole message tree). It returns the file name and the file content.
+func ExportConversation(id string, userID uint, format string) (string, []byte, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch format {
+	case ExportFormatMarkdown, "":
+		messages, _, err := loadActiveBranch(conv)
+		if err != nil {
+			return "", nil, err
+		}
+		return conv.Title + ".md", []byte(renderConversationMarkdown(conv, messages)), nil
+	case ExportFormatJSON:
+		messages, err := dao.GetMessagesForConversations([]uuid.UUID{conv.ID})
+		if err != nil {
+			return "", nil, err
+		}
+		data, err := json.MarshalIndent(buildConversationExport(conv, messages), "", "  ")
+		if err != nil {
+			return "", nil, err
+		}
+		return conv.Title + ".json", data, nil
+	default:
+		return "", nil, errors.New("unsupported export format: " + format)
+	}
+}
+
+// ImportConversation restores a conversation from a Markdown or JSON export. Message
+// IDs are regenerated so the same file can be imported more than once.
+func ImportConversation(userID uint, format string, data []byte) (*ConversationDTO, error) {
+	var export dto.ConversationExport
+	switch format {
+	case ExportFormatJSON, "":
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, errors.New("invalid conversation file: " + err.Error())
+		}
+	case ExportFormatMarkdown:
+		export = parseConversationMarkdown(string(data))
+	default:
+		return nil, errors.New("unsupported import format: " + format)
+	}
+
+	conv := &model.Conversation{
+		UserID:      userID,
+		Title:       export.Title,
+		Summary:     export.Summary,
+		TitleLocked: export.Title != "",
+	}
+	conv.CreatedAt = parseExportTime(export.CreatedAt)
+	conv.UpdatedAt = parseExportTime(export.UpdatedAt)
+	if conv.Title == "" {
+		conv.Title = defaultConversationTitle
+	}
+	if conv.Summary == "" {
+		conv.Summary = defaultConversationSummary
+	}
+	// 原关联的小说或章节已不存在时，导入为未关联的对话
+	if novelID, chapterID, err := resolveConversationLinks(userID, export.NovelID, export.ChapterID); err == nil {
+		conv.NovelID, conv.ChapterID = novelID, chapterID
+	}
+
+	messages, activeLeafID, err := mapExportedMessages(export)
+	if err != nil {
+		return nil, err
+	}
+	conv.ActiveLeafID = activeLeafID
+
+	if err := dao.ImportConversation(conv, messages); err != nil {
+		return nil, err
+	}
+
+	tree := buildMessageTree(messages)
+	return mapConversationToDTO(*conv, pickMessages(tree, tree.activePath(conv))), nil
+}
+
+// SaveConversationAsNote stores the active branch of a conversation as a note on
+// the given novel.
+func SaveConversationAsNote(id string, userID uint, payload dto.SaveConversationAsNotePayload) (*novelModel.Note, error) {
+	conv, err := dao.FindConversationByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, _, err := loadActiveBranch(conv)
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(payload.Title)
+	if title == "" {
+		title = conv.Title
+	}
+	return novelService.CreateNote(payload.NovelID, userID, novelDto.CreateNotePayload{
+		Title:   title,
+		Content: renderConversationHTML(title, messages),
+	})
+}
+
+func renderConversationMarkdown(conv *model.Conversation, messages []model.ConversationMessage) string {
+	var sb strings.Builder
+	sb.WriteString("# " + conv.Title + "\n\n")
+	if conv.Summary != "" {
+		sb.WriteString("> " + strings.ReplaceAll(conv.Summary, "\n", "\n> ") + "\n\n")
+	}
+	sb.WriteString("- 创建时间：" + conv.CreatedAt.Format(time.RFC3339) + "\n")
+	sb.WriteString("- 更新时间：" + conv.UpdatedAt.Format(time.RFC3339) + "\n\n")
+	sb.WriteString("---\n")
+	for _, msg := range messages {
+		sb.WriteString(fmt.Sprintf("\n### %s · %s\n\n", roleLabel(msg.Role), msg.CreatedAt.Format(time.RFC3339)))
+		sb.WriteString(strings.TrimRight(msg.Content, "\n") + "\n")
+	}
+	return sb.String()
+}
+
+// parseConversationMarkdown reads the format written by renderConversationMarkdown.
+// The messages are imported as a single branch.
+func parseConversationMarkdown(text string) dto.ConversationExport {
+	var export dto.ConversationExport
+	var summaryLines, contentLines []string
+	var current *dto.ExportedMessage
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Content = strings.TrimSpace(strings.Join(contentLines, "\n"))
+		export.Messages = append(export.Messages, *current)
+		current, contentLines = nil, nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if m := markdownMessageHeading.FindStringSubmatch(line); m != nil {
+			flush()
+			current = &dto.ExportedMessage{Role: roleFromLabel(m[1]), Timestamp: m[2]}
+			continue
+		}
+		if current != nil {
+			contentLines = append(contentLines, line)
+			continue
+		}
+		// 第一条消息之前为标题、摘要与时间信息
+		switch {
+		case export.Title == "" && strings.HasPrefix(line, "# "):
+			export.Title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, ">"):
+			summaryLines = append(summaryLines, strings.TrimSpace(strings.TrimPrefix(line, ">")))
+		case strings.HasPrefix(line, "- 创建时间："):
+			export.CreatedAt = strings.TrimSpace(strings.TrimPrefix(line, "- 创建时间："))
+		case strings.HasPrefix(line, "- 更新时间："):
+			export.UpdatedAt = strings.TrimSpace(strings.TrimPrefix(line, "- 更新时间："))
+		}
+	}
+	flush()
+
+	export.Summary = strings.Join(summaryLines, "\n")
+	return export
+}
+
+func roleFromLabel(label string) string {
+	switch label {
+	case "用户":
+		return "user"
+	case "系统":
+		return "system"
+	default:
+		return "ai"
+	}
+}
+
+func buildConversationExport(conv *model.Conversation, messages []model.ConversationMessage) dto.ConversationExport {
+	export := dto.ConversationExport{
+		Version:   conversationExportVersion,
+		Title:     conv.Title,
+		Summary:   conv.Summary,
+		CreatedAt: conv.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: conv.UpdatedAt.Format(time.RFC3339),
+		Messages:  make([]dto.ExportedMessage, len(messages)),
+	}
+	if conv.NovelID != nil {
+		export.NovelID = conv.NovelID.String()
+	}
+	if conv.ChapterID != nil {
+		export.ChapterID = conv.ChapterID.String()
+	}
+	if path := buildMessageTree(messages).activePath(conv); len(path) > 0 {
+		export.ActiveLeafID = path[len(path)-1].String()
+	}
+	for i, msg := range messages {
+		exported := dto.ExportedMessage{
+			ID:               msg.ID.String(),
+			Role:             msg.Role,
+			Content:          msg.Content,
+			Model:            msg.Model,
+			PromptTokens:     msg.PromptTokens,
+			CompletionTokens: msg.CompletionTokens,
+			Timestamp:        msg.CreatedAt.Format(time.RFC3339),
+		}
+		if msg.ParentID != nil {
+			exported.ParentID = msg.ParentID.String()
+		}
+		export.Messages[i] = exported
+	}
+	return export
+}
+
+// mapExportedMessages turns exported messages into new records, remapping IDs and
+// parent links. Messages without an ID or with an unknown parent are chained to the
+// previous message, which is how Markdown imports become a single branch.
+func mapExportedMessages(export dto.ConversationExport) ([]model.ConversationMessage, *uuid.UUID, error) {
+	messages := make([]model.ConversationMessage, 0, len(export.Messages))
+	idMap := make(map[string]uuid.UUID, len(export.Messages))
+	var previous *uuid.UUID
+
+	for i, exported := range export.Messages {
+		role := exported.Role
+		if role == "assistant" {
+			role = "ai"
+		}
+		if role != "user" && role != "ai" && role != "system" {
+			return nil, nil, fmt.Errorf("invalid role %q in message %d", exported.Role, i+1)
+		}
+
+		msg := model.ConversationMessage{
+			Seq:              i + 1,
+			Role:             role,
+			Content:          exported.Content,
+			Model:            exported.Model,
+			PromptTokens:     exported.PromptTokens,
+			CompletionTokens: exported.CompletionTokens,
+		}
+		msg.ID = uuid.New()
+		msg.CreatedAt = parseExportTime(exported.Timestamp)
+		msg.UpdatedAt = msg.CreatedAt
+
+		switch {
+		case exported.ID == "":
+			msg.ParentID = previous
+		case exported.ParentID == "":
+			msg.ParentID = nil
+		default:
+			if parentID, ok := idMap[exported.ParentID]; ok {
+				msg.ParentID = &parentID
+			} else {
+				msg.ParentID = previous
+			}
+		}
+		if exported.ID != "" {
+			idMap[exported.ID] = msg.ID
+		}
+
+		id := msg.ID
+		previous = &id
+		messages = append(messages, msg)
+	}
+
+	activeLeafID := previous
+	if leafID, ok := idMap[export.ActiveLeafID]; ok {
+		activeLeafID = &leafID
+	}
+	return messages, activeLeafID, nil
+}
+
+func pickMessages(tree *messageTree, ids []uuid.UUID) []model.ConversationMessage {
+	messages := make([]model.ConversationMessage, 0, len(ids))
+	for _, id := range ids {
+		messages = append(messages, tree.nodes[id])
+	}
+	return messages
+}
+
+// renderConversationHTML renders messages in the HTML format used by note content.
+func renderConversationHTML(title string, messages []model.ConversationMessage) string {
+	var sb strings.Builder
+	sb.WriteString("<h1>" + html.EscapeString(title) + "</h1>")
+	for _, msg := range messages {
+		sb.WriteString("<h3>" + roleLabel(msg.Role) + "</h3>")
+		for _, paragraph := range strings.Split(strings.TrimSpace(msg.Content), "\n") {
+			if strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			sb.WriteString("<p>" + html.EscapeString(paragraph) + "</p>")
+		}
+	}
+	return sb.String()
+}
+
+func parseExportTime(value string) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	return time.Now()
+}
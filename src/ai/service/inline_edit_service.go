@@ -0,0 +1,328 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	novelDao "st-novel-go/src/novel/dao"
+	novelDto "st-novel-go/src/novel/dto"
+	novelModel "st-novel-go/src/novel/model"
+	novelService "st-novel-go/src/novel/service"
+	"strings"
+	"unicode"
+)
+
+const (
+	InlineEditRewrite = "rewrite"
+	InlineEditExpand  = "expand"
+	InlineEditShorten = "shorten"
+	InlineEditTone    = "tone"
+
+	// inlineEditContextRunes 为提示词中附带的选区前后文字数
+	inlineEditContextRunes = 500
+	// maxDiffCells 限制逐词比对的计算量（内存为线性），超出时不同的部分作为一个修改块
+	maxDiffCells = 4000000
+)
+
+var inlineEditLabels = map[string]string{
+	InlineEditRewrite: "改写",
+	InlineEditExpand:  "扩写",
+	InlineEditShorten: "缩写",
+	InlineEditTone:    "调整语气",
+}
+
+var codeFenceRegex = regexp.MustCompile("(?s)^```[a-zA-Z]*\\n(.*?)\\n?```$")
+
+// InlineEditChapter asks the AI to edit a selection of a chapter and returns the
+// result as a diff against the stored content. Nothing is saved until the diff
+// is accepted.
+func InlineEditChapter(ctx context.Context, userID uint, payload dto.InlineEditPayload) (*dto.ChapterEditDiffDTO, error) {
+	label, ok := inlineEditLabels[payload.Operation]
+	if !ok {
+		return nil, fmt.Errorf("unsupported operation: %s", payload.Operation)
+	}
+	if payload.Operation == InlineEditTone && strings.TrimSpace(payload.Tone) == "" {
+		return nil, errors.New("tone is required for the tone operation")
+	}
+
+	chapter, err := novelDao.FindChapterByID(payload.ChapterID)
+	if err != nil {
+		return nil, errors.New("chapter not found")
+	}
+	if _, err := novelDao.FindNovelWithRole(chapter.NovelID.String(), userID, novelModel.RoleEditor); err != nil {
+		return nil, errors.New("permission denied")
+	}
+
+	content := []rune(chapter.Content)
+	if payload.Start < 0 || payload.End <= payload.Start || payload.End > len(content) {
+		return nil, errors.New("selection range is out of bounds")
+	}
+	if insideTag(content, payload.Start) || insideTag(content, payload.End) {
+		return nil, errors.New("selection range must not split an HTML tag")
+	}
+
+	apiKey, aiProvider, err := resolveProvider(payload.APIKeyID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	original := string(content[payload.Start:payload.End])
+	messages := buildInlineEditPrompt(chapter, content, payload, label)
+	replacement, _, err := collectCompletion(ctx, aiProvider, messages, model.ChatConfig{Model: apiKey.DefaultModel})
+	if err != nil {
+		return nil, err
+	}
+	if m := codeFenceRegex.FindStringSubmatch(replacement); m != nil {
+		replacement = strings.TrimSpace(m[1])
+	}
+	if replacement == "" {
+		return nil, errors.New("the AI returned an empty result")
+	}
+
+	return &dto.ChapterEditDiffDTO{
+		ChapterID:   chapter.ID.String(),
+		BaseHash:    novelService.ChapterContentHash(chapter.Content),
+		Operation:   payload.Operation,
+		Start:       payload.Start,
+		End:         payload.End,
+		Original:    original,
+		Replacement: replacement,
+		Hunks:       diffHunks(original, replacement, payload.Start),
+	}, nil
+}
+
+// AcceptInlineEdit applies the accepted hunks to the chapter and records history.
+func AcceptInlineEdit(userID uint, payload dto.AcceptInlineEditPayload) (*novelModel.Chapter, error) {
+	edits := make([]novelDto.ChapterTextEdit, len(payload.Hunks))
+	for i, hunk := range payload.Hunks {
+		edits[i] = novelDto.ChapterTextEdit{Start: hunk.Start, End: hunk.End, Text: hunk.Replacement}
+	}
+	label := "AI 编辑"
+	if opLabel, ok := inlineEditLabels[payload.Operation]; ok {
+		label = "AI " + opLabel
+	}
+	return novelService.ApplyChapterEdits(payload.ChapterID, userID, payload.BaseHash, edits, label)
+}
+
+func buildInlineEditPrompt(chapter *novelModel.Chapter, content []rune, payload dto.InlineEditPayload, label string) []model.ChatMessage {
+	var instruction string
+	switch payload.Operation {
+	case InlineEditRewrite:
+		instruction = "改写选中的片段，保持原意与情节不变，使文字更流畅、更有表现力。"
+	case InlineEditExpand:
+		instruction = "扩写选中的片段，补充细节、动作与描写，篇幅约为原文的 1.5 到 2 倍。"
+	case InlineEditShorten:
+		instruction = "缩写选中的片段，保留关键情节与信息，篇幅约为原文的一半。"
+	case InlineEditTone:
+		instruction = "调整选中片段的语气与风格，使其" + payload.Tone + "，情节保持不变。"
+	}
+	if payload.Instruction != "" {
+		instruction += "\n补充要求：" + payload.Instruction
+	}
+
+	before := content[max(0, payload.Start-inlineEditContextRunes):payload.Start]
+	after := content[payload.End:min(len(content), payload.End+inlineEditContextRunes)]
+
+	system := "你是一名小说编辑，负责" + label + "章节中的选中片段。" +
+		"选中片段是 HTML，请保留其中的 HTML 标签结构（段落、强调等），只输出修改后的片段本身，" +
+		"不要输出解释、前后文或代码块标记。"
+	user := fmt.Sprintf("章节：《%s》\n\n前文：\n%s\n\n选中片段：\n%s\n\n后文：\n%s\n\n任务：%s",
+		chapter.Title,
+		stripTags(string(before)),
+		string(content[payload.Start:payload.End]),
+		stripTags(string(after)),
+		instruction,
+	)
+	return []model.ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: user},
+	}
+}
+
+// insideTag reports whether offset pos of content lies between a '<' and its '>'.
+func insideTag(content []rune, pos int) bool {
+	for i := pos - 1; i >= 0; i-- {
+		switch content[i] {
+		case '>':
+			return false
+		case '<':
+			return true
+		}
+	}
+	return false
+}
+
+func stripTags(s string) string {
+	return strings.TrimSpace(htmlTagRegex.ReplaceAllString(s, ""))
+}
+
+// diffTokens splits HTML into tags, runs of letters/digits (Latin words) and
+// single characters, which is the granularity hunks are reported at.
+func diffTokens(s string) []string {
+	var tokens []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		switch {
+		case runes[i] == '<':
+			for j < len(runes) && runes[j-1] != '>' {
+				j++
+			}
+		case runes[i] < unicode.MaxASCII && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])):
+			for j < len(runes) && runes[j] < unicode.MaxASCII && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+		}
+		tokens = append(tokens, string(runes[i:j]))
+		i = j
+	}
+	return tokens
+}
+
+// diffHunks compares original and replacement token by token (longest common
+// subsequence) and returns the changed regions. offset is the position of
+// original within the chapter content.
+func diffHunks(original, replacement string, offset int) []dto.DiffHunkDTO {
+	a, b := diffTokens(original), diffTokens(replacement)
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	script := make([]byte, 0, len(a)+len(b))
+	for k := 0; k < prefix; k++ {
+		script = append(script, '=')
+	}
+	if len(midA)*len(midB) > maxDiffCells {
+		// 计算量过大时把不同的部分整体作为一个修改块
+		for range midA {
+			script = append(script, '-')
+		}
+		for range midB {
+			script = append(script, '+')
+		}
+	} else {
+		script = appendTokenScript(script, midA, midB)
+	}
+	for k := 0; k < suffix; k++ {
+		script = append(script, '=')
+	}
+
+	var hunks []dto.DiffHunkDTO
+	var current *dto.DiffHunkDTO
+	pos := offset
+	i, j := 0, 0
+	for _, op := range script {
+		if op == '=' {
+			if current != nil {
+				hunks = append(hunks, *current)
+				current = nil
+			}
+			pos += len([]rune(a[i]))
+			i++
+			j++
+			continue
+		}
+		if current == nil {
+			current = &dto.DiffHunkDTO{Start: pos, End: pos}
+		}
+		if op == '+' {
+			current.Replacement += b[j]
+			j++
+		} else {
+			current.Original += a[i]
+			pos += len([]rune(a[i]))
+			current.End = pos
+			i++
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+	return hunks
+}
+
+// appendTokenScript appends an edit script turning a into b to script: '=' keeps
+// a token, '-' deletes one of a and '+' inserts one of b. It finds a longest
+// common subsequence with Hirschberg's algorithm, which needs memory linear in
+// the input instead of a full table.
+func appendTokenScript(script []byte, a, b []string) []byte {
+	switch {
+	case len(a) == 0:
+		for range b {
+			script = append(script, '+')
+		}
+		return script
+	case len(b) == 0:
+		for range a {
+			script = append(script, '-')
+		}
+		return script
+	case len(a) == 1:
+		for j := range b {
+			if b[j] == a[0] {
+				for k := 0; k < j; k++ {
+					script = append(script, '+')
+				}
+				script = append(script, '=')
+				for k := j + 1; k < len(b); k++ {
+					script = append(script, '+')
+				}
+				return script
+			}
+		}
+		script = append(script, '-')
+		for range b {
+			script = append(script, '+')
+		}
+		return script
+	}
+
+	// 以 a 的中点切分，找到使两半公共子序列之和最大的 b 的切分点
+	mid := len(a) / 2
+	forward := lcsLastRow(a[:mid], b, false)
+	backward := lcsLastRow(a[mid:], b, true)
+	split, best := 0, -1
+	for k := 0; k <= len(b); k++ {
+		if total := forward[k] + backward[len(b)-k]; total > best {
+			split, best = k, total
+		}
+	}
+	script = appendTokenScript(script, a[:mid], b[:split])
+	return appendTokenScript(script, a[mid:], b[split:])
+}
+
+// lcsLastRow returns, for every prefix length k of b, the length of the longest
+// common subsequence of a and b[:k]. With reverse set, a and b are read back to
+// front, so the value at k is for a and the last k tokens of b.
+func lcsLastRow(a, b []string, reverse bool) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		ai := a[i]
+		if reverse {
+			ai = a[len(a)-1-i]
+		}
+		for j := range b {
+			bj := b[j]
+			if reverse {
+				bj = b[len(b)-1-j]
+			}
+			if ai == bj {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"log"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/moderation"
+	"st-novel-go/src/ai/provider"
+	settingsModel "st-novel-go/src/settings/model"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// moderationOverlap 为流式增量审核时回看的字节数，使跨 chunk 的关键词也能命中
+	moderationOverlap  = 256
+	moderationExcerpt  = 100
+	defaultLogPageSize = 50
+	maxLogPageSize     = 200
+)
+
+// ModerationBlockedError is returned when moderation blocks a prompt or a completion.
+type ModerationBlockedError struct {
+	Result *model.ModerationResult
+}
+
+func (e *ModerationBlockedError) Error() string {
+	return "blocked by content moderation: " + e.Result.Reason
+}
+
+// withModeration wraps aiProvider so that prompts are checked before they are sent
+// and completions after they are generated. It returns aiProvider unchanged when
+// moderation is disabled.
+func withModeration(aiProvider provider.AIProvider, userID uint, apiKey *settingsModel.APIKey) provider.AIProvider {
+	chain := moderation.Default()
+	if len(chain) == 0 {
+		return aiProvider
+	}
+	return &moderatedProvider{inner: aiProvider, chain: chain, userID: userID, apiKey: apiKey}
+}
+
+type moderatedProvider struct {
+	inner  provider.AIProvider
+	chain  moderation.Chain
+	userID uint
+	apiKey *settingsModel.APIKey
+}
+
+// check runs chain on text and logs any result.
+func (p *moderatedProvider) check(ctx context.Context, chain moderation.Chain, stage string, text string) *model.ModerationResult {
+	result := chain.Check(ctx, stage, text)
+	if result != nil {
+		p.log(result, text)
+	}
+	return result
+}
+
+func (p *moderatedProvider) log(result *model.ModerationResult, text string) {
+	entry := &model.ModerationLog{
+		UserID:   p.userID,
+		APIKeyID: p.apiKey.ID,
+		Stage:    result.Stage,
+		Action:   result.Action,
+		Category: result.Category,
+		Source:   result.Source,
+		Reason:   truncateRunes(result.Reason, 500),
+		Excerpt:  moderationExcerptOf(text, result.Matches),
+	}
+	if err := dao.CreateModerationLog(entry); err != nil {
+		log.Printf("[moderation_service] Failed to log moderation result for user %d: %v", p.userID, err)
+	}
+}
+
+// checkPrompt checks what the user wrote. System messages such as the novel context
+// are not checked.
+func (p *moderatedProvider) checkPrompt(ctx context.Context, messages []model.ChatMessage) (*model.ModerationResult, error) {
+	var parts []string
+	for _, msg := range messages {
+		if msg.Role == "user" {
+			parts = append(parts, msg.Content)
+		}
+	}
+	result := p.check(ctx, p.chain, model.ModerationStagePrompt, strings.Join(parts, "\n"))
+	if result != nil && result.Action == model.ModerationBlock {
+		return nil, &ModerationBlockedError{Result: result}
+	}
+	return result, nil
+}
+
+func (p *moderatedProvider) Chat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (*model.ChatResponse, error) {
+	if _, err := p.checkPrompt(ctx, messages); err != nil {
+		return nil, err
+	}
+	resp, err := p.inner.Chat(ctx, messages, config)
+	if err != nil {
+		return nil, err
+	}
+	if result := p.check(ctx, p.chain, model.ModerationStageCompletion, resp.Content); result != nil && result.Action == model.ModerationBlock {
+		return nil, &ModerationBlockedError{Result: result}
+	}
+	return resp, nil
+}
+
+// StreamChat checks partial completions with the incremental moderators as chunks
+// arrive, and the finished completion with every moderator. When the chain has
+// moderators that only check the finished completion, the chunks are held back
+// until they have passed. A blocked completion ends with a moderation event and an
+// error event instead of the done event; the chunk that triggered the block is not
+// forwarded.
+func (p *moderatedProvider) StreamChat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (<-chan model.StreamResponse, error) {
+	promptResult, err := p.checkPrompt(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	providerChan, err := p.inner.StreamChat(ctx, messages, config)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan model.StreamResponse)
+	go func() {
+		// 先关闭 out 再读完上游，保证提供商的 goroutine 能退出而调用方不必等待
+		defer func() {
+			for range providerChan {
+			}
+		}()
+		defer close(out)
+		send := func(chunk model.StreamResponse) bool {
+			select {
+			case out <- chunk:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		reported := make(map[string]bool)
+		report := func(result *model.ModerationResult) bool {
+			key := result.Stage + "|" + result.Action + "|" + result.Category + "|" + result.Reason
+			if reported[key] {
+				return true
+			}
+			reported[key] = true
+			return send(model.StreamResponse{Event: "moderation", Moderation: result})
+		}
+		block := func(result *model.ModerationResult) {
+			if report(result) {
+				send(model.StreamResponse{Event: "error", Error: (&ModerationBlockedError{Result: result}).Error(), Done: true})
+			}
+		}
+
+		if promptResult != nil && !report(promptResult) {
+			return
+		}
+
+		incremental := p.chain.Incremental()
+		// 存在只能审核完整回复的审核器时，先缓存 chunk，待最终审核通过后再发出
+		buffering := len(incremental) < len(p.chain)
+		var held []model.StreamResponse
+		var sb strings.Builder
+		checked := 0
+		// finish 审核完整回复，通过后发出缓存的 chunk
+		finish := func() bool {
+			if result := p.check(ctx, p.chain, model.ModerationStageCompletion, sb.String()); result != nil {
+				if result.Action == model.ModerationBlock {
+					block(result)
+					return false
+				}
+				if !report(result) {
+					return false
+				}
+			}
+			for _, h := range held {
+				if !send(h) {
+					return false
+				}
+			}
+			held = nil
+			return true
+		}
+		done := false
+		for chunk := range providerChan {
+			done = done || chunk.Done
+			switch {
+			case chunk.Event == "chunk" && len(incremental) > 0:
+				sb.WriteString(chunk.Content)
+				text := sb.String()
+				from := checked - moderationOverlap
+				if from < 0 {
+					from = 0
+				}
+				for from > 0 && !utf8.RuneStart(text[from]) {
+					from--
+				}
+				checked = len(text)
+				if result := p.check(ctx, incremental, model.ModerationStageCompletion, text[from:]); result != nil {
+					if result.Action == model.ModerationBlock {
+						block(result)
+						return
+					}
+					if !report(result) {
+						return
+					}
+				}
+			case chunk.Event == "chunk":
+				sb.WriteString(chunk.Content)
+			case chunk.Done && chunk.Error == "":
+				if !finish() {
+					return
+				}
+			}
+			if buffering && !chunk.Done {
+				held = append(held, chunk)
+				continue
+			}
+			if !send(chunk) {
+				return
+			}
+		}
+		// 上游未发送 done 就结束时同样要做最终审核
+		if !done && sb.Len() > 0 {
+			finish()
+		}
+	}()
+	return out, nil
+}
+
+// moderationExcerptOf returns the text around the first match, or the start of the
+// text when there is no match to locate.
+func moderationExcerptOf(text string, matches []string) string {
+	start := 0
+	lower := strings.ToLower(text)
+	for _, match := range matches {
+		if i := strings.Index(lower, strings.ToLower(match)); i >= 0 {
+			start = utf8.RuneCountInString(text[:i])
+			break
+		}
+	}
+	runes := []rune(text)
+	from := start - moderationExcerpt/2
+	if from < 0 {
+		from = 0
+	}
+	to := from + moderationExcerpt
+	if to > len(runes) {
+		to = len(runes)
+	}
+	return string(runes[from:to])
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// GetModerationLogs lists moderation logs for admins, newest first.
+func GetModerationLogs(userID uint, action string, page, pageSize int) (*dto.ModerationLogPageDTO, error) {
+	if pageSize <= 0 {
+		pageSize = defaultLogPageSize
+	} else if pageSize > maxLogPageSize {
+		pageSize = maxLogPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+	logs, total, err := dao.GetModerationLogs(userID, action, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]dto.ModerationLogDTO, len(logs))
+	for i, entry := range logs {
+		items[i] = dto.ModerationLogDTO{
+			ID:        entry.ID,
+			UserID:    entry.UserID,
+			Stage:     entry.Stage,
+			Action:    entry.Action,
+			Category:  entry.Category,
+			Source:    entry.Source,
+			Reason:    entry.Reason,
+			Excerpt:   entry.Excerpt,
+			CreatedAt: entry.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	return &dto.ModerationLogPageDTO{Items: items, Total: total, Page: page, PageSize: pageSize}, nil
+}
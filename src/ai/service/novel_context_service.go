@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"regexp"
+	"st-novel-go/src/ai/model"
+	novelDao "st-novel-go/src/novel/dao"
+	novelModel "st-novel-go/src/novel/model"
+	"strings"
+)
+
+// novelContextChapterRunes 为附带的章节正文的最大字数
+const novelContextChapterRunes = 3000
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// resolveConversationLinks validates that the novel and chapter belong to the user
+// and returns their IDs. When only a chapter is given the novel is taken from it.
+func resolveConversationLinks(userID uint, novelID string, chapterID string) (*uuid.UUID, *uuid.UUID, error) {
+	var novelUUID, chapterUUID *uuid.UUID
+	if chapterID != "" {
+		chapter, err := novelDao.FindChapterByID(chapterID)
+		if err != nil {
+			return nil, nil, errors.New("chapter not found")
+		}
+		if novelID != "" && novelID != chapter.NovelID.String() {
+			return nil, nil, errors.New("chapter does not belong to the specified novel")
+		}
+		chapterUUID = &chapter.ID
+		novelID = chapter.NovelID.String()
+	}
+	if novelID != "" {
+		novel, err := novelDao.FindNovelWithRole(novelID, userID, novelModel.RoleViewer)
+		if err != nil {
+			return nil, nil, errors.New("novel not found or permission denied")
+		}
+		novelUUID = &novel.ID
+	}
+	return novelUUID, chapterUUID, nil
+}
+
+// buildNovelContext describes the novel and chapter a conversation is linked to,
+// for use as a system prompt. It returns an empty string for unlinked conversations.
+func buildNovelContext(conv *model.Conversation) string {
+	if conv == nil || conv.NovelID == nil {
+		return ""
+	}
+	novel, err := novelDao.FindNovelWithRole(conv.NovelID.String(), conv.UserID, novelModel.RoleViewer)
+	if err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("你正在协助作者创作小说《" + novel.Title + "》。\n")
+	if novel.Category != "" {
+		sb.WriteString("分类：" + novel.Category + "\n")
+	}
+	var tags []struct {
+		Text string `json:"text"`
+	}
+	_ = json.Unmarshal(novel.Tags, &tags)
+	if len(tags) > 0 {
+		names := make([]string, len(tags))
+		for i, tag := range tags {
+			names[i] = tag.Text
+		}
+		sb.WriteString("标签：" + strings.Join(names, "、") + "\n")
+	}
+	if novel.Description != "" {
+		sb.WriteString("简介：" + novel.Description + "\n")
+	}
+
+	if conv.ChapterID != nil {
+		if chapter, err := novelDao.FindChapterByID(conv.ChapterID.String()); err == nil && chapter.NovelID == novel.ID {
+			sb.WriteString("\n当前讨论的章节：《" + chapter.Title + "》\n")
+			text := []rune(strings.TrimSpace(htmlTagRegex.ReplaceAllString(chapter.Content, "")))
+			if len(text) > novelContextChapterRunes {
+				text = append(text[:novelContextChapterRunes], []rune("……（以下省略）")...)
+			}
+			if len(text) > 0 {
+				sb.WriteString("章节正文：\n" + string(text) + "\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// withNovelContext prepends the conversation's novel context to messages, merging
+// it into an existing leading system message since some providers accept only one.
+func withNovelContext(conv *model.Conversation, messages []model.ChatMessage) []model.ChatMessage {
+	novelContext := buildNovelContext(conv)
+	if novelContext == "" {
+		return messages
+	}
+	if len(messages) > 0 && messages[0].Role == "system" {
+		merged := append([]model.ChatMessage{}, messages...)
+		merged[0].Content = novelContext + "\n" + merged[0].Content
+		return merged
+	}
+	return append([]model.ChatMessage{{Role: "system", Content: novelContext}}, messages...)
+}
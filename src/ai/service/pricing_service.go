@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	settingsDao "st-novel-go/src/settings/dao"
+	settingsModel "st-novel-go/src/settings/model"
+	"strings"
+)
+
+// computeCost prices a call in US dollars. A price set on the key wins over the
+// global catalogue; within each, the longest matching model prefix wins.
+func computeCost(apiKey *settingsModel.APIKey, modelName string, promptTokens, completionTokens int) float64 {
+	prices, err := dao.GetPriceCandidates(string(apiKey.Provider), apiKey.ID)
+	if err != nil {
+		log.Printf("[pricing_service] Failed to load prices for %s: %v", apiKey.Provider, err)
+		return 0
+	}
+
+	var best *model.ModelPrice
+	for i := range prices {
+		price := &prices[i]
+		if !strings.HasPrefix(modelName, price.Model) {
+			continue
+		}
+		if best == nil ||
+			(price.APIKeyID != 0 && best.APIKeyID == 0) ||
+			(price.APIKeyID == best.APIKeyID && len(price.Model) > len(best.Model)) {
+			best = price
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return (float64(promptTokens)*best.InputPrice + float64(completionTokens)*best.OutputPrice) / 1e6
+}
+
+func GetModelPrices() ([]dto.ModelPriceDTO, error) {
+	prices, err := dao.GetGlobalModelPrices()
+	if err != nil {
+		return nil, err
+	}
+	return mapModelPricesToDTO(prices), nil
+}
+
+func CreateModelPrice(payload dto.ModelPricePayload) (*dto.ModelPriceDTO, error) {
+	if err := validateModelPrice(payload); err != nil {
+		return nil, err
+	}
+	if payload.Provider == "" {
+		return nil, errors.New("provider is required")
+	}
+	price := &model.ModelPrice{
+		Provider:    payload.Provider,
+		Model:       payload.Model,
+		InputPrice:  payload.InputPrice,
+		OutputPrice: payload.OutputPrice,
+	}
+	if err := dao.UpsertModelPrice(price); err != nil {
+		return nil, err
+	}
+	priceDTO := mapModelPriceToDTO(*price)
+	return &priceDTO, nil
+}
+
+func UpdateModelPrice(id uint, payload dto.ModelPricePayload) (*dto.ModelPriceDTO, error) {
+	if err := validateModelPrice(payload); err != nil {
+		return nil, err
+	}
+	price, err := dao.FindModelPriceByID(id)
+	if err != nil || price.APIKeyID != 0 {
+		return nil, errors.New("model price not found")
+	}
+	if payload.Provider != "" {
+		price.Provider = payload.Provider
+	}
+	price.Model = payload.Model
+	price.InputPrice = payload.InputPrice
+	price.OutputPrice = payload.OutputPrice
+	if err := dao.UpdateModelPrice(price); err != nil {
+		return nil, err
+	}
+	priceDTO := mapModelPriceToDTO(*price)
+	return &priceDTO, nil
+}
+
+func DeleteModelPrice(id uint) error {
+	price, err := dao.FindModelPriceByID(id)
+	if err != nil || price.APIKeyID != 0 {
+		return errors.New("model price not found")
+	}
+	return dao.DeleteModelPrice(id)
+}
+
+// GetKeyModelPrices returns the price overrides of one of the user's keys.
+func GetKeyModelPrices(apiKeyID uint, userID uint) ([]dto.ModelPriceDTO, error) {
+	if _, err := settingsDao.GetAPIKeyByID(apiKeyID, userID); err != nil {
+		return nil, errors.New("invalid API key ID or permission denied")
+	}
+	prices, err := dao.GetModelPricesForKey(apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return mapModelPricesToDTO(prices), nil
+}
+
+// SetKeyModelPrice overrides the catalogue price of a model for one key, e.g. for
+// a proxy or a negotiated rate.
+func SetKeyModelPrice(apiKeyID uint, userID uint, payload dto.ModelPricePayload) (*dto.ModelPriceDTO, error) {
+	apiKey, err := settingsDao.GetAPIKeyByID(apiKeyID, userID)
+	if err != nil {
+		return nil, errors.New("invalid API key ID or permission denied")
+	}
+	if err := validateModelPrice(payload); err != nil {
+		return nil, err
+	}
+	price := &model.ModelPrice{
+		Provider:    string(apiKey.Provider),
+		Model:       payload.Model,
+		APIKeyID:    apiKey.ID,
+		InputPrice:  payload.InputPrice,
+		OutputPrice: payload.OutputPrice,
+	}
+	if err := dao.UpsertModelPrice(price); err != nil {
+		return nil, err
+	}
+	priceDTO := mapModelPriceToDTO(*price)
+	return &priceDTO, nil
+}
+
+func DeleteKeyModelPrice(apiKeyID uint, userID uint, modelName string) error {
+	if _, err := settingsDao.GetAPIKeyByID(apiKeyID, userID); err != nil {
+		return errors.New("invalid API key ID or permission denied")
+	}
+	return dao.DeleteKeyModelPrice(apiKeyID, modelName)
+}
+
+func validateModelPrice(payload dto.ModelPricePayload) error {
+	if payload.InputPrice < 0 || payload.OutputPrice < 0 {
+		return errors.New("prices must not be negative")
+	}
+	return nil
+}
+
+func mapModelPricesToDTO(prices []model.ModelPrice) []dto.ModelPriceDTO {
+	priceDTOs := make([]dto.ModelPriceDTO, len(prices))
+	for i, price := range prices {
+		priceDTOs[i] = mapModelPriceToDTO(price)
+	}
+	return priceDTOs
+}
+
+func mapModelPriceToDTO(price model.ModelPrice) dto.ModelPriceDTO {
+	return dto.ModelPriceDTO{
+		ID:          price.ID,
+		Provider:    price.Provider,
+		Model:       price.Model,
+		APIKeyID:    price.APIKeyID,
+		InputPrice:  price.InputPrice,
+		OutputPrice: price.OutputPrice,
+	}
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/provider"
+	"st-novel-go/src/config"
+	settingsDao "st-novel-go/src/settings/dao"
+	settingsModel "st-novel-go/src/settings/model"
+	userDao "st-novel-go/src/user/dao"
+	userModel "st-novel-go/src/user/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuotaExceededError is returned before an AI call is dispatched when the user has
+// used up one of their limits.
+type QuotaExceededError struct {
+	Reason string
+	// RateLimited 表示仅触发了每分钟请求数限制，稍后即可重试
+	RateLimited bool
+}
+
+func (e *QuotaExceededError) Error() string {
+	return "quota exceeded: " + e.Reason
+}
+
+// defaultPlanQuotas 在配置文件未设置对应套餐时使用
+var defaultPlanQuotas = map[userModel.PlanType]config.QuotaLimits{
+	userModel.PlanFree: {DailyTokens: 200000, MonthlyTokens: 2000000, RequestsPerMinute: 10, DailyCost: 0.5, MonthlyCost: 5},
+	userModel.PlanPro:  {DailyTokens: 2000000, MonthlyTokens: 50000000, RequestsPerMinute: 60, DailyCost: 10, MonthlyCost: 100},
+}
+
+// requestWindow counts each user's requests over the last minute. It is kept in
+// memory, so the limit applies per server instance.
+type requestWindow struct {
+	mu       sync.Mutex
+	requests map[uint][]time.Time
+}
+
+var recentRequests = &requestWindow{requests: make(map[uint][]time.Time)}
+
+// allow records a request unless the user already made limit requests in the last
+// minute. A limit of 0 disables the check.
+func (w *requestWindow) allow(userID uint, limit int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	recent := w.prune(userID)
+	if limit > 0 && len(recent) >= limit {
+		return false
+	}
+	w.requests[userID] = append(recent, time.Now())
+	return true
+}
+
+func (w *requestWindow) count(userID uint) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.prune(userID))
+}
+
+func (w *requestWindow) prune(userID uint) []time.Time {
+	cutoff := time.Now().Add(-time.Minute)
+	recent := w.requests[userID]
+	i := 0
+	for i < len(recent) && recent[i].Before(cutoff) {
+		i++
+	}
+	recent = recent[i:]
+	if len(recent) == 0 {
+		delete(w.requests, userID)
+	} else {
+		w.requests[userID] = recent
+	}
+	return recent
+}
+
+// effectiveQuota returns the user's plan and the limits that apply to them.
+func effectiveQuota(userID uint) (userModel.PlanType, config.QuotaLimits, error) {
+	user, err := userDao.FindUserByID(userID)
+	if err != nil {
+		return "", config.QuotaLimits{}, errors.New("user not found")
+	}
+	limits, ok := config.AppConfig.Quota.Plans[string(user.Plan)]
+	if !ok {
+		limits = defaultPlanQuotas[user.Plan]
+	}
+
+	override, err := dao.GetAIQuotaOverride(userID)
+	if err != nil {
+		return "", config.QuotaLimits{}, err
+	}
+	if override != nil {
+		if override.DailyTokens != nil {
+			limits.DailyTokens = *override.DailyTokens
+		}
+		if override.MonthlyTokens != nil {
+			limits.MonthlyTokens = *override.MonthlyTokens
+		}
+		if override.RequestsPerMinute != nil {
+			limits.RequestsPerMinute = *override.RequestsPerMinute
+		}
+		if override.DailyCost != nil {
+			limits.DailyCost = *override.DailyCost
+		}
+		if override.MonthlyCost != nil {
+			limits.MonthlyCost = *override.MonthlyCost
+		}
+	}
+	return user.Plan, limits, nil
+}
+
+func quotaPeriodStarts(now time.Time) (time.Time, time.Time) {
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return dayStart, monthStart
+}
+
+// checkQuota returns a QuotaExceededError when the user may not make another AI
+// call right now. A successful check counts as a request for the per-minute limit.
+func checkQuota(userID uint) error {
+	_, limits, err := effectiveQuota(userID)
+	if err != nil {
+		return err
+	}
+
+	dayStart, monthStart := quotaPeriodStarts(time.Now())
+	if limits.DailyTokens > 0 || limits.DailyCost > 0 {
+		daily, err := dao.SumUsageSince(userID, dayStart)
+		if err != nil {
+			return err
+		}
+		if limits.DailyTokens > 0 && daily.PromptTokens+daily.CompletionTokens >= limits.DailyTokens {
+			return &QuotaExceededError{Reason: fmt.Sprintf("daily limit of %d tokens reached", limits.DailyTokens)}
+		}
+		if limits.DailyCost > 0 && daily.Cost >= limits.DailyCost {
+			return &QuotaExceededError{Reason: fmt.Sprintf("daily spending limit of $%.2f reached", limits.DailyCost)}
+		}
+	}
+	if limits.MonthlyTokens > 0 || limits.MonthlyCost > 0 {
+		monthly, err := dao.SumUsageSince(userID, monthStart)
+		if err != nil {
+			return err
+		}
+		if limits.MonthlyTokens > 0 && monthly.PromptTokens+monthly.CompletionTokens >= limits.MonthlyTokens {
+			return &QuotaExceededError{Reason: fmt.Sprintf("monthly limit of %d tokens reached", limits.MonthlyTokens)}
+		}
+		if limits.MonthlyCost > 0 && monthly.Cost >= limits.MonthlyCost {
+			return &QuotaExceededError{Reason: fmt.Sprintf("monthly spending limit of $%.2f reached", limits.MonthlyCost)}
+		}
+	}
+	if !recentRequests.allow(userID, limits.RequestsPerMinute) {
+		return &QuotaExceededError{Reason: fmt.Sprintf("rate limit of %d requests per minute reached", limits.RequestsPerMinute), RateLimited: true}
+	}
+	return nil
+}
+
+// GetQuotaStatus returns the user's limits, current usage and what remains.
+// Remaining values of -1 mean unlimited.
+func GetQuotaStatus(userID uint) (*dto.QuotaStatusDTO, error) {
+	plan, limits, err := effectiveQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+	dayStart, monthStart := quotaPeriodStarts(time.Now())
+	daily, err := dao.SumUsageSince(userID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := dao.SumUsageSince(userID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := dto.QuotaUsageDTO{
+		DailyTokens:       daily.PromptTokens + daily.CompletionTokens,
+		MonthlyTokens:     monthly.PromptTokens + monthly.CompletionTokens,
+		RequestsPerMinute: int64(recentRequests.count(userID)),
+		DailyCost:         daily.Cost,
+		MonthlyCost:       monthly.Cost,
+	}
+	return &dto.QuotaStatusDTO{
+		Plan:   string(plan),
+		Limits: limits,
+		Usage:  usage,
+		Remaining: dto.QuotaUsageDTO{
+			DailyTokens:       remainingInt(limits.DailyTokens, usage.DailyTokens),
+			MonthlyTokens:     remainingInt(limits.MonthlyTokens, usage.MonthlyTokens),
+			RequestsPerMinute: remainingInt(int64(limits.RequestsPerMinute), usage.RequestsPerMinute),
+			DailyCost:         remainingFloat(limits.DailyCost, usage.DailyCost),
+			MonthlyCost:       remainingFloat(limits.MonthlyCost, usage.MonthlyCost),
+		},
+	}, nil
+}
+
+// SetQuotaOverride replaces the per-user limits of userID. Fields left nil use the
+// plan limits.
+func SetQuotaOverride(userID uint, payload dto.UpdateQuotaOverridePayload) (*dto.QuotaStatusDTO, error) {
+	if _, err := userDao.FindUserByID(userID); err != nil {
+		return nil, errors.New("user not found")
+	}
+	override := &model.AIQuotaOverride{
+		UserID:            userID,
+		DailyTokens:       payload.DailyTokens,
+		MonthlyTokens:     payload.MonthlyTokens,
+		RequestsPerMinute: payload.RequestsPerMinute,
+		DailyCost:         payload.DailyCost,
+		MonthlyCost:       payload.MonthlyCost,
+	}
+	if err := dao.SaveAIQuotaOverride(override); err != nil {
+		return nil, err
+	}
+	return GetQuotaStatus(userID)
+}
+
+func DeleteQuotaOverride(userID uint) error {
+	return dao.DeleteAIQuotaOverride(userID)
+}
+
+func remainingInt(limit, used int64) int64 {
+	if limit <= 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+func remainingFloat(limit, used float64) float64 {
+	if limit <= 0 {
+		return -1
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// meteredProvider records the token usage and cost of every call made through it.
+// With checkEachCall set it also checks the quota before every call, for callers
+// that make many calls after resolving the provider once.
+type meteredProvider struct {
+	inner         provider.AIProvider
+	userID        uint
+	apiKey        *settingsModel.APIKey
+	checkEachCall bool
+}
+
+func newMeteredProvider(inner provider.AIProvider, userID uint, apiKey *settingsModel.APIKey) provider.AIProvider {
+	return &meteredProvider{inner: inner, userID: userID, apiKey: apiKey}
+}
+
+// newQuotaCheckedProvider is newMeteredProvider with a quota check before every call.
+func newQuotaCheckedProvider(inner provider.AIProvider, userID uint, apiKey *settingsModel.APIKey) provider.AIProvider {
+	return &meteredProvider{inner: inner, userID: userID, apiKey: apiKey, checkEachCall: true}
+}
+
+func (p *meteredProvider) Chat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (*model.ChatResponse, error) {
+	if p.checkEachCall {
+		if err := checkQuota(p.userID); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := p.inner.Chat(ctx, messages, config)
+	if err != nil {
+		return nil, err
+	}
+	p.record(messages, config, resp.Content, nil)
+	return resp, nil
+}
+
+func (p *meteredProvider) StreamChat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (<-chan model.StreamResponse, error) {
+	if p.checkEachCall {
+		if err := checkQuota(p.userID); err != nil {
+			return nil, err
+		}
+	}
+	providerChan, err := p.inner.StreamChat(ctx, messages, config)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan model.StreamResponse)
+	go func() {
+		defer close(out)
+		var sb strings.Builder
+		var usage *model.TokenUsage
+		delivering := true
+		// 调用方停止读取后仍读完提供商的流，以便记录用量
+		for chunk := range providerChan {
+			if chunk.Event == "chunk" {
+				sb.WriteString(chunk.Content)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			if delivering {
+				select {
+				case out <- chunk:
+				case <-ctx.Done():
+					delivering = false
+				}
+			}
+		}
+		p.record(messages, config, sb.String(), usage)
+	}()
+	return out, nil
+}
+
+func (p *meteredProvider) record(messages []model.ChatMessage, config model.ChatConfig, completion string, usage *model.TokenUsage) {
+	record := &model.AIUsageRecord{
+		UserID:   p.userID,
+		APIKeyID: p.apiKey.ID,
+		Provider: string(p.apiKey.Provider),
+		Model:    config.Model,
+	}
+	if record.Model == "" {
+		record.Model = p.apiKey.DefaultModel
+	}
+	if usage != nil {
+		record.PromptTokens = usage.PromptTokens
+		record.CompletionTokens = usage.CompletionTokens
+	} else {
+		// 提供商未返回用量时按字数估算
+		for _, msg := range messages {
+			record.PromptTokens += estimateTokens(msg.Content)
+		}
+		record.CompletionTokens = estimateTokens(completion)
+		record.Estimated = true
+	}
+	record.Cost = computeCost(p.apiKey, record.Model, record.PromptTokens, record.CompletionTokens)
+	if err := dao.CreateUsageRecord(record); err != nil {
+		log.Printf("[quota_service] Failed to record AI usage for user %d: %v", p.userID, err)
+	}
+	if err := settingsDao.IncrementAPIKeyCalls(p.apiKey.ID); err != nil {
+		log.Printf("[quota_service] Failed to count call of API key %d: %v", p.apiKey.ID, err)
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"st-novel-go/src/ai/cache"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/provider"
+	"st-novel-go/src/config"
+	settingsModel "st-novel-go/src/settings/model"
+	"strings"
+)
+
+// replayChunkRunes 是缓存命中时每个 chunk 事件携带的字数
+const replayChunkRunes = 24
+
+// cachedResponse is what the response cache stores for one request.
+type cachedResponse struct {
+	Content string            `json:"content"`
+	Usage   *model.TokenUsage `json:"usage,omitempty"`
+}
+
+// withResponseCache wraps aiProvider with the response cache when caching is enabled
+// and the request is deterministic: an explicit temperature of 0 or a task type
+// configured as cacheable. Otherwise aiProvider is returned unchanged.
+func withResponseCache(aiProvider provider.AIProvider, userID uint, apiKey *settingsModel.APIKey, taskType string, config model.ChatConfig) provider.AIProvider {
+	if !cache.Enabled() || !isCacheableRequest(taskType, config) {
+		return aiProvider
+	}
+	// 缓存放在内容审核之内，命中的结果同样经过审核
+	if moderated, ok := aiProvider.(*moderatedProvider); ok {
+		wrapped := *moderated
+		wrapped.inner = &cachingProvider{inner: moderated.inner, store: cache.Default(), userID: userID, apiKey: apiKey}
+		return &wrapped
+	}
+	return &cachingProvider{inner: aiProvider, store: cache.Default(), userID: userID, apiKey: apiKey}
+}
+
+func isCacheableRequest(taskType string, chatConfig model.ChatConfig) bool {
+	if chatConfig.TemperatureSet && chatConfig.Temperature == 0 {
+		return true
+	}
+	for _, cacheable := range config.AppConfig.AICache.CacheableTaskTypes {
+		if taskType != "" && taskType == cacheable {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTemperature sets the temperature of config when the request specified one.
+func applyTemperature(config *model.ChatConfig, temperature *float32) {
+	if temperature != nil {
+		config.Temperature = *temperature
+		config.TemperatureSet = true
+	}
+}
+
+// responseCacheKey hashes everything that affects the response. Messages are
+// normalised so that differences in line endings and surrounding whitespace do not
+// cause a miss. Entries are per user and never shared between accounts.
+func responseCacheKey(userID uint, apiKey *settingsModel.APIKey, messages []model.ChatMessage, config model.ChatConfig) string {
+	modelName := config.Model
+	if modelName == "" {
+		modelName = apiKey.DefaultModel
+	}
+	normalised := make([]model.ChatMessage, len(messages))
+	for i, msg := range messages {
+		role := msg.Role
+		if role == "ai" {
+			role = "assistant"
+		}
+		normalised[i] = model.ChatMessage{
+			Role:    role,
+			Content: strings.TrimSpace(strings.ReplaceAll(msg.Content, "\r\n", "\n")),
+		}
+	}
+
+	data, _ := json.Marshal(struct {
+		UserID      uint                `json:"userId"`
+		Provider    string              `json:"provider"`
+		BaseURL     string              `json:"baseUrl"`
+		Model       string              `json:"model"`
+		Temperature float32             `json:"temperature"`
+		MaxTokens   int                 `json:"maxTokens"`
+		Messages    []model.ChatMessage `json:"messages"`
+	}{userID, string(apiKey.Provider), apiKey.BaseURL, modelName, config.Temperature, config.MaxTokens, normalised})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachingProvider answers from the response cache when it can and stores the
+// responses of successful calls otherwise.
+type cachingProvider struct {
+	inner  provider.AIProvider
+	store  cache.Store
+	userID uint
+	apiKey *settingsModel.APIKey
+}
+
+func (p *cachingProvider) lookup(ctx context.Context, key string) (*cachedResponse, bool) {
+	value, ok, err := p.store.Get(ctx, key)
+	if err != nil {
+		// 缓存不可用时直接调用提供商
+		log.Printf("[response_cache_service] Failed to read response cache: %v", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal([]byte(value), &cached); err != nil {
+		return nil, false
+	}
+	return &cached, true
+}
+
+func (p *cachingProvider) save(key string, cached cachedResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	// 请求的 ctx 可能已被取消，写入缓存不应随之失败
+	if err := p.store.Set(context.Background(), key, string(data), cache.TTL()); err != nil {
+		log.Printf("[response_cache_service] Failed to write response cache: %v", err)
+	}
+}
+
+// recordHit logs a cache hit in the usage log. Hits cost nothing and use no tokens.
+func (p *cachingProvider) recordHit(config model.ChatConfig) {
+	record := &model.AIUsageRecord{
+		UserID:   p.userID,
+		APIKeyID: p.apiKey.ID,
+		Provider: string(p.apiKey.Provider),
+		Model:    config.Model,
+		CacheHit: true,
+	}
+	if record.Model == "" {
+		record.Model = p.apiKey.DefaultModel
+	}
+	if err := dao.CreateUsageRecord(record); err != nil {
+		log.Printf("[response_cache_service] Failed to record cache hit for user %d: %v", p.userID, err)
+	}
+}
+
+func (p *cachingProvider) Chat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (*model.ChatResponse, error) {
+	key := responseCacheKey(p.userID, p.apiKey, messages, config)
+	if cached, ok := p.lookup(ctx, key); ok {
+		p.recordHit(config)
+		return &model.ChatResponse{Content: cached.Content}, nil
+	}
+
+	resp, err := p.inner.Chat(ctx, messages, config)
+	if err != nil {
+		return nil, err
+	}
+	p.save(key, cachedResponse{Content: resp.Content})
+	return resp, nil
+}
+
+func (p *cachingProvider) StreamChat(ctx context.Context, messages []model.ChatMessage, config model.ChatConfig) (<-chan model.StreamResponse, error) {
+	key := responseCacheKey(p.userID, p.apiKey, messages, config)
+	if cached, ok := p.lookup(ctx, key); ok {
+		p.recordHit(config)
+		return replayCachedResponse(ctx, cached), nil
+	}
+
+	providerChan, err := p.inner.StreamChat(ctx, messages, config)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan model.StreamResponse)
+	go func() {
+		defer close(out)
+		var sb strings.Builder
+		var usage *model.TokenUsage
+		complete := false
+		for chunk := range providerChan {
+			switch {
+			case chunk.Error != "":
+				complete = false
+			case chunk.Event == "chunk":
+				sb.WriteString(chunk.Content)
+			case chunk.Done:
+				complete = true
+				usage = chunk.Usage
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				// 调用方已离开，读完剩余事件即可，不完整的结果不缓存
+				for range providerChan {
+				}
+				return
+			}
+		}
+		if complete && sb.Len() > 0 {
+			p.save(key, cachedResponse{Content: sb.String(), Usage: usage})
+		}
+	}()
+	return out, nil
+}
+
+// replayCachedResponse emits a cached response as chunk events followed by a done
+// event, like a provider stream.
+func replayCachedResponse(ctx context.Context, cached *cachedResponse) <-chan model.StreamResponse {
+	out := make(chan model.StreamResponse)
+	go func() {
+		defer close(out)
+		runes := []rune(cached.Content)
+		for start := 0; start < len(runes); start += replayChunkRunes {
+			end := start + replayChunkRunes
+			if end > len(runes) {
+				end = len(runes)
+			}
+			select {
+			case out <- model.StreamResponse{Event: "chunk", Content: string(runes[start:end])}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case out <- model.StreamResponse{Event: "done", Done: true}:
+		case <-ctx.Done():
+		}
+	}()
+	return out
+}
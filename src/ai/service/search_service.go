@@ -0,0 +1,286 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"html"
+	"log"
+	"sort"
+	"st-novel-go/src/ai/dao"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchTerms     = 8
+	// ngramTokenSize 与 MySQL 的 ngram_token_size 默认值一致，更短的词无法走全文索引
+	ngramTokenSize = 2
+
+	searchConversationCandidates = 200
+	searchMessageCandidates      = 500
+	snippetsPerConversation      = 3
+	snippetRunes                 = 80
+	snippetLeadRunes             = 20
+)
+
+// ConversationSearchResultDTO is one conversation matching a search. Title and the
+// snippets are HTML-escaped, with matched terms wrapped in <mark>.
+type ConversationSearchResultDTO struct {
+	ID        string                  `json:"id"`
+	Title     string                  `json:"title"`
+	Summary   string                  `json:"summary"`
+	UpdatedAt string                  `json:"updatedAt"`
+	Score     float64                 `json:"score"`
+	Matches   []SearchMessageMatchDTO `json:"matches"`
+}
+
+// SearchMessageMatchDTO is a matching message. The message may be on an inactive
+// branch; switching the branch to MessageID makes it visible.
+type SearchMessageMatchDTO struct {
+	MessageID string `json:"messageId"`
+	Role      string `json:"role"`
+	Snippet   string `json:"snippet"`
+	Timestamp string `json:"timestamp"`
+}
+
+// SearchConversations finds the user's conversations whose title, summary or
+// messages contain all of the query terms, best matches first.
+func SearchConversations(userID uint, q string, limit int) ([]ConversationSearchResultDTO, error) {
+	terms := parseSearchTerms(q)
+	if len(terms) == 0 {
+		return nil, errors.New("search query is empty")
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	} else if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	useFulltext := true
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < ngramTokenSize {
+			useFulltext = false
+		}
+	}
+	booleanQuery := buildBooleanQuery(terms)
+
+	convHits, msgHits, err := searchHits(userID, booleanQuery, terms, useFulltext)
+	if err != nil && useFulltext {
+		// 全文索引不可用时退回子串匹配
+		log.Printf("[search_service] Full-text search failed, falling back to LIKE: %v", err)
+		convHits, msgHits, err = searchHits(userID, booleanQuery, terms, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[uuid.UUID]*ConversationSearchResultDTO)
+	scores := make(map[uuid.UUID]float64)
+	updatedAt := make(map[uuid.UUID]time.Time)
+	for _, hit := range convHits {
+		results[hit.ID] = &ConversationSearchResultDTO{
+			ID:        hit.ID.String(),
+			Title:     highlightTerms(hit.Title, terms),
+			Summary:   hit.Summary,
+			UpdatedAt: hit.UpdatedAt.Format(time.RFC3339),
+		}
+		// 标题与摘要命中的权重高于单条消息命中
+		scores[hit.ID] += 2 * hit.Score
+		updatedAt[hit.ID] = hit.UpdatedAt
+	}
+
+	var missing []uuid.UUID
+	matchCounts := make(map[uuid.UUID]int)
+	for _, hit := range msgHits {
+		result, ok := results[hit.ConversationID]
+		if !ok {
+			result = &ConversationSearchResultDTO{ID: hit.ConversationID.String()}
+			results[hit.ConversationID] = result
+			missing = append(missing, hit.ConversationID)
+		}
+		// 消息已按得分降序，首条命中即该会话的最高分
+		if matchCounts[hit.ConversationID] == 0 {
+			scores[hit.ConversationID] += hit.Score
+		} else {
+			scores[hit.ConversationID] += 0.1 * hit.Score
+		}
+		matchCounts[hit.ConversationID]++
+		if len(result.Matches) < snippetsPerConversation {
+			result.Matches = append(result.Matches, SearchMessageMatchDTO{
+				MessageID: hit.ID.String(),
+				Role:      hit.Role,
+				Snippet:   buildSnippet(hit.Content, terms),
+				Timestamp: hit.CreatedAt.Format(time.RFC3339),
+			})
+		}
+	}
+
+	convs, err := dao.GetConversationsByIDs(userID, missing)
+	if err != nil {
+		return nil, err
+	}
+	for _, conv := range convs {
+		result := results[conv.ID]
+		result.Title = highlightTerms(conv.Title, terms)
+		result.Summary = conv.Summary
+		result.UpdatedAt = conv.UpdatedAt.Format(time.RFC3339)
+		updatedAt[conv.ID] = conv.UpdatedAt
+	}
+
+	ids := make([]uuid.UUID, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return updatedAt[ids[i]].After(updatedAt[ids[j]])
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	searchResults := make([]ConversationSearchResultDTO, len(ids))
+	for i, id := range ids {
+		searchResults[i] = *results[id]
+		searchResults[i].Score = scores[id]
+		if searchResults[i].Matches == nil {
+			searchResults[i].Matches = []SearchMessageMatchDTO{}
+		}
+	}
+	return searchResults, nil
+}
+
+func searchHits(userID uint, booleanQuery string, terms []string, useFulltext bool) ([]dao.ConversationHit, []dao.MessageHit, error) {
+	convHits, err := dao.SearchConversationHits(userID, booleanQuery, terms, useFulltext, searchConversationCandidates)
+	if err != nil {
+		return nil, nil, err
+	}
+	msgHits, err := dao.SearchMessageHits(userID, booleanQuery, terms, useFulltext, searchMessageCandidates)
+	if err != nil {
+		return nil, nil, err
+	}
+	return convHits, msgHits, nil
+}
+
+// parseSearchTerms splits the query on whitespace and drops the characters that
+// have a meaning in MySQL boolean full-text syntax.
+func parseSearchTerms(q string) []string {
+	cleaner := strings.NewReplacer(`"`, " ", "+", " ", "-", " ", "<", " ", ">", " ", "(", " ", ")", " ", "~", " ", "*", " ", "@", " ")
+	seen := make(map[string]bool)
+	var terms []string
+	for _, term := range strings.Fields(cleaner.Replace(q)) {
+		if seen[strings.ToLower(term)] {
+			continue
+		}
+		seen[strings.ToLower(term)] = true
+		terms = append(terms, term)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// buildBooleanQuery requires every term as a phrase, so that the ngram tokens of a
+// Chinese word must appear together.
+func buildBooleanQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = `+"` + term + `"`
+	}
+	return strings.Join(parts, " ")
+}
+
+// matchMask marks the runes of text that belong to an occurrence of any term,
+// ignoring case.
+func matchMask(text []rune, terms []string) []bool {
+	mask := make([]bool, len(text))
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	for _, term := range terms {
+		termRunes := []rune(term)
+		for i := range termRunes {
+			termRunes[i] = unicode.ToLower(termRunes[i])
+		}
+		for i := 0; i+len(termRunes) <= len(lower); i++ {
+			matched := true
+			for j, r := range termRunes {
+				if lower[i+j] != r {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				for j := range termRunes {
+					mask[i+j] = true
+				}
+			}
+		}
+	}
+	return mask
+}
+
+// renderHighlighted HTML-escapes text[start:end] and wraps matched runes in <mark>.
+func renderHighlighted(text []rune, mask []bool, start, end int) string {
+	var sb strings.Builder
+	inMark := false
+	for i := start; i < end; i++ {
+		if mask[i] != inMark {
+			if mask[i] {
+				sb.WriteString("<mark>")
+			} else {
+				sb.WriteString("</mark>")
+			}
+			inMark = mask[i]
+		}
+		sb.WriteString(html.EscapeString(string(text[i])))
+	}
+	if inMark {
+		sb.WriteString("</mark>")
+	}
+	return sb.String()
+}
+
+func highlightTerms(text string, terms []string) string {
+	runes := []rune(text)
+	return renderHighlighted(runes, matchMask(runes, terms), 0, len(runes))
+}
+
+// buildSnippet returns a short excerpt of content around its first match.
+func buildSnippet(content string, terms []string) string {
+	runes := []rune(strings.Join(strings.Fields(content), " "))
+	mask := matchMask(runes, terms)
+
+	first := 0
+	for i, marked := range mask {
+		if marked {
+			first = i
+			break
+		}
+	}
+	start := first - snippetLeadRunes
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := renderHighlighted(runes, mask, start, end)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"html"
+	"log"
+	"st-novel-go/src/ai/dao"
+	"st-novel-go/src/ai/dto"
+	"st-novel-go/src/ai/model"
+	"st-novel-go/src/ai/provider"
+	novelDao "st-novel-go/src/novel/dao"
+	novelDto "st-novel-go/src/novel/dto"
+	novelModel "st-novel-go/src/novel/model"
+	novelService "st-novel-go/src/novel/service"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxBatchItems = 200
+	// maxConcurrentTasksPerKey 限制同一 API Key 同时进行的请求数，避免触发提供商限流
+	maxConcurrentTasksPerKey = 3
+	batchItemTimeout         = 5 * time.Minute
+	// maxBatchItemAttempts 为单个条目自动重试的总次数上限
+	maxBatchItemAttempts = 3
+	batchRetryDelay      = 5 * time.Second
+	// 触发频率限制的条目最多推迟 maxBatchItemDeferrals 次，每次等待 batchRateLimitDelay
+	maxBatchItemDeferrals = 20
+	batchRateLimitDelay   = 15 * time.Second
+	defaultBatchTitle     = "{{title}} · AI 分析"
+)
+
+var (
+	// apiKeySlots 为每个 API Key 保存一个信号量，跨批次共享
+	apiKeySlots sync.Map // map[uint]chan struct{}
+	// runningBatches 记录正在执行的批次，防止同一批次被重复调度
+	runningBatches sync.Map // map[uuid.UUID]struct{}
+)
+
+// CreateTaskBatch validates the chapters, stores the batch and starts running it
+// in the background. Progress is read with GetTaskBatch.
+func CreateTaskBatch(userID uint, payload dto.BatchAITaskPayload) (*dto.TaskBatchDTO, error) {
+	apiKeyID, err := strconv.ParseUint(payload.Config.ID, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api key id: %s", payload.Config.ID)
+	}
+	// 仅校验 API Key，不占用请求额度；额度在每个条目调用前检查
+	apiKey, _, err := resolveUnmeteredProvider(uint(apiKeyID), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters, err := collectBatchChapters(userID, payload.ChapterIDs, payload.VolumeIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	modelName := payload.Config.Model
+	if modelName == "" {
+		modelName = apiKey.DefaultModel
+	}
+	titleTemplate := payload.TitleTemplate
+	if titleTemplate == "" {
+		titleTemplate = defaultBatchTitle
+	}
+
+	batch := &model.TaskBatch{
+		UserID:         userID,
+		NovelID:        chapters[0].NovelID,
+		APIKeyID:       apiKey.ID,
+		Model:          modelName,
+		Temperature:    payload.Config.Temperature,
+		MaxTokens:      payload.Config.MaxTokens,
+		TaskType:       payload.TaskType,
+		TitleTemplate:  titleTemplate,
+		PromptTemplate: payload.PromptTemplate,
+		Status:         model.TaskStatusRunning,
+		Total:          len(chapters),
+	}
+	items := make([]model.TaskBatchItem, len(chapters))
+	for i, chapter := range chapters {
+		items[i] = model.TaskBatchItem{
+			Seq:         i + 1,
+			SourceID:    chapter.ID.String(),
+			SourceTitle: chapter.Title,
+			Status:      model.TaskStatusPending,
+		}
+	}
+	if err := dao.CreateTaskBatch(batch, items); err != nil {
+		return nil, err
+	}
+
+	startTaskBatch(batch.ID)
+	return mapTaskBatchToDTO(batch, items), nil
+}
+
+func GetTaskBatches(userID uint) ([]dto.TaskBatchDTO, error) {
+	batches, err := dao.GetTaskBatchesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	batchDTOs := make([]dto.TaskBatchDTO, len(batches))
+	for i := range batches {
+		batchDTOs[i] = *mapTaskBatchToDTO(&batches[i], nil)
+	}
+	return batchDTOs, nil
+}
+
+// GetTaskBatch returns a batch with the progress of each item.
+func GetTaskBatch(id string, userID uint) (*dto.TaskBatchDTO, error) {
+	batch, err := dao.FindTaskBatchByID(id, userID)
+	if err != nil {
+		return nil, errors.New("task batch not found or permission denied")
+	}
+	items, err := dao.GetTaskBatchItems(batch.ID)
+	if err != nil {
+		return nil, err
+	}
+	return mapTaskBatchToDTO(batch, items), nil
+}
+
+// RetryTaskBatch queues the failed items of a finished batch again, together with
+// items left pending or running by an interrupted run.
+func RetryTaskBatch(id string, userID uint) (*dto.TaskBatchDTO, error) {
+	batch, err := dao.FindTaskBatchByID(id, userID)
+	if err != nil {
+		return nil, errors.New("task batch not found or permission denied")
+	}
+	if _, running := runningBatches.Load(batch.ID); running {
+		return nil, errors.New("task batch is still running")
+	}
+
+	reset, err := dao.ResetUnfinishedTaskBatchItems(batch.ID)
+	if err != nil {
+		return nil, err
+	}
+	if reset == 0 {
+		return nil, errors.New("task batch has no unfinished items to retry")
+	}
+	if _, err := dao.RefreshTaskBatchCounts(batch.ID); err != nil {
+		return nil, err
+	}
+
+	startTaskBatch(batch.ID)
+	return GetTaskBatch(id, userID)
+}
+
+// collectBatchChapters resolves chapter and volume IDs to chapters of one novel
+// owned by the user, without duplicates and in the order given.
+func collectBatchChapters(userID uint, chapterIDs []string, volumeIDs []string) ([]novelModel.Chapter, error) {
+	var chapters []novelModel.Chapter
+	seen := make(map[uuid.UUID]bool)
+	add := func(chapter novelModel.Chapter) {
+		if !seen[chapter.ID] {
+			seen[chapter.ID] = true
+			chapters = append(chapters, chapter)
+		}
+	}
+
+	for _, chapterID := range chapterIDs {
+		chapter, err := novelDao.FindChapterByID(chapterID)
+		if err != nil {
+			return nil, fmt.Errorf("chapter not found: %s", chapterID)
+		}
+		add(*chapter)
+	}
+	for _, volumeID := range volumeIDs {
+		volume, err := novelDao.FindVolumeByID(volumeID)
+		if err != nil {
+			return nil, fmt.Errorf("volume not found: %s", volumeID)
+		}
+		volumeChapters, err := novelDao.GetChaptersByVolumeID(volume.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		for _, chapter := range volumeChapters {
+			add(chapter)
+		}
+	}
+
+	if len(chapters) == 0 {
+		return nil, errors.New("no chapters selected")
+	}
+	if len(chapters) > maxBatchItems {
+		return nil, fmt.Errorf("a batch may contain at most %d chapters", maxBatchItems)
+	}
+	novelID := chapters[0].NovelID
+	for _, chapter := range chapters {
+		if chapter.NovelID != novelID {
+			return nil, errors.New("all chapters of a batch must belong to the same novel")
+		}
+	}
+	if _, err := novelDao.FindNovelWithRole(novelID.String(), userID, novelModel.RoleEditor); err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	return chapters, nil
+}
+
+// ResumeTaskBatches restarts the batches that were interrupted by a server
+// restart. Items that were running are queued again.
+func ResumeTaskBatches() {
+	batchIDs, err := dao.RequeueInterruptedTaskBatches()
+	if err != nil {
+		log.Printf("[task_batch_service] Failed to requeue interrupted batch items: %v", err)
+		return
+	}
+	for _, batchID := range batchIDs {
+		startTaskBatch(batchID)
+	}
+	if len(batchIDs) > 0 {
+		log.Printf("[task_batch_service] Resumed %d interrupted task batches.", len(batchIDs))
+	}
+}
+
+// startTaskBatch runs the pending items of a batch in the background unless the
+// batch is already running.
+func startTaskBatch(batchID uuid.UUID) {
+	if _, running := runningBatches.LoadOrStore(batchID, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer runningBatches.Delete(batchID)
+		runTaskBatch(batchID)
+	}()
+}
+
+func runTaskBatch(batchID uuid.UUID) {
+	batch, err := dao.RefreshTaskBatchCounts(batchID)
+	if err != nil {
+		log.Printf("[task_batch_service] Failed to load batch %s: %v", batchID, err)
+		return
+	}
+	items, err := dao.GetTaskBatchItemsByStatus(batchID, model.TaskStatusPending)
+	if err != nil {
+		log.Printf("[task_batch_service] Failed to load batch %s: %v", batchID, err)
+		return
+	}
+
+	apiKey, aiProvider, err := resolveUnmeteredProvider(batch.APIKeyID, batch.UserID)
+	if err != nil {
+		// API Key 已失效时所有条目直接失败，可在修复后重试
+		for _, item := range items {
+			finishTaskBatchItem(item, "", err)
+		}
+		return
+	}
+	novel, err := novelDao.FindNovelWithRole(batch.NovelID.String(), batch.UserID, novelModel.RoleEditor)
+	if err != nil {
+		for _, item := range items {
+			finishTaskBatchItem(item, "", errors.New("novel not found or permission denied"))
+		}
+		return
+	}
+
+	config := model.ChatConfig{
+		Model:     batch.Model,
+		MaxTokens: batch.MaxTokens,
+	}
+	if config.Model == "" {
+		config.Model = apiKey.DefaultModel
+	}
+	// 每个条目发出请求前单独检查额度和频率；缓存命中不经过检查
+	applyTemperature(&config, batch.Temperature)
+	aiProvider = withModeration(newQuotaCheckedProvider(aiProvider, batch.UserID, apiKey), batch.UserID, apiKey)
+	aiProvider = withResponseCache(aiProvider, batch.UserID, apiKey, batch.TaskType, config)
+	slots := taskSlotsForKey(batch.APIKeyID)
+
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(item model.TaskBatchItem) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			var derivedID string
+			var err error
+			deferrals := 0
+			for attempt := 1; ; attempt++ {
+				item.Attempts++
+				if err := dao.UpdateTaskBatchItemColumns(item.ID, map[string]interface{}{
+					"status":   model.TaskStatusRunning,
+					"attempts": item.Attempts,
+				}); err != nil {
+					log.Printf("[task_batch_service] Failed to update batch item %s: %v", item.ID, err)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), batchItemTimeout)
+				derivedID, err = runTaskBatchItem(ctx, batch, &novel, item, aiProvider, config)
+				cancel()
+				// 触发每分钟请求数限制时推迟该条目，不计入重试次数
+				var quotaErr *QuotaExceededError
+				if errors.As(err, &quotaErr) && quotaErr.RateLimited && deferrals < maxBatchItemDeferrals {
+					deferrals++
+					attempt--
+					time.Sleep(batchRateLimitDelay)
+					continue
+				}
+				if err == nil || attempt >= maxBatchItemAttempts || !isRetryableBatchError(err) {
+					break
+				}
+				time.Sleep(time.Duration(attempt) * batchRetryDelay)
+			}
+			finishTaskBatchItem(item, derivedID, err)
+		}(item)
+	}
+	wg.Wait()
+}
+
+// runTaskBatchItem runs the task on one chapter and stores the result as derived
+// content of that chapter.
+func runTaskBatchItem(ctx context.Context, batch *model.TaskBatch, novel *novelModel.Novel, item model.TaskBatchItem, aiProvider provider.AIProvider, config model.ChatConfig) (string, error) {
+	chapter, err := novelDao.FindChapterByID(item.SourceID)
+	if err != nil {
+		return "", errBatchChapterNotFound
+	}
+
+	text := stripTags(chapter.Content)
+	replacer := strings.NewReplacer(
+		"{{novelTitle}}", novel.Title,
+		"{{title}}", chapter.Title,
+		"{{content}}", text,
+	)
+	prompt := replacer.Replace(batch.PromptTemplate)
+	if !strings.Contains(batch.PromptTemplate, "{{content}}") {
+		prompt += "\n\n" + text
+	}
+
+	result, _, err := collectCompletion(ctx, aiProvider, []model.ChatMessage{{Role: "user", Content: prompt}}, config)
+	if err != nil {
+		return "", err
+	}
+	if result == "" {
+		return "", errors.New("the AI returned an empty result")
+	}
+
+	derived, err := novelService.CreateDerivedContent(batch.UserID, novelDto.CreateDerivedContentPayload{
+		Type:     batch.TaskType,
+		SourceID: chapter.ID.String(),
+		Title:    replacer.Replace(batch.TitleTemplate),
+		Content:  plainTextToHTML(result),
+	})
+	if err != nil {
+		return "", err
+	}
+	return derived.ID.String(), nil
+}
+
+var errBatchChapterNotFound = errors.New("chapter not found")
+
+// isRetryableBatchError reports whether a failed item may succeed when run again
+// right away, as with provider errors and timeouts.
+func isRetryableBatchError(err error) bool {
+	var quotaErr *QuotaExceededError
+	return !errors.Is(err, errBatchChapterNotFound) && !errors.As(err, &quotaErr)
+}
+
+func finishTaskBatchItem(item model.TaskBatchItem, derivedID string, taskErr error) {
+	columns := map[string]interface{}{"status": model.TaskStatusSucceeded, "error": ""}
+	if taskErr != nil {
+		columns = map[string]interface{}{"status": model.TaskStatusFailed, "error": taskErr.Error()}
+	} else if id, err := uuid.Parse(derivedID); err == nil {
+		columns["derived_content_id"] = id
+	}
+	if err := dao.UpdateTaskBatchItemColumns(item.ID, columns); err != nil {
+		log.Printf("[task_batch_service] Failed to update batch item %s: %v", item.ID, err)
+	}
+	if _, err := dao.RefreshTaskBatchCounts(item.BatchID); err != nil {
+		log.Printf("[task_batch_service] Failed to refresh batch %s: %v", item.BatchID, err)
+	}
+}
+
+func taskSlotsForKey(apiKeyID uint) chan struct{} {
+	slots, _ := apiKeySlots.LoadOrStore(apiKeyID, make(chan struct{}, maxConcurrentTasksPerKey))
+	return slots.(chan struct{})
+}
+
+// plainTextToHTML wraps each non-empty line of an AI result in a paragraph, the
+// format the editor stores derived content in.
+func plainTextToHTML(text string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			sb.WriteString("<p>" + html.EscapeString(line) + "</p>")
+		}
+	}
+	return sb.String()
+}
+
+func mapTaskBatchToDTO(batch *model.TaskBatch, items []model.TaskBatchItem) *dto.TaskBatchDTO {
+	batchDTO := &dto.TaskBatchDTO{
+		ID:        batch.ID.String(),
+		NovelID:   batch.NovelID.String(),
+		TaskType:  batch.TaskType,
+		Model:     batch.Model,
+		Status:    batch.Status,
+		Total:     batch.Total,
+		Succeeded: batch.Succeeded,
+		Failed:    batch.Failed,
+		CreatedAt: batch.CreatedAt.Format(time.RFC3339),
+	}
+	for _, item := range items {
+		itemDTO := dto.TaskBatchItemDTO{
+			ID:          item.ID.String(),
+			SourceID:    item.SourceID,
+			SourceTitle: item.SourceTitle,
+			Status:      item.Status,
+			Attempts:    item.Attempts,
+			Error:       item.Error,
+		}
+		if item.DerivedContentID != nil {
+			itemDTO.DerivedContentID = item.DerivedContentID.String()
+		}
+		batchDTO.Items = append(batchDTO.Items, itemDTO)
+	}
+	return batchDTO
+}
@@ -17,6 +17,7 @@ func GetAIProvidersForEditor(userID uint) ([]dto.AIProviderConfigDTO, error) {
 		return nil, fmt.Errorf("failed to get api keys: %w", err)
 	}
 
+	defaultTemperature := float32(0.7)
 	var providers []dto.AIProviderConfigDTO
 	for _, key := range apiKeys {
 		if key.Status == settingsModel.Enabled {
@@ -26,7 +27,7 @@ func GetAIProvidersForEditor(userID uint) ([]dto.AIProviderConfigDTO, error) {
 				Model:       key.DefaultModel,
 				Description: fmt.Sprintf("Provider: %s, Model: %s", key.Provider, key.DefaultModel),
 				// Default values, can be overridden by frontend
-				Temperature: 0.7,
+				Temperature: &defaultTemperature,
 				MaxTokens:   2048,
 			})
 		}
@@ -59,13 +60,17 @@ func StreamAITask(ctx context.Context, payload dto.StreamAITaskPayload, userID u
 	if err != nil {
 		return nil, err
 	}
+	// 额度在真正调用服务商前检查，缓存命中不占用额度
+	aiProvider = newQuotaCheckedProvider(aiProvider, userID, actualApiKey)
 
 	chatConfig := model.ChatConfig{
-		Model:       payload.Config.Model,
-		Temperature: payload.Config.Temperature,
-		MaxTokens:   payload.Config.MaxTokens,
-		Stream:      true,
+		Model:     payload.Config.Model,
+		MaxTokens: payload.Config.MaxTokens,
+		Stream:    true,
 	}
+	applyTemperature(&chatConfig, payload.Config.Temperature)
+	aiProvider = withResponseCache(aiProvider, userID, actualApiKey, payload.TaskType, chatConfig)
+	aiProvider = withModeration(aiProvider, userID, actualApiKey)
 
 	messages := []model.ChatMessage{
 		{Role: "user", Content: payload.Prompt},
@@ -81,6 +86,10 @@ func StreamAITask(ctx context.Context, payload dto.StreamAITaskPayload, userID u
 	go func() {
 		defer close(eventChan)
 		for chunk := range providerChan {
+			if chunk.Event == "moderation" {
+				eventChan <- dto.TaskStreamEvent{Event: "moderation", Moderation: chunk.Moderation}
+				continue
+			}
 			if chunk.Error != "" {
 				eventChan <- dto.TaskStreamEvent{Event: "error", Error: chunk.Error}
 				return // Stop on error
@@ -4,6 +4,8 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 )
 
 type Config struct {
@@ -28,13 +30,117 @@ type Config struct {
 	JWT struct {
 		Secret string `yaml:"secret"`
 	} `yaml:"jwt"`
+	Admin struct {
+		// Emails 中的账号在启动时被设为管理员，其余账号的管理员权限被撤销
+		Emails []string `yaml:"emails"`
+	} `yaml:"admin"`
+	Quota struct {
+		// Plans 以套餐名（如 "免费版"、"专业版"）为键；未配置的套餐使用代码中的默认值
+		Plans map[string]QuotaLimits `yaml:"plans"`
+	} `yaml:"quota"`
+	AICache struct {
+		Enabled bool `yaml:"enabled"`
+		// Backend 为 "memory"（默认）或 "redis"，使用 redis 时读取上面的 Redis 配置
+		Backend    string `yaml:"backend"`
+		TTLSeconds int    `yaml:"ttl_seconds"`
+		MaxEntries int    `yaml:"max_entries"` // 仅对 memory 后端生效
+		// CacheableTaskTypes 中的任务类型即使温度不为 0 也会缓存
+		CacheableTaskTypes []string `yaml:"cacheable_task_types"`
+	} `yaml:"ai_cache"`
+	Moderation struct {
+		Enabled  bool                   `yaml:"enabled"`
+		Rules    []ModerationRule       `yaml:"rules"`
+		Provider ModerationProviderConf `yaml:"provider"`
+	} `yaml:"moderation"`
+	History       HistoryConfig       `yaml:"history"`
+	Collaboration CollaborationConfig `yaml:"collaboration"`
+}
+
+// HistoryConfig controls how document versions are stored and thinned. Zero values
+// use the defaults of the novel service.
+type HistoryConfig struct {
+	// SnapshotInterval 为两个完整快照之间最多保存的差异版本数
+	SnapshotInterval int `yaml:"snapshot_interval"`
+	// 最近 KeepAllHours 小时内的版本全部保留，之后 HourlyDays 天内每小时保留一个，再之后每天保留一个
+	KeepAllHours int `yaml:"keep_all_hours"`
+	HourlyDays   int `yaml:"hourly_days"`
+	// DailyDays 为按天保留的天数，0 表示永久保留
+	DailyDays                 int `yaml:"daily_days"`
+	CompactionIntervalMinutes int `yaml:"compaction_interval_minutes"`
+	// 同一用户在该时间窗口内的自动保存合并为一个版本
+	AutosaveWindowSeconds int `yaml:"autosave_window_seconds"`
+	// ChangeLogDays 为同步变更日志的保留天数，更早的条目随历史压缩一起删除
+	ChangeLogDays int `yaml:"change_log_days"`
+}
+
+// CollaborationConfig controls the real-time chapter editing sessions. Zero values
+// use the defaults of the novel service.
+type CollaborationConfig struct {
+	// 协同编辑会话每隔 SaveIntervalSeconds 秒把有改动的内容写回章节
+	SaveIntervalSeconds int `yaml:"save_interval_seconds"`
+	// 服务器保留的最近操作数，基于更早版本提交的操作会被拒绝，客户端需要重新同步
+	MaxBufferedOps int `yaml:"max_buffered_ops"`
+}
+
+// ModerationRule flags text containing any of Keywords (case-insensitive) or
+// matching any of Patterns (Go regular expressions).
+type ModerationRule struct {
+	Name     string   `yaml:"name"`
+	Category string   `yaml:"category"`
+	Keywords []string `yaml:"keywords"`
+	Patterns []string `yaml:"patterns"`
+	// Action 为 block、warn 或 annotate，默认 warn
+	Action string `yaml:"action"`
+	// Stages 为 prompt 和/或 completion，为空时两者都检查
+	Stages []string `yaml:"stages"`
+}
+
+// ModerationProviderConf configures an OpenAI-compatible moderation endpoint.
+type ModerationProviderConf struct {
+	Enabled        bool   `yaml:"enabled"`
+	Endpoint       string `yaml:"endpoint"`
+	APIKey         string `yaml:"api_key"`
+	Model          string `yaml:"model"`
+	Action         string `yaml:"action"` // 被标记时采取的动作，默认 block
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+}
+
+// QuotaLimits are the AI usage limits of a plan. A zero value means unlimited.
+// Costs are estimated in US dollars.
+type QuotaLimits struct {
+	DailyTokens       int64   `yaml:"daily_tokens" json:"dailyTokens"`
+	MonthlyTokens     int64   `yaml:"monthly_tokens" json:"monthlyTokens"`
+	RequestsPerMinute int     `yaml:"requests_per_minute" json:"requestsPerMinute"`
+	DailyCost         float64 `yaml:"daily_cost" json:"dailyCost"`
+	MonthlyCost       float64 `yaml:"monthly_cost" json:"monthlyCost"`
 }
 
 var AppConfig *Config
 
+// configPath is config/config.yaml in the working directory or, for tests that run
+// in a package directory, in the nearest parent that has one.
+func configPath() string {
+	const name = "config/config.yaml"
+	dir, err := os.Getwd()
+	if err != nil {
+		return name
+	}
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return name
+		}
+		dir = parent
+	}
+}
+
 func init() {
 	config := &Config{}
-	file, err := ioutil.ReadFile("config/config.yaml")
+	file, err := ioutil.ReadFile(configPath())
 	if err != nil {
 		log.Fatalf("Failed to read config file: %v", err)
 	}
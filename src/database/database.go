@@ -1,16 +1,19 @@
 package database
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
 	aiModel "st-novel-go/src/ai/model"
 	"st-novel-go/src/config"
 	novelModel "st-novel-go/src/novel/model"
 	settingsModel "st-novel-go/src/settings/model"
 	userModel "st-novel-go/src/user/model"
+	"time"
 )
 
 var DB *gorm.DB
@@ -38,6 +41,14 @@ func InitDatabase() {
 		&userModel.User{},
 		&settingsModel.APIKey{},
 		&aiModel.Conversation{},
+		&aiModel.ConversationMessage{},
+		&aiModel.AIPreference{},
+		&aiModel.TaskBatch{},
+		&aiModel.TaskBatchItem{},
+		&aiModel.AIUsageRecord{},
+		&aiModel.AIQuotaOverride{},
+		&aiModel.ModelPrice{},
+		&aiModel.ModerationLog{},
 		&novelModel.Novel{},
 		&novelModel.Volume{},
 		&novelModel.Chapter{},
@@ -45,6 +56,14 @@ func InitDatabase() {
 		&novelModel.Note{},
 		&novelModel.RecentActivity{},
 		&novelModel.HistoryVersion{},
+		&novelModel.DailyWordStat{},
+		&novelModel.WritingGoal{},
+		&novelModel.WritingSave{},
+		&novelModel.NovelSnapshot{},
+		&novelModel.NovelMember{},
+		&novelModel.ChapterComment{},
+		&novelModel.NovelChange{},
+		&novelModel.NovelChangeHorizon{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to auto-migrate database schema: %v", err)
@@ -52,6 +71,12 @@ func InitDatabase() {
 	log.Println("Database schema migrated successfully.")
 
 	seedAdminUser()
+	syncAdministrators()
+	seedModelPrices()
+	migrateLegacyConversationMessages()
+	backfillConversationMessageTree()
+	ensureConversationFulltextIndexes()
+	migrateWritingSessions()
 }
 
 func seedAdminUser() {
@@ -77,3 +102,193 @@ func seedAdminUser() {
 		log.Println("Admin user already exists.")
 	}
 }
+
+// syncAdministrators makes exactly the accounts listed in admin.emails of the
+// config administrators. Accounts that are no longer listed, including the demo
+// account that earlier versions made an administrator, lose the role.
+func syncAdministrators() {
+	emails := config.AppConfig.Admin.Emails
+	revoke := DB.Model(&userModel.User{}).Where("is_admin = ?", true)
+	if len(emails) > 0 {
+		revoke = revoke.Where("email NOT IN ?", emails)
+	}
+	if err := revoke.UpdateColumn("is_admin", false).Error; err != nil {
+		log.Printf("Failed to revoke admin privileges: %v", err)
+	}
+	if len(emails) == 0 {
+		log.Println("No administrators configured (admin.emails).")
+		return
+	}
+	if err := DB.Model(&userModel.User{}).Where("email IN ? AND is_admin = ?", emails, false).UpdateColumn("is_admin", true).Error; err != nil {
+		log.Printf("Failed to grant admin privileges: %v", err)
+	}
+}
+
+// seedModelPrices fills the pricing catalogue with the default prices when it has
+// no global entries yet. Entries edited or deleted by admins are left alone.
+func seedModelPrices() {
+	var count int64
+	if err := DB.Model(&aiModel.ModelPrice{}).Where("api_key_id = 0").Count(&count).Error; err != nil {
+		log.Printf("Failed to check model prices: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	prices := make([]aiModel.ModelPrice, len(aiModel.DefaultModelPrices))
+	copy(prices, aiModel.DefaultModelPrices)
+	if err := DB.Create(&prices).Error; err != nil {
+		log.Printf("Failed to seed model prices: %v", err)
+		return
+	}
+	log.Printf("Seeded %d default model prices.", len(prices))
+}
+
+// migrateLegacyConversationMessages moves messages stored in the old
+// Conversation.Messages JSON column into the ConversationMessage table.
+// Each conversation is migrated in its own transaction and the JSON column is
+// cleared afterwards, so the migration is idempotent and can resume after a crash.
+func migrateLegacyConversationMessages() {
+	var convs []aiModel.Conversation
+	if err := DB.Where("messages IS NOT NULL").Find(&convs).Error; err != nil {
+		log.Printf("Failed to load conversations for message migration: %v", err)
+		return
+	}
+
+	migrated := 0
+	for _, conv := range convs {
+		var legacy []struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			Timestamp string `json:"timestamp"`
+		}
+		_ = json.Unmarshal(conv.Messages, &legacy)
+
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			// 与追加消息一样先锁定会话行，再读取已有消息数，避免与并发追加分配到相同的 seq
+			var locked aiModel.Conversation
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&locked, "id = ?", conv.ID).Error; err != nil {
+				return err
+			}
+			var existing int64
+			if err := tx.Model(&aiModel.ConversationMessage{}).Where("conversation_id = ?", conv.ID).Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing == 0 && len(legacy) > 0 {
+				messages := make([]aiModel.ConversationMessage, len(legacy))
+				for i, m := range legacy {
+					messages[i] = aiModel.ConversationMessage{
+						ConversationID: conv.ID,
+						Seq:            i + 1,
+						Role:           m.Role,
+						Content:        m.Content,
+					}
+					// 旧数据的时间戳可能为空，此时沿用会话的更新时间
+					createdAt, err := time.Parse(time.RFC3339, m.Timestamp)
+					if err != nil {
+						createdAt = conv.UpdatedAt
+					}
+					messages[i].CreatedAt = createdAt
+					messages[i].UpdatedAt = createdAt
+				}
+				if err := tx.Create(&messages).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&aiModel.Conversation{}).Where("id = ?", conv.ID).UpdateColumn("messages", nil).Error
+		})
+		if err != nil {
+			log.Printf("Failed to migrate messages of conversation %s: %v", conv.ID, err)
+			continue
+		}
+		migrated++
+	}
+	if migrated > 0 {
+		log.Printf("Migrated legacy messages of %d conversations.", migrated)
+	}
+}
+
+// backfillConversationMessageTree links messages stored before branching existed
+// into a single chain (each message's parent is the previous one by seq) and
+// records the last one as the active leaf. Conversations that already have an
+// active leaf are skipped, so this runs only once per conversation.
+func backfillConversationMessageTree() {
+	var convIDs []string
+	if err := DB.Model(&aiModel.ConversationMessage{}).
+		Distinct("conversation_id").
+		Where("conversation_id IN (?)", DB.Model(&aiModel.Conversation{}).Select("id").Where("active_leaf_id IS NULL")).
+		Pluck("conversation_id", &convIDs).Error; err != nil {
+		log.Printf("Failed to load conversations for message tree backfill: %v", err)
+		return
+	}
+
+	for _, convID := range convIDs {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			var messages []aiModel.ConversationMessage
+			if err := tx.Select("id", "seq").Where("conversation_id = ?", convID).Order("seq ASC").Find(&messages).Error; err != nil {
+				return err
+			}
+			for i := 1; i < len(messages); i++ {
+				if err := tx.Model(&aiModel.ConversationMessage{}).Where("id = ?", messages[i].ID).
+					UpdateColumn("parent_id", messages[i-1].ID).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&aiModel.Conversation{}).Where("id = ?", convID).
+				UpdateColumn("active_leaf_id", messages[len(messages)-1].ID).Error
+		})
+		if err != nil {
+			log.Printf("Failed to backfill message tree of conversation %s: %v", convID, err)
+		}
+	}
+}
+
+// ensureConversationFulltextIndexes creates the ngram full-text indexes used by the
+// conversation search. The ngram parser tokenizes Chinese text, which the default
+// parser cannot split into words. A failure is only logged: search then falls back
+// to substring matching.
+func ensureConversationFulltextIndexes() {
+	indexes := []struct {
+		model   interface{}
+		table   string
+		name    string
+		columns string
+	}{
+		{&aiModel.Conversation{}, "conversations", "ft_conversations_title_summary", "title, summary"},
+		{&aiModel.ConversationMessage{}, "conversation_messages", "ft_conversation_messages_content", "content"},
+	}
+	for _, idx := range indexes {
+		if DB.Migrator().HasIndex(idx.model, idx.name) {
+			continue
+		}
+		sql := fmt.Sprintf("ALTER TABLE %s ADD FULLTEXT INDEX %s (%s) WITH PARSER ngram", idx.table, idx.name, idx.columns)
+		if err := DB.Exec(sql).Error; err != nil {
+			log.Printf("Failed to create full-text index %s: %v", idx.name, err)
+		}
+	}
+}
+
+// migrateWritingSessions turns the sessions stored before saves were logged one by
+// one into saves: one at the start of each session carrying its words, and one at
+// its end so that the session keeps its duration. It runs only while the save log
+// is empty; the old table is left in place.
+func migrateWritingSessions() {
+	if !DB.Migrator().HasTable("writing_sessions") {
+		return
+	}
+	var saves int64
+	if err := DB.Model(&novelModel.WritingSave{}).Count(&saves).Error; err != nil || saves > 0 {
+		return
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO writing_saves (user_id, novel_id, chapter_id, saved_at, words_added, words_removed) " +
+			"SELECT user_id, novel_id, chapter_id, started_at, words_added, words_removed FROM writing_sessions").Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO writing_saves (user_id, novel_id, chapter_id, saved_at, words_added, words_removed) " +
+			"SELECT user_id, novel_id, chapter_id, ended_at, 0, 0 FROM writing_sessions WHERE ended_at > started_at").Error
+	})
+	if err != nil {
+		log.Printf("Failed to migrate writing sessions: %v", err)
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"log"
+	aiDao "st-novel-go/src/ai/dao"
+	aiService "st-novel-go/src/ai/service"
 	"st-novel-go/src/config"
 	"st-novel-go/src/database"
+	novelService "st-novel-go/src/novel/service"
 	"st-novel-go/src/router"
 )
 
@@ -28,6 +31,21 @@ func main() {
 	// Initialize database connection
 	database.InitDatabase()
 
+	// Keep AI conversations in step with the novels and chapters they are linked to
+	aiDao.RegisterNovelHooks()
+
+	// Re-map comment anchors whenever a chapter's content is overwritten
+	novelService.RegisterNovelHooks()
+
+	// Count the words of chapters saved before word counts were kept
+	novelService.BackfillChapterWordCounts()
+
+	// Continue the AI task batches interrupted by the last shutdown
+	aiService.ResumeTaskBatches()
+
+	// Thin old history versions in the background
+	novelService.StartHistoryCompaction()
+
 	// Setup router
 	r := router.SetupRouter()
 
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	userDao "st-novel-go/src/user/dao"
+	"st-novel-go/src/utils"
+)
+
+// AdminMiddleware allows only administrators. It must run after AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, exists := c.Get(UserClaimsKey)
+		if !exists {
+			utils.FailWithUnauthorized(c, "Authentication required")
+			c.Abort()
+			return
+		}
+
+		user, err := userDao.FindUserByID(claims.(*utils.Claims).UserID)
+		if err != nil || !user.IsAdmin {
+			utils.FailWithForbidden(c, "Administrator privileges required")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -15,6 +15,18 @@ const (
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader(AuthorizationHeader)
+		// 浏览器无法为 WebSocket 握手设置请求头，升级请求改用一次性的 ticket 查询参数认证
+		if authHeader == "" && isWebSocketUpgrade(c) && c.Query("ticket") != "" {
+			claims, ok := redeemWebSocketTicket(c.Query("ticket"))
+			if !ok {
+				utils.FailWithUnauthorized(c, "Invalid or expired ticket")
+				c.Abort()
+				return
+			}
+			c.Set(UserClaimsKey, claims)
+			c.Next()
+			return
+		}
 		if authHeader == "" {
 			utils.FailWithUnauthorized(c, "Authorization header is required")
 			c.Abort()
@@ -39,3 +51,8 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func isWebSocketUpgrade(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(c.GetHeader("Connection")), "upgrade")
+}
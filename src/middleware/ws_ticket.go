@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"st-novel-go/src/utils"
+	"sync"
+	"time"
+)
+
+// WebSocketTicketTTL is how long a ticket can be redeemed after it was issued.
+const WebSocketTicketTTL = 30 * time.Second
+
+type webSocketTicket struct {
+	claims    *utils.Claims
+	expiresAt time.Time
+}
+
+var webSocketTickets = struct {
+	sync.Mutex
+	m map[string]webSocketTicket
+}{m: make(map[string]webSocketTicket)}
+
+// IssueWebSocketTicket returns a single-use ticket that authenticates one WebSocket
+// handshake as the holder of claims. Browsers cannot set headers on the handshake,
+// and a ticket in the URL does no harm once it has been used or has expired.
+func IssueWebSocketTicket(claims *utils.Claims) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(buf)
+
+	now := time.Now()
+	webSocketTickets.Lock()
+	defer webSocketTickets.Unlock()
+	for key, t := range webSocketTickets.m {
+		if now.After(t.expiresAt) {
+			delete(webSocketTickets.m, key)
+		}
+	}
+	webSocketTickets.m[ticket] = webSocketTicket{claims: claims, expiresAt: now.Add(WebSocketTicketTTL)}
+	return ticket, nil
+}
+
+// redeemWebSocketTicket returns the claims of a ticket and invalidates it.
+func redeemWebSocketTicket(ticket string) (*utils.Claims, bool) {
+	webSocketTickets.Lock()
+	defer webSocketTickets.Unlock()
+	t, ok := webSocketTickets.m[ticket]
+	if !ok {
+		return nil, false
+	}
+	delete(webSocketTickets.m, ticket)
+	if time.Now().After(t.expiresAt) {
+		return nil, false
+	}
+	return t.claims, true
+}
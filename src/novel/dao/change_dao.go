@@ -0,0 +1,237 @@
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+	"time"
+)
+
+func upsertChange(novelID uuid.UUID, entityType string, entityID uuid.UUID) model.NovelChange {
+	return model.NovelChange{NovelID: novelID, EntityType: entityType, EntityID: entityID.String(), Op: model.ChangeOpUpsert}
+}
+
+func deleteChange(novelID uuid.UUID, entityType string, entityID uuid.UUID) model.NovelChange {
+	return model.NovelChange{NovelID: novelID, EntityType: entityType, EntityID: entityID.String(), Op: model.ChangeOpDelete}
+}
+
+// lockNovels locks the rows of the given novels, including ones in the trash, until
+// tx ends. Every transaction that records changes calls it before it writes
+// anything else: the change log entries of one novel are then committed in the
+// order of their sequence numbers, and a later lock on the novel never has to wait
+// on the shared lock a child row insert took on it, which could deadlock.
+func lockNovels(tx *gorm.DB, novelIDs ...uuid.UUID) error {
+	if len(novelIDs) == 0 {
+		return nil
+	}
+	var locked []uuid.UUID
+	return tx.Unscoped().Model(&model.Novel{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", novelIDs).
+		Order("id").
+		Pluck("id", &locked).Error
+}
+
+// lockNovelOf locks the novel the row of value's table with the given ID belongs
+// to. It does nothing when there is no such row.
+func lockNovelOf(tx *gorm.DB, value interface{}, id string) error {
+	var novelIDs []uuid.UUID
+	if err := tx.Unscoped().Model(value).Where("id = ?", id).Pluck("novel_id", &novelIDs).Error; err != nil {
+		return err
+	}
+	return lockNovels(tx, novelIDs...)
+}
+
+// changedNovels returns the IDs of the novels changes belong to.
+func changedNovels(changes []model.NovelChange) []uuid.UUID {
+	novelIDs := make([]uuid.UUID, 0, 1)
+	seen := make(map[uuid.UUID]bool)
+	for _, change := range changes {
+		if !seen[change.NovelID] {
+			seen[change.NovelID] = true
+			novelIDs = append(novelIDs, change.NovelID)
+		}
+	}
+	return novelIDs
+}
+
+// recordChanges appends changes to the change log inside tx. The novels must have
+// been locked with lockNovels at the start of tx.
+func recordChanges(tx *gorm.DB, changes ...model.NovelChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	return tx.Create(&changes).Error
+}
+
+// deleteWithChanges soft-deletes the rows of value's table matching the query and
+// records a delete for each of them. It returns the number of deleted rows.
+func deleteWithChanges(tx *gorm.DB, value interface{}, entityType string, query interface{}, args ...interface{}) (int, error) {
+	var rows []struct {
+		ID      uuid.UUID
+		NovelID uuid.UUID
+	}
+	if err := tx.Model(value).Select("id, novel_id").Where(query, args...).Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	ids := make([]uuid.UUID, len(rows))
+	changes := make([]model.NovelChange, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+		changes[i] = deleteChange(row.NovelID, entityType, row.ID)
+	}
+	if err := tx.Where("id IN ?", ids).Delete(value).Error; err != nil {
+		return 0, err
+	}
+	return len(rows), recordChanges(tx, changes...)
+}
+
+// nodeChanges compares two versions of a JSON node tree and returns an upsert for
+// every node that was added, edited or moved and a delete for every node that is
+// gone. Nodes are matched by their "id".
+func nodeChanges(novelID uuid.UUID, nodeType string, before, after []byte) []model.NovelChange {
+	oldNodes, newNodes := flattenNodeTree(before), flattenNodeTree(after)
+	var changes []model.NovelChange
+	for id, state := range newNodes {
+		if oldNodes[id] != state {
+			changes = append(changes, model.NovelChange{NovelID: novelID, EntityType: model.ChangeEntityNode, EntityID: nodeType + ":" + id, Op: model.ChangeOpUpsert})
+		}
+	}
+	for id := range oldNodes {
+		if _, ok := newNodes[id]; !ok {
+			changes = append(changes, model.NovelChange{NovelID: novelID, EntityType: model.ChangeEntityNode, EntityID: nodeType + ":" + id, Op: model.ChangeOpDelete})
+		}
+	}
+	return changes
+}
+
+// novelNodeChanges returns the node changes between two versions of a novel's JSON
+// fields.
+func novelNodeChanges(before, after *model.Novel) []model.NovelChange {
+	var changes []model.NovelChange
+	changes = append(changes, nodeChanges(after.ID, novelJSONFields["settings_data"], before.SettingsData, after.SettingsData)...)
+	changes = append(changes, nodeChanges(after.ID, novelJSONFields["plot_custom_data"], before.PlotCustomData, after.PlotCustomData)...)
+	changes = append(changes, nodeChanges(after.ID, novelJSONFields["analysis_custom_data"], before.AnalysisCustomData, after.AnalysisCustomData)...)
+	changes = append(changes, nodeChanges(after.ID, novelJSONFields["others_custom_data"], before.OthersCustomData, after.OthersCustomData)...)
+	return changes
+}
+
+// flattenNodeTree maps each node ID of a tree to a serialization of the node
+// without its children, together with its parent and position.
+func flattenNodeTree(data []byte) map[string]string {
+	var tree []interface{}
+	_ = json.Unmarshal(data, &tree)
+	nodes := make(map[string]string)
+	var walk func(items []interface{}, parentID string)
+	walk = func(items []interface{}, parentID string) {
+		for i, item := range items {
+			node, ok := item.(map[string]interface{})
+			if !ok || node["id"] == nil {
+				continue
+			}
+			id := fmt.Sprint(node["id"])
+			own := make(map[string]interface{}, len(node))
+			for key, value := range node {
+				if key != "children" {
+					own[key] = value
+				}
+			}
+			// map 序列化时按键排序，结果可以直接比较
+			state, _ := json.Marshal([]interface{}{parentID, i, own})
+			nodes[id] = string(state)
+			children, _ := node["children"].([]interface{})
+			walk(children, id)
+		}
+	}
+	walk(tree, "")
+	return nodes
+}
+
+// GetNovelChanges returns up to limit change log entries of a novel with sequence
+// numbers in (after, upTo], oldest first.
+func GetNovelChanges(novelID string, after, upTo uint64, limit int) ([]model.NovelChange, error) {
+	var changes []model.NovelChange
+	err := database.DB.Where("novel_id = ? AND seq > ? AND seq <= ?", novelID, after, upTo).Order("seq ASC").Limit(limit).Find(&changes).Error
+	return changes, err
+}
+
+// GetLatestNovelChangeSeq returns the sequence number of a novel's latest change log
+// entry, or 0 if it has none.
+func GetLatestNovelChangeSeq(novelID string) (uint64, error) {
+	var seq uint64
+	err := database.DB.Model(&model.NovelChange{}).Select("COALESCE(MAX(seq), 0)").Where("novel_id = ?", novelID).Scan(&seq).Error
+	return seq, err
+}
+
+// GetNovelChangeHorizon returns the sequence number up to which a novel's change log
+// was pruned, or 0 if it never was.
+func GetNovelChangeHorizon(novelID string) (uint64, error) {
+	var seqs []uint64
+	err := database.DB.Model(&model.NovelChangeHorizon{}).Where("novel_id = ?", novelID).Pluck("pruned_seq", &seqs).Error
+	if err != nil || len(seqs) == 0 {
+		return 0, err
+	}
+	return seqs[0], nil
+}
+
+// GetNovelsWithChangesBefore returns the IDs of novels with change log entries
+// older than before, in ID order after afterID.
+func GetNovelsWithChangesBefore(before time.Time, afterID string, limit int) ([]string, error) {
+	var novelIDs []string
+	err := database.DB.Model(&model.NovelChange{}).
+		Select("novel_id").
+		Where("created_at < ? AND novel_id > ?", before, afterID).
+		Group("novel_id").
+		Order("novel_id ASC").
+		Limit(limit).
+		Pluck("novel_id", &novelIDs).Error
+	return novelIDs, err
+}
+
+// PruneNovelChanges deletes the change log entries of a novel older than before and
+// moves the novel's horizon past them. It returns the number of entries deleted.
+func PruneNovelChanges(novelID string, before time.Time) (int64, error) {
+	novelUUID, err := uuid.Parse(novelID)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, novelUUID); err != nil {
+			return err
+		}
+		var prunedSeq uint64
+		if err := tx.Model(&model.NovelChange{}).
+			Select("COALESCE(MAX(seq), 0)").
+			Where("novel_id = ? AND created_at < ?", novelID, before).
+			Scan(&prunedSeq).Error; err != nil {
+			return err
+		}
+		if prunedSeq == 0 {
+			return nil
+		}
+		result := tx.Where("novel_id = ? AND seq <= ?", novelID, prunedSeq).Delete(&model.NovelChange{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "novel_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"pruned_seq", "updated_at"}),
+		}).Create(&model.NovelChangeHorizon{NovelID: novelUUID, PrunedSeq: prunedSeq}).Error
+	})
+	return deleted, err
+}
+
+// FindNovelRowsByID loads the rows of a novel with the given IDs into dest, a
+// pointer to a slice of volumes, chapters, derived content or notes.
+func FindNovelRowsByID(novelID string, ids []string, dest interface{}) error {
+	return database.DB.Where("novel_id = ? AND id IN ?", novelID, ids).Find(dest).Error
+}
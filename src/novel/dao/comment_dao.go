@@ -0,0 +1,94 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+	"strconv"
+)
+
+func CreateChapterComment(comment *model.ChapterComment) error {
+	return database.DB.Create(comment).Error
+}
+
+func UpdateChapterComment(comment *model.ChapterComment) error {
+	return database.DB.Save(comment).Error
+}
+
+func FindChapterCommentByID(commentID string) (*model.ChapterComment, error) {
+	var comment model.ChapterComment
+	if err := database.DB.First(&comment, "id = ?", commentID).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// GetChapterComments returns every comment of a chapter, oldest first.
+func GetChapterComments(chapterID string) ([]model.ChapterComment, error) {
+	var comments []model.ChapterComment
+	err := database.DB.Where("chapter_id = ?", chapterID).Order("created_at ASC").Find(&comments).Error
+	return comments, err
+}
+
+// GetAnchoredChapterComments returns the thread starts of a chapter that are
+// anchored and not yet detached, locking them in tx.
+func GetAnchoredChapterComments(tx *gorm.DB, chapterID string) ([]model.ChapterComment, error) {
+	var comments []model.ChapterComment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("chapter_id = ? AND parent_id IS NULL AND detached = ? AND (range_start IS NOT NULL OR anchor_id <> '')", chapterID, false).
+		Find(&comments).Error
+	return comments, err
+}
+
+// UpdateChapterCommentAnchor stores a re-mapped anchor without touching updated_at.
+func UpdateChapterCommentAnchor(tx *gorm.DB, comment *model.ChapterComment) error {
+	return tx.Model(comment).UpdateColumns(map[string]interface{}{
+		"range_start": comment.Start,
+		"range_end":   comment.End,
+		"detached":    comment.Detached,
+	}).Error
+}
+
+// DeleteChapterComment deletes a comment and, for a thread start, its replies.
+func DeleteChapterComment(commentID string) error {
+	return database.DB.Where("id = ? OR parent_id = ?", commentID, commentID).Delete(&model.ChapterComment{}).Error
+}
+
+// CountUnresolvedComments returns the number of unresolved threads per chapter of
+// a novel.
+func CountUnresolvedComments(novelIDs []uuid.UUID) (map[uuid.UUID]int, error) {
+	counts := make(map[uuid.UUID]int)
+	if len(novelIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		ChapterID uuid.UUID
+		Count     int
+	}
+	err := database.DB.Model(&model.ChapterComment{}).
+		Select("chapter_id, COUNT(*) AS count").
+		Where("novel_id IN ? AND parent_id IS NULL AND resolved = ?", novelIDs, false).
+		Group("chapter_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ChapterID] = row.Count
+	}
+	return counts, nil
+}
+
+// GetCommentsMentioningUser returns the comments that mention the user, newest
+// first.
+func GetCommentsMentioningUser(userID uint, limit int) ([]model.ChapterComment, error) {
+	var comments []model.ChapterComment
+	err := database.DB.
+		Where("JSON_CONTAINS(mentions, ?)", strconv.FormatUint(uint64(userID), 10)).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&comments).Error
+	return comments, err
+}
@@ -24,26 +24,40 @@ func FindDerivedContentByID(itemID string) (*model.DerivedContent, error) {
 }
 
 func CreateDerivedContent(item *model.DerivedContent) error {
-	return database.DB.Create(item).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, item.NovelID); err != nil {
+			return err
+		}
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, upsertChange(item.NovelID, model.ChangeEntityDerivedContent, item.ID))
+	})
 }
 
 func UpdateDerivedContent(item *model.DerivedContent) error {
-	return database.DB.Save(item).Error
+	return saveWithRevision(item, &item.Revision, nil, upsertChange(item.NovelID, model.ChangeEntityDerivedContent, item.ID))
 }
 
 func DeleteDerivedContent(itemID string) error {
-	result := database.DB.Delete(&model.DerivedContent{}, "id = ?", itemID)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("derived content not found")
-	}
-	return nil
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovelOf(tx, &model.DerivedContent{}, itemID); err != nil {
+			return err
+		}
+		deleted, err := deleteWithChanges(tx, &model.DerivedContent{}, model.ChangeEntityDerivedContent, "id = ?", itemID)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return errors.New("derived content not found")
+		}
+		return nil
+	})
 }
 
 func DeleteDerivedContentForSource(tx *gorm.DB, sourceID string) error {
-	return tx.Where("source_id = ?", sourceID).Delete(&model.DerivedContent{}).Error
+	_, err := deleteWithChanges(tx, &model.DerivedContent{}, model.ChangeEntityDerivedContent, "source_id = ?", sourceID)
+	return err
 }
 
 // Note DAO
@@ -62,20 +76,33 @@ func FindNoteByID(noteID string) (*model.Note, error) {
 }
 
 func CreateNote(note *model.Note) error {
-	return database.DB.Create(note).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, note.NovelID); err != nil {
+			return err
+		}
+		if err := tx.Create(note).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, upsertChange(note.NovelID, model.ChangeEntityNote, note.ID))
+	})
 }
 
 func UpdateNote(note *model.Note) error {
-	return database.DB.Save(note).Error
+	return saveWithRevision(note, &note.Revision, nil, upsertChange(note.NovelID, model.ChangeEntityNote, note.ID))
 }
 
 func DeleteNote(noteID string) error {
-	result := database.DB.Delete(&model.Note{}, "id = ?", noteID)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("note not found")
-	}
-	return nil
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovelOf(tx, &model.Note{}, noteID); err != nil {
+			return err
+		}
+		deleted, err := deleteWithChanges(tx, &model.Note{}, model.ChangeEntityNote, "id = ?", noteID)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return errors.New("note not found")
+		}
+		return nil
+	})
 }
@@ -2,17 +2,34 @@ package dao
 
 import (
 	"errors"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"st-novel-go/src/database"
 	"st-novel-go/src/novel/model"
 )
 
 func CreateVolume(volume *model.Volume) error {
-	return database.DB.Create(volume).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, volume.NovelID); err != nil {
+			return err
+		}
+		if err := tx.Create(volume).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, upsertChange(volume.NovelID, model.ChangeEntityVolume, volume.ID))
+	})
 }
 
 func CreateChapter(chapter *model.Chapter) error {
-	return database.DB.Create(chapter).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, chapter.NovelID); err != nil {
+			return err
+		}
+		if err := tx.Create(chapter).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, upsertChange(chapter.NovelID, model.ChangeEntityChapter, chapter.ID))
+	})
 }
 
 func FindVolumeByID(volumeID string) (*model.Volume, error) {
@@ -59,15 +76,32 @@ func GetLastUpdatedChapterForNovel(novelID string) (*model.Chapter, error) {
 }
 
 func UpdateVolume(volume *model.Volume) error {
-	return database.DB.Save(volume).Error
+	return saveWithRevision(volume, &volume.Revision, nil, upsertChange(volume.NovelID, model.ChangeEntityVolume, volume.ID))
 }
 
+// UpdateChapter saves chapter unless it was changed since it was loaded. The
+// ChapterContentChanged hooks run in the same transaction, against the content
+// the save replaces.
 func UpdateChapter(chapter *model.Chapter) error {
-	return database.DB.Save(chapter).Error
+	beforeSave := func(tx *gorm.DB) error {
+		contents, err := lockChapterContents(tx, []uuid.UUID{chapter.ID})
+		if err != nil {
+			return err
+		}
+		before, ok := contents[chapter.ID]
+		if !ok {
+			return nil
+		}
+		return runChapterContentChangedHooks(tx, chapter.ID.String(), before, chapter.Content)
+	}
+	return saveWithRevision(chapter, &chapter.Revision, beforeSave, upsertChange(chapter.NovelID, model.ChangeEntityChapter, chapter.ID))
 }
 
 func DeleteVolume(volumeID string) error {
 	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovelOf(tx, &model.Volume{}, volumeID); err != nil {
+			return err
+		}
 		var chapters []model.Chapter
 		if err := tx.Where("volume_id = ?", volumeID).Find(&chapters).Error; err != nil {
 			return err
@@ -80,9 +114,12 @@ func DeleteVolume(volumeID string) error {
 			if err := DeleteDerivedContentForSource(tx, chapter.ID.String()); err != nil {
 				return err
 			}
+			if err := runChapterDeletedHooks(tx, chapter.ID.String()); err != nil {
+				return err
+			}
 		}
 
-		if err := tx.Where("volume_id = ?", volumeID).Delete(&model.Chapter{}).Error; err != nil {
+		if _, err := deleteWithChanges(tx, &model.Chapter{}, model.ChangeEntityChapter, "volume_id = ?", volumeID); err != nil {
 			return err
 		}
 
@@ -93,11 +130,11 @@ func DeleteVolume(volumeID string) error {
 			return err
 		}
 
-		result := tx.Where("id = ?", volumeID).Delete(&model.Volume{})
-		if result.Error != nil {
-			return result.Error
+		deleted, err := deleteWithChanges(tx, &model.Volume{}, model.ChangeEntityVolume, "id = ?", volumeID)
+		if err != nil {
+			return err
 		}
-		if result.RowsAffected == 0 {
+		if deleted == 0 {
 			return errors.New("volume not found")
 		}
 
@@ -107,18 +144,24 @@ func DeleteVolume(volumeID string) error {
 
 func DeleteChapter(chapterID string) error {
 	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovelOf(tx, &model.Chapter{}, chapterID); err != nil {
+			return err
+		}
 		if err := DeleteHistoryForDocument(tx, chapterID); err != nil {
 			return err
 		}
 		if err := DeleteDerivedContentForSource(tx, chapterID); err != nil {
 			return err
 		}
+		if err := runChapterDeletedHooks(tx, chapterID); err != nil {
+			return err
+		}
 
-		result := tx.Delete(&model.Chapter{}, "id = ?", chapterID)
-		if result.Error != nil {
-			return result.Error
+		deleted, err := deleteWithChanges(tx, &model.Chapter{}, model.ChangeEntityChapter, "id = ?", chapterID)
+		if err != nil {
+			return err
 		}
-		if result.RowsAffected == 0 {
+		if deleted == 0 {
 			return errors.New("chapter not found")
 		}
 		return nil
@@ -126,23 +169,47 @@ func DeleteChapter(chapterID string) error {
 }
 
 func UpdateVolumeOrder(novelID string, orderedIDs []string) error {
+	novelUUID, err := uuid.Parse(novelID)
+	if err != nil {
+		return err
+	}
 	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, novelUUID); err != nil {
+			return err
+		}
+		var changes []model.NovelChange
 		for i, id := range orderedIDs {
-			if err := tx.Model(&model.Volume{}).Where("id = ? AND novel_id = ?", id, novelID).Update("order", i).Error; err != nil {
-				return err
+			result := tx.Model(&model.Volume{}).Where("id = ? AND novel_id = ?", id, novelID).Update("order", i)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				changes = append(changes, model.NovelChange{NovelID: novelUUID, EntityType: model.ChangeEntityVolume, EntityID: id, Op: model.ChangeOpUpsert})
 			}
 		}
-		return nil
+		return recordChanges(tx, changes...)
 	})
 }
 
 func UpdateChapterOrder(volumeID string, orderedIDs []string) error {
 	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var volume model.Volume
+		if err := tx.Select("id", "novel_id").First(&volume, "id = ?", volumeID).Error; err != nil {
+			return err
+		}
+		if err := lockNovels(tx, volume.NovelID); err != nil {
+			return err
+		}
+		var changes []model.NovelChange
 		for i, id := range orderedIDs {
-			if err := tx.Model(&model.Chapter{}).Where("id = ? AND volume_id = ?", id, volumeID).Update("order", i).Error; err != nil {
-				return err
+			result := tx.Model(&model.Chapter{}).Where("id = ? AND volume_id = ?", id, volumeID).Update("order", i)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				changes = append(changes, model.NovelChange{NovelID: volume.NovelID, EntityType: model.ChangeEntityChapter, EntityID: id, Op: model.ChangeOpUpsert})
 			}
 		}
-		return nil
+		return recordChanges(tx, changes...)
 	})
 }
@@ -2,35 +2,151 @@
 package dao
 
 import (
+	"errors"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"st-novel-go/src/database"
 	"st-novel-go/src/novel/model"
+	"time"
 )
 
 func CreateHistoryVersion(version *model.HistoryVersion) error {
 	return database.DB.Create(version).Error
 }
 
-func GetHistoryForDocument(documentID string, userID uint) ([]model.HistoryVersion, error) {
+// FindHistoryVersionByID returns a version saved by any user. Callers check access
+// to the document.
+func FindHistoryVersionByID(versionID string) (*model.HistoryVersion, error) {
+	var version model.HistoryVersion
+	err := database.DB.
+		Where("id = ?", versionID).
+		First(&version).Error
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func DeleteHistoryForDocument(tx *gorm.DB, documentID string) error {
+	return tx.Where("document_id = ?", documentID).Delete(&model.HistoryVersion{}).Error
+}
+
+// GetHistoryChainForDocument returns every version of a document, oldest first,
+// regardless of who saved it, so that delta chains can be rebuilt.
+func GetHistoryChainForDocument(documentID string) ([]model.HistoryVersion, error) {
 	var versions []model.HistoryVersion
 	err := database.DB.
-		Where("document_id = ? AND user_id = ?", documentID, userID).
-		Order("created_at DESC").
+		Where("document_id = ?", documentID).
+		Order("created_at ASC").
 		Find(&versions).Error
 	return versions, err
 }
 
-func FindHistoryVersionByID(versionID string, userID uint) (*model.HistoryVersion, error) {
-	var version model.HistoryVersion
+// GetHistorySummariesForDocument returns every version of a document, oldest first,
+// without its content or delta.
+func GetHistorySummariesForDocument(documentID string) ([]model.HistoryVersion, error) {
+	var versions []model.HistoryVersion
 	err := database.DB.
-		Where("id = ? AND user_id = ?", versionID, userID).
-		First(&version).Error
+		Omit("content", "delta").
+		Where("document_id = ?", documentID).
+		Order("created_at ASC").
+		Find(&versions).Error
+	return versions, err
+}
+
+// SetHistoryVersionSummary stores the summary of a version.
+func SetHistoryVersionSummary(versionID uuid.UUID, wordCount int, preview string) error {
+	return database.DB.Model(&model.HistoryVersion{}).Where("id = ?", versionID).UpdateColumns(map[string]interface{}{
+		"word_count": wordCount,
+		"preview":    preview,
+		"summarized": true,
+	}).Error
+}
+
+// GetHistorySinceLatestSnapshot returns the latest snapshot of a document and the
+// versions saved after it, oldest first. These are enough to rebuild the latest
+// version.
+func GetHistorySinceLatestSnapshot(documentID string) ([]model.HistoryVersion, error) {
+	var snapshot model.HistoryVersion
+	err := database.DB.
+		Where("document_id = ? AND kind = ?", documentID, model.HistoryKindSnapshot).
+		Order("created_at DESC").
+		First(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &version, nil
+	var versions []model.HistoryVersion
+	err = database.DB.
+		Where("document_id = ? AND created_at >= ?", documentID, snapshot.CreatedAt).
+		Order("created_at ASC").
+		Find(&versions).Error
+	return versions, err
 }
 
-func DeleteHistoryForDocument(tx *gorm.DB, documentID string) error {
-	return tx.Where("document_id = ?", documentID).Delete(&model.HistoryVersion{}).Error
+// GetDocumentsWithHistoryBefore returns, ordered by ID, up to limit documents after
+// afterID that have more than one version saved before the given time.
+func GetDocumentsWithHistoryBefore(before time.Time, afterID string, limit int) ([]string, error) {
+	var documentIDs []string
+	err := database.DB.Model(&model.HistoryVersion{}).
+		Select("document_id").
+		Where("created_at < ? AND document_id > ?", before, afterID).
+		Group("document_id").
+		Having("COUNT(*) > 1").
+		Order("document_id ASC").
+		Limit(limit).
+		Pluck("document_id", &documentIDs).Error
+	return documentIDs, err
+}
+
+// RewriteHistory saves the re-encoded versions of a document and permanently
+// deletes the versions dropped by the retention policy. A dropped version that a
+// remaining delta is still based on, such as one saved while the document was being
+// compacted, is kept.
+func RewriteHistory(updated []model.HistoryVersion, deletedIDs []uuid.UUID) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, version := range updated {
+			if err := tx.Model(&model.HistoryVersion{}).Where("id = ?", version.ID).Updates(map[string]interface{}{
+				"kind":    version.Kind,
+				"base_id": version.BaseID,
+				"content": version.Content,
+				"delta":   version.Delta,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if len(deletedIDs) == 0 {
+			return nil
+		}
+		// 被保留的版本引用的基准版本不能删除；保留后它自己的基准同样要保留，直到不再变化
+		for len(deletedIDs) > 0 {
+			var bases []uuid.UUID
+			if err := tx.Model(&model.HistoryVersion{}).
+				Where("base_id IN ? AND id NOT IN ?", deletedIDs, deletedIDs).
+				Distinct("base_id").
+				Pluck("base_id", &bases).Error; err != nil {
+				return err
+			}
+			if len(bases) == 0 {
+				break
+			}
+			needed := make(map[uuid.UUID]bool, len(bases))
+			for _, id := range bases {
+				needed[id] = true
+			}
+			var deletable []uuid.UUID
+			for _, id := range deletedIDs {
+				if !needed[id] {
+					deletable = append(deletable, id)
+				}
+			}
+			deletedIDs = deletable
+		}
+		if len(deletedIDs) == 0 {
+			return nil
+		}
+		return tx.Unscoped().Where("id IN ?", deletedIDs).Delete(&model.HistoryVersion{}).Error
+	})
 }
@@ -0,0 +1,126 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+)
+
+// ErrInsufficientRole is returned when a member's role does not allow an action.
+var ErrInsufficientRole = errors.New("your role on this novel does not allow this action")
+
+// GetNovelRole returns the user's role on a novel: owner for its creator, the role
+// of an accepted membership otherwise, or "" when the user has no access.
+func GetNovelRole(novel model.Novel, userID uint) (string, error) {
+	if novel.UserID == userID {
+		return model.RoleOwner, nil
+	}
+	var member model.NovelMember
+	err := database.DB.Where("novel_id = ? AND user_id = ? AND status = ?", novel.ID, userID, model.MemberStatusAccepted).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// FindNovelWithRole returns the novel when the user's role on it is at least
+// minRole. Users without access get gorm.ErrRecordNotFound, as if the novel did
+// not exist; members with a lower role get ErrInsufficientRole.
+func FindNovelWithRole(novelID string, userID uint, minRole string) (model.Novel, error) {
+	var novel model.Novel
+	if err := database.DB.Where("id = ?", novelID).First(&novel).Error; err != nil {
+		return model.Novel{}, err
+	}
+	role, err := GetNovelRole(novel, userID)
+	if err != nil {
+		return model.Novel{}, err
+	}
+	if role == "" {
+		return model.Novel{}, gorm.ErrRecordNotFound
+	}
+	if !model.RoleAtLeast(role, minRole) {
+		return model.Novel{}, ErrInsufficientRole
+	}
+	return novel, nil
+}
+
+func CreateNovelMember(member *model.NovelMember) error {
+	return database.DB.Create(member).Error
+}
+
+func UpdateNovelMember(member *model.NovelMember) error {
+	return database.DB.Save(member).Error
+}
+
+func FindNovelMemberByID(memberID string) (*model.NovelMember, error) {
+	var member model.NovelMember
+	if err := database.DB.Where("id = ?", memberID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// FindNovelMember returns the user's membership of a novel, pending or accepted.
+func FindNovelMember(novelID string, userID uint) (*model.NovelMember, error) {
+	var member model.NovelMember
+	if err := database.DB.Where("novel_id = ? AND user_id = ?", novelID, userID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetNovelMembers(novelID string) ([]model.NovelMember, error) {
+	var members []model.NovelMember
+	err := database.DB.Where("novel_id = ?", novelID).Order("created_at ASC").Find(&members).Error
+	return members, err
+}
+
+// PendingInvitation is an invitation with the title of the novel it is for.
+type PendingInvitation struct {
+	model.NovelMember
+	NovelTitle string
+}
+
+// GetPendingInvitations returns the invitations waiting for the user's answer,
+// newest first. Invitations to novels in the trash are left out.
+func GetPendingInvitations(userID uint) ([]PendingInvitation, error) {
+	var invitations []PendingInvitation
+	err := database.DB.Model(&model.NovelMember{}).
+		Select("novel_members.*, novels.title AS novel_title").
+		Joins("JOIN novels ON novels.id = novel_members.novel_id AND novels.deleted_at IS NULL").
+		Where("novel_members.user_id = ? AND novel_members.status = ?", userID, model.MemberStatusPending).
+		Order("novel_members.created_at DESC").
+		Scan(&invitations).Error
+	return invitations, err
+}
+
+// GetSharedNovels returns the novels the user has accepted to join, most recently
+// updated first, with the user's role on each.
+func GetSharedNovels(userID uint) ([]model.Novel, map[string]string, error) {
+	var members []model.NovelMember
+	if err := database.DB.Where("user_id = ? AND status = ?", userID, model.MemberStatusAccepted).Find(&members).Error; err != nil {
+		return nil, nil, err
+	}
+	roles := make(map[string]string, len(members))
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		roles[m.NovelID.String()] = m.Role
+		ids = append(ids, m.NovelID.String())
+	}
+	var novels []model.Novel
+	if len(ids) == 0 {
+		return novels, roles, nil
+	}
+	err := database.DB.Where("id IN ?", ids).Order("updated_at desc").Find(&novels).Error
+	return novels, roles, err
+}
+
+// DeleteNovelMember removes a membership for good, so that the user can be invited
+// again.
+func DeleteNovelMember(memberID string) error {
+	return database.DB.Unscoped().Where("id = ?", memberID).Delete(&model.NovelMember{}).Error
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"st-novel-go/src/database"
 	"st-novel-go/src/novel/model"
 )
@@ -57,7 +58,9 @@ func CreateNovel(novel *model.Novel) error {
 			return err
 		}
 
-		return nil
+		return recordChanges(tx,
+			upsertChange(novel.ID, model.ChangeEntityNovel, novel.ID),
+			upsertChange(novel.ID, model.ChangeEntityVolume, defaultVolume.ID))
 	})
 }
 
@@ -67,45 +70,91 @@ func FindNovelByID(novelID string, userID uint) (model.Novel, error) {
 	return novel, err
 }
 
+// novelMetadataColumns are the columns that UpdateNovel writes. The JSON fields are
+// left out so that a concurrent node change is not overwritten.
+var novelMetadataColumns = []string{"title", "description", "cover", "tags", "status", "category", "reference_novel_ids", "updated_at"}
+
+// UpdateNovel saves the metadata of a novel.
 func UpdateNovel(novel *model.Novel) error {
-	return database.DB.Save(novel).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, novel.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(novel).Select(novelMetadataColumns).Updates(novel).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, upsertChange(novel.ID, model.ChangeEntityNovel, novel.ID))
+	})
+}
+
+// novelJSONFields 字段白名单：防止通过 fieldName 注入更新非预期的列。值为变更日志中节点所属的类型
+var novelJSONFields = map[string]string{
+	"settings_data":        "settings",
+	"plot_custom_data":     "custom-plot",
+	"analysis_custom_data": "custom-analysis",
+	"others_custom_data":   "custom-others",
 }
 
+// UpdateNovelJSONField replaces the value of a JSON field. It requires the editor role.
 func UpdateNovelJSONField(novelID string, userID uint, fieldName string, data interface{}) error {
-	// 字段白名单：防止通过 fieldName 注入更新非预期的列
-	allowedFields := map[string]bool{
-		"settings_data":        true,
-		"plot_custom_data":     true,
-		"analysis_custom_data": true,
-		"others_custom_data":   true,
-	}
-	if !allowedFields[fieldName] {
+	return ModifyNovelJSONField(novelID, userID, fieldName, func([]byte) (interface{}, error) {
+		return data, nil
+	})
+}
+
+// ModifyNovelJSONField passes the stored value of a JSON field to modify and saves
+// what it returns. The novel row stays locked in between, so that concurrent
+// changes to the same field are not lost. The nodes that changed are recorded in
+// the change log. It requires the editor role.
+func ModifyNovelJSONField(novelID string, userID uint, fieldName string, modify func(data []byte) (interface{}, error)) error {
+	nodeType, ok := novelJSONFields[fieldName]
+	if !ok {
 		return fmt.Errorf("update of field '%s' is not allowed", fieldName)
 	}
-
-	// Verify user ownership first
-	_, err := FindNovelByID(novelID, userID)
+	novel, err := FindNovelWithRole(novelID, userID, model.RoleEditor)
 	if err != nil {
 		return err
 	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal data for field %s: %w", fieldName, err)
-	}
-
-	return database.DB.Model(&model.Novel{}).Where("id = ?", novelID).Update(fieldName, jsonData).Error
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var raw struct{ Data []byte }
+		err := tx.Model(&model.Novel{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select(fieldName+" AS data").
+			Where("id = ?", novelID).
+			Take(&raw).Error
+		if err != nil {
+			return err
+		}
+		data, err := modify(raw.Data)
+		if err != nil {
+			return err
+		}
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal data for field %s: %w", fieldName, err)
+		}
+		if err := tx.Model(&model.Novel{}).Where("id = ?", novelID).Update(fieldName, jsonData).Error; err != nil {
+			return err
+		}
+		return recordChanges(tx, nodeChanges(novel.ID, nodeType, raw.Data, jsonData)...)
+	})
 }
 
 func SoftDeleteNovelByID(novelID string, userID uint) error {
-	result := database.DB.Where("id = ? AND user_id = ?", novelID, userID).Delete(&model.Novel{})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("novel not found or permission denied")
-	}
-	return nil
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", novelID, userID).Delete(&model.Novel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("novel not found or permission denied")
+		}
+		novelUUID, _ := uuid.Parse(novelID)
+		if err := recordChanges(tx, deleteChange(novelUUID, model.ChangeEntityNovel, novelUUID)); err != nil {
+			return err
+		}
+		return runNovelTrashedHooks(tx, novelID, userID)
+	})
 }
 
 func GetTrashedNovelsByUserID(userID uint) ([]model.Novel, error) {
@@ -115,14 +164,25 @@ func GetTrashedNovelsByUserID(userID uint) ([]model.Novel, error) {
 }
 
 func RestoreNovelByID(novelID string, userID uint) error {
-	result := database.DB.Unscoped().Model(&model.Novel{}).Where("id = ? AND user_id = ?", novelID, userID).Update("deleted_at", nil)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("trashed novel not found or permission denied")
-	}
-	return nil
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var novel model.Novel
+		if err := tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", novelID, userID).First(&novel).Error; err != nil {
+			return errors.New("trashed novel not found or permission denied")
+		}
+
+		result := tx.Unscoped().Model(&model.Novel{}).Where("id = ? AND user_id = ?", novelID, userID).Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("trashed novel not found or permission denied")
+		}
+		if err := recordChanges(tx, upsertChange(novel.ID, model.ChangeEntityNovel, novel.ID)); err != nil {
+			return err
+		}
+
+		return runNovelRestoredHooks(tx, novelID, userID, novel.DeletedAt.Time)
+	})
 }
 
 func PermanentlyDeleteNovelByID(novelID string, userID uint) error {
@@ -135,6 +195,9 @@ func PermanentlyDeleteNovelByID(novelID string, userID uint) error {
 			}
 			return err
 		}
+		if err := lockNovels(tx, novel.ID); err != nil {
+			return err
+		}
 
 		// 2. Collect all document IDs for history cleanup
 		docIDs := []string{novel.ID.String()}
@@ -146,7 +209,8 @@ func PermanentlyDeleteNovelByID(novelID string, userID uint) error {
 		}
 
 		// 3. Delete related HistoryVersions
-		if err := tx.Where("document_id IN ?", docIDs).Delete(&model.HistoryVersion{}).Error; err != nil {
+		// 设定树节点的历史以 "<novelId>:" 为前缀
+		if err := tx.Where("document_id IN ? OR document_id LIKE ?", docIDs, novel.ID.String()+":%").Delete(&model.HistoryVersion{}).Error; err != nil {
 			return err
 		}
 
@@ -155,7 +219,35 @@ func PermanentlyDeleteNovelByID(novelID string, userID uint) error {
 			return err
 		}
 
-		// 5. Permanently delete the novel. GORM's `OnDelete:CASCADE` will handle
+		// 5. Delete the novel's snapshots
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&model.NovelSnapshot{}).Error; err != nil {
+			return err
+		}
+
+		// 6. Delete the novel's members and pending invitations
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&model.NovelMember{}).Error; err != nil {
+			return err
+		}
+
+		// 7. Delete the comments on the novel's chapters
+		if err := tx.Unscoped().Where("novel_id = ?", novel.ID).Delete(&model.ChapterComment{}).Error; err != nil {
+			return err
+		}
+
+		// 8. Delete the novel's change log
+		if err := tx.Where("novel_id = ?", novel.ID).Delete(&model.NovelChange{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("novel_id = ?", novel.ID).Delete(&model.NovelChangeHorizon{}).Error; err != nil {
+			return err
+		}
+
+		// 9. Let other modules delete what they keep for the novel (e.g. AI conversations)
+		if err := runNovelDeletedHooks(tx, novel.ID.String()); err != nil {
+			return err
+		}
+
+		// 10. Permanently delete the novel. GORM's `OnDelete:CASCADE` will handle
 		// Volumes, Chapters, DerivedContents, and Notes.
 		result := tx.Unscoped().Delete(&novel)
 		if result.Error != nil {
@@ -0,0 +1,119 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/novel/model"
+	"time"
+)
+
+// NovelHooks lets other modules keep their own rows in step with novels and
+// chapters without this package depending on them. Every hook runs inside the
+// transaction of the change, so returning an error rolls the change back.
+type NovelHooks struct {
+	// NovelTrashed runs when a novel is moved to the trash.
+	NovelTrashed func(tx *gorm.DB, novelID string, userID uint) error
+	// NovelRestored runs when a novel comes back from the trash it was moved to at
+	// trashedAt.
+	NovelRestored func(tx *gorm.DB, novelID string, userID uint, trashedAt time.Time) error
+	// NovelDeleted runs before a novel is permanently deleted.
+	NovelDeleted func(tx *gorm.DB, novelID string) error
+	// ChapterDeleted runs before a chapter is deleted.
+	ChapterDeleted func(tx *gorm.DB, chapterID string) error
+	// ChapterContentChanged runs when the content of an existing chapter is
+	// overwritten. The chapter row is locked, so before is the content the new one
+	// replaces.
+	ChapterContentChanged func(tx *gorm.DB, chapterID, before, after string) error
+}
+
+var novelHooks []NovelHooks
+
+// RegisterNovelHooks adds hooks that run on novel and chapter lifecycle changes.
+// It must be called before the server starts handling requests.
+func RegisterNovelHooks(hooks NovelHooks) {
+	novelHooks = append(novelHooks, hooks)
+}
+
+func runNovelTrashedHooks(tx *gorm.DB, novelID string, userID uint) error {
+	for _, hooks := range novelHooks {
+		if hooks.NovelTrashed != nil {
+			if err := hooks.NovelTrashed(tx, novelID, userID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runNovelRestoredHooks(tx *gorm.DB, novelID string, userID uint, trashedAt time.Time) error {
+	for _, hooks := range novelHooks {
+		if hooks.NovelRestored != nil {
+			if err := hooks.NovelRestored(tx, novelID, userID, trashedAt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runNovelDeletedHooks(tx *gorm.DB, novelID string) error {
+	for _, hooks := range novelHooks {
+		if hooks.NovelDeleted != nil {
+			if err := hooks.NovelDeleted(tx, novelID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runChapterDeletedHooks(tx *gorm.DB, chapterID string) error {
+	for _, hooks := range novelHooks {
+		if hooks.ChapterDeleted != nil {
+			if err := hooks.ChapterDeleted(tx, chapterID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runChapterContentChangedHooks(tx *gorm.DB, chapterID, before, after string) error {
+	if before == after {
+		return nil
+	}
+	for _, hooks := range novelHooks {
+		if hooks.ChapterContentChanged != nil {
+			if err := hooks.ChapterContentChanged(tx, chapterID, before, after); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lockChapterContents locks the chapters with the given IDs, including ones in the
+// trash, and returns their current content. Chapters that do not exist yet are
+// left out.
+func lockChapterContents(tx *gorm.DB, chapterIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	contents := make(map[uuid.UUID]string, len(chapterIDs))
+	if len(chapterIDs) == 0 {
+		return contents, nil
+	}
+	var rows []struct {
+		ID      uuid.UUID
+		Content string
+	}
+	if err := tx.Unscoped().Model(&model.Chapter{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id, content").
+		Where("id IN ?", chapterIDs).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		contents[row.ID] = row.Content
+	}
+	return contents, nil
+}
@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"st-novel-go/src/database"
@@ -11,9 +12,12 @@ type FullProjectData struct {
 	Novel           model.Novel
 	DerivedContents []model.DerivedContent
 	Notes           []model.Note
+	// UnresolvedComments 为各章节未解决的评论串数量，快照中不保存
+	UnresolvedComments map[uuid.UUID]int
 }
 
-func GetFullNovelProject(novelID string, userID uint) (*FullProjectData, error) {
+// GetFullNovelProject loads a novel with all its content. Callers check access.
+func GetFullNovelProject(novelID string) (*FullProjectData, error) {
 	var novel model.Novel
 	if err := database.DB.
 		Preload("Volumes", func(db *gorm.DB) *gorm.DB {
@@ -22,7 +26,7 @@ func GetFullNovelProject(novelID string, userID uint) (*FullProjectData, error)
 		Preload("Volumes.Chapters", func(db *gorm.DB) *gorm.DB {
 			return db.Order("`order` ASC")
 		}).
-		Where("id = ? AND user_id = ?", novelID, userID).
+		Where("id = ?", novelID).
 		First(&novel).Error; err != nil {
 		return nil, err
 	}
@@ -59,12 +63,21 @@ func GetAllNovelProjectsForUser(userID uint) ([]model.Novel, error) {
 
 func UpsertNovelProjectWithData(novel *model.Novel) error {
 	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// 覆盖已有小说时与原有的设定树比较，记录节点变更
+		if err := lockNovels(tx, novel.ID); err != nil {
+			return err
+		}
+		var previous model.Novel
+		if err := tx.Unscoped().Omit(clause.Associations).Where("id = ?", novel.ID).Limit(1).Find(&previous).Error; err != nil {
+			return err
+		}
 		if err := tx.Clauses(clause.OnConflict{
 			UpdateAll: true,
 		}).Create(novel).Error; err != nil {
 			return err
 		}
 
+		changes := append(novelNodeChanges(&previous, novel), upsertChange(novel.ID, model.ChangeEntityNovel, novel.ID))
 		for i := range novel.Volumes {
 			novel.Volumes[i].NovelID = novel.ID
 			if err := tx.Clauses(clause.OnConflict{
@@ -73,16 +86,28 @@ func UpsertNovelProjectWithData(novel *model.Novel) error {
 				return err
 			}
 			for j := range novel.Volumes[i].Chapters {
-				novel.Volumes[i].Chapters[j].NovelID = novel.ID
-				novel.Volumes[i].Chapters[j].VolumeID = novel.Volumes[i].ID
+				chapter := &novel.Volumes[i].Chapters[j]
+				chapter.NovelID = novel.ID
+				chapter.VolumeID = novel.Volumes[i].ID
+				contentsBefore, err := lockChapterContents(tx, []uuid.UUID{chapter.ID})
+				if err != nil {
+					return err
+				}
 				if err := tx.Clauses(clause.OnConflict{
 					UpdateAll: true,
-				}).Create(&novel.Volumes[i].Chapters[j]).Error; err != nil {
+				}).Create(chapter).Error; err != nil {
 					return err
 				}
+				if before, ok := contentsBefore[chapter.ID]; ok {
+					if err := runChapterContentChangedHooks(tx, chapter.ID.String(), before, chapter.Content); err != nil {
+						return err
+					}
+				}
+				changes = append(changes, upsertChange(novel.ID, model.ChangeEntityChapter, novel.Volumes[i].Chapters[j].ID))
 			}
+			changes = append(changes, upsertChange(novel.ID, model.ChangeEntityVolume, novel.Volumes[i].ID))
 		}
 
-		return nil
+		return recordChanges(tx, changes...)
 	})
 }
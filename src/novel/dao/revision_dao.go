@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+)
+
+// ErrRevisionConflict is returned when a row was changed by someone else after it was
+// loaded.
+var ErrRevisionConflict = errors.New("the document was modified by another session")
+
+// saveWithRevision updates every column of value and increments its revision, unless
+// the stored revision is no longer the one value was loaded with. Associations are
+// not saved. beforeSave, if not nil, runs in the same transaction before the update
+// and is rolled back with it on a conflict. The changes are recorded in the same
+// transaction.
+func saveWithRevision(value interface{}, revision *int64, beforeSave func(tx *gorm.DB) error, changes ...model.NovelChange) error {
+	expected := *revision
+	*revision = expected + 1
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockNovels(tx, changedNovels(changes)...); err != nil {
+			return err
+		}
+		if beforeSave != nil {
+			if err := beforeSave(tx); err != nil {
+				return err
+			}
+		}
+		result := tx.Model(value).
+			Select("*").
+			Omit("created_at", clause.Associations).
+			Where("revision = ?", expected).
+			Updates(value)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRevisionConflict
+		}
+		return recordChanges(tx, changes...)
+	})
+	if err != nil {
+		*revision = expected
+	}
+	return err
+}
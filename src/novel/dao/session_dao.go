@@ -0,0 +1,84 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+	"time"
+)
+
+// RecordWritingSave appends a save to the user's writing log.
+func RecordWritingSave(userID uint, novelID, chapterID uuid.UUID, added, removed int, at time.Time) error {
+	return database.DB.Create(&model.WritingSave{
+		UserID:       userID,
+		NovelID:      novelID,
+		ChapterID:    chapterID,
+		SavedAt:      at,
+		WordsAdded:   added,
+		WordsRemoved: removed,
+	}).Error
+}
+
+// writingSessions groups the saves selected by saves into sessions: a save starts a
+// new session of its chapter when the previous save of that chapter is more than
+// gap earlier.
+func writingSessions(saves *gorm.DB, gap time.Duration) *gorm.DB {
+	marked := saves.Select("id, user_id, novel_id, chapter_id, saved_at, words_added, words_removed, "+
+		"CASE WHEN TIMESTAMPDIFF(SECOND, LAG(saved_at) OVER (PARTITION BY user_id, chapter_id ORDER BY saved_at, id), saved_at) <= ? "+
+		"THEN 0 ELSE 1 END AS starts_session", int64(gap/time.Second))
+	numbered := database.DB.Table("(?) AS marked", marked).
+		Select("*, SUM(starts_session) OVER (PARTITION BY user_id, chapter_id ORDER BY saved_at, id) AS session_no")
+	return database.DB.Table("(?) AS numbered", numbered).
+		Select("MIN(id) AS id, user_id, novel_id, chapter_id, MIN(saved_at) AS started_at, MAX(saved_at) AS ended_at, " +
+			"SUM(words_added) AS words_added, SUM(words_removed) AS words_removed, COUNT(*) AS saves").
+		Group("user_id, novel_id, chapter_id, session_no")
+}
+
+type WritingDayTotal struct {
+	Date         string
+	Sessions     int
+	Seconds      int64
+	WordsAdded   int
+	WordsRemoved int
+}
+
+// GetWritingDayTotals sums the user's sessions per day of their start time.
+func GetWritingDayTotals(userID uint, from, to time.Time, gap time.Duration) ([]WritingDayTotal, error) {
+	saves := database.DB.Model(&model.WritingSave{}).Where("user_id = ? AND saved_at >= ? AND saved_at < ?", userID, from, to)
+	var totals []WritingDayTotal
+	err := database.DB.Table("(?) AS sessions", writingSessions(saves, gap)).
+		Select("DATE_FORMAT(started_at, '%Y-%m-%d') AS date, COUNT(*) AS sessions, " +
+			"COALESCE(SUM(TIMESTAMPDIFF(SECOND, started_at, ended_at)), 0) AS seconds, " +
+			"COALESCE(SUM(words_added), 0) AS words_added, COALESCE(SUM(words_removed), 0) AS words_removed").
+		Group("date").
+		Order("date ASC").
+		Find(&totals).Error
+	return totals, err
+}
+
+// GetWritingSessionsForNovel returns the sessions of a novel, newest first.
+func GetWritingSessionsForNovel(novelID uuid.UUID, userID uint, gap time.Duration, offset, limit int) ([]model.WritingSession, int64, error) {
+	saves := database.DB.Model(&model.WritingSave{}).Where("novel_id = ? AND user_id = ?", novelID, userID)
+	query := database.DB.Table("(?) AS sessions", writingSessions(saves, gap))
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var sessions []model.WritingSession
+	err := query.Order("started_at DESC, id DESC").Offset(offset).Limit(limit).Find(&sessions).Error
+	return sessions, total, err
+}
+
+// GetChapterTitles returns the titles of the chapters, including deleted ones.
+func GetChapterTitles(chapterIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	var chapters []model.Chapter
+	if err := database.DB.Unscoped().Select("id", "title").Where("id IN ?", chapterIDs).Find(&chapters).Error; err != nil {
+		return nil, err
+	}
+	titles := make(map[uuid.UUID]string, len(chapters))
+	for _, chapter := range chapters {
+		titles[chapter.ID] = chapter.Title
+	}
+	return titles, nil
+}
@@ -0,0 +1,192 @@
+package dao
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+)
+
+func CreateNovelSnapshot(snapshot *model.NovelSnapshot) error {
+	return database.DB.Create(snapshot).Error
+}
+
+func CountNovelSnapshots(novelID string) (int64, error) {
+	var count int64
+	err := database.DB.Model(&model.NovelSnapshot{}).Where("novel_id = ?", novelID).Count(&count).Error
+	return count, err
+}
+
+// GetNovelSnapshots lists the snapshots of a novel taken by any member, newest
+// first, without their data.
+func GetNovelSnapshots(novelID string) ([]model.NovelSnapshot, error) {
+	var snapshots []model.NovelSnapshot
+	err := database.DB.Omit("data").
+		Where("novel_id = ?", novelID).
+		Order("created_at DESC").
+		Find(&snapshots).Error
+	return snapshots, err
+}
+
+func FindNovelSnapshot(snapshotID, novelID string) (*model.NovelSnapshot, error) {
+	var snapshot model.NovelSnapshot
+	err := database.DB.Where("id = ? AND novel_id = ?", snapshotID, novelID).First(&snapshot).Error
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func DeleteNovelSnapshot(snapshotID, novelID string) (int64, error) {
+	result := database.DB.Unscoped().Where("id = ? AND novel_id = ?", snapshotID, novelID).Delete(&model.NovelSnapshot{})
+	return result.RowsAffected, result.Error
+}
+
+// SaveFullNovelProject writes a novel with its volumes, chapters, derived content
+// and notes in one transaction. Rows that already exist are overwritten, including
+// ones in the trash. When replace is true the novel must exist, and its content
+// that is not part of data is moved to the trash.
+func SaveFullNovelProject(data *FullProjectData, replace bool) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		novel := &data.Novel
+		var previous model.Novel
+		if replace {
+			if err := lockNovels(tx, novel.ID); err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Omit(clause.Associations).First(&previous, "id = ?", novel.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Omit(clause.Associations).Save(novel).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Omit(clause.Associations).Create(novel).Error; err != nil {
+			return err
+		}
+
+		var volumes []model.Volume
+		var chapters []model.Chapter
+		for _, volume := range novel.Volumes {
+			volume.NovelID = novel.ID
+			for _, chapter := range volume.Chapters {
+				chapter.NovelID = novel.ID
+				chapter.VolumeID = volume.ID
+				chapters = append(chapters, chapter)
+			}
+			volume.Chapters = nil
+			volumes = append(volumes, volume)
+		}
+		derivedContents := make([]model.DerivedContent, len(data.DerivedContents))
+		for i, item := range data.DerivedContents {
+			item.NovelID = novel.ID
+			derivedContents[i] = item
+		}
+		notes := make([]model.Note, len(data.Notes))
+		for i, note := range data.Notes {
+			note.NovelID = novel.ID
+			notes[i] = note
+		}
+
+		if replace {
+			// 快照中没有的内容移入回收站
+			trashMissing := func(value interface{}, entityType string, ids []uuid.UUID) error {
+				var err error
+				if len(ids) > 0 {
+					_, err = deleteWithChanges(tx, value, entityType, "novel_id = ? AND id NOT IN ?", novel.ID, ids)
+				} else {
+					_, err = deleteWithChanges(tx, value, entityType, "novel_id = ?", novel.ID)
+				}
+				return err
+			}
+			volumeIDs := make([]uuid.UUID, len(volumes))
+			for i := range volumes {
+				volumeIDs[i] = volumes[i].ID
+			}
+			chapterIDs := make([]uuid.UUID, len(chapters))
+			for i := range chapters {
+				chapterIDs[i] = chapters[i].ID
+			}
+			derivedIDs := make([]uuid.UUID, len(derivedContents))
+			for i := range derivedContents {
+				derivedIDs[i] = derivedContents[i].ID
+			}
+			noteIDs := make([]uuid.UUID, len(notes))
+			for i := range notes {
+				noteIDs[i] = notes[i].ID
+			}
+			if err := trashMissing(&model.Chapter{}, model.ChangeEntityChapter, chapterIDs); err != nil {
+				return err
+			}
+			if err := trashMissing(&model.Volume{}, model.ChangeEntityVolume, volumeIDs); err != nil {
+				return err
+			}
+			if err := trashMissing(&model.DerivedContent{}, model.ChangeEntityDerivedContent, derivedIDs); err != nil {
+				return err
+			}
+			if err := trashMissing(&model.Note{}, model.ChangeEntityNote, noteIDs); err != nil {
+				return err
+			}
+		}
+
+		// 覆盖已有记录时递增 revision，使基于旧版本的编辑产生冲突
+		upsert := func(value interface{}, columns ...string) error {
+			assignments := append(clause.AssignmentColumns(append(columns, "novel_id", "updated_at", "deleted_at")),
+				clause.Assignment{Column: clause.Column{Name: "revision"}, Value: gorm.Expr("revision + 1")})
+			return tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "id"}},
+				DoUpdates: assignments,
+			}).Create(value).Error
+		}
+		if len(volumes) > 0 {
+			if err := upsert(&volumes, "title", "content", "order"); err != nil {
+				return err
+			}
+		}
+		if len(chapters) > 0 {
+			chapterIDs := make([]uuid.UUID, len(chapters))
+			for i := range chapters {
+				chapterIDs[i] = chapters[i].ID
+			}
+			contentsBefore, err := lockChapterContents(tx, chapterIDs)
+			if err != nil {
+				return err
+			}
+			if err := upsert(&chapters, "volume_id", "title", "word_count", "content", "status", "order"); err != nil {
+				return err
+			}
+			for _, chapter := range chapters {
+				if before, ok := contentsBefore[chapter.ID]; ok {
+					if err := runChapterContentChangedHooks(tx, chapter.ID.String(), before, chapter.Content); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if len(derivedContents) > 0 {
+			if err := upsert(&derivedContents, "source_id", "type", "title", "content"); err != nil {
+				return err
+			}
+		}
+		if len(notes) > 0 {
+			if err := upsert(&notes, "title", "content"); err != nil {
+				return err
+			}
+		}
+
+		changes := append(novelNodeChanges(&previous, novel), upsertChange(novel.ID, model.ChangeEntityNovel, novel.ID))
+		for _, volume := range volumes {
+			changes = append(changes, upsertChange(novel.ID, model.ChangeEntityVolume, volume.ID))
+		}
+		for _, chapter := range chapters {
+			changes = append(changes, upsertChange(novel.ID, model.ChangeEntityChapter, chapter.ID))
+		}
+		for _, item := range derivedContents {
+			changes = append(changes, upsertChange(novel.ID, model.ChangeEntityDerivedContent, item.ID))
+		}
+		for _, note := range notes {
+			changes = append(changes, upsertChange(novel.ID, model.ChangeEntityNote, note.ID))
+		}
+		return recordChanges(tx, changes...)
+	})
+}
@@ -0,0 +1,149 @@
+package dao
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"st-novel-go/src/database"
+	"st-novel-go/src/novel/model"
+)
+
+// AddDailyWordStat adds one save with the given word changes to the day's totals.
+func AddDailyWordStat(userID uint, novelID uuid.UUID, date string, added, removed int) error {
+	stat := &model.DailyWordStat{
+		UserID:       userID,
+		NovelID:      novelID,
+		Date:         date,
+		WordsAdded:   added,
+		WordsRemoved: removed,
+		Saves:        1,
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "novel_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"words_added":   gorm.Expr("words_added + ?", added),
+			"words_removed": gorm.Expr("words_removed + ?", removed),
+			"saves":         gorm.Expr("saves + 1"),
+			"updated_at":    gorm.Expr("NOW()"),
+		}),
+	}).Create(stat).Error
+}
+
+type DailyWordTotal struct {
+	Date         string
+	WordsAdded   int
+	WordsRemoved int
+	Saves        int
+}
+
+// GetDailyWordTotals returns the daily totals since the given date, oldest first. A
+// nil novelID sums over all of the user's novels.
+func GetDailyWordTotals(userID uint, novelID *uuid.UUID, since string) ([]DailyWordTotal, error) {
+	query := database.DB.Model(&model.DailyWordStat{}).
+		Select("date, SUM(words_added) AS words_added, SUM(words_removed) AS words_removed, SUM(saves) AS saves").
+		Where("user_id = ? AND date >= ?", userID, since)
+	if novelID != nil {
+		query = query.Where("novel_id = ?", *novelID)
+	}
+	var totals []DailyWordTotal
+	err := query.Group("date").Order("date ASC").Find(&totals).Error
+	return totals, err
+}
+
+// GetWritingDates returns the days on which words were added, newest first.
+func GetWritingDates(userID uint, novelID *uuid.UUID) ([]string, error) {
+	query := database.DB.Model(&model.DailyWordStat{}).
+		Distinct("date").
+		Where("user_id = ? AND words_added > 0", userID)
+	if novelID != nil {
+		query = query.Where("novel_id = ?", *novelID)
+	}
+	var dates []string
+	err := query.Order("date DESC").Pluck("date", &dates).Error
+	return dates, err
+}
+
+// GetChapterWordCounts returns the word count of every chapter of the novel, or of
+// all of the user's own novels that are not in the trash when novelID is nil. The
+// caller checks the access to a single novel, which may be shared with the user.
+func GetChapterWordCounts(userID uint, novelID *uuid.UUID) ([]int, error) {
+	query := database.DB.Model(&model.Chapter{}).
+		Joins("JOIN novels ON novels.id = chapters.novel_id AND novels.deleted_at IS NULL")
+	if novelID != nil {
+		query = query.Where("chapters.novel_id = ?", *novelID)
+	} else {
+		query = query.Where("novels.user_id = ?", userID)
+	}
+	var counts []int
+	err := query.Pluck("chapters.word_count", &counts).Error
+	return counts, err
+}
+
+type NovelWordTotal struct {
+	NovelID  uuid.UUID
+	Words    int64
+	Chapters int64
+}
+
+func GetWordTotalsForNovels(novelIDs []uuid.UUID) (map[uuid.UUID]NovelWordTotal, error) {
+	var results []NovelWordTotal
+	err := database.DB.Model(&model.Chapter{}).
+		Select("novel_id, COALESCE(SUM(word_count), 0) AS words, COUNT(*) AS chapters").
+		Where("novel_id IN ?", novelIDs).
+		Group("novel_id").
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[uuid.UUID]NovelWordTotal, len(results))
+	for _, result := range results {
+		totals[result.NovelID] = result
+	}
+	return totals, nil
+}
+
+func GetWritingGoals(userID uint) ([]model.WritingGoal, error) {
+	var goals []model.WritingGoal
+	err := database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&goals).Error
+	return goals, err
+}
+
+// SaveWritingGoal creates the goal or replaces the target of the existing goal with
+// the same novel and type.
+func SaveWritingGoal(goal *model.WritingGoal) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var existing model.WritingGoal
+		err := tx.Where("user_id = ? AND novel_id = ? AND type = ?", goal.UserID, goal.NovelID, goal.Type).First(&existing).Error
+		if err == nil {
+			goal.ID = existing.ID
+			goal.CreatedAt = existing.CreatedAt
+			return tx.Model(&existing).Select("target_words", "deadline").Updates(goal).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(goal).Error
+	})
+}
+
+func DeleteWritingGoal(goalID string, userID uint) (int64, error) {
+	result := database.DB.Unscoped().Where("id = ? AND user_id = ?", goalID, userID).Delete(&model.WritingGoal{})
+	return result.RowsAffected, result.Error
+}
+
+// GetChaptersWithoutWordCount returns up to limit chapters, trashed ones included,
+// that have content but no word count, ordered by ID and starting after afterID.
+func GetChaptersWithoutWordCount(afterID string, limit int) ([]model.Chapter, error) {
+	var chapters []model.Chapter
+	err := database.DB.Unscoped().Select("id, content").
+		Where("word_count = 0 AND content <> '' AND id > ?", afterID).
+		Order("id ASC").Limit(limit).Find(&chapters).Error
+	return chapters, err
+}
+
+// SetChapterWordCount stores a chapter's word count without touching its other
+// columns or recording a change.
+func SetChapterWordCount(chapterID uuid.UUID, wordCount int) error {
+	return database.DB.Unscoped().Model(&model.Chapter{}).Where("id = ?", chapterID).UpdateColumn("word_count", wordCount).Error
+}
@@ -0,0 +1,58 @@
+package dto
+
+// CollabOpComponent is one component of a text operation on a chapter's HTML,
+// counted in UTF-16 code units like JavaScript string indexes: retain R units,
+// insert I, or delete D units. Exactly one field is set.
+type CollabOpComponent struct {
+	R int    `json:"r,omitempty"`
+	I string `json:"i,omitempty"`
+	D int    `json:"d,omitempty"`
+}
+
+// CollabTicketDTO is a single-use ticket for the collaboration WebSocket handshake.
+type CollabTicketDTO struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expiresIn"` // 秒
+}
+
+// CollabCursorDTO is a selection in the chapter content, in UTF-16 code units.
+// Anchor equals Head for a plain caret.
+type CollabCursorDTO struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+type CollabPresenceDTO struct {
+	ClientID string           `json:"clientId"`
+	UserID   uint             `json:"userId"`
+	Name     string           `json:"name"`
+	Color    string           `json:"color"`
+	ReadOnly bool             `json:"readOnly,omitempty"`
+	Cursor   *CollabCursorDTO `json:"cursor,omitempty"`
+}
+
+// CollabMessage is a frame of the collaboration WebSocket protocol.
+//
+// Client to server:
+//   - op: Ops based on document Version
+//   - cursor: the client's new Cursor
+//   - ping: keeps the connection open; some frame must arrive at least once a minute
+//
+// Server to client:
+//   - init / resync: the full Content at Version, the client's ClientID and everyone online
+//   - ack: the client's last op was applied as Version
+//   - op: Ops of another client (ClientID), applied as Version
+//   - join / leave / cursor: presence changes of Clients
+//   - saved: the content up to Version is stored as chapter Revision
+//   - pong / error
+type CollabMessage struct {
+	Type     string              `json:"type"`
+	Version  int                 `json:"version,omitempty"`
+	Revision int64               `json:"revision,omitempty"`
+	Ops      []CollabOpComponent `json:"ops,omitempty"`
+	Content  *string             `json:"content,omitempty"`
+	ClientID string              `json:"clientId,omitempty"`
+	Cursor   *CollabCursorDTO    `json:"cursor,omitempty"`
+	Clients  []CollabPresenceDTO `json:"clients,omitempty"`
+	Message  string              `json:"message,omitempty"`
+}
@@ -0,0 +1,42 @@
+package dto
+
+// CreateCommentPayload starts a thread or, with ParentID, replies to one. A thread
+// is anchored to the range Start..End of the chapter's HTML content, to the element
+// AnchorID, or to both. Start and End are counted in UTF-16 code units, like the
+// positions of the collaborative editor, so an emoji counts as two. Mentions are
+// user IDs of novel members.
+type CreateCommentPayload struct {
+	Content  string `json:"content" binding:"required"`
+	ParentID string `json:"parentId"`
+	Start    *int   `json:"start"`
+	End      *int   `json:"end"`
+	AnchorID string `json:"anchorId"`
+	Mentions []uint `json:"mentions"`
+}
+
+type UpdateCommentPayload struct {
+	Content  *string `json:"content"`
+	Mentions *[]uint `json:"mentions"`
+}
+
+type ChapterCommentDTO struct {
+	ID         string              `json:"id"`
+	NovelID    string              `json:"novelId"`
+	ChapterID  string              `json:"chapterId"`
+	ParentID   string              `json:"parentId,omitempty"`
+	UserID     uint                `json:"userId"`
+	AuthorName string              `json:"authorName"`
+	Content    string              `json:"content"`
+	Start      *int                `json:"start,omitempty"`
+	End        *int                `json:"end,omitempty"`
+	AnchorID   string              `json:"anchorId,omitempty"`
+	Quote      string              `json:"quote,omitempty"`
+	Detached   bool                `json:"detached"`
+	Mentions   []uint              `json:"mentions"`
+	Resolved   bool                `json:"resolved"`
+	ResolvedBy uint                `json:"resolvedBy,omitempty"`
+	ResolvedAt string              `json:"resolvedAt,omitempty"`
+	CreatedAt  string              `json:"createdAt"`
+	UpdatedAt  string              `json:"updatedAt"`
+	Replies    []ChapterCommentDTO `json:"replies,omitempty"`
+}
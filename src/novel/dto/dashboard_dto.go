@@ -20,6 +20,8 @@ type NovelDashboardItemDTO struct {
 	Chapters    int            `json:"chapters"`
 	LastUpdated string         `json:"lastUpdated"`
 	Category    string         `json:"category"`
+	// Role 仅在共享给当前用户的小说列表中返回
+	Role string `json:"role,omitempty"`
 }
 
 type CreateNovelPayload struct {
@@ -8,8 +8,9 @@ type CreateDerivedContentPayload struct {
 }
 
 type UpdateDerivedContentPayload struct {
-	Title   *string `json:"title"`
-	Content *string `json:"content"`
+	Title       *string `json:"title"`
+	Content     *string `json:"content"`
+	BaseVersion *int64  `json:"baseVersion"`
 }
 
 type CreateNotePayload struct {
@@ -18,6 +19,7 @@ type CreateNotePayload struct {
 }
 
 type UpdateNotePayload struct {
-	Title   *string `json:"title"`
-	Content *string `json:"content"`
+	Title       *string `json:"title"`
+	Content     *string `json:"content"`
+	BaseVersion *int64  `json:"baseVersion"`
 }
@@ -7,9 +7,12 @@ type CreateVolumePayload struct {
 	Order   int    `json:"order"`
 }
 
+// UpdateVolumePayload updates a volume. When BaseVersion (or an If-Match header) is
+// set, the update is rejected unless the volume is still at that revision.
 type UpdateVolumePayload struct {
-	Title   *string `json:"title"`
-	Content *string `json:"content"`
+	Title       *string `json:"title"`
+	Content     *string `json:"content"`
+	BaseVersion *int64  `json:"baseVersion"`
 }
 
 type CreateChapterPayload struct {
@@ -19,13 +22,27 @@ type CreateChapterPayload struct {
 	Order   int    `json:"order"`
 }
 
+// UpdateChapterPayload updates a chapter. SaveKind tells how the editor saved it:
+// "autosave", "manual" (the default) or "checkpoint", which also keeps the saved
+// content as a version named Label. BaseVersion works as for volumes.
 type UpdateChapterPayload struct {
-	Title   *string `json:"title"`
-	Content *string `json:"content"`
-	Status  *string `json:"status"`
+	Title       *string `json:"title"`
+	Content     *string `json:"content"`
+	Status      *string `json:"status"`
+	SaveKind    string  `json:"saveKind"`
+	Label       string  `json:"label"`
+	BaseVersion *int64  `json:"baseVersion"`
 }
 
 type OrderPayload struct {
 	OrderedVolumeIDs  []string `json:"orderedVolumeIds"`
 	OrderedChapterIDs []string `json:"orderedChapterIds"`
 }
+
+// ChapterTextEdit replaces Content[Start:End] of a chapter with Text. Offsets count
+// Unicode code points in the stored HTML.
+type ChapterTextEdit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
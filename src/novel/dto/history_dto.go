@@ -1,9 +1,72 @@
 // st-novel-go/src/novel/dto/history_dto.go
 package dto
 
+// HistoryVersionDTO describes a version without its content. Kind tells how it was
+// saved (autosave, manual, checkpoint or system), WordDelta is the change from the
+// previous version and Preview is the start of the plain text.
 type HistoryVersionDTO struct {
 	ID        string `json:"id"`
 	Label     string `json:"label"`
+	Kind      string `json:"kind"`
+	UserID    uint   `json:"userId"`
 	Timestamp string `json:"timestamp"`
-	Content   string `json:"content"`
+	CreatedAt string `json:"createdAt"`
+	WordCount int    `json:"wordCount"`
+	WordDelta int    `json:"wordDelta"`
+	Preview   string `json:"preview"`
+}
+
+type HistoryVersionDetailDTO struct {
+	HistoryVersionDTO
+	Content string `json:"content"`
+}
+
+// DiffSegmentDTO is a run of text that is equal in both versions, or only in the
+// newer one (insert) or the older one (delete).
+type DiffSegmentDTO struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type HistoryDiffDTO struct {
+	From          string           `json:"from"`
+	To            string           `json:"to"`
+	FromLabel     string           `json:"fromLabel"`
+	ToLabel       string           `json:"toLabel"`
+	HTML          string           `json:"html"`
+	Segments      []DiffSegmentDTO `json:"segments"`
+	InsertedChars int              `json:"insertedChars"`
+	DeletedChars  int              `json:"deletedChars"`
+	WordDelta     int              `json:"wordDelta"`
+}
+
+// MergePayload asks for a three-way merge of two edits of the same base HTML.
+// Prefer ("ours" by default, or "theirs") decides which side fills a conflict.
+type MergePayload struct {
+	Base   string `json:"base"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+	Prefer string `json:"prefer"`
+}
+
+type MergeConflictDTO struct {
+	Index  int    `json:"index"`
+	Base   string `json:"base"`
+	Ours   string `json:"ours"`
+	Theirs string `json:"theirs"`
+}
+
+type MergeResultDTO struct {
+	Merged    string             `json:"merged"`
+	Clean     bool               `json:"clean"`
+	Conflicts []MergeConflictDTO `json:"conflicts"`
+}
+
+// RevisionConflictDTO is returned with 409 when an update is based on an outdated
+// revision: Current is the stored document and Yours the rejected update.
+type RevisionConflictDTO struct {
+	BaseVersion    int64       `json:"baseVersion"`
+	CurrentVersion int64       `json:"currentVersion"`
+	Current        interface{} `json:"current"`
+	Yours          interface{} `json:"yours"`
 }
@@ -0,0 +1,35 @@
+package dto
+
+// InviteNovelMemberPayload invites a registered user by email with one of the
+// roles editor, commenter or viewer.
+type InviteNovelMemberPayload struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type UpdateNovelMemberPayload struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// NovelMemberDTO is a user with access to a novel. The owner is listed with an
+// empty ID, since ownership is not a membership.
+type NovelMemberDTO struct {
+	ID        string `json:"id"`
+	UserID    uint   `json:"userId"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Avatar    string `json:"avatar"`
+	Role      string `json:"role"`
+	Status    string `json:"status"`
+	InvitedAt string `json:"invitedAt,omitempty"`
+}
+
+type NovelInvitationDTO struct {
+	ID          string `json:"id"`
+	NovelID     string `json:"novelId"`
+	NovelTitle  string `json:"novelTitle"`
+	Role        string `json:"role"`
+	InviterID   uint   `json:"inviterId"`
+	InviterName string `json:"inviterName"`
+	InvitedAt   string `json:"invitedAt"`
+}
@@ -23,6 +23,8 @@ type ChapterDTO struct {
 	Content   string `json:"content"`
 	Status    string `json:"status"`
 	Order     int    `json:"order"`
+	// UnresolvedComments 为该章节未解决的评论串数量
+	UnresolvedComments int `json:"unresolvedComments"`
 }
 
 type VolumeDTO struct {
@@ -0,0 +1,58 @@
+package dto
+
+type CreateNovelSnapshotPayload struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// RestoreNovelSnapshotPayload selects how a snapshot is restored: "copy" creates a
+// new novel, "overwrite" replaces the content of the snapshotted novel.
+type RestoreNovelSnapshotPayload struct {
+	Mode  string `json:"mode"`
+	Title string `json:"title"`
+}
+
+type NovelSnapshotDTO struct {
+	ID           string `json:"id"`
+	NovelID      string `json:"novelId"`
+	UserID       uint   `json:"userId"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Automatic    bool   `json:"automatic"`
+	VolumeCount  int    `json:"volumeCount"`
+	ChapterCount int    `json:"chapterCount"`
+	WordCount    int    `json:"wordCount"`
+	Size         int    `json:"size"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+// SnapshotChangeItemDTO is a volume, chapter, derived content item or note that
+// differs between a snapshot and the current novel.
+type SnapshotChangeItemDTO struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+}
+
+// SnapshotChangesDTO describes what restoring a snapshot over the novel would do:
+// Added items come back, Removed items go to the trash and Modified items are
+// overwritten. Sections lists the changed metadata and custom data sections.
+type SnapshotChangesDTO struct {
+	Added    []SnapshotChangeItemDTO `json:"added"`
+	Removed  []SnapshotChangeItemDTO `json:"removed"`
+	Modified []SnapshotChangeItemDTO `json:"modified"`
+	Sections []string                `json:"sections"`
+}
+
+type NovelSnapshotPreviewDTO struct {
+	NovelSnapshotDTO
+	Project NovelProjectDTO     `json:"project"`
+	Changes *SnapshotChangesDTO `json:"changes"`
+}
+
+type RestoreNovelSnapshotResultDTO struct {
+	Mode             string          `json:"mode"`
+	NovelID          string          `json:"novelId"`
+	BackupSnapshotID string          `json:"backupSnapshotId,omitempty"`
+	Project          NovelProjectDTO `json:"project"`
+}
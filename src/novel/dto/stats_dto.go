@@ -0,0 +1,107 @@
+package dto
+
+// WritingStatsDTO summarises the words of one novel, or of all of a user's novels.
+type WritingStatsDTO struct {
+	TotalWords           int64                    `json:"totalWords"`
+	ChapterCount         int                      `json:"chapterCount"`
+	TodayWords           int                      `json:"todayWords"`
+	CurrentStreak        int                      `json:"currentStreak"`
+	LongestStreak        int                      `json:"longestStreak"`
+	AverageChapterWords  int                      `json:"averageChapterWords"`
+	LongestChapterWords  int                      `json:"longestChapterWords"`
+	ShortestChapterWords int                      `json:"shortestChapterWords"`
+	Daily                []DailyWordsDTO          `json:"daily"`
+	Distribution         []ChapterLengthBucketDTO `json:"distribution"`
+	Goals                []WritingGoalDTO         `json:"goals"`
+	Novels               []NovelWordsDTO          `json:"novels,omitempty"`
+}
+
+// DailyWordsDTO is the word count change of one day, derived from chapter saves.
+type DailyWordsDTO struct {
+	Date         string `json:"date"`
+	WordsAdded   int    `json:"wordsAdded"`
+	WordsRemoved int    `json:"wordsRemoved"`
+	NetWords     int    `json:"netWords"`
+	Saves        int    `json:"saves"`
+}
+
+// ChapterLengthBucketDTO counts the chapters whose length is in [Min, Max). Max is
+// 0 for the last, open-ended bucket.
+type ChapterLengthBucketDTO struct {
+	Label string `json:"label"`
+	Min   int    `json:"min"`
+	Max   int    `json:"max"`
+	Count int    `json:"count"`
+}
+
+type NovelWordsDTO struct {
+	ID         string `json:"id"`
+	Title      string `json:"title"`
+	TotalWords int64  `json:"totalWords"`
+	Chapters   int64  `json:"chapters"`
+}
+
+type WritingGoalDTO struct {
+	ID          string `json:"id"`
+	NovelID     string `json:"novelId,omitempty"`
+	Type        string `json:"type"`
+	TargetWords int    `json:"targetWords"`
+	Deadline    string `json:"deadline,omitempty"`
+	// Current 对每日目标为今天新增的字数，对项目目标为当前总字数
+	Current        int64   `json:"current"`
+	Percent        float64 `json:"percent"`
+	Achieved       bool    `json:"achieved"`
+	RemainingWords int64   `json:"remainingWords"`
+	// DaysLeft 与 WordsPerDayNeeded 仅对设置了截止日期的项目目标有值
+	DaysLeft          int   `json:"daysLeft,omitempty"`
+	WordsPerDayNeeded int64 `json:"wordsPerDayNeeded,omitempty"`
+}
+
+// SetWritingGoalPayload sets a goal. NovelID is empty for a goal over all novels;
+// Deadline is an optional date (2006-01-02) for project goals.
+type SetWritingGoalPayload struct {
+	NovelID     string `json:"novelId"`
+	Type        string `json:"type" binding:"required,oneof=daily project"`
+	TargetWords int    `json:"targetWords" binding:"required,min=1"`
+	Deadline    string `json:"deadline"`
+}
+
+// WritingCalendarDayDTO is one day of the writing heat map. Level runs from 0 (no
+// writing) to 4 (the busiest days of the range).
+type WritingCalendarDayDTO struct {
+	Date         string `json:"date"`
+	Sessions     int    `json:"sessions"`
+	Minutes      int    `json:"minutes"`
+	WordsAdded   int    `json:"wordsAdded"`
+	WordsRemoved int    `json:"wordsRemoved"`
+	Level        int    `json:"level"`
+}
+
+type WritingCalendarDTO struct {
+	From          string                  `json:"from"`
+	To            string                  `json:"to"`
+	TotalSessions int                     `json:"totalSessions"`
+	TotalMinutes  int                     `json:"totalMinutes"`
+	ActiveDays    int                     `json:"activeDays"`
+	Days          []WritingCalendarDayDTO `json:"days"`
+}
+
+type WritingSessionDTO struct {
+	ID           uint   `json:"id"`
+	ChapterID    string `json:"chapterId"`
+	ChapterTitle string `json:"chapterTitle"`
+	StartedAt    string `json:"startedAt"`
+	EndedAt      string `json:"endedAt"`
+	Minutes      int    `json:"minutes"`
+	WordsAdded   int    `json:"wordsAdded"`
+	WordsRemoved int    `json:"wordsRemoved"`
+	NetWords     int    `json:"netWords"`
+	Saves        int    `json:"saves"`
+}
+
+type WritingTimelineDTO struct {
+	Sessions []WritingSessionDTO `json:"sessions"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"pageSize"`
+}
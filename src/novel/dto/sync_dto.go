@@ -0,0 +1,24 @@
+package dto
+
+// NovelUpdatesDTO is a page of a novel's change feed. Updates holds the current
+// state of every entity changed after the requested cursor and Deletes the IDs of
+// the ones that were deleted, both keyed by "volumes", "chapters",
+// "derived_content", "notes", "metadata" and "nodes". Reset is set when the page
+// is the novel's full state instead, and the client should drop what it has.
+type NovelUpdatesDTO struct {
+	Updates map[string][]interface{} `json:"updates"`
+	Deletes map[string][]string      `json:"deletes"`
+	Cursor  uint64                   `json:"cursor"`
+	HasMore bool                     `json:"hasMore"`
+	Reset   bool                     `json:"reset"`
+}
+
+// NodeUpdateDTO is a changed node of a settings tree or custom data list, without
+// its children. ID is "<type>:<nodeId>", as in Deletes.
+type NodeUpdateDTO struct {
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	ParentID string      `json:"parentId,omitempty"`
+	Index    int         `json:"index"`
+	Node     TreeNodeDTO `json:"node"`
+}
@@ -29,6 +29,7 @@ func GetChapterHandler(c *gin.Context) {
 		utils.Fail(c, err.Error())
 		return
 	}
+	setETag(c, chapter.Revision)
 	utils.Success(c, chapter)
 }
 
@@ -58,11 +59,16 @@ func UpdateChapterHandler(c *gin.Context) {
 		utils.FailWithBadRequest(c, err.Error())
 		return
 	}
+	if err := applyIfMatch(c, &payload.BaseVersion); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
 	chapter, err := service.UpdateChapter(chapterID, userClaims.UserID, payload)
 	if err != nil {
-		utils.Fail(c, err.Error())
+		failUpdate(c, "", err, payload)
 		return
 	}
+	setETag(c, chapter.Revision)
 	utils.Success(c, chapter)
 }
 
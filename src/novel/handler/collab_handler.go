@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/service"
+	"st-novel-go/src/utils"
+	"time"
+)
+
+const (
+	collabMaxFrameBytes = 4 << 20
+	// 客户端在 collabReadTimeout 内没有发送任何帧（包括 ping）即视为断线
+	collabReadTimeout  = 60 * time.Second
+	collabPingInterval = 25 * time.Second
+)
+
+// collabPing sends a WebSocket ping control frame, which browsers answer on their
+// own. A connection whose peer is gone fails the write and is closed.
+var collabPing = websocket.Codec{Marshal: func(interface{}) ([]byte, byte, error) {
+	return nil, websocket.PingFrame, nil
+}}
+
+// CreateCollabTicketHandler POST /api/novels/chapters/:chapterId/collab/ticket
+// 返回一次性的 WebSocket 票据，浏览器用它代替 JWT 放在握手地址中
+func CreateCollabTicketHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	if _, err := service.GetChapter(c.Param("chapterId"), userClaims.UserID); err != nil {
+		utils.Fail(c, err.Error())
+		return
+	}
+	ticket, err := middleware.IssueWebSocketTicket(userClaims)
+	if err != nil {
+		utils.Fail(c, "Failed to issue ticket: "+err.Error())
+		return
+	}
+	utils.Success(c, dto.CollabTicketDTO{Ticket: ticket, ExpiresIn: int(middleware.WebSocketTicketTTL / time.Second)})
+}
+
+// CollabChapterHandler upgrades to a WebSocket that joins the real-time editing
+// session of the chapter. Frames are dto.CollabMessage JSON objects. Browsers
+// authenticate with a ticket from CreateCollabTicketHandler in the ticket query
+// parameter. A client that sends nothing, not even a ping, for collabReadTimeout is
+// disconnected.
+func CollabChapterHandler(c *gin.Context) {
+	chapterID := c.Param("chapterId")
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	client, err := service.JoinCollabSession(chapterID, userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, err.Error())
+		return
+	}
+	// 握手失败时不会进入下面的处理函数，这里统一离开会话
+	defer client.Leave()
+
+	// 令牌认证不依赖 Cookie，因此不校验 Origin
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		ws.MaxPayloadBytes = collabMaxFrameBytes
+		// 发送协程在 Leave 关闭消息通道后退出
+		go func() {
+			defer ws.Close()
+			ticker := time.NewTicker(collabPingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case msg, ok := <-client.Messages():
+					if !ok {
+						return
+					}
+					if err := websocket.JSON.Send(ws, msg); err != nil {
+						return
+					}
+				case <-ticker.C:
+					if err := collabPing.Send(ws, nil); err != nil {
+						return
+					}
+				}
+			}
+		}()
+
+		for {
+			if err := ws.SetReadDeadline(time.Now().Add(collabReadTimeout)); err != nil {
+				break
+			}
+			var msg dto.CollabMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				break
+			}
+			client.Handle(msg)
+		}
+		ws.Close()
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
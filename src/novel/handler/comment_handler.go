@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/service"
+	"st-novel-go/src/utils"
+)
+
+// GetChapterCommentsHandler GET /api/chapters/:chapterId/comments?status=open|resolved
+func GetChapterCommentsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	comments, err := service.GetChapterComments(c.Param("chapterId"), c.Query("status"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get comments: "+err.Error())
+		return
+	}
+	utils.Success(c, comments)
+}
+
+// CreateChapterCommentHandler POST /api/chapters/:chapterId/comments — 新建批注或回复
+func CreateChapterCommentHandler(c *gin.Context) {
+	var payload dto.CreateCommentPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	comment, err := service.CreateChapterComment(c.Param("chapterId"), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to create comment: "+err.Error())
+		return
+	}
+	utils.Success(c, comment)
+}
+
+// UpdateChapterCommentHandler PATCH /api/comments/:commentId
+func UpdateChapterCommentHandler(c *gin.Context) {
+	var payload dto.UpdateCommentPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	comment, err := service.UpdateChapterComment(c.Param("commentId"), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to update comment: "+err.Error())
+		return
+	}
+	utils.Success(c, comment)
+}
+
+// DeleteChapterCommentHandler DELETE /api/comments/:commentId — 删除线程起始批注时一并删除其回复
+func DeleteChapterCommentHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	if err := service.DeleteChapterComment(c.Param("commentId"), userClaims.UserID); err != nil {
+		utils.Fail(c, "Failed to delete comment: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Comment deleted successfully")
+}
+
+// ResolveChapterCommentHandler POST /api/comments/:commentId/resolve
+func ResolveChapterCommentHandler(c *gin.Context) {
+	setChapterCommentResolved(c, true)
+}
+
+// ReopenChapterCommentHandler POST /api/comments/:commentId/reopen
+func ReopenChapterCommentHandler(c *gin.Context) {
+	setChapterCommentResolved(c, false)
+}
+
+func setChapterCommentResolved(c *gin.Context, resolved bool) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	comment, err := service.SetChapterCommentResolved(c.Param("commentId"), userClaims.UserID, resolved)
+	if err != nil {
+		utils.Fail(c, "Failed to update comment status: "+err.Error())
+		return
+	}
+	utils.Success(c, comment)
+}
+
+// GetCommentMentionsHandler GET /api/comments/mentions — 提及当前用户的批注
+func GetCommentMentionsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	comments, err := service.GetCommentMentions(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get mentions: "+err.Error())
+		return
+	}
+	utils.Success(c, comments)
+}
@@ -54,12 +54,17 @@ func UpdateDerivedContentHandler(c *gin.Context) {
 		utils.FailWithBadRequest(c, err.Error())
 		return
 	}
+	if err := applyIfMatch(c, &payload.BaseVersion); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
 
 	item, err := service.UpdateDerivedContent(itemID, userClaims.UserID, payload)
 	if err != nil {
-		utils.Fail(c, err.Error())
+		failUpdate(c, "", err, payload)
 		return
 	}
+	setETag(c, item.Revision)
 	utils.Success(c, item)
 }
 
@@ -121,12 +126,17 @@ func UpdateNoteHandler(c *gin.Context) {
 		utils.FailWithBadRequest(c, err.Error())
 		return
 	}
+	if err := applyIfMatch(c, &payload.BaseVersion); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
 
 	note, err := service.UpdateNote(noteID, userClaims.UserID, payload)
 	if err != nil {
-		utils.Fail(c, err.Error())
+		failUpdate(c, "", err, payload)
 		return
 	}
+	setETag(c, note.Revision)
 	utils.Success(c, note)
 }
 
@@ -4,6 +4,7 @@ package handler
 import (
 	"st-novel-go/src/middleware"
 	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/model"
 	"st-novel-go/src/utils"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +17,7 @@ func ExportNovelHandler(c *gin.Context) {
 	claims, _ := c.Get(middleware.UserClaimsKey)
 	userClaims := claims.(*utils.Claims)
 
-	novel, err := dao.FindNovelByID(novelID, userClaims.UserID)
+	novel, err := dao.FindNovelWithRole(novelID, userClaims.UserID, model.RoleViewer)
 	if err != nil {
 		utils.Fail(c, "Novel not found or permission denied")
 		return
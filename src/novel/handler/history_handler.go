@@ -13,7 +13,8 @@ func GetHistoryHandler(c *gin.Context) {
 	claims, _ := c.Get(middleware.UserClaimsKey)
 	userClaims := claims.(*utils.Claims)
 
-	history, err := service.GetHistory(documentID, userClaims.UserID)
+	// kind 可按保存方式筛选：autosave、manual、checkpoint、system
+	history, err := service.GetHistory(documentID, c.Query("kind"), userClaims.UserID)
 	if err != nil {
 		utils.Fail(c, "Failed to get history: "+err.Error())
 		return
@@ -34,3 +35,29 @@ func RestoreVersionHandler(c *gin.Context) {
 	}
 	utils.SuccessWithMessage(c, "Version restored successfully.")
 }
+
+// GetHistoryVersionHandler GET /api/documents/:documentId/history/:versionId — 单个版本的完整内容
+func GetHistoryVersionHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	version, err := service.GetHistoryVersion(c.Param("documentId"), c.Param("versionId"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get history version: "+err.Error())
+		return
+	}
+	utils.Success(c, version)
+}
+
+// DiffHistoryHandler GET /api/documents/:documentId/history/diff?from=&to= — to 缺省或为 current 时与当前内容对比
+func DiffHistoryHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	diff, err := service.DiffHistoryVersions(c.Param("documentId"), c.Query("from"), c.Query("to"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to diff history versions: "+err.Error())
+		return
+	}
+	utils.Success(c, diff)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/service"
+	"st-novel-go/src/utils"
+)
+
+// GetNovelMembersHandler GET /api/novels/:novelId/members
+func GetNovelMembersHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	members, err := service.GetNovelMembers(c.Param("novelId"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get members: "+err.Error())
+		return
+	}
+	utils.Success(c, members)
+}
+
+// InviteNovelMemberHandler POST /api/novels/:novelId/members — 通过邮箱邀请协作者
+func InviteNovelMemberHandler(c *gin.Context) {
+	var payload dto.InviteNovelMemberPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	member, err := service.InviteNovelMember(c.Param("novelId"), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to invite member: "+err.Error())
+		return
+	}
+	utils.Success(c, member)
+}
+
+// UpdateNovelMemberHandler PATCH /api/novels/:novelId/members/:memberId
+func UpdateNovelMemberHandler(c *gin.Context) {
+	var payload dto.UpdateNovelMemberPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	if err := service.UpdateNovelMemberRole(c.Param("novelId"), c.Param("memberId"), userClaims.UserID, payload); err != nil {
+		utils.Fail(c, "Failed to update member: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Member updated successfully")
+}
+
+// RemoveNovelMemberHandler DELETE /api/novels/:novelId/members/:memberId — 移除成员、撤回邀请或退出协作
+func RemoveNovelMemberHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	if err := service.RemoveNovelMember(c.Param("novelId"), c.Param("memberId"), userClaims.UserID); err != nil {
+		utils.Fail(c, "Failed to remove member: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Member removed successfully")
+}
+
+// GetSharedNovelsHandler GET /api/novels/shared — 其他用户共享给当前用户的小说
+func GetSharedNovelsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	novels, err := service.GetSharedNovels(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get shared novels: "+err.Error())
+		return
+	}
+	utils.Success(c, novels)
+}
+
+// GetNovelInvitationsHandler GET /api/invitations
+func GetNovelInvitationsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	invitations, err := service.GetNovelInvitations(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get invitations: "+err.Error())
+		return
+	}
+	utils.Success(c, invitations)
+}
+
+// AcceptNovelInvitationHandler POST /api/invitations/:invitationId/accept
+func AcceptNovelInvitationHandler(c *gin.Context) {
+	respondToNovelInvitation(c, true)
+}
+
+// DeclineNovelInvitationHandler POST /api/invitations/:invitationId/decline
+func DeclineNovelInvitationHandler(c *gin.Context) {
+	respondToNovelInvitation(c, false)
+}
+
+func respondToNovelInvitation(c *gin.Context, accept bool) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	if err := service.RespondToNovelInvitation(c.Param("invitationId"), userClaims.UserID, accept); err != nil {
+		utils.Fail(c, "Failed to respond to invitation: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Invitation answered successfully")
+}
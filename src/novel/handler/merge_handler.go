@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/service"
+	"st-novel-go/src/utils"
+	"strconv"
+	"strings"
+)
+
+// applyIfMatch fills base from the If-Match header (`"12"` or `W/"12"`) when the
+// request body has no baseVersion.
+func applyIfMatch(c *gin.Context, base **int64) error {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if *base != nil || header == "" || header == "*" {
+		return nil
+	}
+	revision, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil {
+		return errors.New("invalid If-Match header")
+	}
+	*base = &revision
+	return nil
+}
+
+func setETag(c *gin.Context, revision int64) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, revision))
+}
+
+// failUpdate responds to a failed update. A revision conflict gets a 409 carrying
+// the stored document and the rejected update.
+func failUpdate(c *gin.Context, message string, err error, yours interface{}) {
+	var conflict *service.RevisionConflictError
+	if errors.As(err, &conflict) {
+		setETag(c, conflict.CurrentRevision)
+		utils.FailWithConflict(c, err.Error(), dto.RevisionConflictDTO{
+			BaseVersion:    conflict.BaseRevision,
+			CurrentVersion: conflict.CurrentRevision,
+			Current:        conflict.Current,
+			Yours:          yours,
+		})
+		return
+	}
+	utils.Fail(c, message+err.Error())
+}
+
+// MergeDocumentsHandler POST /api/documents/merge — 对 HTML 做三方合并，用于解决编辑冲突
+func MergeDocumentsHandler(c *gin.Context) {
+	var payload dto.MergePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	result, err := service.MergeHTML(payload)
+	if err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+	utils.Success(c, result)
+}
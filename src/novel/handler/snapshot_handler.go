@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/service"
+	"st-novel-go/src/utils"
+)
+
+// CreateNovelSnapshotHandler POST /api/novels/:novelId/snapshots
+func CreateNovelSnapshotHandler(c *gin.Context) {
+	var payload dto.CreateNovelSnapshotPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	snapshot, err := service.CreateNovelSnapshot(c.Param("novelId"), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to create snapshot: "+err.Error())
+		return
+	}
+	utils.Success(c, snapshot)
+}
+
+// GetNovelSnapshotsHandler GET /api/novels/:novelId/snapshots
+func GetNovelSnapshotsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	snapshots, err := service.GetNovelSnapshots(c.Param("novelId"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get snapshots: "+err.Error())
+		return
+	}
+	utils.Success(c, snapshots)
+}
+
+// GetNovelSnapshotHandler GET /api/novels/:novelId/snapshots/:snapshotId — 快照内容及与当前小说的差异
+func GetNovelSnapshotHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	preview, err := service.GetNovelSnapshotPreview(c.Param("novelId"), c.Param("snapshotId"), userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to get snapshot: "+err.Error())
+		return
+	}
+	utils.Success(c, preview)
+}
+
+// RestoreNovelSnapshotHandler POST /api/novels/:novelId/snapshots/:snapshotId/restore
+func RestoreNovelSnapshotHandler(c *gin.Context) {
+	var payload dto.RestoreNovelSnapshotPayload
+	// 请求体可省略，默认恢复为新的小说
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			utils.FailWithBadRequest(c, err.Error())
+			return
+		}
+	}
+
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	result, err := service.RestoreNovelSnapshot(c.Param("novelId"), c.Param("snapshotId"), userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to restore snapshot: "+err.Error())
+		return
+	}
+	utils.Success(c, result)
+}
+
+// DeleteNovelSnapshotHandler DELETE /api/novels/:novelId/snapshots/:snapshotId
+func DeleteNovelSnapshotHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	if err := service.DeleteNovelSnapshot(c.Param("novelId"), c.Param("snapshotId"), userClaims.UserID); err != nil {
+		utils.Fail(c, "Failed to delete snapshot: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Snapshot deleted.")
+}
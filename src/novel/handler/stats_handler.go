@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/middleware"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/service"
+	"st-novel-go/src/utils"
+	"strconv"
+)
+
+// GetWritingStatsHandler GET /api/novels/stats?days=30 — 全部小说的字数统计
+func GetWritingStatsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	days, _ := strconv.Atoi(c.Query("days"))
+
+	stats, err := service.GetUserWritingStats(userClaims.UserID, days)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch writing stats: "+err.Error())
+		return
+	}
+	utils.Success(c, stats)
+}
+
+// GetNovelWritingStatsHandler GET /api/novels/:novelId/stats?days=30
+func GetNovelWritingStatsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	days, _ := strconv.Atoi(c.Query("days"))
+
+	stats, err := service.GetNovelWritingStats(c.Param("novelId"), userClaims.UserID, days)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch writing stats: "+err.Error())
+		return
+	}
+	utils.Success(c, stats)
+}
+
+// GetWritingGoalsHandler GET /api/novels/goals
+func GetWritingGoalsHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	goals, err := service.GetWritingGoals(userClaims.UserID)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch writing goals: "+err.Error())
+		return
+	}
+	utils.Success(c, goals)
+}
+
+// SetWritingGoalHandler PUT /api/novels/goals
+func SetWritingGoalHandler(c *gin.Context) {
+	var payload dto.SetWritingGoalPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	goal, err := service.SetWritingGoal(userClaims.UserID, payload)
+	if err != nil {
+		utils.Fail(c, "Failed to set writing goal: "+err.Error())
+		return
+	}
+	utils.Success(c, goal)
+}
+
+// DeleteWritingGoalHandler DELETE /api/novels/goals/:goalId
+func DeleteWritingGoalHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	if err := service.DeleteWritingGoal(c.Param("goalId"), userClaims.UserID); err != nil {
+		utils.Fail(c, "Failed to delete writing goal: "+err.Error())
+		return
+	}
+	utils.SuccessWithMessage(c, "Writing goal deleted")
+}
+
+// GetWritingCalendarHandler GET /api/novels/activity/calendar?from=&to= — 写作热力图
+func GetWritingCalendarHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+
+	calendar, err := service.GetWritingCalendar(userClaims.UserID, c.Query("from"), c.Query("to"))
+	if err != nil {
+		utils.Fail(c, "Failed to fetch writing calendar: "+err.Error())
+		return
+	}
+	utils.Success(c, calendar)
+}
+
+// GetWritingTimelineHandler GET /api/novels/:novelId/timeline?page=&pageSize=
+func GetWritingTimelineHandler(c *gin.Context) {
+	claims, _ := c.Get(middleware.UserClaimsKey)
+	userClaims := claims.(*utils.Claims)
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+
+	timeline, err := service.GetWritingTimeline(c.Param("novelId"), userClaims.UserID, page, pageSize)
+	if err != nil {
+		utils.Fail(c, "Failed to fetch writing timeline: "+err.Error())
+		return
+	}
+	utils.Success(c, timeline)
+}
@@ -46,11 +46,16 @@ func UpdateVolumeHandler(c *gin.Context) {
 		utils.FailWithBadRequest(c, err.Error())
 		return
 	}
+	if err := applyIfMatch(c, &payload.BaseVersion); err != nil {
+		utils.FailWithBadRequest(c, err.Error())
+		return
+	}
 	volume, err := service.UpdateVolume(volumeID, userClaims.UserID, payload)
 	if err != nil {
-		utils.Fail(c, err.Error())
+		failUpdate(c, "", err, payload)
 		return
 	}
+	setETag(c, volume.Revision)
 	utils.Success(c, volume)
 }
 
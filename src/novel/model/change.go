@@ -0,0 +1,42 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Entity types of the change log.
+const (
+	ChangeEntityNovel          = "novel"
+	ChangeEntityVolume         = "volume"
+	ChangeEntityChapter        = "chapter"
+	ChangeEntityDerivedContent = "derived_content"
+	ChangeEntityNote           = "note"
+	ChangeEntityNode           = "node"
+)
+
+const (
+	ChangeOpUpsert = "upsert"
+	ChangeOpDelete = "delete"
+)
+
+// NovelChange is an entry of a novel's change log. Every DAO mutation of a novel's
+// content appends one entry per affected row in the same transaction, so Seq is a
+// cursor clients can sync from. A node's EntityID is "<nodeType>:<nodeId>"; the
+// novel's own entry stands for its metadata.
+type NovelChange struct {
+	Seq        uint64    `gorm:"primaryKey;autoIncrement;index:idx_novel_change,priority:2" json:"seq"`
+	NovelID    uuid.UUID `gorm:"type:char(36);not null;index:idx_novel_change,priority:1" json:"novel_id"`
+	EntityType string    `gorm:"type:varchar(20);not null" json:"entity_type"`
+	EntityID   string    `gorm:"type:varchar(150);not null" json:"entity_id"`
+	Op         string    `gorm:"type:varchar(10);not null" json:"op"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NovelChangeHorizon records the sequence number up to which a novel's change log
+// was pruned. Clients with an older cursor have to start over from the full state.
+type NovelChangeHorizon struct {
+	NovelID   uuid.UUID `gorm:"type:char(36);primaryKey" json:"novel_id"`
+	PrunedSeq uint64    `gorm:"not null" json:"pruned_seq"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
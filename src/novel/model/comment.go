@@ -0,0 +1,30 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"time"
+)
+
+// ChapterComment is a comment on a chapter. A thread starts with a comment anchored
+// to a character range of the chapter's HTML content (Start and End, in runes), to
+// an element ID, or to both; replies carry ParentID and no anchor. The range is
+// re-mapped whenever the chapter content changes, and Detached is set once the
+// anchored text or element is gone. Quote keeps the text as it was when commented.
+type ChapterComment struct {
+	BaseModel
+	NovelID    uuid.UUID      `gorm:"type:char(36);not null;index" json:"novel_id"`
+	ChapterID  uuid.UUID      `gorm:"type:char(36);not null;index" json:"chapter_id"`
+	ParentID   *uuid.UUID     `gorm:"type:char(36);index" json:"parent_id"`
+	UserID     uint           `gorm:"not null;index" json:"user_id"`
+	Content    string         `gorm:"type:text;not null" json:"content"`
+	Start      *int           `gorm:"column:range_start" json:"start"`
+	End        *int           `gorm:"column:range_end" json:"end"`
+	AnchorID   string         `gorm:"type:varchar(100)" json:"anchor_id"`
+	Quote      string         `gorm:"type:text" json:"quote"`
+	Detached   bool           `gorm:"not null;default:false" json:"detached"`
+	Mentions   datatypes.JSON `gorm:"type:json" json:"mentions"`
+	Resolved   bool           `gorm:"not null;default:false;index" json:"resolved"`
+	ResolvedBy uint           `json:"resolved_by"`
+	ResolvedAt *time.Time     `json:"resolved_at"`
+}
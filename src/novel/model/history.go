@@ -1,10 +1,35 @@
 package model
 
+import "github.com/google/uuid"
+
+const (
+	HistoryKindSnapshot = "snapshot"
+	HistoryKindDelta    = "delta"
+
+	// 保存方式：编辑器自动保存、用户手动保存、带标签的检查点、恢复或 AI 编辑前由系统保存
+	HistorySaveAutosave   = "autosave"
+	HistorySaveManual     = "manual"
+	HistorySaveCheckpoint = "checkpoint"
+	HistorySaveSystem     = "system"
+)
+
+// HistoryVersion is one saved version of a document. A snapshot holds the full text
+// in Content; a delta holds in Delta the changes from the version BaseID and is
+// rebuilt from the snapshot its chain starts at. SaveKind records how the version was
+// saved. WordCount and Preview summarise the content so that versions can be listed
+// without rebuilding it; Summarized is false for versions saved before they existed.
 type HistoryVersion struct {
 	BaseModel
-	DocumentID   string `gorm:"type:varchar(255);not null;index" json:"document_id"`
-	DocumentType string `gorm:"type:varchar(50);not null;index" json:"document_type"`
-	Label        string `gorm:"type:varchar(255)" json:"label"`
-	Content      string `gorm:"type:longtext" json:"content"`
-	UserID       uint   `gorm:"not null;index" json:"user_id"`
+	DocumentID   string     `gorm:"type:varchar(255);not null;index" json:"document_id"`
+	DocumentType string     `gorm:"type:varchar(50);not null;index" json:"document_type"`
+	Label        string     `gorm:"type:varchar(255)" json:"label"`
+	SaveKind     string     `gorm:"type:varchar(20);not null;default:'manual';index" json:"save_kind"`
+	Kind         string     `gorm:"type:varchar(20);not null;default:'snapshot'" json:"kind"`
+	BaseID       *uuid.UUID `gorm:"type:char(36)" json:"base_id"`
+	Content      string     `gorm:"type:longtext" json:"content"`
+	Delta        string     `gorm:"type:mediumtext" json:"delta"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	WordCount    int        `gorm:"default:0" json:"word_count"`
+	Preview      string     `gorm:"type:varchar(400)" json:"preview"`
+	Summarized   bool       `gorm:"default:false" json:"summarized"`
 }
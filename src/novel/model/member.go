@@ -0,0 +1,45 @@
+package model
+
+import "github.com/google/uuid"
+
+// Roles of a user on a novel, from the most to the least privileged. The owner is
+// the novel's UserID and has no NovelMember row.
+const (
+	RoleOwner     = "owner"
+	RoleEditor    = "editor"
+	RoleCommenter = "commenter"
+	RoleViewer    = "viewer"
+)
+
+const (
+	MemberStatusPending  = "pending"
+	MemberStatusAccepted = "accepted"
+)
+
+var roleRanks = map[string]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleOwner:     4,
+}
+
+// RoleAtLeast reports whether role grants everything minRole does.
+func RoleAtLeast(role, minRole string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[minRole]
+}
+
+// IsMemberRole reports whether role can be given to an invited member.
+func IsMemberRole(role string) bool {
+	return role == RoleEditor || role == RoleCommenter || role == RoleViewer
+}
+
+// NovelMember gives a user other than the owner access to a novel. An invitation is
+// pending until the invited user accepts it.
+type NovelMember struct {
+	BaseModel
+	NovelID   uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_novel_member" json:"novel_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_novel_member;index" json:"user_id"`
+	Role      string    `gorm:"type:varchar(20);not null" json:"role"`
+	Status    string    `gorm:"type:varchar(20);not null;default:'pending'" json:"status"`
+	InvitedBy uint      `gorm:"not null" json:"invited_by"`
+}
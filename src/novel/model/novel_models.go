@@ -25,12 +25,15 @@ type Novel struct {
 	Notes              []Note           `gorm:"foreignKey:NovelID;constraint:OnDelete:CASCADE;" json:"notes"`
 }
 
+// Volume, Chapter, DerivedContent and Note carry a Revision that is incremented on
+// every update, so that an update based on an outdated copy can be rejected.
 type Volume struct {
 	BaseModel
 	NovelID  uuid.UUID `gorm:"type:char(36);not null;index" json:"novel_id"`
 	Title    string    `gorm:"type:varchar(255);not null" json:"title"`
 	Content  string    `gorm:"type:longtext" json:"content"`
 	Order    int       `gorm:"default:0" json:"order"`
+	Revision int64     `gorm:"not null;default:1" json:"revision"`
 	Chapters []Chapter `gorm:"foreignKey:VolumeID;constraint:OnDelete:CASCADE;" json:"chapters"`
 }
 
@@ -43,6 +46,7 @@ type Chapter struct {
 	Content   string    `gorm:"type:longtext" json:"content"`
 	Status    string    `gorm:"type:varchar(50);default:'editing'" json:"status"`
 	Order     int       `gorm:"default:0" json:"order"`
+	Revision  int64     `gorm:"not null;default:1" json:"revision"`
 }
 
 type DerivedContent struct {
@@ -52,11 +56,13 @@ type DerivedContent struct {
 	Type     string    `gorm:"type:varchar(50);not null" json:"type"`             // 'plot' or 'analysis'
 	Title    string    `gorm:"type:varchar(255);not null" json:"title"`
 	Content  string    `gorm:"type:longtext" json:"content"`
+	Revision int64     `gorm:"not null;default:1" json:"revision"`
 }
 
 type Note struct {
 	BaseModel
-	NovelID uuid.UUID `gorm:"type:char(36);not null;index" json:"novel_id"`
-	Title   string    `gorm:"type:varchar(255);not null" json:"title"`
-	Content string    `gorm:"type:longtext" json:"content"`
+	NovelID  uuid.UUID `gorm:"type:char(36);not null;index" json:"novel_id"`
+	Title    string    `gorm:"type:varchar(255);not null" json:"title"`
+	Content  string    `gorm:"type:longtext" json:"content"`
+	Revision int64     `gorm:"not null;default:1" json:"revision"`
 }
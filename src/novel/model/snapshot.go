@@ -0,0 +1,21 @@
+package model
+
+import "github.com/google/uuid"
+
+// NovelSnapshot is a named copy of a whole novel. Data holds the gzip-compressed
+// JSON of the novel's NovelProjectDTO; Category is kept beside it because the
+// project shape does not include it.
+type NovelSnapshot struct {
+	BaseModel
+	NovelID      uuid.UUID `gorm:"type:char(36);not null;index" json:"novel_id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	Name         string    `gorm:"type:varchar(255);not null" json:"name"`
+	Description  string    `gorm:"type:text" json:"description"`
+	Automatic    bool      `gorm:"not null;default:false" json:"automatic"`
+	Category     string    `gorm:"type:varchar(50)" json:"category"`
+	VolumeCount  int       `json:"volume_count"`
+	ChapterCount int       `json:"chapter_count"`
+	WordCount    int       `json:"word_count"`
+	Size         int       `json:"size"`
+	Data         []byte    `gorm:"type:longblob" json:"-"`
+}
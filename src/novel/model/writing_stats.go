@@ -0,0 +1,63 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// DailyWordStat accumulates the word count changes of one novel on one day. It is
+// updated on every chapter save.
+type DailyWordStat struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_daily_word_stat,priority:1" json:"user_id"`
+	NovelID      uuid.UUID `gorm:"type:char(36);not null;uniqueIndex:idx_daily_word_stat,priority:2" json:"novel_id"`
+	Date         string    `gorm:"type:char(10);not null;uniqueIndex:idx_daily_word_stat,priority:3" json:"date"` // 服务器本地日期，格式 2006-01-02
+	WordsAdded   int       `gorm:"default:0" json:"words_added"`
+	WordsRemoved int       `gorm:"default:0" json:"words_removed"`
+	Saves        int       `gorm:"default:0" json:"saves"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const (
+	WritingGoalDaily   = "daily"
+	WritingGoalProject = "project"
+)
+
+// WritingGoal is a word count target. A daily goal counts the words added each day;
+// a project goal counts the total words. NovelID is uuid.Nil for goals that cover
+// all of the user's novels.
+type WritingGoal struct {
+	BaseModel
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_writing_goal,priority:1" json:"user_id"`
+	NovelID     uuid.UUID  `gorm:"type:char(36);not null;uniqueIndex:idx_writing_goal,priority:2" json:"novel_id"`
+	Type        string     `gorm:"type:varchar(20);not null;uniqueIndex:idx_writing_goal,priority:3" json:"type"`
+	TargetWords int        `gorm:"not null" json:"target_words"`
+	Deadline    *time.Time `json:"deadline"`
+}
+
+// WritingSave is one save of a chapter. Saves are only appended; they are grouped
+// into writing sessions when read.
+type WritingSave struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	UserID       uint      `gorm:"not null;index:idx_writing_save_user,priority:1;index:idx_writing_save_novel,priority:2" json:"user_id"`
+	NovelID      uuid.UUID `gorm:"type:char(36);not null;index:idx_writing_save_novel,priority:1" json:"novel_id"`
+	ChapterID    uuid.UUID `gorm:"type:char(36);not null;index" json:"chapter_id"`
+	SavedAt      time.Time `gorm:"not null;index:idx_writing_save_user,priority:2" json:"saved_at"`
+	WordsAdded   int       `gorm:"default:0" json:"words_added"`
+	WordsRemoved int       `gorm:"default:0" json:"words_removed"`
+}
+
+// WritingSession is a run of saves of one chapter with no more than a short pause
+// between them. It is derived from the saves and not stored; ID is the ID of its
+// first save.
+type WritingSession struct {
+	ID           uint      `json:"id"`
+	UserID       uint      `json:"user_id"`
+	NovelID      uuid.UUID `json:"novel_id"`
+	ChapterID    uuid.UUID `json:"chapter_id"`
+	StartedAt    time.Time `json:"started_at"`
+	EndedAt      time.Time `json:"ended_at"`
+	WordsAdded   int       `json:"words_added"`
+	WordsRemoved int       `json:"words_removed"`
+	Saves        int       `json:"saves"`
+}
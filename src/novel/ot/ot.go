@@ -0,0 +1,254 @@
+// Package ot implements the operational transforms of the collaborative chapter
+// editor. Positions and lengths are counted in UTF-16 code units, as in browser
+// editors and ot.js, so a character outside the Basic Multilingual Plane such as an
+// emoji counts as two.
+package ot
+
+import (
+	"errors"
+	"st-novel-go/src/novel/dto"
+	"unicode/utf16"
+)
+
+// Operation is an edit of a whole document in the format of ot.js: a sequence of
+// retains, inserts and deletes that together span the document it applies to.
+type Operation []dto.CollabOpComponent
+
+var ErrLength = errors.New("operation does not match the document length")
+
+// Encode returns the UTF-16 code units of s.
+func Encode(s string) []uint16 {
+	return utf16.Encode([]rune(s))
+}
+
+// Decode returns the text of UTF-16 code units. An unpaired surrogate becomes
+// U+FFFD.
+func Decode(units []uint16) string {
+	return string(utf16.Decode(units))
+}
+
+// Len returns the length of s in UTF-16 code units.
+func Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+func (op Operation) Retain(n int) Operation {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].R > 0 {
+		op[last].R += n
+		return op
+	}
+	return append(op, dto.CollabOpComponent{R: n})
+}
+
+// Insert keeps inserts in front of an adjacent delete, so that equivalent
+// operations have the same form.
+func (op Operation) Insert(text string) Operation {
+	if text == "" {
+		return op
+	}
+	last := len(op) - 1
+	if last >= 0 && op[last].I != "" {
+		op[last].I += text
+		return op
+	}
+	if last >= 0 && op[last].D > 0 {
+		if last > 0 && op[last-1].I != "" {
+			op[last-1].I += text
+			return op
+		}
+		op = append(op, op[last])
+		op[last] = dto.CollabOpComponent{I: text}
+		return op
+	}
+	return append(op, dto.CollabOpComponent{I: text})
+}
+
+func (op Operation) Delete(n int) Operation {
+	if n <= 0 {
+		return op
+	}
+	if last := len(op) - 1; last >= 0 && op[last].D > 0 {
+		op[last].D += n
+		return op
+	}
+	return append(op, dto.CollabOpComponent{D: n})
+}
+
+// Normalize validates the components sent by a client and merges adjacent ones of
+// the same kind.
+func Normalize(components []dto.CollabOpComponent) (Operation, error) {
+	var op Operation
+	for _, c := range components {
+		set := 0
+		if c.R != 0 {
+			set++
+		}
+		if c.I != "" {
+			set++
+		}
+		if c.D != 0 {
+			set++
+		}
+		if set != 1 || c.R < 0 || c.D < 0 {
+			return nil, errors.New("each operation component must retain, insert or delete")
+		}
+		op = op.Retain(c.R).Insert(c.I).Delete(c.D)
+	}
+	return op, nil
+}
+
+// BaseLength is the length of the documents op applies to.
+func (op Operation) BaseLength() int {
+	n := 0
+	for _, c := range op {
+		n += c.R + c.D
+	}
+	return n
+}
+
+func (op Operation) IsNoop() bool {
+	for _, c := range op {
+		if c.I != "" || c.D > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns doc edited by op.
+func (op Operation) Apply(doc []uint16) ([]uint16, error) {
+	if op.BaseLength() != len(doc) {
+		return nil, ErrLength
+	}
+	result := make([]uint16, 0, len(doc))
+	pos := 0
+	for _, c := range op {
+		switch {
+		case c.R > 0:
+			result = append(result, doc[pos:pos+c.R]...)
+			pos += c.R
+		case c.I != "":
+			result = append(result, Encode(c.I)...)
+		default:
+			pos += c.D
+		}
+	}
+	return result, nil
+}
+
+// Transform transforms two concurrent operations a and b on the same document into
+// a' and b' such that applying a then b' equals applying b then a'. When both
+// insert at the same position, a's text comes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	var aPrime, bPrime Operation
+	ai, bi := 0, 0
+	var ac, bc *dto.CollabOpComponent
+	next := func(op Operation, i *int) *dto.CollabOpComponent {
+		if *i >= len(op) {
+			return nil
+		}
+		c := op[*i]
+		*i++
+		return &c
+	}
+	ac, bc = next(a, &ai), next(b, &bi)
+	for ac != nil || bc != nil {
+		if ac != nil && ac.I != "" {
+			aPrime = aPrime.Insert(ac.I)
+			bPrime = bPrime.Retain(Len(ac.I))
+			ac = next(a, &ai)
+			continue
+		}
+		if bc != nil && bc.I != "" {
+			aPrime = aPrime.Retain(Len(bc.I))
+			bPrime = bPrime.Insert(bc.I)
+			bc = next(b, &bi)
+			continue
+		}
+		if ac == nil || bc == nil {
+			return nil, nil, ErrLength
+		}
+
+		aLen, bLen := ac.R+ac.D, bc.R+bc.D
+		n := min(aLen, bLen)
+		switch {
+		case ac.R > 0 && bc.R > 0:
+			aPrime = aPrime.Retain(n)
+			bPrime = bPrime.Retain(n)
+		case ac.D > 0 && bc.R > 0:
+			aPrime = aPrime.Delete(n)
+		case ac.R > 0 && bc.D > 0:
+			bPrime = bPrime.Delete(n)
+		}
+		// 两边都删除同一段内容时无需输出任何操作
+
+		if aLen == n {
+			ac = next(a, &ai)
+		} else if ac.R > 0 {
+			ac.R -= n
+		} else {
+			ac.D -= n
+		}
+		if bLen == n {
+			bc = next(b, &bi)
+		} else if bc.R > 0 {
+			bc.R -= n
+		} else {
+			bc.D -= n
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// TransformIndex moves a cursor position over op, so that it keeps pointing at the
+// same character.
+func TransformIndex(index int, op Operation) int {
+	newIndex := index
+	for _, c := range op {
+		switch {
+		case c.R > 0:
+			index -= c.R
+		case c.I != "":
+			newIndex += Len(c.I)
+		default:
+			newIndex -= min(index, c.D)
+			index -= c.D
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return newIndex
+}
+
+// Replace returns the operation that turns from into to by replacing the part
+// between their common prefix and suffix. It never splits a surrogate pair.
+func Replace(from, to []uint16) Operation {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	if prefix > 0 && isHighSurrogate(from[prefix-1]) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	if suffix > 0 && isLowSurrogate(from[len(from)-suffix]) {
+		suffix--
+	}
+	var op Operation
+	return op.Retain(prefix).Insert(Decode(to[prefix : len(to)-suffix])).Delete(len(from) - prefix - suffix).Retain(suffix)
+}
+
+func isHighSurrogate(u uint16) bool { return u >= 0xd800 && u < 0xdc00 }
+
+func isLowSurrogate(u uint16) bool { return u >= 0xdc00 && u < 0xe000 }
@@ -0,0 +1,240 @@
+package ot
+
+import (
+	"math/rand"
+	"reflect"
+	"st-novel-go/src/novel/dto"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestLen(t *testing.T) {
+	cases := map[string]int{
+		"":         0,
+		"abc":      3,
+		"中文":       2,
+		"😀":        2,
+		"a😀中b":     5,
+		"𠀀":        2, // CJK 扩展 B 区字符同样占两个码元
+		"<p>😀</p>": 9,
+	}
+	for s, want := range cases {
+		if got := Len(s); got != want {
+			t.Errorf("Len(%q) = %d, want %d", s, got, want)
+		}
+		if got := len(Encode(s)); got != want {
+			t.Errorf("len(Encode(%q)) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestApplyCountsUTF16CodeUnits(t *testing.T) {
+	// 浏览器中 "a😀b".length 为 4，在 b 之前插入时 retain 3
+	op := Operation{}.Retain(3).Insert("x").Retain(1)
+	got, err := op.Apply(Encode("a😀b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Decode(got) != "a😀xb" {
+		t.Errorf("Apply = %q, want %q", Decode(got), "a😀xb")
+	}
+
+	// 按字符计数的操作长度不符，必须被拒绝
+	if _, err := (Operation{}.Retain(3)).Apply(Encode("a😀b")); err != ErrLength {
+		t.Errorf("Apply with a rune-counted length: err = %v, want ErrLength", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	op, err := Normalize([]dto.CollabOpComponent{{R: 1}, {R: 2}, {I: "a"}, {I: "b"}, {D: 1}, {D: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Operation{{R: 3}, {I: "ab"}, {D: 2}}
+	if !reflect.DeepEqual(op, want) {
+		t.Errorf("Normalize = %v, want %v", op, want)
+	}
+
+	for _, invalid := range [][]dto.CollabOpComponent{
+		{{}},
+		{{R: 1, I: "a"}},
+		{{R: -1}},
+		{{D: -2}},
+	} {
+		if _, err := Normalize(invalid); err == nil {
+			t.Errorf("Normalize(%v) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestInsertBeforeDelete(t *testing.T) {
+	a := Operation{}.Retain(1).Delete(2).Insert("x")
+	b := Operation{}.Retain(1).Insert("x").Delete(2)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("equivalent operations differ: %v and %v", a, b)
+	}
+}
+
+func TestTransformConverges(t *testing.T) {
+	doc := "a😀中b"
+	cases := []struct {
+		name string
+		a, b Operation
+	}{
+		{"inserts at different positions", Operation{}.Retain(1).Insert("x").Retain(4), Operation{}.Retain(3).Insert("😁").Retain(2)},
+		{"insert inside a deleted range", Operation{}.Retain(2).Insert("y").Retain(3), Operation{}.Retain(1).Delete(3).Retain(1)},
+		{"overlapping deletes", Operation{}.Delete(3).Retain(2), Operation{}.Retain(1).Delete(4)},
+		{"same position", Operation{}.Retain(3).Insert("A").Retain(2), Operation{}.Retain(3).Insert("B").Retain(2)},
+		{"noop", Operation{}.Retain(5), Operation{}.Delete(5).Insert("z")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkConverges(t, Encode(doc), tc.a, tc.b)
+		})
+	}
+}
+
+func TestTransformTieBreak(t *testing.T) {
+	a := Operation{}.Retain(1).Insert("A").Retain(1)
+	b := Operation{}.Retain(1).Insert("B").Retain(1)
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := Encode("xy")
+	viaA, _ := a.Apply(doc)
+	viaA, _ = bPrime.Apply(viaA)
+	viaB, _ := b.Apply(doc)
+	viaB, _ = aPrime.Apply(viaB)
+	if Decode(viaA) != "xABy" || Decode(viaB) != "xABy" {
+		t.Errorf("got %q and %q, want a's insert first: %q", Decode(viaA), Decode(viaB), "xABy")
+	}
+}
+
+func TestTransformRejectsMismatchedLengths(t *testing.T) {
+	if _, _, err := Transform(Operation{}.Retain(3), Operation{}.Retain(4)); err != ErrLength {
+		t.Errorf("err = %v, want ErrLength", err)
+	}
+}
+
+func TestTransformConvergesRandomly(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "中", "文", "😀", "𠀀", "<p>", "</p>"}
+	for i := 0; i < 2000; i++ {
+		doc := Encode(randomText(rng, alphabet, rng.Intn(8)))
+		checkConverges(t, doc, randomOperation(rng, alphabet, doc), randomOperation(rng, alphabet, doc))
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	cases := []struct {
+		name  string
+		index int
+		op    Operation
+		want  int
+	}{
+		{"insert before", 3, Operation{}.Insert("😀").Retain(4), 5},
+		{"insert after", 1, Operation{}.Retain(2).Insert("😀").Retain(2), 1},
+		{"delete before", 3, Operation{}.Delete(2).Retain(2), 1},
+		{"delete around", 2, Operation{}.Retain(1).Delete(2).Retain(1), 1},
+		{"delete after", 1, Operation{}.Retain(2).Delete(2), 1},
+	}
+	for _, tc := range cases {
+		if got := TransformIndex(tc.index, tc.op); got != tc.want {
+			t.Errorf("%s: TransformIndex(%d) = %d, want %d", tc.name, tc.index, got, tc.want)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	cases := []struct{ from, to string }{
+		{"", ""},
+		{"abc", "abc"},
+		{"abc", "axc"},
+		{"", "😀"},
+		{"a😀b", "ab"},
+		// 两个表情的高位代理相同，公共前缀不能停在代理对中间
+		{"a😀b", "a😁b"},
+		{"😀x😀", "😁x😁"},
+		{"中文😀", "中文"},
+	}
+	for _, tc := range cases {
+		from, to := Encode(tc.from), Encode(tc.to)
+		op := Replace(from, to)
+		got, err := op.Apply(from)
+		if err != nil {
+			t.Errorf("Replace(%q, %q) = %v: %v", tc.from, tc.to, op, err)
+			continue
+		}
+		if Decode(got) != tc.to {
+			t.Errorf("Replace(%q, %q) produces %q", tc.from, tc.to, Decode(got))
+		}
+		for _, c := range op {
+			if strings.ContainsRune(c.I, utf8.RuneError) {
+				t.Errorf("Replace(%q, %q) inserts a broken surrogate pair: %q", tc.from, tc.to, c.I)
+			}
+		}
+	}
+}
+
+func checkConverges(t *testing.T, doc []uint16, a, b Operation) {
+	t.Helper()
+	aPrime, bPrime, err := Transform(a, b)
+	if err != nil {
+		t.Fatalf("Transform(%v, %v): %v", a, b, err)
+	}
+	viaA, err := a.Apply(doc)
+	if err == nil {
+		viaA, err = bPrime.Apply(viaA)
+	}
+	if err != nil {
+		t.Fatalf("a then b' on %q: %v", Decode(doc), err)
+	}
+	viaB, err := b.Apply(doc)
+	if err == nil {
+		viaB, err = aPrime.Apply(viaB)
+	}
+	if err != nil {
+		t.Fatalf("b then a' on %q: %v", Decode(doc), err)
+	}
+	if !reflect.DeepEqual(viaA, viaB) {
+		t.Errorf("on %q, a=%v b=%v: a then b' gives %q, b then a' gives %q", Decode(doc), a, b, Decode(viaA), Decode(viaB))
+	}
+}
+
+func randomText(rng *rand.Rand, alphabet []string, n int) string {
+	s := ""
+	for i := 0; i < n; i++ {
+		s += alphabet[rng.Intn(len(alphabet))]
+	}
+	return s
+}
+
+// randomOperation edits doc at code point boundaries, as an editor does.
+func randomOperation(rng *rand.Rand, alphabet []string, doc []uint16) Operation {
+	var op Operation
+	pos := 0
+	for pos < len(doc) {
+		n := 1
+		if isHighSurrogate(doc[pos]) {
+			n = 2
+		}
+		switch rng.Intn(4) {
+		case 0:
+			op = op.Delete(n)
+		case 1:
+			op = op.Insert(randomText(rng, alphabet, 1+rng.Intn(2))).Retain(n)
+		default:
+			op = op.Retain(n)
+		}
+		pos += n
+	}
+	if rng.Intn(3) == 0 {
+		op = op.Insert(randomText(rng, alphabet, 1))
+	}
+	return op
+}
@@ -16,6 +16,12 @@ func RegisterNovelRoutes(router *gin.RouterGroup) {
 			dashboardGroup.GET("", handler.GetNovelsHandler)
 			dashboardGroup.POST("", handler.CreateNovelHandler)
 			dashboardGroup.GET("/categories", handler.GetCategoriesHandler)
+			dashboardGroup.GET("/shared", handler.GetSharedNovelsHandler)
+			dashboardGroup.GET("/stats", handler.GetWritingStatsHandler)
+			dashboardGroup.GET("/goals", handler.GetWritingGoalsHandler)
+			dashboardGroup.PUT("/goals", handler.SetWritingGoalHandler)
+			dashboardGroup.DELETE("/goals/:goalId", handler.DeleteWritingGoalHandler)
+			dashboardGroup.GET("/activity/calendar", handler.GetWritingCalendarHandler)
 		}
 
 		// Trash routes
@@ -26,6 +32,14 @@ func RegisterNovelRoutes(router *gin.RouterGroup) {
 			trashGroup.DELETE("/:itemId", handler.PermanentlyDeleteNovelHandler)
 		}
 
+		// Collaboration invitations received by the current user
+		invitationGroup := novelRoutes.Group("/invitations")
+		{
+			invitationGroup.GET("", handler.GetNovelInvitationsHandler)
+			invitationGroup.POST("/:invitationId/accept", handler.AcceptNovelInvitationHandler)
+			invitationGroup.POST("/:invitationId/decline", handler.DeclineNovelInvitationHandler)
+		}
+
 		// Recent Activity routes
 		recentGroup := novelRoutes.Group("/recent-items")
 		{
@@ -48,6 +62,8 @@ func RegisterNovelRoutes(router *gin.RouterGroup) {
 		novelSpecificGroup := novelRoutes.Group("/novels/:novelId")
 		{
 			novelSpecificGroup.GET("/metadata", handler.GetNovelMetadataHandler)
+			novelSpecificGroup.GET("/stats", handler.GetNovelWritingStatsHandler)
+			novelSpecificGroup.GET("/timeline", handler.GetWritingTimelineHandler)
 			novelSpecificGroup.PATCH("/metadata", handler.UpdateNovelMetadataHandler)
 			novelSpecificGroup.GET("/settings", handler.GetSettingsDataHandler)
 			novelSpecificGroup.PUT("/settings", handler.UpdateSettingsDataHandler)
@@ -63,6 +79,15 @@ func RegisterNovelRoutes(router *gin.RouterGroup) {
 			novelSpecificGroup.GET("/volumes", handler.GetVolumesHandler)
 			novelSpecificGroup.POST("/volumes", handler.CreateVolumeHandler)
 			novelSpecificGroup.PUT("/volumes/order", handler.UpdateVolumeOrderHandler)
+			novelSpecificGroup.GET("/snapshots", handler.GetNovelSnapshotsHandler)
+			novelSpecificGroup.POST("/snapshots", handler.CreateNovelSnapshotHandler)
+			novelSpecificGroup.GET("/snapshots/:snapshotId", handler.GetNovelSnapshotHandler)
+			novelSpecificGroup.POST("/snapshots/:snapshotId/restore", handler.RestoreNovelSnapshotHandler)
+			novelSpecificGroup.DELETE("/snapshots/:snapshotId", handler.DeleteNovelSnapshotHandler)
+			novelSpecificGroup.GET("/members", handler.GetNovelMembersHandler)
+			novelSpecificGroup.POST("/members", handler.InviteNovelMemberHandler)
+			novelSpecificGroup.PATCH("/members/:memberId", handler.UpdateNovelMemberHandler)
+			novelSpecificGroup.DELETE("/members/:memberId", handler.RemoveNovelMemberHandler)
 		}
 
 		// Routes for specific Volumes
@@ -95,6 +120,20 @@ func RegisterNovelRoutes(router *gin.RouterGroup) {
 			chapterSpecificGroup.GET("", handler.GetChapterHandler)
 			chapterSpecificGroup.PATCH("", handler.UpdateChapterHandler)
 			chapterSpecificGroup.DELETE("", handler.DeleteChapterHandler)
+			chapterSpecificGroup.POST("/collab/ticket", handler.CreateCollabTicketHandler)
+			chapterSpecificGroup.GET("/collab", handler.CollabChapterHandler)
+			chapterSpecificGroup.GET("/comments", handler.GetChapterCommentsHandler)
+			chapterSpecificGroup.POST("/comments", handler.CreateChapterCommentHandler)
+		}
+
+		// Comment routes (threads anchored to chapter text)
+		commentGroup := novelRoutes.Group("/comments")
+		{
+			commentGroup.GET("/mentions", handler.GetCommentMentionsHandler)
+			commentGroup.PATCH("/:commentId", handler.UpdateChapterCommentHandler)
+			commentGroup.DELETE("/:commentId", handler.DeleteChapterCommentHandler)
+			commentGroup.POST("/:commentId/resolve", handler.ResolveChapterCommentHandler)
+			commentGroup.POST("/:commentId/reopen", handler.ReopenChapterCommentHandler)
 		}
 
 		// Routes for Derived Content and Notes (CRUD on individual items)
@@ -110,10 +149,15 @@ func RegisterNovelRoutes(router *gin.RouterGroup) {
 			notesGroup.DELETE("/:noteId", handler.DeleteNoteHandler)
 		}
 
+		// Three-way merge for resolving edit conflicts
+		novelRoutes.POST("/documents/merge", handler.MergeDocumentsHandler)
+
 		// History routes
 		documentsGroup := novelRoutes.Group("/documents/:documentId/history")
 		{
 			documentsGroup.GET("", handler.GetHistoryHandler)
+			documentsGroup.GET("/diff", handler.DiffHistoryHandler)
+			documentsGroup.GET("/:versionId", handler.GetHistoryVersionHandler)
 			documentsGroup.POST("/:versionId/restore", handler.RestoreVersionHandler)
 		}
 	}
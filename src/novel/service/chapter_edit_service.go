@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sort"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+)
+
+// ErrChapterContentChanged is returned when a chapter was modified after the edits
+// to apply were computed.
+var ErrChapterContentChanged = errors.New("chapter content has changed since the edit was generated")
+
+// ChapterContentHash identifies a version of chapter content, so that edits computed
+// against it can be checked before they are applied.
+func ChapterContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApplyChapterEdits applies non-overlapping edits to a chapter whose content still
+// hashes to baseHash. The content before and after is recorded as history versions.
+func ApplyChapterEdits(chapterID string, userID uint, baseHash string, edits []dto.ChapterTextEdit, label string) (*model.Chapter, error) {
+	chapter, err := dao.FindChapterByID(chapterID)
+	if err != nil {
+		return nil, errors.New("chapter not found")
+	}
+	if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleEditor); err != nil {
+		return nil, errors.New("permission denied")
+	}
+	if ChapterContentHash(chapter.Content) != baseHash {
+		return nil, ErrChapterContentChanged
+	}
+	if len(edits) == 0 {
+		return nil, errors.New("no edits to apply")
+	}
+
+	sorted := append([]dto.ChapterTextEdit{}, edits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	content := []rune(chapter.Content)
+	for i, edit := range sorted {
+		if edit.Start < 0 || edit.End < edit.Start || edit.End > len(content) {
+			return nil, errors.New("edit range is out of bounds")
+		}
+		if i > 0 && edit.Start < sorted[i-1].End {
+			return nil, errors.New("edit ranges overlap")
+		}
+	}
+
+	// 从后往前替换，前面的偏移量保持不变
+	for i := len(sorted) - 1; i >= 0; i-- {
+		edit := sorted[i]
+		replaced := make([]rune, 0, len(content)-(edit.End-edit.Start)+len(edit.Text))
+		replaced = append(replaced, content[:edit.Start]...)
+		replaced = append(replaced, []rune(edit.Text)...)
+		content = append(replaced, content[edit.End:]...)
+	}
+
+	if err := CreateVersion(chapter.ID.String(), "chapter", model.HistorySaveSystem, "AI 编辑前快照", chapter.Content, userID); err != nil {
+		log.Printf("[chapter_edit_service] Failed to create history version for chapter %s: %v", chapterID, err)
+	}
+
+	oldWordCount := chapter.WordCount
+	chapter.Content = string(content)
+	chapter.Title = SyncTitleFromContent(chapter.Content, chapter.Title)
+	chapter.WordCount = countWordsFromHTML(chapter.Content)
+	if err := dao.UpdateChapter(chapter); err != nil {
+		return nil, err
+	}
+	recordChapterSave(userID, chapter, oldWordCount)
+
+	if err := CreateVersion(chapter.ID.String(), "chapter", model.HistorySaveSystem, label, chapter.Content, userID); err != nil {
+		log.Printf("[chapter_edit_service] Failed to create history version for chapter %s: %v", chapterID, err)
+	}
+	if err := LogRecentEdit(userID, chapter.NovelID, "chapter", chapter.ID.String(), chapter.Title); err != nil {
+		log.Printf("[chapter_edit_service] Failed to log recent edit for chapter %s: %v", chapterID, err)
+	}
+
+	return chapter, nil
+}
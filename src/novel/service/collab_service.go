@@ -0,0 +1,478 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"st-novel-go/src/config"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"st-novel-go/src/novel/ot"
+	userDao "st-novel-go/src/user/dao"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCollabSaveInterval = 10 * time.Second
+	defaultCollabMaxOps       = 1000
+	// 客户端发送队列满时说明连接过慢，直接断开，客户端重连后会重新同步
+	collabSendBuffer = 256
+)
+
+var collabColors = []string{"#e57373", "#64b5f6", "#81c784", "#ffb74d", "#ba68c8", "#4db6ac", "#f06292", "#a1887f"}
+
+func collabSaveInterval() time.Duration {
+	if seconds := config.AppConfig.Collaboration.SaveIntervalSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultCollabSaveInterval
+}
+
+func collabMaxOps() int {
+	if n := config.AppConfig.Collaboration.MaxBufferedOps; n > 0 {
+		return n
+	}
+	return defaultCollabMaxOps
+}
+
+// collabSession is the server copy of a chapter edited in real time. Clients send
+// operations based on a document version; the session transforms them against the
+// operations applied since, applies them and relays them to the other clients. The
+// content is written back to the chapter periodically and when the last client
+// leaves.
+type collabSession struct {
+	chapterID string
+	novelID   string
+
+	mu      sync.Mutex
+	content []uint16 // UTF-16 编码，与浏览器编辑器的位置计数一致
+	version int
+	// ops[i] 把版本 firstVersion+i 变为 firstVersion+i+1
+	ops          []ot.Operation
+	firstVersion int
+	clients      map[string]*CollabClient
+	dirty        bool
+	lastEditor   uint
+	// 最近一次写回章节的内容及其 revision，作为与其他途径修改合并时的共同祖先
+	savedContent  string
+	savedRevision int64
+	stop          chan struct{}
+
+	saveMu sync.Mutex
+}
+
+// CollabClient is a connection to a collaboration session. The transport reads
+// outgoing frames from Messages until it is closed and passes incoming frames to
+// Handle.
+type CollabClient struct {
+	ID     string
+	UserID uint
+	name   string
+	color  string
+	cursor *dto.CollabCursorDTO
+	// 评论者和只读成员可以查看实时内容和在线状态，但不能提交操作
+	readOnly bool
+	send     chan dto.CollabMessage
+	session  *collabSession
+	closed   bool
+}
+
+var collabSessions = struct {
+	sync.Mutex
+	m map[string]*collabSession
+}{m: make(map[string]*collabSession)}
+
+// JoinCollabSession connects the user to the editing session of a chapter, opening
+// the session when nobody is editing it yet. The client first receives an init frame
+// with the content and everyone online.
+func JoinCollabSession(chapterID string, userID uint) (*CollabClient, error) {
+	chapter, err := GetChapter(chapterID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &CollabClient{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		color:  collabColors[int(userID)%len(collabColors)],
+		send:   make(chan dto.CollabMessage, collabSendBuffer),
+	}
+	if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleEditor); err != nil {
+		client.readOnly = true
+	}
+	client.name = fmt.Sprintf("用户 %d", userID)
+	if user, err := userDao.FindUserByID(userID); err == nil && user.Name != "" {
+		client.name = user.Name
+	}
+
+	collabSessions.Lock()
+	defer collabSessions.Unlock()
+	s := collabSessions.m[chapterID]
+	if s == nil {
+		s = &collabSession{
+			chapterID:     chapterID,
+			novelID:       chapter.NovelID.String(),
+			content:       ot.Encode(chapter.Content),
+			clients:       make(map[string]*CollabClient),
+			savedContent:  chapter.Content,
+			savedRevision: chapter.Revision,
+			stop:          make(chan struct{}),
+		}
+		collabSessions.m[chapterID] = s
+		go s.run()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client.session = s
+	s.clients[client.ID] = client
+	s.sendLocked(client, s.snapshotLocked("init", client.ID))
+	s.broadcastLocked(client.ID, dto.CollabMessage{Type: "join", Clients: []dto.CollabPresenceDTO{client.presence()}})
+	return client, nil
+}
+
+func (c *CollabClient) Messages() <-chan dto.CollabMessage {
+	return c.send
+}
+
+// Handle processes a frame received from the client.
+func (c *CollabClient) Handle(msg dto.CollabMessage) {
+	s := c.session
+	switch msg.Type {
+	case "op":
+		s.applyOperation(c, msg)
+	case "cursor":
+		s.moveCursor(c, msg)
+	case "ping":
+		s.mu.Lock()
+		s.sendLocked(c, dto.CollabMessage{Type: "pong", Version: s.version})
+		s.mu.Unlock()
+	default:
+		s.mu.Lock()
+		s.sendLocked(c, dto.CollabMessage{Type: "error", Message: "unknown message type: " + msg.Type})
+		s.mu.Unlock()
+	}
+}
+
+// Leave disconnects the client. The last client to leave saves the content and
+// closes the session.
+func (c *CollabClient) Leave() {
+	s := c.session
+	s.mu.Lock()
+	s.removeClientLocked(c)
+	empty := len(s.clients) == 0
+	s.mu.Unlock()
+	if !empty {
+		return
+	}
+
+	s.save()
+
+	// 保存期间可能有新客户端加入，此时会话继续保留
+	collabSessions.Lock()
+	defer collabSessions.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) == 0 && collabSessions.m[s.chapterID] == s {
+		delete(collabSessions.m, s.chapterID)
+		close(s.stop)
+	}
+}
+
+// refreshCollabAccess applies a change of the user's membership of a novel to the
+// user's open collaboration clients: they are disconnected when the user lost access
+// and become read-only or writable with the new role.
+func refreshCollabAccess(novelID string, userID uint) {
+	collabSessions.Lock()
+	var sessions []*collabSession
+	for _, s := range collabSessions.m {
+		if s.novelID == novelID {
+			sessions = append(sessions, s)
+		}
+	}
+	collabSessions.Unlock()
+	if len(sessions) == 0 {
+		return
+	}
+
+	_, viewErr := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
+	_, editErr := dao.FindNovelWithRole(novelID, userID, model.RoleEditor)
+	for _, s := range sessions {
+		s.mu.Lock()
+		for _, c := range s.clients {
+			if c.UserID != userID {
+				continue
+			}
+			if viewErr != nil {
+				s.sendLocked(c, dto.CollabMessage{Type: "error", Message: "you no longer have access to this novel"})
+				s.removeClientLocked(c)
+				continue
+			}
+			if readOnly := editErr != nil; readOnly != c.readOnly {
+				c.readOnly = readOnly
+				s.broadcastLocked("", dto.CollabMessage{Type: "cursor", Version: s.version, Clients: []dto.CollabPresenceDTO{c.presence()}})
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// presence copies the cursor, which is moved in place while the frame may still be
+// queued.
+func (c *CollabClient) presence() dto.CollabPresenceDTO {
+	p := dto.CollabPresenceDTO{ClientID: c.ID, UserID: c.UserID, Name: c.name, Color: c.color, ReadOnly: c.readOnly}
+	if c.cursor != nil {
+		cursor := *c.cursor
+		p.Cursor = &cursor
+	}
+	return p
+}
+
+func (s *collabSession) run() {
+	ticker := time.NewTicker(collabSaveInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.save()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *collabSession) snapshotLocked(kind, clientID string) dto.CollabMessage {
+	content := ot.Decode(s.content)
+	clients := make([]dto.CollabPresenceDTO, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, c.presence())
+	}
+	return dto.CollabMessage{Type: kind, Version: s.version, Revision: s.savedRevision, Content: &content, ClientID: clientID, Clients: clients}
+}
+
+// sendLocked queues a frame for the client, disconnecting it when its queue is full.
+func (s *collabSession) sendLocked(c *CollabClient, msg dto.CollabMessage) {
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+		log.Printf("[collab_service] Dropping slow client %s of chapter %s", c.ID, s.chapterID)
+		s.removeClientLocked(c)
+	}
+}
+
+func (s *collabSession) broadcastLocked(exceptID string, msg dto.CollabMessage) {
+	for id, c := range s.clients {
+		if id != exceptID {
+			s.sendLocked(c, msg)
+		}
+	}
+}
+
+func (s *collabSession) removeClientLocked(c *CollabClient) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.send)
+	delete(s.clients, c.ID)
+	s.broadcastLocked(c.ID, dto.CollabMessage{Type: "leave", Clients: []dto.CollabPresenceDTO{c.presence()}})
+}
+
+// transformSinceLocked rebases an operation made at version onto the current content.
+func (s *collabSession) transformSinceLocked(op ot.Operation, version int) (ot.Operation, error) {
+	if version < s.firstVersion || version > s.version {
+		return nil, errors.New("version is out of range, resync required")
+	}
+	for _, applied := range s.ops[version-s.firstVersion:] {
+		var err error
+		if op, _, err = ot.Transform(op, applied); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// commitLocked applies an operation that is based on the current content and relays
+// it to every client except the author.
+func (s *collabSession) commitLocked(op ot.Operation, author *CollabClient) error {
+	content, err := op.Apply(s.content)
+	if err != nil {
+		return err
+	}
+	s.content = content
+	s.ops = append(s.ops, op)
+	s.version++
+	if extra := len(s.ops) - collabMaxOps(); extra > 0 {
+		s.ops = append([]ot.Operation(nil), s.ops[extra:]...)
+		s.firstVersion += extra
+	}
+	for _, c := range s.clients {
+		if c.cursor != nil {
+			c.cursor.Anchor = ot.TransformIndex(c.cursor.Anchor, op)
+			c.cursor.Head = ot.TransformIndex(c.cursor.Head, op)
+		}
+	}
+
+	msg := dto.CollabMessage{Type: "op", Version: s.version, Ops: op}
+	if author != nil {
+		msg.ClientID = author.ID
+		s.sendLocked(author, dto.CollabMessage{Type: "ack", Version: s.version})
+		s.broadcastLocked(author.ID, msg)
+	} else {
+		s.broadcastLocked("", msg)
+	}
+	return nil
+}
+
+func (s *collabSession) applyOperation(c *CollabClient, msg dto.CollabMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if c.readOnly {
+		s.sendLocked(c, dto.CollabMessage{Type: "error", Message: "your role on this novel does not allow editing"})
+		return
+	}
+	op, err := ot.Normalize(msg.Ops)
+	if err == nil {
+		op, err = s.transformSinceLocked(op, msg.Version)
+	}
+	if err == nil {
+		err = s.commitLocked(op, c)
+	}
+	if err != nil {
+		// 客户端状态已与服务器不一致，下发完整内容让其重新同步
+		s.sendLocked(c, dto.CollabMessage{Type: "error", Message: err.Error()})
+		s.sendLocked(c, s.snapshotLocked("resync", c.ID))
+		return
+	}
+	s.dirty = true
+	s.lastEditor = c.UserID
+}
+
+func (s *collabSession) moveCursor(c *CollabClient, msg dto.CollabMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if msg.Cursor == nil {
+		c.cursor = nil
+	} else {
+		if msg.Version < s.firstVersion || msg.Version > s.version {
+			return
+		}
+		cursor := *msg.Cursor
+		for _, applied := range s.ops[msg.Version-s.firstVersion:] {
+			cursor.Anchor = ot.TransformIndex(cursor.Anchor, applied)
+			cursor.Head = ot.TransformIndex(cursor.Head, applied)
+		}
+		cursor.Anchor = max(0, min(cursor.Anchor, len(s.content)))
+		cursor.Head = max(0, min(cursor.Head, len(s.content)))
+		c.cursor = &cursor
+	}
+	s.broadcastLocked(c.ID, dto.CollabMessage{Type: "cursor", Version: s.version, Clients: []dto.CollabPresenceDTO{c.presence()}})
+}
+
+// save writes the session content back to the chapter, with an autosave history
+// version attributed to the last editor. When the chapter was changed by another
+// route in the meantime, both edits are merged and the merge is sent to the clients
+// as an operation.
+func (s *collabSession) save() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	dirty, version := s.dirty, s.version
+	content := ot.Decode(s.content)
+	base, baseRevision, editor := s.savedContent, s.savedRevision, s.lastEditor
+	s.dirty = false
+	s.mu.Unlock()
+
+	chapter, err := dao.FindChapterByID(s.chapterID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.mu.Lock()
+			for _, c := range s.clients {
+				s.sendLocked(c, dto.CollabMessage{Type: "error", Message: "chapter has been deleted"})
+				s.removeClientLocked(c)
+			}
+			s.mu.Unlock()
+		} else {
+			s.markDirty()
+		}
+		log.Printf("[collab_service] Failed to load chapter %s for saving: %v", s.chapterID, err)
+		return
+	}
+	if !dirty && chapter.Revision == baseRevision {
+		return
+	}
+
+	merged := content
+	if chapter.Revision != baseRevision {
+		result, err := MergeHTML(dto.MergePayload{Base: base, Ours: content, Theirs: chapter.Content})
+		if err != nil {
+			s.markDirty()
+			return
+		}
+		merged = result.Merged
+	}
+
+	if merged != chapter.Content {
+		before, oldWordCount := chapter.Content, chapter.WordCount
+		chapter.Content = merged
+		chapter.Title = SyncTitleFromContent(chapter.Content, chapter.Title)
+		chapter.WordCount = countWordsFromHTML(chapter.Content)
+		if err := dao.UpdateChapter(chapter); err != nil {
+			// 与其他保存冲突时留到下一轮重新合并
+			s.markDirty()
+			if !errors.Is(err, dao.ErrRevisionConflict) {
+				log.Printf("[collab_service] Failed to save chapter %s: %v", s.chapterID, err)
+			}
+			return
+		}
+		if editor != 0 {
+			saveDocumentVersions(s.chapterID, "chapter", model.HistorySaveAutosave, "", before, merged, editor)
+			recordChapterSave(editor, chapter, oldWordCount)
+			if err := LogRecentEdit(editor, chapter.NovelID, "chapter", s.chapterID, chapter.Title); err != nil {
+				log.Printf("[collab_service] Failed to log recent edit for chapter %s: %v", s.chapterID, err)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.savedContent, s.savedRevision = merged, chapter.Revision
+	if merged != content {
+		op, err := s.transformSinceLocked(ot.Replace(ot.Encode(content), ot.Encode(merged)), version)
+		if err == nil {
+			err = s.commitLocked(op, nil)
+		}
+		if err != nil {
+			// 无法变换时以合并结果为准，所有客户端重新同步
+			s.content, s.ops, s.firstVersion = ot.Encode(merged), nil, s.version
+			s.dirty = false
+			for _, c := range s.clients {
+				c.cursor = nil
+				s.sendLocked(c, s.snapshotLocked("resync", c.ID))
+			}
+			return
+		}
+		version = s.version
+	}
+	s.broadcastLocked("", dto.CollabMessage{Type: "saved", Version: version, Revision: chapter.Revision})
+}
+
+func (s *collabSession) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
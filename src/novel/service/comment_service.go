@@ -0,0 +1,420 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"st-novel-go/src/novel/ot"
+	userDao "st-novel-go/src/user/dao"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxCommentRunes  = 5000
+	maxQuoteRunes    = 500
+	maxMentionedList = 100
+)
+
+// GetChapterComments returns the threads of a chapter, oldest first, each with its
+// replies. status is "open", "resolved" or empty for all threads.
+func GetChapterComments(chapterID, status string, userID uint) ([]dto.ChapterCommentDTO, error) {
+	if status != "" && status != "open" && status != "resolved" {
+		return nil, errors.New("status must be open or resolved")
+	}
+	chapter, err := dao.FindChapterByID(chapterID)
+	if err != nil {
+		return nil, errors.New("chapter not found")
+	}
+	if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleViewer); err != nil {
+		return nil, errors.New("permission denied")
+	}
+	comments, err := dao.GetChapterComments(chapterID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint]string)
+	threads := make([]dto.ChapterCommentDTO, 0)
+	index := make(map[uuid.UUID]int)
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			continue
+		}
+		if (status == "open" && comment.Resolved) || (status == "resolved" && !comment.Resolved) {
+			continue
+		}
+		index[comment.ID] = len(threads)
+		threads = append(threads, mapChapterCommentToDTO(&comment, names))
+	}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			continue
+		}
+		if i, ok := index[*comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, mapChapterCommentToDTO(&comment, names))
+		}
+	}
+	return threads, nil
+}
+
+// CreateChapterComment starts a thread on a chapter or replies to one. Commenters
+// and above can comment.
+func CreateChapterComment(chapterID string, userID uint, payload dto.CreateCommentPayload) (*dto.ChapterCommentDTO, error) {
+	chapter, err := dao.FindChapterByID(chapterID)
+	if err != nil {
+		return nil, errors.New("chapter not found")
+	}
+	novel, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleCommenter)
+	if err != nil {
+		return nil, errors.New("permission denied")
+	}
+	content, err := normalizeCommentContent(payload.Content)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := validateMentions(novel, payload.Mentions)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &model.ChapterComment{
+		NovelID:   chapter.NovelID,
+		ChapterID: chapter.ID,
+		UserID:    userID,
+		Content:   content,
+		Mentions:  mentions,
+	}
+	if payload.ParentID != "" {
+		parent, err := dao.FindChapterCommentByID(payload.ParentID)
+		if err != nil || parent.ChapterID != chapter.ID {
+			return nil, errors.New("parent comment not found")
+		}
+		if parent.ParentID != nil {
+			return nil, errors.New("replies can only be added to the first comment of a thread")
+		}
+		comment.ParentID = &parent.ID
+	} else {
+		if err := anchorComment(comment, chapter.Content, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := dao.CreateChapterComment(comment); err != nil {
+		return nil, err
+	}
+	result := mapChapterCommentToDTO(comment, make(map[uint]string))
+	return &result, nil
+}
+
+// anchorComment checks the anchor of a new thread and records the quoted text.
+func anchorComment(comment *model.ChapterComment, content string, payload dto.CreateCommentPayload) error {
+	anchorID := strings.TrimSpace(payload.AnchorID)
+	if (payload.Start == nil) != (payload.End == nil) {
+		return errors.New("start and end must be given together")
+	}
+	if payload.Start == nil && anchorID == "" {
+		return errors.New("a thread must be anchored to a text range or an anchor ID")
+	}
+	if anchorID != "" {
+		if !hasAnchorElement(content, anchorID) {
+			return errors.New("anchor ID not found in chapter content")
+		}
+		comment.AnchorID = anchorID
+	}
+	if payload.Start != nil {
+		start, end := *payload.Start, *payload.End
+		// 与协同编辑器一致，位置按 UTF-16 码元计数
+		units := ot.Encode(content)
+		if start < 0 || end < start || end > len(units) {
+			return errors.New("text range is outside the chapter content")
+		}
+		if splitsSurrogatePair(units, start) || splitsSurrogatePair(units, end) {
+			return errors.New("text range splits a character")
+		}
+		comment.Start, comment.End = &start, &end
+		quote := []rune(strings.TrimSpace(stripHtmlTags(ot.Decode(units[start:end]))))
+		if len(quote) > maxQuoteRunes {
+			quote = append(quote[:maxQuoteRunes], '…')
+		}
+		comment.Quote = string(quote)
+	}
+	return nil
+}
+
+// splitsSurrogatePair reports whether pos falls between the two halves of a
+// character outside the Basic Multilingual Plane.
+func splitsSurrogatePair(units []uint16, pos int) bool {
+	return pos > 0 && pos < len(units) && units[pos] >= 0xDC00 && units[pos] <= 0xDFFF
+}
+
+func hasAnchorElement(content, anchorID string) bool {
+	return strings.Contains(content, `id="`+anchorID+`"`)
+}
+
+func normalizeCommentContent(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", errors.New("comment content is required")
+	}
+	if utf8.RuneCountInString(content) > maxCommentRunes {
+		return "", errors.New("comment content is too long")
+	}
+	return content, nil
+}
+
+// validateMentions keeps each mentioned user once and checks that all of them can
+// see the novel.
+func validateMentions(novel model.Novel, mentions []uint) ([]byte, error) {
+	seen := make(map[uint]bool)
+	unique := make([]uint, 0, len(mentions))
+	for _, id := range mentions {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		role, err := dao.GetNovelRole(novel, id)
+		if err != nil {
+			return nil, err
+		}
+		if role == "" {
+			return nil, errors.New("only members of the novel can be mentioned")
+		}
+		unique = append(unique, id)
+	}
+	return json.Marshal(unique)
+}
+
+// UpdateChapterComment edits the content or mentions of the user's own comment.
+func UpdateChapterComment(commentID string, userID uint, payload dto.UpdateCommentPayload) (*dto.ChapterCommentDTO, error) {
+	comment, err := dao.FindChapterCommentByID(commentID)
+	if err != nil {
+		return nil, errors.New("comment not found")
+	}
+	if comment.UserID != userID {
+		return nil, errors.New("only the author can edit a comment")
+	}
+	novel, err := dao.FindNovelWithRole(comment.NovelID.String(), userID, model.RoleCommenter)
+	if err != nil {
+		return nil, errors.New("permission denied")
+	}
+	if payload.Content != nil {
+		if comment.Content, err = normalizeCommentContent(*payload.Content); err != nil {
+			return nil, err
+		}
+	}
+	if payload.Mentions != nil {
+		if comment.Mentions, err = validateMentions(novel, *payload.Mentions); err != nil {
+			return nil, err
+		}
+	}
+	if err := dao.UpdateChapterComment(comment); err != nil {
+		return nil, err
+	}
+	result := mapChapterCommentToDTO(comment, make(map[uint]string))
+	return &result, nil
+}
+
+// DeleteChapterComment deletes a comment, with its replies when it starts a thread.
+// Authors can delete their comments and the owner can delete any.
+func DeleteChapterComment(commentID string, userID uint) error {
+	comment, err := dao.FindChapterCommentByID(commentID)
+	if err != nil {
+		return errors.New("comment not found")
+	}
+	minRole := model.RoleCommenter
+	if comment.UserID != userID {
+		minRole = model.RoleOwner
+	}
+	if _, err := dao.FindNovelWithRole(comment.NovelID.String(), userID, minRole); err != nil {
+		return errors.New("permission denied")
+	}
+	return dao.DeleteChapterComment(commentID)
+}
+
+// SetChapterCommentResolved resolves or reopens a thread. Editors, the owner and
+// the author of the thread can do so.
+func SetChapterCommentResolved(commentID string, userID uint, resolved bool) (*dto.ChapterCommentDTO, error) {
+	comment, err := dao.FindChapterCommentByID(commentID)
+	if err != nil {
+		return nil, errors.New("comment not found")
+	}
+	if comment.ParentID != nil {
+		return nil, errors.New("only the first comment of a thread can be resolved")
+	}
+	minRole := model.RoleEditor
+	if comment.UserID == userID {
+		minRole = model.RoleCommenter
+	}
+	if _, err := dao.FindNovelWithRole(comment.NovelID.String(), userID, minRole); err != nil {
+		return nil, errors.New("permission denied")
+	}
+
+	comment.Resolved = resolved
+	if resolved {
+		now := time.Now()
+		comment.ResolvedBy, comment.ResolvedAt = userID, &now
+	} else {
+		comment.ResolvedBy, comment.ResolvedAt = 0, nil
+	}
+	if err := dao.UpdateChapterComment(comment); err != nil {
+		return nil, err
+	}
+	result := mapChapterCommentToDTO(comment, make(map[uint]string))
+	return &result, nil
+}
+
+// GetCommentMentions returns the latest comments mentioning the user, on novels the
+// user can still access.
+func GetCommentMentions(userID uint) ([]dto.ChapterCommentDTO, error) {
+	comments, err := dao.GetCommentsMentioningUser(userID, maxMentionedList)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string)
+	access := make(map[uuid.UUID]bool)
+	dtoList := make([]dto.ChapterCommentDTO, 0, len(comments))
+	for _, comment := range comments {
+		allowed, ok := access[comment.NovelID]
+		if !ok {
+			_, err := dao.FindNovelWithRole(comment.NovelID.String(), userID, model.RoleViewer)
+			allowed = err == nil
+			access[comment.NovelID] = allowed
+		}
+		if allowed {
+			dtoList = append(dtoList, mapChapterCommentToDTO(&comment, names))
+		}
+	}
+	return dtoList, nil
+}
+
+// commentPositionMapper maps positions in the old content of a chapter to the new
+// content along an edit script. Positions are counted in UTF-16 code units. Text inserted exactly at the position goes before
+// it when afterInserts is true, after it otherwise; positions inside deleted text
+// move to where the deletion was.
+func commentPositionMapper(script []diffOp) func(pos int, afterInserts bool) int {
+	return func(pos int, afterInserts bool) int {
+		oldPos, newPos := 0, 0
+		for _, op := range script {
+			n := ot.Len(op.text)
+			switch op.kind {
+			case diffInsert:
+				if pos == oldPos && !afterInserts {
+					return newPos
+				}
+				newPos += n
+			case diffEqual:
+				if pos < oldPos+n {
+					return newPos + pos - oldPos
+				}
+				oldPos += n
+				newPos += n
+			default:
+				if pos < oldPos+n {
+					return newPos
+				}
+				oldPos += n
+			}
+		}
+		return newPos
+	}
+}
+
+// remapChapterComments moves the anchors of a chapter's threads after its content
+// changed from before to after. A thread whose text was deleted entirely, or whose
+// anchor element is gone, is marked detached. It runs as a ChapterContentChanged
+// hook inside the transaction that saves the chapter, so concurrent saves re-map in
+// the order they are committed.
+func remapChapterComments(tx *gorm.DB, chapterID, before, after string) error {
+	comments, err := dao.GetAnchoredChapterComments(tx, chapterID)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	var mapPos func(int, bool) int
+	for i := range comments {
+		comment := &comments[i]
+		changed := false
+		if comment.AnchorID != "" && !hasAnchorElement(after, comment.AnchorID) {
+			comment.Detached, changed = true, true
+		}
+		if comment.Start != nil && comment.End != nil {
+			if mapPos == nil {
+				mapPos = commentPositionMapper(diffHTML(before, after))
+			}
+			start, end := mapPos(*comment.Start, true), mapPos(*comment.End, false)
+			if end < start {
+				end = start
+			}
+			if start == end && *comment.Start < *comment.End {
+				comment.Detached = true
+			}
+			changed = changed || start != *comment.Start || end != *comment.End || comment.Detached
+			comment.Start, comment.End = &start, &end
+		}
+		if !changed {
+			continue
+		}
+		if err := dao.UpdateChapterCommentAnchor(tx, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterNovelHooks keeps the comment anchors of a chapter in step with its
+// content, whichever path saves it.
+func RegisterNovelHooks() {
+	dao.RegisterNovelHooks(dao.NovelHooks{
+		ChapterContentChanged: remapChapterComments,
+	})
+}
+
+func mapChapterCommentToDTO(comment *model.ChapterComment, names map[uint]string) dto.ChapterCommentDTO {
+	name, ok := names[comment.UserID]
+	if !ok {
+		if user, err := userDao.FindUserByID(comment.UserID); err == nil {
+			name = user.Name
+		}
+		names[comment.UserID] = name
+	}
+	var mentions []uint
+	_ = json.Unmarshal(comment.Mentions, &mentions)
+	if mentions == nil {
+		mentions = []uint{}
+	}
+
+	result := dto.ChapterCommentDTO{
+		ID:         comment.ID.String(),
+		NovelID:    comment.NovelID.String(),
+		ChapterID:  comment.ChapterID.String(),
+		UserID:     comment.UserID,
+		AuthorName: name,
+		Content:    comment.Content,
+		Start:      comment.Start,
+		End:        comment.End,
+		AnchorID:   comment.AnchorID,
+		Quote:      comment.Quote,
+		Detached:   comment.Detached,
+		Mentions:   mentions,
+		Resolved:   comment.Resolved,
+		ResolvedBy: comment.ResolvedBy,
+		CreatedAt:  comment.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:  comment.UpdatedAt.Format(time.RFC3339),
+	}
+	if comment.ParentID != nil {
+		result.ParentID = comment.ParentID.String()
+	}
+	if comment.ResolvedAt != nil {
+		result.ResolvedAt = comment.ResolvedAt.Format(time.RFC3339)
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"testing"
+)
+
+func TestAnchorCommentCountsUTF16(t *testing.T) {
+	content := "<p>😀你好世界</p>"
+	// "<p>" 占 3 个码元，表情占 2 个，因此“你好”是 5..7
+	start, end := 5, 7
+	var comment model.ChapterComment
+	if err := anchorComment(&comment, content, dto.CreateCommentPayload{Start: &start, End: &end}); err != nil {
+		t.Fatalf("anchorComment: %v", err)
+	}
+	if comment.Quote != "你好" {
+		t.Fatalf("quote = %q, want %q", comment.Quote, "你好")
+	}
+
+	splitStart := 4
+	if err := anchorComment(&comment, content, dto.CreateCommentPayload{Start: &splitStart, End: &end}); err == nil {
+		t.Fatal("a range that splits the emoji was accepted")
+	}
+	last := len([]rune(content)) + 1
+	if err := anchorComment(&comment, content, dto.CreateCommentPayload{Start: &start, End: &last}); err != nil {
+		t.Fatalf("a range within the UTF-16 length was rejected: %v", err)
+	}
+}
+
+func TestCommentPositionMapperCountsUTF16(t *testing.T) {
+	before := "<p>你好世界</p>"
+	after := "<p>😀你好世界</p>"
+	mapPos := commentPositionMapper(diffHTML(before, after))
+	// “你好”在旧内容中是 3..5，前面插入的表情占 2 个码元
+	if start, end := mapPos(3, true), mapPos(5, false); start != 5 || end != 7 {
+		t.Fatalf("mapped range = %d..%d, want 5..7", start, end)
+	}
+}
@@ -30,7 +30,7 @@ func getNovelIDFromSource(sourceID string) (uuid.UUID, error) {
 }
 
 func GetDerivedContentForNovel(novelID string, userID uint) ([]model.DerivedContent, error) {
-	if _, err := dao.FindNovelByID(novelID, userID); err != nil {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
 		return nil, errors.New("permission denied or novel not found")
 	}
 	return dao.GetDerivedContentForNovel(novelID)
@@ -42,7 +42,7 @@ func CreateDerivedContent(userID uint, payload dto.CreateDerivedContentPayload)
 		return nil, err
 	}
 
-	if _, err := dao.FindNovelByID(novelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(novelID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied for the associated novel")
 	}
 
@@ -64,11 +64,14 @@ func UpdateDerivedContent(itemID string, userID uint, payload dto.UpdateDerivedC
 	if err != nil {
 		return nil, errors.New("derived content not found")
 	}
-	if _, err := dao.FindNovelByID(item.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(item.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied")
 	}
+	if err := checkBaseRevision(payload.BaseVersion, item.Revision, item); err != nil {
+		return nil, err
+	}
 
-	_ = CreateVersion(item.ID.String(), "derived_content", "手动保存", item.Content, userID)
+	_ = CreateVersion(item.ID.String(), "derived_content", model.HistorySaveManual, "手动保存", item.Content, userID)
 
 	if payload.Title != nil {
 		item.Title = *payload.Title
@@ -78,7 +81,13 @@ func UpdateDerivedContent(itemID string, userID uint, payload dto.UpdateDerivedC
 		item.Title = SyncTitleFromContent(item.Content, item.Title)
 	}
 	if err := dao.UpdateDerivedContent(item); err != nil {
-		return nil, err
+		return nil, asRevisionConflict(err, item.Revision, func() (interface{}, int64, error) {
+			latest, err := dao.FindDerivedContentByID(itemID)
+			if err != nil {
+				return nil, 0, err
+			}
+			return latest, latest.Revision, nil
+		})
 	}
 
 	_ = LogRecentEdit(userID, item.NovelID, item.Type, item.ID.String(), item.Title)
@@ -91,14 +100,14 @@ func DeleteDerivedContent(itemID string, userID uint) error {
 	if err != nil {
 		return errors.New("derived content not found")
 	}
-	if _, err := dao.FindNovelByID(item.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(item.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return errors.New("permission denied")
 	}
 	return dao.DeleteDerivedContent(itemID)
 }
 
 func GetNotesForNovel(novelID string, userID uint) ([]model.Note, error) {
-	if _, err := dao.FindNovelByID(novelID, userID); err != nil {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
 		return nil, errors.New("permission denied or novel not found")
 	}
 	return dao.GetNotesForNovel(novelID)
@@ -109,7 +118,7 @@ func CreateNote(novelID string, userID uint, payload dto.CreateNotePayload) (*mo
 	if err != nil {
 		return nil, errors.New("invalid novel ID")
 	}
-	if _, err := dao.FindNovelByID(novelUUID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(novelUUID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied or novel not found")
 	}
 	note := &model.Note{
@@ -128,11 +137,14 @@ func UpdateNote(noteID string, userID uint, payload dto.UpdateNotePayload) (*mod
 	if err != nil {
 		return nil, errors.New("note not found")
 	}
-	if _, err := dao.FindNovelByID(note.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(note.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied")
 	}
+	if err := checkBaseRevision(payload.BaseVersion, note.Revision, note); err != nil {
+		return nil, err
+	}
 
-	_ = CreateVersion(note.ID.String(), "note", "手动保存", note.Content, userID)
+	_ = CreateVersion(note.ID.String(), "note", model.HistorySaveManual, "手动保存", note.Content, userID)
 
 	if payload.Title != nil {
 		note.Title = *payload.Title
@@ -142,7 +154,13 @@ func UpdateNote(noteID string, userID uint, payload dto.UpdateNotePayload) (*mod
 		note.Title = SyncTitleFromContent(note.Content, note.Title)
 	}
 	if err := dao.UpdateNote(note); err != nil {
-		return nil, err
+		return nil, asRevisionConflict(err, note.Revision, func() (interface{}, int64, error) {
+			latest, err := dao.FindNoteByID(noteID)
+			if err != nil {
+				return nil, 0, err
+			}
+			return latest, latest.Revision, nil
+		})
 	}
 
 	_ = LogRecentEdit(userID, note.NovelID, "note", note.ID.String(), note.Title)
@@ -155,7 +173,7 @@ func DeleteNote(noteID string, userID uint) error {
 	if err != nil {
 		return errors.New("note not found")
 	}
-	if _, err := dao.FindNovelByID(note.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(note.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return errors.New("permission denied")
 	}
 	return dao.DeleteNote(noteID)
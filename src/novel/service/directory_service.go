@@ -9,7 +9,7 @@ import (
 )
 
 func GetVolumes(novelID string, userID uint) ([]model.Volume, error) {
-	if _, err := dao.FindNovelByID(novelID, userID); err != nil {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
 		return nil, errors.New("permission denied or novel not found")
 	}
 	return dao.GetVolumesByNovelID(novelID)
@@ -20,7 +20,7 @@ func GetChaptersForVolume(volumeID string, userID uint) ([]model.Chapter, error)
 	if err != nil {
 		return nil, errors.New("volume not found")
 	}
-	if _, err := dao.FindNovelByID(volume.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(volume.NovelID.String(), userID, model.RoleViewer); err != nil {
 		return nil, errors.New("permission denied")
 	}
 	return dao.GetChaptersByVolumeID(volumeID)
@@ -31,14 +31,14 @@ func GetChapter(chapterID string, userID uint) (*model.Chapter, error) {
 	if err != nil {
 		return nil, err
 	}
-	if _, err := dao.FindNovelByID(chapter.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleViewer); err != nil {
 		return nil, errors.New("permission denied or novel not found")
 	}
 	return chapter, nil
 }
 
 func CreateVolume(novelID string, userID uint, payload dto.CreateVolumePayload) (*model.Volume, error) {
-	novel, err := dao.FindNovelByID(novelID, userID)
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleEditor)
 	if err != nil {
 		return nil, errors.New("permission denied or novel not found")
 	}
@@ -59,7 +59,7 @@ func CreateChapter(volumeID string, userID uint, payload dto.CreateChapterPayloa
 	if err != nil {
 		return nil, errors.New("volume not found")
 	}
-	if _, err := dao.FindNovelByID(volume.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(volume.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied")
 	}
 	chapter := &model.Chapter{
@@ -70,9 +70,13 @@ func CreateChapter(volumeID string, userID uint, payload dto.CreateChapterPayloa
 		Status:   payload.Status,
 		Order:    payload.Order,
 	}
+	chapter.WordCount = countWordsFromHTML(chapter.Content)
 	if err := dao.CreateChapter(chapter); err != nil {
 		return nil, err
 	}
+	if chapter.WordCount > 0 {
+		recordChapterSave(userID, chapter, 0)
+	}
 	return chapter, nil
 }
 
@@ -81,11 +85,14 @@ func UpdateVolume(volumeID string, userID uint, payload dto.UpdateVolumePayload)
 	if err != nil {
 		return nil, errors.New("volume not found")
 	}
-	if _, err := dao.FindNovelByID(volume.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(volume.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied")
 	}
+	if err := checkBaseRevision(payload.BaseVersion, volume.Revision, volume); err != nil {
+		return nil, err
+	}
 
-	if err := CreateVersion(volume.ID.String(), "volume", "手动保存", volume.Content, userID); err != nil {
+	if err := CreateVersion(volume.ID.String(), "volume", model.HistorySaveManual, "手动保存", volume.Content, userID); err != nil {
 		log.Printf("[directory_service] Failed to create history version for volume %s: %v", volumeID, err)
 	}
 
@@ -97,7 +104,13 @@ func UpdateVolume(volumeID string, userID uint, payload dto.UpdateVolumePayload)
 		volume.Title = SyncTitleFromContent(volume.Content, volume.Title)
 	}
 	if err := dao.UpdateVolume(volume); err != nil {
-		return nil, err
+		return nil, asRevisionConflict(err, volume.Revision, func() (interface{}, int64, error) {
+			latest, err := dao.FindVolumeByID(volumeID)
+			if err != nil {
+				return nil, 0, err
+			}
+			return latest, latest.Revision, nil
+		})
 	}
 
 	if err := LogRecentEdit(userID, volume.NovelID, "outline", volume.ID.String(), volume.Title); err != nil {
@@ -112,17 +125,23 @@ func UpdateChapter(chapterID string, userID uint, payload dto.UpdateChapterPaylo
 	if err != nil {
 		return nil, errors.New("chapter not found")
 	}
-	if _, err := dao.FindNovelByID(chapter.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return nil, errors.New("permission denied")
 	}
 
-	if err := CreateVersion(chapter.ID.String(), "chapter", "手动保存", chapter.Content, userID); err != nil {
-		log.Printf("[directory_service] Failed to create history version for chapter %s: %v", chapterID, err)
+	saveKind, err := normalizeSaveKind(payload.SaveKind, payload.Label)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBaseRevision(payload.BaseVersion, chapter.Revision, chapter); err != nil {
+		return nil, err
 	}
+	contentBefore := chapter.Content
 
 	if payload.Title != nil {
 		chapter.Title = *payload.Title
 	}
+	oldWordCount := chapter.WordCount
 	if payload.Content != nil {
 		chapter.Content = *payload.Content
 		chapter.Title = SyncTitleFromContent(chapter.Content, chapter.Title)
@@ -133,7 +152,17 @@ func UpdateChapter(chapterID string, userID uint, payload dto.UpdateChapterPaylo
 		chapter.Status = *payload.Status
 	}
 	if err := dao.UpdateChapter(chapter); err != nil {
-		return nil, err
+		return nil, asRevisionConflict(err, chapter.Revision, func() (interface{}, int64, error) {
+			latest, err := dao.FindChapterByID(chapterID)
+			if err != nil {
+				return nil, 0, err
+			}
+			return latest, latest.Revision, nil
+		})
+	}
+	saveDocumentVersions(chapter.ID.String(), "chapter", saveKind, payload.Label, contentBefore, chapter.Content, userID)
+	if payload.Content != nil {
+		recordChapterSave(userID, chapter, oldWordCount)
 	}
 
 	if err := LogRecentEdit(userID, chapter.NovelID, "chapter", chapter.ID.String(), chapter.Title); err != nil {
@@ -148,7 +177,7 @@ func DeleteVolume(volumeID string, userID uint) error {
 	if err != nil {
 		return errors.New("volume not found")
 	}
-	if _, err := dao.FindNovelByID(volume.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(volume.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return errors.New("permission denied")
 	}
 	return dao.DeleteVolume(volume.ID.String())
@@ -159,14 +188,14 @@ func DeleteChapter(chapterID string, userID uint) error {
 	if err != nil {
 		return errors.New("chapter not found")
 	}
-	if _, err := dao.FindNovelByID(chapter.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return errors.New("permission denied")
 	}
 	return dao.DeleteChapter(chapter.ID.String())
 }
 
 func UpdateVolumeOrder(novelID string, userID uint, orderedIDs []string) error {
-	if _, err := dao.FindNovelByID(novelID, userID); err != nil {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleEditor); err != nil {
 		return errors.New("permission denied or novel not found")
 	}
 	return dao.UpdateVolumeOrder(novelID, orderedIDs)
@@ -177,7 +206,7 @@ func UpdateChapterOrder(volumeID string, userID uint, orderedIDs []string) error
 	if err != nil {
 		return errors.New("volume not found")
 	}
-	if _, err := dao.FindNovelByID(volume.NovelID.String(), userID); err != nil {
+	if _, err := dao.FindNovelWithRole(volume.NovelID.String(), userID, model.RoleEditor); err != nil {
 		return errors.New("permission denied")
 	}
 	return dao.UpdateChapterOrder(volumeID, orderedIDs)
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDeltaCells 限制 LCS 表的大小，超过时把中间的差异整体替换
+const maxDeltaCells = 2000000
+
+// deltaOp is one step of a history delta: copy or skip bytes of the base, or insert
+// new text.
+type deltaOp struct {
+	Copy   int    `json:"c,omitempty"`
+	Delete int    `json:"d,omitempty"`
+	Insert string `json:"i,omitempty"`
+}
+
+// computeDelta returns the operations that turn base into target. The texts are
+// compared by tokens (tags and sentences), and each replaced region is then trimmed
+// to the characters that actually differ.
+func computeDelta(base, target string) []deltaOp {
+	a, b := tokenizeForDelta(base), tokenizeForDelta(target)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	builder := &deltaBuilder{}
+	builder.copy(joinedLen(a[:prefix]))
+	builder.diffTokens(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	builder.copy(joinedLen(a[len(a)-suffix:]))
+	return builder.ops
+}
+
+// applyDelta rebuilds the target text from base and the operations of computeDelta.
+func applyDelta(base string, ops []deltaOp) (string, error) {
+	var sb strings.Builder
+	pos := 0
+	for _, op := range ops {
+		switch {
+		case op.Copy > 0:
+			if pos+op.Copy > len(base) {
+				return "", errors.New("history delta does not match its base version")
+			}
+			sb.WriteString(base[pos : pos+op.Copy])
+			pos += op.Copy
+		case op.Delete > 0:
+			if pos+op.Delete > len(base) {
+				return "", errors.New("history delta does not match its base version")
+			}
+			pos += op.Delete
+		default:
+			sb.WriteString(op.Insert)
+		}
+	}
+	if pos != len(base) {
+		return "", errors.New("history delta does not match its base version")
+	}
+	return sb.String(), nil
+}
+
+// tokenizeForDelta splits text after tags, line breaks and sentence endings.
+func tokenizeForDelta(text string) []string {
+	var tokens []string
+	start := 0
+	for i, r := range text {
+		switch r {
+		case '>', '\n', '。', '！', '？', '.', '!', '?':
+			end := i + utf8.RuneLen(r)
+			tokens = append(tokens, text[start:end])
+			start = end
+		}
+	}
+	if start < len(text) {
+		tokens = append(tokens, text[start:])
+	}
+	return tokens
+}
+
+func joinedLen(tokens []string) int {
+	n := 0
+	for _, token := range tokens {
+		n += len(token)
+	}
+	return n
+}
+
+type deltaBuilder struct {
+	ops []deltaOp
+}
+
+func (d *deltaBuilder) copy(n int) {
+	if n == 0 {
+		return
+	}
+	if last := len(d.ops) - 1; last >= 0 && d.ops[last].Copy > 0 {
+		d.ops[last].Copy += n
+		return
+	}
+	d.ops = append(d.ops, deltaOp{Copy: n})
+}
+
+// replace records that removed is replaced by inserted, keeping the characters the
+// two have in common at either end.
+func (d *deltaBuilder) replace(removed, inserted string) {
+	prefix := 0
+	for prefix < len(removed) && prefix < len(inserted) && removed[prefix] == inserted[prefix] {
+		prefix++
+	}
+	for prefix > 0 && prefix < len(removed) && !utf8.RuneStart(removed[prefix]) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(removed)-prefix && suffix < len(inserted)-prefix &&
+		removed[len(removed)-1-suffix] == inserted[len(inserted)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && !utf8.RuneStart(removed[len(removed)-suffix]) {
+		suffix--
+	}
+
+	d.copy(prefix)
+	if n := len(removed) - prefix - suffix; n > 0 {
+		d.ops = append(d.ops, deltaOp{Delete: n})
+	}
+	if text := inserted[prefix : len(inserted)-suffix]; text != "" {
+		d.ops = append(d.ops, deltaOp{Insert: text})
+	}
+	d.copy(suffix)
+}
+
+// diffTokens emits the operations for two token lists using their longest common
+// subsequence.
+func (d *deltaBuilder) diffTokens(a, b []string) {
+	var removed, inserted strings.Builder
+	flush := func() {
+		if removed.Len() > 0 || inserted.Len() > 0 {
+			d.replace(removed.String(), inserted.String())
+			removed.Reset()
+			inserted.Reset()
+		}
+	}
+	for _, op := range lcsScript(a, b, maxDeltaCells) {
+		switch op.kind {
+		case diffEqual:
+			flush()
+			d.copy(len(op.text))
+		case diffDelete:
+			removed.WriteString(op.text)
+		default:
+			inserted.WriteString(op.text)
+		}
+	}
+	flush()
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	cases := []struct{ name, base, target string }{
+		{"empty", "", ""},
+		{"from empty", "", "<p>第一句。</p>"},
+		{"to empty", "<p>第一句。</p>", ""},
+		{"unchanged", "<p>第一句。第二句。</p>", "<p>第一句。第二句。</p>"},
+		{"edit inside a sentence", "<p>他走进房间。她笑了。</p>", "<p>他慢慢走进房间。她笑了。</p>"},
+		{"new paragraph", "<p>第一段。</p>", "<p>第一段。</p><p>第二段。</p>"},
+		{"deleted sentence", "<p>一。二。三。</p>", "<p>一。三。</p>"},
+		{"emoji and ascii", "<p>Hello 😀 world.</p>", "<p>Hello 😁 brave world.</p>"},
+		{"rewritten", "<p>完全不同的内容。</p>", "<h1>标题</h1><p>另一段文字。</p>"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := applyDelta(tc.base, computeDelta(tc.base, tc.target))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.target {
+				t.Errorf("applyDelta(computeDelta) = %q, want %q", got, tc.target)
+			}
+		})
+	}
+}
+
+func TestDeltaOfSmallEditIsSmall(t *testing.T) {
+	base := strings.Repeat("<p>这是一段很长的正文。</p>", 200)
+	target := strings.Replace(base, "正文", "文字", 1)
+	inserted := 0
+	for _, op := range computeDelta(base, target) {
+		inserted += len(op.Insert)
+	}
+	if inserted > len("文字") {
+		t.Errorf("delta inserts %d bytes for a two-character edit", inserted)
+	}
+}
+
+func TestApplyDeltaRejectsAnotherBase(t *testing.T) {
+	ops := computeDelta("<p>原文。</p>", "<p>新文。</p>")
+	if _, err := applyDelta("<p>别的版本。</p>", ops); err == nil {
+		t.Error("applyDelta on a different base succeeded, want an error")
+	}
+}
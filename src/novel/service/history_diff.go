@@ -0,0 +1,461 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"html"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	diffEqual  = '='
+	diffInsert = '+'
+	diffDelete = '-'
+
+	// CurrentVersionID 在对比接口中表示文档的当前内容
+	CurrentVersionID = "current"
+
+	// maxFineDiffCells 限制逐字对比时 LCS 表的大小
+	maxFineDiffCells = 1000000
+	previewRunes     = 80
+)
+
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// lcsScript returns the edit script between two token lists. Common tokens at
+// either end are matched first; when the remaining table would exceed maxCells, the
+// middle is reported as one deletion and one insertion.
+func lcsScript(a, b []string, maxCells int) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var script []diffOp
+	for _, token := range a[:prefix] {
+		script = append(script, diffOp{diffEqual, token})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxCells {
+		for _, token := range midA {
+			script = append(script, diffOp{diffDelete, token})
+		}
+		for _, token := range midB {
+			script = append(script, diffOp{diffInsert, token})
+		}
+	} else {
+		// lcs[i][j] 为 midA[i:] 与 midB[j:] 的最长公共子序列长度
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) || j < len(midB) {
+			switch {
+			case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+				script = append(script, diffOp{diffEqual, midA[i]})
+				i++
+				j++
+			case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+				script = append(script, diffOp{diffDelete, midA[i]})
+				i++
+			default:
+				script = append(script, diffOp{diffInsert, midB[j]})
+				j++
+			}
+		}
+	}
+	for _, token := range a[len(a)-suffix:] {
+		script = append(script, diffOp{diffEqual, token})
+	}
+	return script
+}
+
+// tokenizeHTMLForDiff splits HTML into tags, entities, Latin words, runs of
+// whitespace and single characters, so that Chinese text is compared character by
+// character and other text word by word.
+func tokenizeHTMLForDiff(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		end := i + size
+		switch {
+		case r == '<':
+			if j := strings.IndexByte(text[i:], '>'); j >= 0 {
+				end = i + j + 1
+			}
+		case r == '&':
+			if j := strings.IndexByte(text[i:], ';'); j > 0 && j <= 10 {
+				end = i + j + 1
+			}
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if next >= utf8.RuneSelf || !(unicode.IsLetter(next) || unicode.IsDigit(next)) {
+					break
+				}
+				end += nextSize
+			}
+		case unicode.IsSpace(r):
+			for end < len(text) {
+				next, nextSize := utf8.DecodeRuneInString(text[end:])
+				if !unicode.IsSpace(next) {
+					break
+				}
+				end += nextSize
+			}
+		}
+		tokens = append(tokens, text[i:end])
+		i = end
+	}
+	return tokens
+}
+
+// diffHTML compares two HTML documents sentence by sentence, then refines every
+// changed region character by character.
+func diffHTML(from, to string) []diffOp {
+	var script []diffOp
+	var removed, inserted []string
+	flush := func() {
+		if len(removed) == 0 && len(inserted) == 0 {
+			return
+		}
+		script = append(script, lcsScript(tokenizeHTMLForDiff(strings.Join(removed, "")), tokenizeHTMLForDiff(strings.Join(inserted, "")), maxFineDiffCells)...)
+		removed, inserted = nil, nil
+	}
+	for _, op := range lcsScript(tokenizeForDelta(from), tokenizeForDelta(to), maxDeltaCells) {
+		switch op.kind {
+		case diffEqual:
+			flush()
+			script = append(script, op)
+		case diffDelete:
+			removed = append(removed, op.text)
+		default:
+			inserted = append(inserted, op.text)
+		}
+	}
+	flush()
+	return script
+}
+
+// renderDiff merges the script into segments and renders it as HTML. Changed text is
+// wrapped in <ins> and <del>; inserted tags are kept and deleted tags dropped, so
+// that the result has the structure of the newer document.
+func renderDiff(script []diffOp) ([]dto.DiffSegmentDTO, string, int, int) {
+	var segments []dto.DiffSegmentDTO
+	var sb strings.Builder
+	open := byte(0)
+	inserted, deleted := 0, 0
+
+	closeMark := func() {
+		switch open {
+		case diffInsert:
+			sb.WriteString("</ins>")
+		case diffDelete:
+			sb.WriteString("</del>")
+		}
+		open = 0
+	}
+	for _, op := range script {
+		name := map[byte]string{diffEqual: "equal", diffInsert: "insert", diffDelete: "delete"}[op.kind]
+		if last := len(segments) - 1; last >= 0 && segments[last].Op == name {
+			segments[last].Text += op.text
+		} else {
+			segments = append(segments, dto.DiffSegmentDTO{Op: name, Text: op.text})
+		}
+
+		isTag := strings.HasPrefix(op.text, "<")
+		switch {
+		case op.kind == diffEqual:
+			closeMark()
+			sb.WriteString(op.text)
+		case isTag:
+			closeMark()
+			if op.kind == diffInsert {
+				sb.WriteString(op.text)
+			}
+		default:
+			if open != op.kind {
+				closeMark()
+				if op.kind == diffInsert {
+					sb.WriteString(`<ins class="diff-insert">`)
+				} else {
+					sb.WriteString(`<del class="diff-delete">`)
+				}
+				open = op.kind
+			}
+			sb.WriteString(op.text)
+			chars := utf8.RuneCountInString(html.UnescapeString(op.text))
+			if op.kind == diffInsert {
+				inserted += chars
+			} else {
+				deleted += chars
+			}
+		}
+	}
+	closeMark()
+	return segments, sb.String(), inserted, deleted
+}
+
+// GetHistoryVersion returns one version with its full content.
+func GetHistoryVersion(documentID, versionID string, userID uint) (*dto.HistoryVersionDetailDTO, error) {
+	versions, err := dao.GetHistorySummariesForDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		if err := checkHistoryAccess(documentID, versions[0].DocumentType, userID); err != nil {
+			return nil, err
+		}
+	}
+	for i, v := range versions {
+		if v.ID.String() != versionID {
+			continue
+		}
+		full, err := dao.FindHistoryVersionByID(versionID)
+		if err != nil {
+			return nil, err
+		}
+		contents := make(map[uuid.UUID]string)
+		content, err := loadVersionContent(full, contents)
+		if err != nil {
+			return nil, err
+		}
+		v.WordCount, v.Preview = summarizeHistoryContent(v.DocumentType, content)
+		previousWordCount := 0
+		if i > 0 {
+			previous := versions[i-1]
+			previousWordCount = previous.WordCount
+			if !previous.Summarized {
+				previousWordCount = 0
+				if full, err := dao.FindHistoryVersionByID(previous.ID.String()); err == nil {
+					if content, err := loadVersionContent(full, contents); err == nil {
+						previousWordCount, _ = summarizeHistoryContent(previous.DocumentType, content)
+					}
+				}
+			}
+		}
+		return &dto.HistoryVersionDetailDTO{
+			HistoryVersionDTO: mapHistoryVersionSummaryToDTO(v, previousWordCount),
+			Content:           historyDisplayContent(v.DocumentType, content),
+		}, nil
+	}
+	return nil, errors.New("history version not found or permission denied")
+}
+
+// DiffHistoryVersions compares two versions of a document. Either ID may be
+// CurrentVersionID to compare against the document's current content.
+func DiffHistoryVersions(documentID, fromID, toID string, userID uint) (*dto.HistoryDiffDTO, error) {
+	if fromID == "" {
+		return nil, errors.New("from is required")
+	}
+	if toID == "" {
+		toID = CurrentVersionID
+	}
+	versions, err := dao.GetHistorySummariesForDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("document has no history")
+	}
+	if err := checkHistoryAccess(documentID, versions[0].DocumentType, userID); err != nil {
+		return nil, err
+	}
+	contents := make(map[uuid.UUID]string)
+
+	resolve := func(id string) (string, string, error) {
+		if id == CurrentVersionID {
+			content, err := loadCurrentDocumentContent(documentID, versions[0].DocumentType, userID)
+			return content, "当前内容", err
+		}
+		for _, v := range versions {
+			if v.ID.String() == id {
+				full, err := dao.FindHistoryVersionByID(id)
+				if err != nil {
+					return "", "", err
+				}
+				content, err := loadVersionContent(full, contents)
+				if err != nil {
+					return "", "", err
+				}
+				return historyDisplayContent(v.DocumentType, content), v.Label + " · " + v.CreatedAt.Format(time.RFC3339), nil
+			}
+		}
+		return "", "", errors.New("history version not found or permission denied")
+	}
+	fromContent, fromLabel, err := resolve(fromID)
+	if err != nil {
+		return nil, err
+	}
+	toContent, toLabel, err := resolve(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, diffHTMLText, inserted, deleted := renderDiff(diffHTML(fromContent, toContent))
+	if segments == nil {
+		segments = []dto.DiffSegmentDTO{}
+	}
+	return &dto.HistoryDiffDTO{
+		From:          fromID,
+		To:            toID,
+		FromLabel:     fromLabel,
+		ToLabel:       toLabel,
+		HTML:          diffHTMLText,
+		Segments:      segments,
+		InsertedChars: inserted,
+		DeletedChars:  deleted,
+		WordDelta:     countWordsFromHTML(toContent) - countWordsFromHTML(fromContent),
+	}, nil
+}
+
+// checkHistoryAccess lets every member of the novel a document belongs to read the
+// document's history.
+func checkHistoryAccess(documentID, documentType string, userID uint) error {
+	var novelID string
+	switch documentType {
+	case "chapter":
+		chapter, err := dao.FindChapterByID(documentID)
+		if err != nil {
+			return errors.New("chapter not found")
+		}
+		novelID = chapter.NovelID.String()
+	case "volume":
+		volume, err := dao.FindVolumeByID(documentID)
+		if err != nil {
+			return errors.New("volume not found")
+		}
+		novelID = volume.NovelID.String()
+	case "derived_content":
+		item, err := dao.FindDerivedContentByID(documentID)
+		if err != nil {
+			return errors.New("derived content not found")
+		}
+		novelID = item.NovelID.String()
+	case "note":
+		note, err := dao.FindNoteByID(documentID)
+		if err != nil {
+			return errors.New("note not found")
+		}
+		novelID = note.NovelID.String()
+	case NodeDocumentType:
+		nodeNovelID, _, _, err := parseNodeDocumentID(documentID)
+		if err != nil {
+			return err
+		}
+		novelID = nodeNovelID
+	default:
+		return errors.New("unsupported document type: " + documentType)
+	}
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
+		return errors.New("history version not found or permission denied")
+	}
+	return nil
+}
+
+// loadCurrentDocumentContent returns the current content of a document the user can
+// access.
+func loadCurrentDocumentContent(documentID, documentType string, userID uint) (string, error) {
+	var novelID, content string
+	switch documentType {
+	case "chapter":
+		chapter, err := dao.FindChapterByID(documentID)
+		if err != nil {
+			return "", errors.New("chapter not found")
+		}
+		novelID, content = chapter.NovelID.String(), chapter.Content
+	case "volume":
+		volume, err := dao.FindVolumeByID(documentID)
+		if err != nil {
+			return "", errors.New("volume not found")
+		}
+		novelID, content = volume.NovelID.String(), volume.Content
+	case "derived_content":
+		item, err := dao.FindDerivedContentByID(documentID)
+		if err != nil {
+			return "", errors.New("derived content not found")
+		}
+		novelID, content = item.NovelID.String(), item.Content
+	case "note":
+		note, err := dao.FindNoteByID(documentID)
+		if err != nil {
+			return "", errors.New("note not found")
+		}
+		novelID, content = note.NovelID.String(), note.Content
+	case NodeDocumentType:
+		nodeNovelID, nodeType, id, err := parseNodeDocumentID(documentID)
+		if err != nil {
+			return "", err
+		}
+		tree, _, err := loadNodeTree(nodeNovelID, nodeType, userID)
+		if err != nil {
+			return "", errors.New("permission denied")
+		}
+		node, parent := findTreeNode(tree, id)
+		if node == nil {
+			return "", errors.New("node not found")
+		}
+		encoded, err := encodeNodeVersion(node, parent)
+		if err != nil {
+			return "", err
+		}
+		return nodeDisplayContent(encoded), nil
+	default:
+		return "", errors.New("unsupported document type: " + documentType)
+	}
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
+		return "", errors.New("permission denied")
+	}
+	return content, nil
+}
+
+// mapHistoryVersionSummaryToDTO maps a version from its stored summary.
+func mapHistoryVersionSummaryToDTO(v model.HistoryVersion, previousWordCount int) dto.HistoryVersionDTO {
+	return dto.HistoryVersionDTO{
+		ID:        v.ID.String(),
+		Label:     v.Label,
+		Kind:      v.SaveKind,
+		UserID:    v.UserID,
+		Timestamp: formatTimeAgo(v.CreatedAt),
+		CreatedAt: v.CreatedAt.Format(time.RFC3339),
+		WordCount: v.WordCount,
+		WordDelta: v.WordCount - previousWordCount,
+		Preview:   v.Preview,
+	}
+}
+
+// summarizeHistoryContent returns the word count and the preview of a version's
+// content.
+func summarizeHistoryContent(documentType, content string) (int, string) {
+	content = historyDisplayContent(documentType, content)
+	preview := []rune(strings.Join(strings.Fields(stripHtmlTags(strings.NewReplacer("<", " <").Replace(content))), " "))
+	if len(preview) > previewRunes {
+		preview = append(preview[:previewRunes], '…')
+	}
+	return countWordsFromHTML(content), html.UnescapeString(string(preview))
+}
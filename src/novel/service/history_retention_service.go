@@ -0,0 +1,225 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"log"
+	"sort"
+	"st-novel-go/src/config"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/model"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeepAllHours       = 24
+	defaultHourlyDays         = 7
+	defaultCompactionInterval = time.Hour
+	compactionBatchSize       = 100
+	defaultChangeLogDays      = 30
+)
+
+var compactionOnce sync.Once
+
+// historyRetention is the retention policy: every version newer than keepAll, the
+// latest version of each hour until hourlyUntil, and the latest version of each day
+// after that, until dailyUntil when it is set.
+type historyRetention struct {
+	keepAllSince time.Time
+	hourlySince  time.Time
+	dailySince   time.Time // 零值表示按天保留的版本永不删除
+}
+
+func currentHistoryRetention(now time.Time) historyRetention {
+	cfg := config.AppConfig.History
+	keepAllHours := cfg.KeepAllHours
+	if keepAllHours <= 0 {
+		keepAllHours = defaultKeepAllHours
+	}
+	hourlyDays := cfg.HourlyDays
+	if hourlyDays <= 0 {
+		hourlyDays = defaultHourlyDays
+	}
+	policy := historyRetention{
+		keepAllSince: now.Add(-time.Duration(keepAllHours) * time.Hour),
+		hourlySince:  now.AddDate(0, 0, -hourlyDays),
+	}
+	if cfg.DailyDays > 0 {
+		policy.dailySince = now.AddDate(0, 0, -(hourlyDays + cfg.DailyDays))
+	}
+	return policy
+}
+
+// retainedVersions returns the IDs of the versions the policy keeps. versions are
+// sorted oldest first; the latest version and checkpoints are always kept.
+func (p historyRetention) retainedVersions(versions []model.HistoryVersion) map[uuid.UUID]bool {
+	kept := make(map[uuid.UUID]bool, len(versions))
+	seenBuckets := make(map[string]bool)
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		var bucket string
+		switch {
+		case i == len(versions)-1 || v.SaveKind == model.HistorySaveCheckpoint || !v.CreatedAt.Before(p.keepAllSince):
+			kept[v.ID] = true
+			continue
+		case !v.CreatedAt.Before(p.hourlySince):
+			bucket = v.CreatedAt.Format("2006-01-02 15")
+		case p.dailySince.IsZero() || !v.CreatedAt.Before(p.dailySince):
+			bucket = v.CreatedAt.Format("2006-01-02")
+		default:
+			continue
+		}
+		// 从新到旧遍历，每个时间段保留最先遇到的（即最新的）版本
+		if !seenBuckets[bucket] {
+			seenBuckets[bucket] = true
+			kept[v.ID] = true
+		}
+	}
+	return kept
+}
+
+// StartHistoryCompaction starts the background job that thins old history versions
+// with the retention policy and prunes the sync change log. It runs once at startup
+// and then periodically.
+func StartHistoryCompaction() {
+	compactionOnce.Do(func() {
+		interval := defaultCompactionInterval
+		if minutes := config.AppConfig.History.CompactionIntervalMinutes; minutes > 0 {
+			interval = time.Duration(minutes) * time.Minute
+		}
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				CompactHistory()
+				PruneChangeLog()
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+// CompactHistory applies the retention policy to every document with versions older
+// than the keep-all window.
+func CompactHistory() {
+	policy := currentHistoryRetention(time.Now())
+	compacted, removed := 0, 0
+	afterID := ""
+	for {
+		documentIDs, err := dao.GetDocumentsWithHistoryBefore(policy.keepAllSince, afterID, compactionBatchSize)
+		if err != nil {
+			log.Printf("[history_retention_service] Failed to list documents for compaction: %v", err)
+			return
+		}
+		for _, documentID := range documentIDs {
+			n, err := compactDocumentHistory(documentID, policy)
+			if err != nil {
+				log.Printf("[history_retention_service] Failed to compact history of document %s: %v", documentID, err)
+				continue
+			}
+			if n > 0 {
+				compacted++
+				removed += n
+			}
+		}
+		if len(documentIDs) < compactionBatchSize {
+			break
+		}
+		afterID = documentIDs[len(documentIDs)-1]
+	}
+	if removed > 0 {
+		log.Printf("History compaction removed %d versions from %d documents.", removed, compacted)
+	}
+}
+
+// PruneChangeLog deletes the change log entries older than the configured number of
+// days. Clients whose cursor falls into the pruned range get the full state again.
+func PruneChangeLog() {
+	days := config.AppConfig.History.ChangeLogDays
+	if days <= 0 {
+		days = defaultChangeLogDays
+	}
+	before := time.Now().AddDate(0, 0, -days)
+	var pruned int64
+	afterID := ""
+	for {
+		novelIDs, err := dao.GetNovelsWithChangesBefore(before, afterID, compactionBatchSize)
+		if err != nil {
+			log.Printf("[history_retention_service] Failed to list novels for change log pruning: %v", err)
+			return
+		}
+		for _, novelID := range novelIDs {
+			n, err := dao.PruneNovelChanges(novelID, before)
+			if err != nil {
+				log.Printf("[history_retention_service] Failed to prune change log of novel %s: %v", novelID, err)
+				continue
+			}
+			pruned += n
+		}
+		if len(novelIDs) < compactionBatchSize {
+			break
+		}
+		afterID = novelIDs[len(novelIDs)-1]
+	}
+	if pruned > 0 {
+		log.Printf("Change log pruning removed %d entries.", pruned)
+	}
+}
+
+// compactDocumentHistory deletes the versions of a document that the policy drops
+// and re-encodes the remaining ones as a new chain of snapshots and deltas. It
+// returns the number of versions deleted.
+func compactDocumentHistory(documentID string, policy historyRetention) (int, error) {
+	versions, err := dao.GetHistoryChainForDocument(documentID)
+	if err != nil {
+		return 0, err
+	}
+	kept := policy.retainedVersions(versions)
+	if len(kept) == len(versions) {
+		return 0, nil
+	}
+	contents, _ := rebuildHistoryContents(versions)
+
+	var deleted []uuid.UUID
+	var retained []model.HistoryVersion
+	for _, v := range versions {
+		if !kept[v.ID] {
+			deleted = append(deleted, v.ID)
+			continue
+		}
+		if _, ok := contents[v.ID]; !ok {
+			// 无法重建的版本保持原样，不参与重新编码
+			log.Printf("[history_retention_service] Skipping history version %s that cannot be rebuilt", v.ID)
+			continue
+		}
+		retained = append(retained, v)
+	}
+	sort.SliceStable(retained, func(i, j int) bool { return retained[i].CreatedAt.Before(retained[j].CreatedAt) })
+
+	var updated []model.HistoryVersion
+	depth := 0
+	for i, v := range retained {
+		encoded := v
+		content := contents[v.ID]
+		encoded.Kind, encoded.BaseID, encoded.Content, encoded.Delta = model.HistoryKindSnapshot, nil, content, ""
+		if i > 0 && depth+1 < snapshotInterval() {
+			if delta, ok := encodeDelta(contents[retained[i-1].ID], content); ok {
+				baseID := retained[i-1].ID
+				encoded.Kind, encoded.BaseID, encoded.Content, encoded.Delta = model.HistoryKindDelta, &baseID, "", delta
+			}
+		}
+		if encoded.Kind == model.HistoryKindDelta {
+			depth++
+		} else {
+			depth = 0
+		}
+		if encoded.Kind != v.Kind || derefUUID(encoded.BaseID) != derefUUID(v.BaseID) {
+			updated = append(updated, encoded)
+		}
+	}
+
+	if err := dao.RewriteHistory(updated, deleted); err != nil {
+		return 0, err
+	}
+	return len(deleted), nil
+}
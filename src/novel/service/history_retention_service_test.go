@@ -0,0 +1,70 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"st-novel-go/src/novel/model"
+	"testing"
+	"time"
+)
+
+func TestRetainedVersions(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	policy := historyRetention{
+		keepAllSince: now.Add(-24 * time.Hour),
+		hourlySince:  now.AddDate(0, 0, -7),
+		dailySince:   now.AddDate(0, 0, -30),
+	}
+	type saved struct {
+		name string
+		at   time.Time
+		kind string
+		want bool
+	}
+	cases := []saved{
+		{"older than daily retention", now.AddDate(0, 0, -40), model.HistorySaveAutosave, false},
+		{"checkpoint older than daily retention", now.AddDate(0, 0, -40).Add(time.Hour), model.HistorySaveCheckpoint, true},
+		{"earlier save of a day", time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), model.HistorySaveManual, false},
+		{"latest save of a day", time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC), model.HistorySaveManual, true},
+		{"earlier save of an hour", time.Date(2024, 5, 17, 10, 5, 0, 0, time.UTC), model.HistorySaveAutosave, false},
+		{"latest save of an hour", time.Date(2024, 5, 17, 10, 55, 0, 0, time.UTC), model.HistorySaveAutosave, true},
+		{"another hour", time.Date(2024, 5, 17, 11, 5, 0, 0, time.UTC), model.HistorySaveAutosave, true},
+		{"within keep-all window", now.Add(-2 * time.Hour), model.HistorySaveAutosave, true},
+		{"also within keep-all window", now.Add(-time.Hour), model.HistorySaveAutosave, true},
+	}
+	versions := make([]model.HistoryVersion, len(cases))
+	for i, c := range cases {
+		versions[i] = model.HistoryVersion{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: c.at}, SaveKind: c.kind}
+	}
+
+	kept := policy.retainedVersions(versions)
+	for i, c := range cases {
+		if kept[versions[i].ID] != c.want {
+			t.Errorf("%s: kept = %v, want %v", c.name, kept[versions[i].ID], c.want)
+		}
+	}
+}
+
+func TestRetainedVersionsKeepsLatest(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	policy := historyRetention{keepAllSince: now, hourlySince: now, dailySince: now}
+	versions := []model.HistoryVersion{
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.AddDate(-1, 0, 0)}},
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.AddDate(0, -6, 0)}},
+	}
+	kept := policy.retainedVersions(versions)
+	if kept[versions[0].ID] || !kept[versions[1].ID] {
+		t.Errorf("kept = %v, want only the latest version", kept)
+	}
+}
+
+func TestRetainedVersionsWithoutDailyLimit(t *testing.T) {
+	now := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	policy := historyRetention{keepAllSince: now.Add(-24 * time.Hour), hourlySince: now.AddDate(0, 0, -7)}
+	versions := []model.HistoryVersion{
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now.AddDate(-3, 0, 0)}},
+		{BaseModel: model.BaseModel{ID: uuid.New(), CreatedAt: now}},
+	}
+	if kept := policy.retainedVersions(versions); !kept[versions[0].ID] {
+		t.Error("a daily version was dropped although daily versions are kept forever")
+	}
+}
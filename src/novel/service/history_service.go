@@ -1,44 +1,315 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"st-novel-go/src/config"
 	"st-novel-go/src/novel/dao"
 	"st-novel-go/src/novel/dto"
 	"st-novel-go/src/novel/model"
+	"strings"
+	"time"
 )
 
-func CreateVersion(documentID, documentType, label, content string, userID uint) error {
+const (
+	defaultSnapshotInterval = 20
+	defaultAutosaveWindow   = 5 * time.Minute
+	// 差异超过正文长度的该比例时直接保存完整快照
+	maxDeltaRatio = 0.5
+)
+
+func snapshotInterval() int {
+	if n := config.AppConfig.History.SnapshotInterval; n > 0 {
+		return n
+	}
+	return defaultSnapshotInterval
+}
+
+func autosaveWindow() time.Duration {
+	if seconds := config.AppConfig.History.AutosaveWindowSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultAutosaveWindow
+}
+
+// CreateVersion saves a version of a document. It is stored as a delta from the
+// latest version unless a snapshot is due. An autosave is skipped when the content
+// is unchanged, or when the latest version is an autosave of the same user within
+// the autosave window, so that a burst of autosaves leaves one version.
+func CreateVersion(documentID, documentType, saveKind, label, content string, userID uint) error {
 	version := &model.HistoryVersion{
 		DocumentID:   documentID,
 		DocumentType: documentType,
 		Label:        label,
+		SaveKind:     saveKind,
+		Kind:         model.HistoryKindSnapshot,
 		Content:      content,
 		UserID:       userID,
+		Summarized:   true,
+	}
+	version.WordCount, version.Preview = summarizeHistoryContent(documentType, content)
+
+	chain, err := dao.GetHistorySinceLatestSnapshot(documentID)
+	if err != nil {
+		return err
+	}
+	if len(chain) > 0 {
+		contents, depths := rebuildHistoryContents(chain)
+		latest := chain[len(chain)-1]
+		baseContent, ok := contents[latest.ID]
+		if saveKind == model.HistorySaveAutosave {
+			if ok && baseContent == content {
+				return nil
+			}
+			if latest.SaveKind == model.HistorySaveAutosave && latest.UserID == userID && time.Since(latest.CreatedAt) < autosaveWindow() {
+				return nil
+			}
+		}
+		if ok && depths[latest.ID]+1 < snapshotInterval() {
+			if delta, ok := encodeDelta(baseContent, content); ok {
+				baseID := latest.ID
+				version.Kind = model.HistoryKindDelta
+				version.BaseID = &baseID
+				version.Content = ""
+				version.Delta = delta
+			}
+		}
 	}
 	return dao.CreateHistoryVersion(version)
 }
 
-func GetHistory(documentID string, userID uint) ([]dto.HistoryVersionDTO, error) {
-	versions, err := dao.GetHistoryForDocument(documentID, userID)
+// encodeDelta returns the delta from base to content, or false when the delta would
+// not be much smaller than content itself.
+func encodeDelta(base, content string) (string, bool) {
+	data, err := json.Marshal(computeDelta(base, content))
+	if err != nil || float64(len(data)) > float64(len(content))*maxDeltaRatio {
+		return "", false
+	}
+	return string(data), true
+}
+
+// rebuildHistoryContents returns the full text of every version whose chain can be
+// followed back to a snapshot in versions, and the number of deltas between each
+// version and that snapshot.
+func rebuildHistoryContents(versions []model.HistoryVersion) (map[uuid.UUID]string, map[uuid.UUID]int) {
+	byID := make(map[uuid.UUID]*model.HistoryVersion, len(versions))
+	for i := range versions {
+		byID[versions[i].ID] = &versions[i]
+	}
+	contents := make(map[uuid.UUID]string, len(versions))
+	depths := make(map[uuid.UUID]int, len(versions))
+	failed := make(map[uuid.UUID]bool)
+
+	var rebuild func(v *model.HistoryVersion) bool
+	rebuild = func(v *model.HistoryVersion) bool {
+		if _, ok := contents[v.ID]; ok {
+			return true
+		}
+		if failed[v.ID] {
+			return false
+		}
+		if v.Kind != model.HistoryKindDelta {
+			contents[v.ID] = v.Content
+			depths[v.ID] = 0
+			return true
+		}
+		failed[v.ID] = true // 防止链条成环
+		base, ok := byID[derefUUID(v.BaseID)]
+		if !ok || !rebuild(base) {
+			return false
+		}
+		var ops []deltaOp
+		if err := json.Unmarshal([]byte(v.Delta), &ops); err != nil {
+			log.Printf("[history_service] Invalid delta in history version %s: %v", v.ID, err)
+			return false
+		}
+		content, err := applyDelta(contents[base.ID], ops)
+		if err != nil {
+			log.Printf("[history_service] Failed to rebuild history version %s: %v", v.ID, err)
+			return false
+		}
+		delete(failed, v.ID)
+		contents[v.ID] = content
+		depths[v.ID] = depths[base.ID] + 1
+		return true
+	}
+	for i := range versions {
+		rebuild(&versions[i])
+	}
+	return contents, depths
+}
+
+func derefUUID(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
+// normalizeSaveKind validates how a document is being saved: autosave, manual or
+// checkpoint, defaulting to manual. A checkpoint needs a label.
+func normalizeSaveKind(saveKind, label string) (string, error) {
+	switch saveKind {
+	case "":
+		return model.HistorySaveManual, nil
+	case model.HistorySaveAutosave, model.HistorySaveManual:
+		return saveKind, nil
+	case model.HistorySaveCheckpoint:
+		if strings.TrimSpace(label) == "" {
+			return "", errors.New("a checkpoint needs a label")
+		}
+		return saveKind, nil
+	default:
+		return "", errors.New("saveKind must be autosave, manual or checkpoint")
+	}
+}
+
+// saveDocumentVersions records the history of a save: the content before the save as
+// an autosave or manual version and, for a checkpoint, the saved content under the
+// user's label.
+func saveDocumentVersions(documentID, documentType, saveKind, label, before, after string, userID uint) {
+	beforeKind, beforeLabel := model.HistorySaveManual, "手动保存"
+	if saveKind == model.HistorySaveAutosave {
+		beforeKind, beforeLabel = model.HistorySaveAutosave, "自动保存"
+	}
+	if err := CreateVersion(documentID, documentType, beforeKind, beforeLabel, before, userID); err != nil {
+		log.Printf("[history_service] Failed to create history version for %s %s: %v", documentType, documentID, err)
+	}
+	if saveKind == model.HistorySaveCheckpoint {
+		if err := CreateVersion(documentID, documentType, model.HistorySaveCheckpoint, strings.TrimSpace(label), after, userID); err != nil {
+			log.Printf("[history_service] Failed to create checkpoint for %s %s: %v", documentType, documentID, err)
+		}
+	}
+}
+
+// GetHistory lists the versions of a document saved by any member of its novel,
+// newest first, without their content. A non-empty saveKind keeps only the versions
+// saved that way.
+func GetHistory(documentID, saveKind string, userID uint) ([]dto.HistoryVersionDTO, error) {
+	versions, err := dao.GetHistorySummariesForDocument(documentID)
 	if err != nil {
 		return nil, err
 	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	if err := checkHistoryAccess(documentID, versions[0].DocumentType, userID); err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if !v.Summarized {
+			if versions, err = summarizeHistory(documentID); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
 
 	var dtoList []dto.HistoryVersionDTO
-	for _, v := range versions {
-		dtoList = append(dtoList, dto.HistoryVersionDTO{
-			ID:        v.ID.String(),
-			Label:     v.Label,
-			Timestamp: formatTimeAgo(v.CreatedAt),
-			Content:   v.Content,
-		})
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if saveKind != "" && v.SaveKind != saveKind {
+			continue
+		}
+		previousWordCount := 0
+		if i > 0 {
+			previousWordCount = versions[i-1].WordCount
+		}
+		dtoList = append(dtoList, mapHistoryVersionSummaryToDTO(v, previousWordCount))
 	}
 	return dtoList, nil
 }
 
+// summarizeHistory stores the summaries of the versions of a document saved before
+// versions were summarised, and returns every version with its summary.
+func summarizeHistory(documentID string) ([]model.HistoryVersion, error) {
+	versions, err := dao.GetHistorySummariesForDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	// 按时间顺序重建，相邻版本共用已重建的基础版本
+	contents := make(map[uuid.UUID]string)
+	for i := range versions {
+		v := &versions[i]
+		if v.Summarized {
+			continue
+		}
+		full, err := dao.FindHistoryVersionByID(v.ID.String())
+		if err != nil {
+			return nil, err
+		}
+		content, err := loadVersionContent(full, contents)
+		if err != nil {
+			log.Printf("[history_service] Failed to rebuild history version %s: %v", v.ID, err)
+			continue
+		}
+		v.WordCount, v.Preview = summarizeHistoryContent(v.DocumentType, content)
+		v.Summarized = true
+		if err := dao.SetHistoryVersionSummary(v.ID, v.WordCount, v.Preview); err != nil {
+			log.Printf("[history_service] Failed to store summary of history version %s: %v", v.ID, err)
+		}
+	}
+	return versions, nil
+}
+
+// loadVersionContent returns the full text of a version. A delta is rebuilt from the
+// versions on its path back to the base snapshot, which are loaded one by one and
+// are at most snapshotInterval long. contents, when not nil, holds versions that
+// were already rebuilt and receives the ones rebuilt here.
+func loadVersionContent(version *model.HistoryVersion, contents map[uuid.UUID]string) (string, error) {
+	if version.Kind != model.HistoryKindDelta {
+		return version.Content, nil
+	}
+	corrupted := errors.New("history version is corrupted and cannot be rebuilt")
+	path := []*model.HistoryVersion{version}
+	seen := map[uuid.UUID]bool{version.ID: true}
+	content := ""
+	for {
+		current := path[len(path)-1]
+		if cached, ok := contents[current.ID]; ok {
+			content, path = cached, path[:len(path)-1]
+			break
+		}
+		if current.Kind != model.HistoryKindDelta {
+			content, path = current.Content, path[:len(path)-1]
+			break
+		}
+		// 防止链条成环
+		if current.BaseID == nil || seen[*current.BaseID] {
+			return "", corrupted
+		}
+		seen[*current.BaseID] = true
+		base, err := dao.FindHistoryVersionByID(current.BaseID.String())
+		if err != nil || base.DocumentID != version.DocumentID {
+			return "", corrupted
+		}
+		path = append(path, base)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		var ops []deltaOp
+		if err := json.Unmarshal([]byte(path[i].Delta), &ops); err != nil {
+			log.Printf("[history_service] Invalid delta in history version %s: %v", path[i].ID, err)
+			return "", corrupted
+		}
+		rebuilt, err := applyDelta(content, ops)
+		if err != nil {
+			log.Printf("[history_service] Failed to rebuild history version %s: %v", path[i].ID, err)
+			return "", corrupted
+		}
+		content = rebuilt
+		if contents != nil {
+			contents[path[i].ID] = content
+		}
+	}
+	return content, nil
+}
+
 func RestoreVersion(documentID, versionID string, userID uint) error {
-	versionToRestore, err := dao.FindHistoryVersionByID(versionID, userID)
+	// 各文档类型分支会校验编辑权限
+	versionToRestore, err := dao.FindHistoryVersionByID(versionID)
 	if err != nil {
 		return errors.New("history version not found or permission denied")
 	}
@@ -49,6 +320,10 @@ func RestoreVersion(documentID, versionID string, userID uint) error {
 	}
 
 	restoreLabel := fmt.Sprintf("从 %s 恢复", formatTimeAgo(versionToRestore.CreatedAt))
+	restoredContent, err := loadVersionContent(versionToRestore, nil)
+	if err != nil {
+		return err
+	}
 
 	switch versionToRestore.DocumentType {
 	case "chapter":
@@ -56,60 +331,66 @@ func RestoreVersion(documentID, versionID string, userID uint) error {
 		if err != nil {
 			return errors.New("target chapter not found")
 		}
-		if _, err := dao.FindNovelByID(chapter.NovelID.String(), userID); err != nil {
+		if _, err := dao.FindNovelWithRole(chapter.NovelID.String(), userID, model.RoleEditor); err != nil {
 			return errors.New("permission denied for target chapter")
 		}
-		_ = CreateVersion(documentID, "chapter", "恢复前快照", chapter.Content, userID)
-		chapter.Content = versionToRestore.Content
+		_ = CreateVersion(documentID, "chapter", model.HistorySaveSystem, "恢复前快照", chapter.Content, userID)
+		oldWordCount := chapter.WordCount
+		chapter.Content = restoredContent
+		chapter.WordCount = countWordsFromHTML(chapter.Content)
 		if err := dao.UpdateChapter(chapter); err != nil {
 			return err
 		}
-		return CreateVersion(documentID, "chapter", restoreLabel, chapter.Content, userID)
+		recordChapterSave(userID, chapter, oldWordCount)
+		return CreateVersion(documentID, "chapter", model.HistorySaveSystem, restoreLabel, chapter.Content, userID)
 
 	case "volume":
 		volume, err := dao.FindVolumeByID(documentID)
 		if err != nil {
 			return errors.New("target volume not found")
 		}
-		if _, err := dao.FindNovelByID(volume.NovelID.String(), userID); err != nil {
+		if _, err := dao.FindNovelWithRole(volume.NovelID.String(), userID, model.RoleEditor); err != nil {
 			return errors.New("permission denied for target volume")
 		}
-		_ = CreateVersion(documentID, "volume", "恢复前快照", volume.Content, userID)
-		volume.Content = versionToRestore.Content
+		_ = CreateVersion(documentID, "volume", model.HistorySaveSystem, "恢复前快照", volume.Content, userID)
+		volume.Content = restoredContent
 		if err := dao.UpdateVolume(volume); err != nil {
 			return err
 		}
-		return CreateVersion(documentID, "volume", restoreLabel, volume.Content, userID)
+		return CreateVersion(documentID, "volume", model.HistorySaveSystem, restoreLabel, volume.Content, userID)
 
 	case "derived_content":
 		item, err := dao.FindDerivedContentByID(documentID)
 		if err != nil {
 			return errors.New("target derived content not found")
 		}
-		if _, err := dao.FindNovelByID(item.NovelID.String(), userID); err != nil {
+		if _, err := dao.FindNovelWithRole(item.NovelID.String(), userID, model.RoleEditor); err != nil {
 			return errors.New("permission denied for target derived content")
 		}
-		_ = CreateVersion(documentID, "derived_content", "恢复前快照", item.Content, userID)
-		item.Content = versionToRestore.Content
+		_ = CreateVersion(documentID, "derived_content", model.HistorySaveSystem, "恢复前快照", item.Content, userID)
+		item.Content = restoredContent
 		if err := dao.UpdateDerivedContent(item); err != nil {
 			return err
 		}
-		return CreateVersion(documentID, "derived_content", restoreLabel, item.Content, userID)
+		return CreateVersion(documentID, "derived_content", model.HistorySaveSystem, restoreLabel, item.Content, userID)
 
 	case "note":
 		note, err := dao.FindNoteByID(documentID)
 		if err != nil {
 			return errors.New("target note not found")
 		}
-		if _, err := dao.FindNovelByID(note.NovelID.String(), userID); err != nil {
+		if _, err := dao.FindNovelWithRole(note.NovelID.String(), userID, model.RoleEditor); err != nil {
 			return errors.New("permission denied for target note")
 		}
-		_ = CreateVersion(documentID, "note", "恢复前快照", note.Content, userID)
-		note.Content = versionToRestore.Content
+		_ = CreateVersion(documentID, "note", model.HistorySaveSystem, "恢复前快照", note.Content, userID)
+		note.Content = restoredContent
 		if err := dao.UpdateNote(note); err != nil {
 			return err
 		}
-		return CreateVersion(documentID, "note", restoreLabel, note.Content, userID)
+		return CreateVersion(documentID, "note", model.HistorySaveSystem, restoreLabel, note.Content, userID)
+
+	case NodeDocumentType:
+		return restoreNodeVersion(documentID, restoredContent, restoreLabel, userID)
 
 	default:
 		return fmt.Errorf("restoring document type '%s' is not supported", versionToRestore.DocumentType)
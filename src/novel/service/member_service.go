@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	userDao "st-novel-go/src/user/dao"
+	"strings"
+	"time"
+)
+
+// GetNovelMembers lists the owner of a novel followed by its members and pending
+// invitations. Every member can see who else has access.
+func GetNovelMembers(novelID string, userID uint) ([]dto.NovelMemberDTO, error) {
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
+	if err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	members, err := dao.GetNovelMembers(novelID)
+	if err != nil {
+		return nil, err
+	}
+
+	dtoList := make([]dto.NovelMemberDTO, 0, len(members)+1)
+	owner := dto.NovelMemberDTO{UserID: novel.UserID, Role: model.RoleOwner, Status: model.MemberStatusAccepted}
+	fillMemberUser(&owner)
+	dtoList = append(dtoList, owner)
+	for _, m := range members {
+		item := dto.NovelMemberDTO{
+			ID:        m.ID.String(),
+			UserID:    m.UserID,
+			Role:      m.Role,
+			Status:    m.Status,
+			InvitedAt: m.CreatedAt.Format(time.RFC3339),
+		}
+		fillMemberUser(&item)
+		dtoList = append(dtoList, item)
+	}
+	return dtoList, nil
+}
+
+func fillMemberUser(item *dto.NovelMemberDTO) {
+	if user, err := userDao.FindUserByID(item.UserID); err == nil {
+		item.Name, item.Email, item.Avatar = user.Name, user.Email, user.Avatar
+	}
+}
+
+// InviteNovelMember invites the registered user with the given email to a novel.
+// Only the owner can invite; the invitation takes effect once accepted.
+func InviteNovelMember(novelID string, userID uint, payload dto.InviteNovelMemberPayload) (*dto.NovelMemberDTO, error) {
+	novel, err := dao.FindNovelByID(novelID, userID)
+	if err != nil {
+		return nil, errors.New("novel not found or only the owner can invite members")
+	}
+	if !model.IsMemberRole(payload.Role) {
+		return nil, errors.New("role must be editor, commenter or viewer")
+	}
+	invitee, err := userDao.FindUserByEmail(strings.TrimSpace(payload.Email))
+	if err != nil {
+		return nil, errors.New("no user is registered with this email")
+	}
+	if invitee.ID == novel.UserID {
+		return nil, errors.New("the owner cannot be invited")
+	}
+	if _, err := dao.FindNovelMember(novelID, invitee.ID); err == nil {
+		return nil, errors.New("this user is already a member or has been invited")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	member := &model.NovelMember{
+		NovelID:   novel.ID,
+		UserID:    invitee.ID,
+		Role:      payload.Role,
+		Status:    model.MemberStatusPending,
+		InvitedBy: userID,
+	}
+	if err := dao.CreateNovelMember(member); err != nil {
+		return nil, err
+	}
+	return &dto.NovelMemberDTO{
+		ID:        member.ID.String(),
+		UserID:    invitee.ID,
+		Name:      invitee.Name,
+		Email:     invitee.Email,
+		Avatar:    invitee.Avatar,
+		Role:      member.Role,
+		Status:    member.Status,
+		InvitedAt: member.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func findNovelMemberOf(novelID, memberID string) (*model.NovelMember, error) {
+	member, err := dao.FindNovelMemberByID(memberID)
+	if err != nil || member.NovelID.String() != novelID {
+		return nil, errors.New("member not found")
+	}
+	return member, nil
+}
+
+// UpdateNovelMemberRole changes the role of a member or of a pending invitation.
+func UpdateNovelMemberRole(novelID, memberID string, userID uint, payload dto.UpdateNovelMemberPayload) error {
+	if _, err := dao.FindNovelByID(novelID, userID); err != nil {
+		return errors.New("novel not found or only the owner can change roles")
+	}
+	if !model.IsMemberRole(payload.Role) {
+		return errors.New("role must be editor, commenter or viewer")
+	}
+	member, err := findNovelMemberOf(novelID, memberID)
+	if err != nil {
+		return err
+	}
+	member.Role = payload.Role
+	if err := dao.UpdateNovelMember(member); err != nil {
+		return err
+	}
+	refreshCollabAccess(novelID, member.UserID)
+	return nil
+}
+
+// RemoveNovelMember removes a member or withdraws an invitation. The owner can
+// remove anyone; members can remove themselves to leave the novel.
+func RemoveNovelMember(novelID, memberID string, userID uint) error {
+	member, err := findNovelMemberOf(novelID, memberID)
+	if err != nil {
+		return err
+	}
+	if member.UserID != userID {
+		if _, err := dao.FindNovelByID(novelID, userID); err != nil {
+			return errors.New("only the owner can remove other members")
+		}
+	}
+	if err := dao.DeleteNovelMember(memberID); err != nil {
+		return err
+	}
+	refreshCollabAccess(novelID, member.UserID)
+	return nil
+}
+
+// GetNovelInvitations lists the invitations waiting for the user's answer.
+func GetNovelInvitations(userID uint) ([]dto.NovelInvitationDTO, error) {
+	invitations, err := dao.GetPendingInvitations(userID)
+	if err != nil {
+		return nil, err
+	}
+	dtoList := make([]dto.NovelInvitationDTO, 0, len(invitations))
+	for _, m := range invitations {
+		item := dto.NovelInvitationDTO{
+			ID:         m.ID.String(),
+			NovelID:    m.NovelID.String(),
+			NovelTitle: m.NovelTitle,
+			Role:       m.Role,
+			InviterID:  m.InvitedBy,
+			InvitedAt:  m.CreatedAt.Format(time.RFC3339),
+		}
+		if inviter, err := userDao.FindUserByID(m.InvitedBy); err == nil {
+			item.InviterName = inviter.Name
+		}
+		dtoList = append(dtoList, item)
+	}
+	return dtoList, nil
+}
+
+// RespondToNovelInvitation accepts or declines an invitation. A declined
+// invitation is deleted.
+func RespondToNovelInvitation(invitationID string, userID uint, accept bool) error {
+	member, err := dao.FindNovelMemberByID(invitationID)
+	if err != nil || member.UserID != userID || member.Status != model.MemberStatusPending {
+		return errors.New("invitation not found")
+	}
+	if !accept {
+		return dao.DeleteNovelMember(invitationID)
+	}
+	member.Status = model.MemberStatusAccepted
+	return dao.UpdateNovelMember(member)
+}
+
+// GetSharedNovels lists the novels shared with the user, with the user's role.
+func GetSharedNovels(userID uint) ([]dto.NovelDashboardItemDTO, error) {
+	novels, roles, err := dao.GetSharedNovels(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(novels) == 0 {
+		return []dto.NovelDashboardItemDTO{}, nil
+	}
+	novelIDs := make([]uuid.UUID, len(novels))
+	for i, n := range novels {
+		novelIDs[i] = n.ID
+	}
+	chapterCounts, err := dao.GetChapterCountsForNovels(novelIDs)
+	if err != nil {
+		return nil, err
+	}
+	dtoList := make([]dto.NovelDashboardItemDTO, 0, len(novels))
+	for _, novel := range novels {
+		item := mapNovelToDashboardDTO(novel, int(chapterCounts[novel.ID]))
+		item.Role = roles[novel.ID.String()]
+		dtoList = append(dtoList, item)
+	}
+	return dtoList, nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"strings"
+)
+
+// RevisionConflictError is returned when an update is based on a revision of a
+// document that is no longer the latest. Current is the stored document.
+type RevisionConflictError struct {
+	BaseRevision    int64
+	CurrentRevision int64
+	Current         interface{}
+}
+
+func (e *RevisionConflictError) Error() string {
+	return fmt.Sprintf("conflict: the update is based on revision %d but the document is at revision %d", e.BaseRevision, e.CurrentRevision)
+}
+
+func checkBaseRevision(base *int64, current int64, document interface{}) error {
+	if base != nil && *base != current {
+		return &RevisionConflictError{BaseRevision: *base, CurrentRevision: current, Current: document}
+	}
+	return nil
+}
+
+// asRevisionConflict turns dao.ErrRevisionConflict, raised when another update won
+// the race after the document was loaded, into a RevisionConflictError carrying the
+// latest stored document.
+func asRevisionConflict(err error, base int64, reload func() (interface{}, int64, error)) error {
+	if !errors.Is(err, dao.ErrRevisionConflict) {
+		return err
+	}
+	current, revision, loadErr := reload()
+	if loadErr != nil {
+		return err
+	}
+	return &RevisionConflictError{BaseRevision: base, CurrentRevision: revision, Current: current}
+}
+
+// mergeChunk is a stretch of a three-way merge: text all sides agree on, or a
+// region where ours, theirs or both changed the base.
+type mergeChunk struct {
+	stable             bool
+	base, ours, theirs []string
+}
+
+// matchIndexes maps every index of a to the index of the same token in b along
+// their longest common subsequence, or -1.
+func matchIndexes(a, b []string, maxCells int) []int {
+	matches := make([]int, len(a))
+	i, j := 0, 0
+	for _, op := range lcsScript(a, b, maxCells) {
+		switch op.kind {
+		case diffEqual:
+			matches[i] = j
+			i++
+			j++
+		case diffDelete:
+			matches[i] = -1
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+// diff3 splits three token lists into chunks, aligning ours and theirs with base.
+func diff3(base, ours, theirs []string, maxCells int) []mergeChunk {
+	matchOurs := matchIndexes(base, ours, maxCells)
+	matchTheirs := matchIndexes(base, theirs, maxCells)
+
+	var chunks []mergeChunk
+	i, o, t := 0, 0, 0
+	for i < len(base) || o < len(ours) || t < len(theirs) {
+		// 三方一致的部分
+		start := i
+		for i < len(base) && matchOurs[i] == o && matchTheirs[i] == t {
+			i++
+			o++
+			t++
+		}
+		if i > start {
+			chunks = append(chunks, mergeChunk{stable: true, base: base[start:i]})
+			continue
+		}
+		// 找到下一个三方都匹配的位置，其间为变更区域
+		next := i
+		for next < len(base) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		endOurs, endTheirs := len(ours), len(theirs)
+		if next < len(base) {
+			endOurs, endTheirs = matchOurs[next], matchTheirs[next]
+		}
+		chunks = append(chunks, mergeChunk{base: base[i:next], ours: ours[o:endOurs], theirs: theirs[t:endTheirs]})
+		i, o, t = next, endOurs, endTheirs
+	}
+	return chunks
+}
+
+// resolve returns the merged text of a changed chunk, or false when both sides
+// changed it differently.
+func (c mergeChunk) resolve() (string, bool) {
+	base, ours, theirs := strings.Join(c.base, ""), strings.Join(c.ours, ""), strings.Join(c.theirs, "")
+	switch {
+	case ours == theirs, theirs == base:
+		return ours, true
+	case ours == base:
+		return theirs, true
+	default:
+		return "", false
+	}
+}
+
+// MergeHTML merges the changes that ours and theirs each made to base. It aligns
+// the versions sentence by sentence and retries conflicting regions character by
+// character. Conflicts that remain take the side named by prefer and are wrapped in
+// <mark class="merge-conflict"> when they contain no tags.
+func MergeHTML(payload dto.MergePayload) (*dto.MergeResultDTO, error) {
+	prefer := payload.Prefer
+	if prefer == "" {
+		prefer = "ours"
+	}
+	if prefer != "ours" && prefer != "theirs" {
+		return nil, errors.New("prefer must be ours or theirs")
+	}
+
+	result := &dto.MergeResultDTO{Conflicts: []dto.MergeConflictDTO{}}
+	var sb strings.Builder
+	for _, coarse := range diff3(tokenizeForDelta(payload.Base), tokenizeForDelta(payload.Ours), tokenizeForDelta(payload.Theirs), maxDeltaCells) {
+		if coarse.stable {
+			sb.WriteString(strings.Join(coarse.base, ""))
+			continue
+		}
+		if text, ok := coarse.resolve(); ok {
+			sb.WriteString(text)
+			continue
+		}
+		fine := diff3(
+			tokenizeHTMLForDiff(strings.Join(coarse.base, "")),
+			tokenizeHTMLForDiff(strings.Join(coarse.ours, "")),
+			tokenizeHTMLForDiff(strings.Join(coarse.theirs, "")),
+			maxFineDiffCells,
+		)
+		for _, chunk := range fine {
+			if chunk.stable {
+				sb.WriteString(strings.Join(chunk.base, ""))
+				continue
+			}
+			if text, ok := chunk.resolve(); ok {
+				sb.WriteString(text)
+				continue
+			}
+			conflict := dto.MergeConflictDTO{
+				Index:  len(result.Conflicts),
+				Base:   strings.Join(chunk.base, ""),
+				Ours:   strings.Join(chunk.ours, ""),
+				Theirs: strings.Join(chunk.theirs, ""),
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+			chosen := conflict.Ours
+			if prefer == "theirs" {
+				chosen = conflict.Theirs
+			}
+			if strings.ContainsAny(chosen, "<>") {
+				sb.WriteString(chosen)
+			} else {
+				fmt.Fprintf(&sb, `<mark class="merge-conflict" data-conflict="%d">%s</mark>`, conflict.Index, chosen)
+			}
+		}
+	}
+	result.Merged = sb.String()
+	result.Clean = len(result.Conflicts) == 0
+	return result, nil
+}
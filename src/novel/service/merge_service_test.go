@@ -0,0 +1,95 @@
+package service
+
+import (
+	"st-novel-go/src/novel/dto"
+	"strings"
+	"testing"
+)
+
+func TestMergeHTMLClean(t *testing.T) {
+	cases := []struct {
+		name                       string
+		base, ours, theirs, merged string
+	}{
+		{
+			"edits in different paragraphs",
+			"<p>第一段。</p><p>第二段。</p>",
+			"<p>第一段改了。</p><p>第二段。</p>",
+			"<p>第一段。</p><p>第二段也改了。</p>",
+			"<p>第一段改了。</p><p>第二段也改了。</p>",
+		},
+		{
+			"edits in different sentences of a paragraph",
+			"<p>他来了。她走了。</p>",
+			"<p>他终于来了。她走了。</p>",
+			"<p>他来了。她悄悄走了。</p>",
+			"<p>他终于来了。她悄悄走了。</p>",
+		},
+		{
+			"only one side changed",
+			"<p>原文。</p>",
+			"<p>原文。</p>",
+			"<p>新文。</p>",
+			"<p>新文。</p>",
+		},
+		{
+			"same change on both sides",
+			"<p>原文。</p>",
+			"<p>新文。</p>",
+			"<p>新文。</p>",
+			"<p>新文。</p>",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := MergeHTML(dto.MergePayload{Base: tc.base, Ours: tc.ours, Theirs: tc.theirs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Clean || len(result.Conflicts) != 0 {
+				t.Errorf("conflicts = %+v, want a clean merge", result.Conflicts)
+			}
+			if result.Merged != tc.merged {
+				t.Errorf("merged = %q, want %q", result.Merged, tc.merged)
+			}
+		})
+	}
+}
+
+func TestMergeHTMLConflict(t *testing.T) {
+	payload := dto.MergePayload{
+		Base:   "<p>他来了。</p>",
+		Ours:   "<p>他跑来了。</p>",
+		Theirs: "<p>他走来了。</p>",
+	}
+	result, err := MergeHTML(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Clean || len(result.Conflicts) != 1 {
+		t.Fatalf("clean = %v, conflicts = %+v, want one conflict", result.Clean, result.Conflicts)
+	}
+	conflict := result.Conflicts[0]
+	if conflict.Ours != "跑" || conflict.Theirs != "走" {
+		t.Errorf("conflict = %+v, want 跑 against 走", conflict)
+	}
+	want := `<p>他<mark class="merge-conflict" data-conflict="0">跑</mark>来了。</p>`
+	if result.Merged != want {
+		t.Errorf("merged = %q, want %q", result.Merged, want)
+	}
+
+	payload.Prefer = "theirs"
+	result, err = MergeHTML(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Merged, ">走</mark>") {
+		t.Errorf("merged = %q, want their side in the conflict", result.Merged)
+	}
+}
+
+func TestMergeHTMLRejectsUnknownPrefer(t *testing.T) {
+	if _, err := MergeHTML(dto.MergePayload{Prefer: "mine"}); err == nil {
+		t.Error("MergeHTML with prefer=mine succeeded, want an error")
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"encoding/json"
 	"st-novel-go/src/novel/dao"
 	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
 )
 
 func GetNovelMetadata(novelID string, userID uint) (*dto.NovelMetadataDTO, error) {
-	novel, err := dao.FindNovelByID(novelID, userID)
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +32,7 @@ func GetNovelMetadata(novelID string, userID uint) (*dto.NovelMetadataDTO, error
 }
 
 func UpdateNovelMetadata(novelID string, userID uint, payload dto.UpdateMetadataPayload) (*dto.NovelMetadataDTO, error) {
-	novel, err := dao.FindNovelByID(novelID, userID)
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleEditor)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"strings"
+)
+
+// NodeDocumentType is the history document type of a node in a settings tree or a
+// custom data list.
+const NodeDocumentType = "node"
+
+// nodeFields maps the node types of the /nodes/:type routes to the novel columns
+// holding them.
+var nodeFields = map[string]string{
+	"settings":        "settings_data",
+	"custom-plot":     "plot_custom_data",
+	"custom-analysis": "analysis_custom_data",
+	"custom-others":   "others_custom_data",
+}
+
+// nodeVersionContent is what a history version of a node stores: the node without
+// its children, and the parent it was under so that a deleted node can be put back.
+type nodeVersionContent struct {
+	ParentID string          `json:"parentId,omitempty"`
+	Node     dto.TreeNodeDTO `json:"node"`
+}
+
+// NodeDocumentID returns the history document ID of a node, "<novelId>:<type>:<nodeId>".
+// Node IDs are only unique within a novel, so the novel and type are part of it.
+func NodeDocumentID(novelID, nodeType, nodeID string) string {
+	return novelID + ":" + nodeType + ":" + nodeID
+}
+
+func parseNodeDocumentID(documentID string) (novelID, nodeType, nodeID string, err error) {
+	parts := strings.SplitN(documentID, ":", 3)
+	if len(parts) != 3 || nodeFields[parts[1]] == "" {
+		return "", "", "", errors.New("invalid node document id")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+func loadNodeTree(novelID, nodeType string, userID uint) ([]dto.TreeNodeDTO, string, error) {
+	field, ok := nodeFields[nodeType]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported node type: %s", nodeType)
+	}
+	var tree []dto.TreeNodeDTO
+	if err := getNovelJSONField(novelID, userID, field, &tree); err != nil {
+		return nil, "", err
+	}
+	return tree, field, nil
+}
+
+func nodeID(node map[string]interface{}) string {
+	if id, ok := node["id"]; ok && id != nil {
+		return fmt.Sprint(id)
+	}
+	return ""
+}
+
+func childNodes(node map[string]interface{}) []map[string]interface{} {
+	items, _ := node["children"].([]interface{})
+	children := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if child, ok := item.(map[string]interface{}); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// findTreeNode returns the node with the given ID and its parent, which is nil for a
+// node at the top level.
+func findTreeNode(tree []dto.TreeNodeDTO, id string) (node, parent map[string]interface{}) {
+	var search func(nodes []map[string]interface{}, parent map[string]interface{}) (map[string]interface{}, map[string]interface{})
+	search = func(nodes []map[string]interface{}, parent map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+		for _, n := range nodes {
+			if nodeID(n) == id {
+				return n, parent
+			}
+			if found, foundParent := search(childNodes(n), n); found != nil {
+				return found, foundParent
+			}
+		}
+		return nil, nil
+	}
+	top := make([]map[string]interface{}, len(tree))
+	for i := range tree {
+		top[i] = tree[i]
+	}
+	return search(top, nil)
+}
+
+// removeTreeNode removes the node with the given ID and reports whether it was found.
+func removeTreeNode(tree []dto.TreeNodeDTO, id string) ([]dto.TreeNodeDTO, bool) {
+	var removeFrom func(items []interface{}) ([]interface{}, bool)
+	removeFrom = func(items []interface{}) ([]interface{}, bool) {
+		result := make([]interface{}, 0, len(items))
+		removed := false
+		for _, item := range items {
+			n, ok := item.(map[string]interface{})
+			if ok && nodeID(n) == id {
+				removed = true
+				continue
+			}
+			if ok {
+				if children, isList := n["children"].([]interface{}); isList {
+					var childRemoved bool
+					n["children"], childRemoved = removeFrom(children)
+					removed = removed || childRemoved
+				}
+			}
+			result = append(result, item)
+		}
+		return result, removed
+	}
+	items := make([]interface{}, len(tree))
+	for i := range tree {
+		items[i] = map[string]interface{}(tree[i])
+	}
+	remaining, removed := removeFrom(items)
+	newTree := make([]dto.TreeNodeDTO, len(remaining))
+	for i, item := range remaining {
+		newTree[i] = item.(map[string]interface{})
+	}
+	return newTree, removed
+}
+
+// insertTreeNode adds node as the last child of parentID, or at the top level when
+// the parent is empty or not found.
+func insertTreeNode(tree []dto.TreeNodeDTO, parentID string, node dto.TreeNodeDTO) []dto.TreeNodeDTO {
+	if parentID != "" {
+		if parent, _ := findTreeNode(tree, parentID); parent != nil {
+			children, _ := parent["children"].([]interface{})
+			parent["children"] = append(children, map[string]interface{}(node))
+			return tree
+		}
+	}
+	return append(tree, node)
+}
+
+// encodeNodeVersion stores a node without its children, which are versioned on
+// their own.
+func encodeNodeVersion(node, parent map[string]interface{}) (string, error) {
+	stored := make(dto.TreeNodeDTO, len(node))
+	for key, value := range node {
+		if key != "children" {
+			stored[key] = value
+		}
+	}
+	content := nodeVersionContent{Node: stored}
+	if parent != nil {
+		content.ParentID = nodeID(parent)
+	}
+	data, err := json.Marshal(content)
+	return string(data), err
+}
+
+func saveNodeVersion(novelID, nodeType string, node, parent map[string]interface{}, saveKind, label string, userID uint) {
+	content, err := encodeNodeVersion(node, parent)
+	if err == nil {
+		err = CreateVersion(NodeDocumentID(novelID, nodeType, nodeID(node)), NodeDocumentType, saveKind, label, content, userID)
+	}
+	if err != nil {
+		log.Printf("[node_service] Failed to create history version for node %s: %v", nodeID(node), err)
+	}
+}
+
+// nodeDisplayContent returns the text shown for a node version in previews and
+// diffs: its HTML content, or its title when it has none.
+func nodeDisplayContent(content string) string {
+	var version nodeVersionContent
+	if err := json.Unmarshal([]byte(content), &version); err != nil || version.Node == nil {
+		return content
+	}
+	if text, ok := version.Node["content"].(string); ok && text != "" {
+		return text
+	}
+	if title, ok := version.Node["title"].(string); ok {
+		return "<p>" + title + "</p>"
+	}
+	return ""
+}
+
+// historyDisplayContent returns the text of a version as shown in the history list
+// and diffs.
+func historyDisplayContent(documentType, content string) string {
+	if documentType == NodeDocumentType {
+		return nodeDisplayContent(content)
+	}
+	return content
+}
+
+// NodeRevision returns the revision kept in a node's "revision" field, whether the
+// node was decoded from JSON or changed in memory; nodes saved before revisions
+// existed are at revision 0.
+func NodeRevision(node map[string]interface{}) int64 {
+	switch revision := node["revision"].(type) {
+	case float64:
+		return int64(revision)
+	case int64:
+		return revision
+	case int:
+		return int64(revision)
+	}
+	return 0
+}
+
+// modifyNodeTree loads the tree of nodeType, passes it to modify and saves the result
+// while the novel row is locked.
+func modifyNodeTree(novelID, nodeType string, userID uint, modify func(tree []dto.TreeNodeDTO) ([]dto.TreeNodeDTO, error)) error {
+	field, ok := nodeFields[nodeType]
+	if !ok {
+		return fmt.Errorf("unsupported node type: %s", nodeType)
+	}
+	return dao.ModifyNovelJSONField(novelID, userID, field, func(data []byte) (interface{}, error) {
+		var tree []dto.TreeNodeDTO
+		if len(data) > 0 && string(data) != "null" {
+			if err := json.Unmarshal(data, &tree); err != nil {
+				return nil, err
+			}
+		}
+		if tree == nil {
+			tree = make([]dto.TreeNodeDTO, 0)
+		}
+		return modify(tree)
+	})
+}
+
+// CreateNode adds a node to a tree, under parentID when it names an existing node.
+func CreateNode(novelID, nodeType, parentID string, node dto.TreeNodeDTO, userID uint) (dto.TreeNodeDTO, error) {
+	err := modifyNodeTree(novelID, nodeType, userID, func(tree []dto.TreeNodeDTO) ([]dto.TreeNodeDTO, error) {
+		if nodeID(node) == "" {
+			node["id"] = uuid.New().String()
+		} else if existing, _ := findTreeNode(tree, nodeID(node)); existing != nil {
+			return nil, errors.New("node id already exists")
+		}
+		node["revision"] = int64(1)
+		return insertTreeNode(tree, parentID, node), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// UpdateNode changes the fields of a node and increments its revision. The node
+// before the change is saved in its history; saveKind and label work as for
+// chapters. When base is set, the update is rejected unless the node is still at
+// that revision.
+func UpdateNode(novelID, nodeType, id string, updates map[string]interface{}, base *int64, userID uint) (dto.TreeNodeDTO, error) {
+	saveKind, _ := updates["saveKind"].(string)
+	label, _ := updates["label"].(string)
+	saveKind, err := normalizeSaveKind(saveKind, label)
+	if err != nil {
+		return nil, err
+	}
+
+	var node map[string]interface{}
+	var before, after string
+	err = modifyNodeTree(novelID, nodeType, userID, func(tree []dto.TreeNodeDTO) ([]dto.TreeNodeDTO, error) {
+		var parent map[string]interface{}
+		node, parent = findTreeNode(tree, id)
+		if node == nil {
+			return nil, errors.New("node not found")
+		}
+		if err := checkBaseRevision(base, NodeRevision(node), node); err != nil {
+			return nil, err
+		}
+		var err error
+		if before, err = encodeNodeVersion(node, parent); err != nil {
+			return nil, err
+		}
+		for key, value := range updates {
+			switch key {
+			case "id", "children", "novelId", "saveKind", "label", "baseVersion", "revision":
+				continue
+			}
+			node[key] = value
+		}
+		node["revision"] = NodeRevision(node) + 1
+		after, _ = encodeNodeVersion(node, parent)
+		return tree, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	saveDocumentVersions(NodeDocumentID(novelID, nodeType, id), NodeDocumentType, saveKind, label, before, after, userID)
+	return node, nil
+}
+
+// DeleteNode removes a node and its children. Each removed node is saved in its
+// history, so that it can be restored.
+func DeleteNode(novelID, nodeType, id string, userID uint) error {
+	type removedNode struct{ node, parent map[string]interface{} }
+	var removed []removedNode
+	err := modifyNodeTree(novelID, nodeType, userID, func(tree []dto.TreeNodeDTO) ([]dto.TreeNodeDTO, error) {
+		node, parent := findTreeNode(tree, id)
+		if node == nil {
+			return nil, errors.New("node not found")
+		}
+		var collect func(n, p map[string]interface{})
+		collect = func(n, p map[string]interface{}) {
+			removed = append(removed, removedNode{n, p})
+			for _, child := range childNodes(n) {
+				collect(child, n)
+			}
+		}
+		collect(node, parent)
+		tree, _ = removeTreeNode(tree, id)
+		return tree, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range removed {
+		saveNodeVersion(novelID, nodeType, r.node, r.parent, model.HistorySaveSystem, "删除前快照", userID)
+	}
+	return nil
+}
+
+// restoreNodeVersion puts the node stored in a version back into its tree. An
+// existing node keeps its children; a deleted one is added back under its old parent.
+func restoreNodeVersion(documentID, content, restoreLabel string, userID uint) error {
+	novelID, nodeType, id, err := parseNodeDocumentID(documentID)
+	if err != nil {
+		return err
+	}
+	var version nodeVersionContent
+	if err := json.Unmarshal([]byte(content), &version); err != nil || version.Node == nil {
+		return errors.New("history version of node is corrupted")
+	}
+
+	var previous, restored string
+	err = modifyNodeTree(novelID, nodeType, userID, func(tree []dto.TreeNodeDTO) ([]dto.TreeNodeDTO, error) {
+		node, parent := findTreeNode(tree, id)
+		revision := int64(0)
+		if node != nil {
+			previous, _ = encodeNodeVersion(node, parent)
+			revision = NodeRevision(node)
+			for key := range node {
+				if key != "children" {
+					delete(node, key)
+				}
+			}
+			for key, value := range version.Node {
+				node[key] = value
+			}
+		} else {
+			node = version.Node
+			tree = insertTreeNode(tree, version.ParentID, node)
+			_, parent = findTreeNode(tree, id)
+		}
+		node["id"] = id
+		node["revision"] = revision + 1
+		restored, _ = encodeNodeVersion(node, parent)
+		return tree, nil
+	})
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		_ = CreateVersion(documentID, NodeDocumentType, model.HistorySaveSystem, "恢复前快照", previous, userID)
+	}
+	return CreateVersion(documentID, NodeDocumentType, model.HistorySaveSystem, restoreLabel, restored, userID)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"github.com/google/uuid"
 	"math/rand"
 	"st-novel-go/src/novel/dao"
 	"st-novel-go/src/novel/dto"
@@ -9,10 +10,16 @@ import (
 )
 
 func GetNovelProject(novelID string, userID uint) (*dto.NovelProjectDTO, error) {
-	fullData, err := dao.GetFullNovelProject(novelID, userID)
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
+		return nil, err
+	}
+	fullData, err := dao.GetFullNovelProject(novelID)
 	if err != nil {
 		return nil, err
 	}
+	if fullData.UnresolvedComments, err = dao.CountUnresolvedComments([]uuid.UUID{fullData.Novel.ID}); err != nil {
+		return nil, err
+	}
 
 	projectDTO := mapFullDataToProjectDTO(fullData)
 	return &projectDTO, nil
@@ -24,12 +31,22 @@ func GetAllNovelProjects(userID uint) ([]dto.NovelProjectDTO, error) {
 		return nil, err
 	}
 
+	novelIDs := make([]uuid.UUID, len(novels))
+	for i, novel := range novels {
+		novelIDs[i] = novel.ID
+	}
+	unresolved, err := dao.CountUnresolvedComments(novelIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	var projectDTOs []dto.NovelProjectDTO
 	for _, novel := range novels {
 		fullData := &dao.FullProjectData{
-			Novel:           novel,
-			DerivedContents: novel.DerivedContents,
-			Notes:           novel.Notes,
+			Novel:              novel,
+			DerivedContents:    novel.DerivedContents,
+			Notes:              novel.Notes,
+			UnresolvedComments: unresolved,
 		}
 		projectDTOs = append(projectDTOs, mapFullDataToProjectDTO(fullData))
 	}
@@ -141,14 +158,15 @@ func mapFullDataToProjectDTO(data *dao.FullProjectData) dto.NovelProjectDTO {
 		var chapters []dto.ChapterDTO
 		for _, chap := range vol.Chapters {
 			chapters = append(chapters, dto.ChapterDTO{
-				ID:        chap.ID.String(),
-				Type:      "chapter",
-				VolumeID:  chap.VolumeID.String(),
-				Title:     chap.Title,
-				WordCount: chap.WordCount,
-				Content:   chap.Content,
-				Status:    chap.Status,
-				Order:     chap.Order,
+				ID:                 chap.ID.String(),
+				Type:               "chapter",
+				VolumeID:           chap.VolumeID.String(),
+				Title:              chap.Title,
+				WordCount:          chap.WordCount,
+				Content:            chap.Content,
+				Status:             chap.Status,
+				Order:              chap.Order,
+				UnresolvedComments: data.UnresolvedComments[chap.ID],
 			})
 		}
 		directoryData = append(directoryData, dto.VolumeDTO{
@@ -62,7 +62,7 @@ func GetRecentItems(userID uint) ([]dto.RecentActivityItemDTO, error) {
 }
 
 func LogRecentEdit(userID uint, novelID uuid.UUID, itemType string, itemID string, itemName string) error {
-	novel, err := dao.FindNovelByID(novelID.String(), userID)
+	novel, err := dao.FindNovelWithRole(novelID.String(), userID, model.RoleViewer)
 	if err != nil {
 		return errors.New("novel not found or permission denied when logging recent activity")
 	}
@@ -80,7 +80,7 @@ func LogRecentEdit(userID uint, novelID uuid.UUID, itemType string, itemID strin
 }
 
 func LogRecentAccess(payload dto.LogRecentAccessPayload, userID uint) (*dto.RecentActivityItemDTO, error) {
-	novel, err := dao.FindNovelByID(payload.NovelID, userID)
+	novel, err := dao.FindNovelWithRole(payload.NovelID, userID, model.RoleViewer)
 	if err != nil {
 		return nil, errors.New("novel not found or permission denied")
 	}
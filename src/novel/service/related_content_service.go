@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"st-novel-go/src/novel/dao"
 	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
 )
 
 func UpdateNovelJSONField(novelID string, userID uint, fieldName string, data interface{}) error {
@@ -11,27 +12,30 @@ func UpdateNovelJSONField(novelID string, userID uint, fieldName string, data in
 }
 
 func getNovelJSONField(novelID string, userID uint, fieldName string, target interface{}) error {
-	novel, err := dao.FindNovelByID(novelID, userID)
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
 	if err != nil {
 		return err
 	}
 
-	var rawData json.RawMessage
+	rawData := novelJSONFieldData(&novel, fieldName)
+	if len(rawData) > 0 && string(rawData) != "null" {
+		if err := json.Unmarshal(rawData, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func novelJSONFieldData(novel *model.Novel, fieldName string) []byte {
 	switch fieldName {
 	case "settings_data":
-		rawData = json.RawMessage(novel.SettingsData)
+		return novel.SettingsData
 	case "plot_custom_data":
-		rawData = json.RawMessage(novel.PlotCustomData)
+		return novel.PlotCustomData
 	case "analysis_custom_data":
-		rawData = json.RawMessage(novel.AnalysisCustomData)
+		return novel.AnalysisCustomData
 	case "others_custom_data":
-		rawData = json.RawMessage(novel.OthersCustomData)
-	}
-
-	if len(rawData) > 0 && string(rawData) != "null" {
-		if err := json.Unmarshal(rawData, target); err != nil {
-			return err
-		}
+		return novel.OthersCustomData
 	}
 	return nil
 }
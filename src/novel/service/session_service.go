@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"time"
+)
+
+const (
+	// writingSessionGap 内的连续保存合并为同一次写作；读取时分组，修改后对历史保存同样生效
+	writingSessionGap = 30 * time.Minute
+
+	defaultCalendarDays     = 365
+	defaultTimelinePageSize = 20
+	maxTimelinePageSize     = 100
+)
+
+// GetWritingCalendar returns the heat map of the user's writing between from and to
+// (inclusive dates, 2006-01-02). By default it covers the last year.
+func GetWritingCalendar(userID uint, from, to string) (*dto.WritingCalendarDTO, error) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if to != "" {
+		parsed, err := time.ParseInLocation(statsDateLayout, to, now.Location())
+		if err != nil {
+			return nil, errors.New("invalid to date, expected YYYY-MM-DD")
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -(defaultCalendarDays - 1))
+	if from != "" {
+		parsed, err := time.ParseInLocation(statsDateLayout, from, now.Location())
+		if err != nil {
+			return nil, errors.New("invalid from date, expected YYYY-MM-DD")
+		}
+		start = parsed
+	}
+	if start.After(end) {
+		return nil, errors.New("from must not be after to")
+	}
+	if end.Sub(start) > maxStatsDays*24*time.Hour {
+		return nil, errors.New("the calendar covers at most one year")
+	}
+
+	totals, err := dao.GetWritingDayTotals(userID, start, end.AddDate(0, 0, 1), writingSessionGap)
+	if err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]dao.WritingDayTotal, len(totals))
+	maxWords := 0
+	for _, total := range totals {
+		byDate[total.Date] = total
+		if total.WordsAdded > maxWords {
+			maxWords = total.WordsAdded
+		}
+	}
+
+	calendar := &dto.WritingCalendarDTO{
+		From: start.Format(statsDateLayout),
+		To:   end.Format(statsDateLayout),
+		Days: []dto.WritingCalendarDayDTO{},
+	}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(statsDateLayout)
+		total := byDate[date]
+		calendarDay := dto.WritingCalendarDayDTO{
+			Date:         date,
+			Sessions:     total.Sessions,
+			Minutes:      int(total.Seconds / 60),
+			WordsAdded:   total.WordsAdded,
+			WordsRemoved: total.WordsRemoved,
+			Level:        heatLevel(total, maxWords),
+		}
+		calendar.Days = append(calendar.Days, calendarDay)
+		calendar.TotalSessions += calendarDay.Sessions
+		calendar.TotalMinutes += calendarDay.Minutes
+		if calendarDay.Sessions > 0 {
+			calendar.ActiveDays++
+		}
+	}
+	return calendar, nil
+}
+
+// heatLevel scales the words added on a day against the busiest day of the range.
+// A day with saves but no added words still gets level 1.
+func heatLevel(total dao.WritingDayTotal, maxWords int) int {
+	if total.Sessions == 0 {
+		return 0
+	}
+	if maxWords == 0 || total.WordsAdded == 0 {
+		return 1
+	}
+	level := (total.WordsAdded*4 + maxWords - 1) / maxWords
+	if level < 1 {
+		level = 1
+	}
+	return level
+}
+
+// GetWritingTimeline returns the writing sessions of a novel, newest first.
+func GetWritingTimeline(novelID string, userID uint, page, pageSize int) (*dto.WritingTimelineDTO, error) {
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
+	if err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	if pageSize <= 0 {
+		pageSize = defaultTimelinePageSize
+	} else if pageSize > maxTimelinePageSize {
+		pageSize = maxTimelinePageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	sessions, total, err := dao.GetWritingSessionsForNovel(novel.ID, userID, writingSessionGap, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	chapterIDs := make([]uuid.UUID, 0, len(sessions))
+	for _, session := range sessions {
+		chapterIDs = append(chapterIDs, session.ChapterID)
+	}
+	titles := map[uuid.UUID]string{}
+	if len(chapterIDs) > 0 {
+		if titles, err = dao.GetChapterTitles(chapterIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	timeline := &dto.WritingTimelineDTO{
+		Sessions: make([]dto.WritingSessionDTO, len(sessions)),
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i, session := range sessions {
+		timeline.Sessions[i] = dto.WritingSessionDTO{
+			ID:           session.ID,
+			ChapterID:    session.ChapterID.String(),
+			ChapterTitle: titles[session.ChapterID],
+			StartedAt:    session.StartedAt.Format(time.RFC3339),
+			EndedAt:      session.EndedAt.Format(time.RFC3339),
+			Minutes:      int(session.EndedAt.Sub(session.StartedAt).Minutes()),
+			WordsAdded:   session.WordsAdded,
+			WordsRemoved: session.WordsRemoved,
+			NetWords:     session.WordsAdded - session.WordsRemoved,
+			Saves:        session.Saves,
+		}
+	}
+	return timeline, nil
+}
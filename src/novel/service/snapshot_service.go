@@ -0,0 +1,431 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"io"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"strings"
+	"time"
+)
+
+const (
+	maxNovelSnapshots = 100
+
+	SnapshotRestoreCopy      = "copy"
+	SnapshotRestoreOverwrite = "overwrite"
+)
+
+// CreateNovelSnapshot saves the current state of a whole novel. It requires the
+// editor role.
+func CreateNovelSnapshot(novelID string, userID uint, payload dto.CreateNovelSnapshotPayload) (*dto.NovelSnapshotDTO, error) {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleEditor); err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	count, err := dao.CountNovelSnapshots(novelID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxNovelSnapshots {
+		return nil, errors.New("snapshot limit reached, delete old snapshots first")
+	}
+	snapshot, err := saveNovelSnapshot(novelID, userID, payload.Name, payload.Description, false)
+	if err != nil {
+		return nil, err
+	}
+	snapshotDTO := mapNovelSnapshotToDTO(snapshot)
+	return &snapshotDTO, nil
+}
+
+func saveNovelSnapshot(novelID string, userID uint, name, description string, automatic bool) (*model.NovelSnapshot, error) {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleEditor); err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	fullData, err := dao.GetFullNovelProject(novelID)
+	if err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	project := mapFullDataToProjectDTO(fullData)
+	data, size, err := encodeSnapshotData(&project)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &model.NovelSnapshot{
+		NovelID:     fullData.Novel.ID,
+		UserID:      userID,
+		Name:        name,
+		Description: description,
+		Automatic:   automatic,
+		Category:    fullData.Novel.Category,
+		VolumeCount: len(project.DirectoryData),
+		Size:        size,
+		Data:        data,
+	}
+	for _, volume := range project.DirectoryData {
+		snapshot.ChapterCount += len(volume.Chapters)
+		for _, chapter := range volume.Chapters {
+			snapshot.WordCount += chapter.WordCount
+		}
+	}
+	if err := dao.CreateNovelSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GetNovelSnapshots lists the snapshots that the members of a novel have taken.
+func GetNovelSnapshots(novelID string, userID uint) ([]dto.NovelSnapshotDTO, error) {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	snapshots, err := dao.GetNovelSnapshots(novelID)
+	if err != nil {
+		return nil, err
+	}
+	dtoList := make([]dto.NovelSnapshotDTO, len(snapshots))
+	for i, snapshot := range snapshots {
+		dtoList[i] = mapNovelSnapshotToDTO(&snapshot)
+	}
+	return dtoList, nil
+}
+
+// GetNovelSnapshotPreview returns the content of a snapshot and, while the novel
+// still exists, what restoring it over the novel would change. Every member of the
+// novel may preview its snapshots; removed members may not.
+func GetNovelSnapshotPreview(novelID, snapshotID string, userID uint) (*dto.NovelSnapshotPreviewDTO, error) {
+	if _, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer); err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	snapshot, err := dao.FindNovelSnapshot(snapshotID, novelID)
+	if err != nil {
+		return nil, errors.New("snapshot not found or permission denied")
+	}
+	project, err := decodeSnapshotData(snapshot.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &dto.NovelSnapshotPreviewDTO{
+		NovelSnapshotDTO: mapNovelSnapshotToDTO(snapshot),
+		Project:          *project,
+	}
+	if current, err := GetNovelProject(novelID, userID); err == nil {
+		preview.Changes = compareNovelProjects(project, current)
+	}
+	return preview, nil
+}
+
+// DeleteNovelSnapshot deletes a snapshot. Only the member who took it and the owner
+// of the novel may delete it.
+func DeleteNovelSnapshot(novelID, snapshotID string, userID uint) error {
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
+	if err != nil {
+		return errors.New("snapshot not found or permission denied")
+	}
+	snapshot, err := dao.FindNovelSnapshot(snapshotID, novelID)
+	if err != nil || (snapshot.UserID != userID && novel.UserID != userID) {
+		return errors.New("snapshot not found or permission denied")
+	}
+	rows, err := dao.DeleteNovelSnapshot(snapshotID, novelID)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("snapshot not found or permission denied")
+	}
+	return nil
+}
+
+// RestoreNovelSnapshot restores a snapshot into a new novel, or over the novel it
+// was taken from. Before overwriting, the current state is saved as an automatic
+// snapshot so that the restore can be undone.
+func RestoreNovelSnapshot(novelID, snapshotID string, userID uint, payload dto.RestoreNovelSnapshotPayload) (*dto.RestoreNovelSnapshotResultDTO, error) {
+	mode := payload.Mode
+	if mode == "" {
+		mode = SnapshotRestoreCopy
+	}
+	if mode != SnapshotRestoreCopy && mode != SnapshotRestoreOverwrite {
+		return nil, errors.New("mode must be copy or overwrite")
+	}
+	// 两种模式都要求仍是小说的编辑者，被移除的成员不能再从旧快照中复制内容
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleEditor)
+	if err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	snapshot, err := dao.FindNovelSnapshot(snapshotID, novelID)
+	if err != nil {
+		return nil, errors.New("snapshot not found or permission denied")
+	}
+	project, err := decodeSnapshotData(snapshot.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.RestoreNovelSnapshotResultDTO{Mode: mode}
+	if mode == SnapshotRestoreOverwrite {
+		backup, err := saveNovelSnapshot(novelID, userID, "恢复快照「"+snapshot.Name+"」前的自动备份", "", true)
+		if err != nil {
+			return nil, err
+		}
+		result.BackupSnapshotID = backup.ID.String()
+	} else {
+		novel = model.Novel{
+			BaseModel: model.BaseModel{ID: uuid.New()},
+			UserID:    userID,
+			Category:  snapshot.Category,
+		}
+	}
+
+	fullData, err := mapProjectToFullData(project, novel, mode == SnapshotRestoreCopy)
+	if err != nil {
+		return nil, err
+	}
+	if mode == SnapshotRestoreCopy {
+		fullData.Novel.Title = strings.TrimSpace(payload.Title)
+		if fullData.Novel.Title == "" {
+			fullData.Novel.Title = project.Metadata.Title + "（" + snapshot.Name + "）"
+		}
+	}
+	if err := dao.SaveFullNovelProject(fullData, mode == SnapshotRestoreOverwrite); err != nil {
+		return nil, err
+	}
+
+	restored, err := GetNovelProject(fullData.Novel.ID.String(), userID)
+	if err != nil {
+		return nil, err
+	}
+	result.NovelID = fullData.Novel.ID.String()
+	result.Project = *restored
+	return result, nil
+}
+
+// mapProjectToFullData turns a project into the models of novel. With freshIDs, every
+// volume, chapter, derived content item and note gets a new ID, and the source IDs of
+// derived content are remapped to match.
+func mapProjectToFullData(project *dto.NovelProjectDTO, novel model.Novel, freshIDs bool) (*dao.FullProjectData, error) {
+	ids := make(map[string]uuid.UUID)
+	idFor := func(oldID string) uuid.UUID {
+		if id, ok := ids[oldID]; ok {
+			return id
+		}
+		id, err := uuid.Parse(oldID)
+		if freshIDs || err != nil {
+			id = uuid.New()
+		}
+		ids[oldID] = id
+		return id
+	}
+
+	var err error
+	meta := project.Metadata
+	novel.Title = meta.Title
+	novel.Description = meta.Description
+	novel.Cover = meta.Cover
+	novel.Status = meta.Status
+	if novel.Tags, err = json.Marshal(nonNil(meta.Tags)); err != nil {
+		return nil, err
+	}
+	if novel.ReferenceNovelIDs, err = json.Marshal(nonNil(meta.ReferenceNovelIDs)); err != nil {
+		return nil, err
+	}
+	if novel.SettingsData, err = json.Marshal(nonNil(project.SettingsData)); err != nil {
+		return nil, err
+	}
+	if novel.PlotCustomData, err = json.Marshal(nonNil(project.PlotCustomData)); err != nil {
+		return nil, err
+	}
+	if novel.AnalysisCustomData, err = json.Marshal(nonNil(project.AnalysisCustomData)); err != nil {
+		return nil, err
+	}
+	if novel.OthersCustomData, err = json.Marshal(nonNil(project.OthersCustomData)); err != nil {
+		return nil, err
+	}
+
+	novel.Volumes = nil
+	for _, volDTO := range project.DirectoryData {
+		volume := model.Volume{
+			BaseModel: model.BaseModel{ID: idFor(volDTO.ID)},
+			Title:     volDTO.Title,
+			Content:   volDTO.Content,
+			Order:     volDTO.Order,
+		}
+		for _, chapDTO := range volDTO.Chapters {
+			volume.Chapters = append(volume.Chapters, model.Chapter{
+				BaseModel: model.BaseModel{ID: idFor(chapDTO.ID)},
+				Title:     chapDTO.Title,
+				WordCount: chapDTO.WordCount,
+				Content:   chapDTO.Content,
+				Status:    chapDTO.Status,
+				Order:     chapDTO.Order,
+			})
+		}
+		novel.Volumes = append(novel.Volumes, volume)
+	}
+
+	data := &dao.FullProjectData{Novel: novel}
+	addDerived := func(items []dto.PlotAnalysisItemDTO, contentType string) {
+		for _, item := range items {
+			sourceID := item.SourceID
+			if id, ok := ids[sourceID]; ok {
+				sourceID = id.String()
+			}
+			data.DerivedContents = append(data.DerivedContents, model.DerivedContent{
+				BaseModel: model.BaseModel{ID: idFor(item.ID)},
+				SourceID:  sourceID,
+				Type:      contentType,
+				Title:     item.Title,
+				Content:   item.Content,
+			})
+		}
+	}
+	addDerived(project.DerivedPlotData, "plot")
+	addDerived(project.DerivedAnalysisData, "analysis")
+	for _, noteDTO := range project.NoteData {
+		data.Notes = append(data.Notes, model.Note{
+			BaseModel: model.BaseModel{ID: idFor(noteDTO.ID)},
+			Title:     noteDTO.Title,
+			Content:   noteDTO.Content,
+		})
+	}
+	return data, nil
+}
+
+// compareNovelProjects lists what differs between a snapshot and the current novel,
+// in the order the items appear in each.
+func compareNovelProjects(snapshot, current *dto.NovelProjectDTO) *dto.SnapshotChangesDTO {
+	type entry struct {
+		item        dto.SnapshotChangeItemDTO
+		fingerprint string
+	}
+	collect := func(project *dto.NovelProjectDTO) ([]entry, map[string]string) {
+		var entries []entry
+		add := func(id, itemType, title string, fields ...string) {
+			entries = append(entries, entry{
+				item:        dto.SnapshotChangeItemDTO{ID: id, Type: itemType, Title: title},
+				fingerprint: strings.Join(append(fields, title), "\x00"),
+			})
+		}
+		for _, volume := range project.DirectoryData {
+			add(volume.ID, "volume", volume.Title, volume.Content)
+			for _, chapter := range volume.Chapters {
+				add(chapter.ID, "chapter", chapter.Title, chapter.Content, chapter.Status, volume.ID)
+			}
+		}
+		for _, item := range project.DerivedPlotData {
+			add(item.ID, "plot", item.Title, item.Content, item.SourceID)
+		}
+		for _, item := range project.DerivedAnalysisData {
+			add(item.ID, "analysis", item.Title, item.Content, item.SourceID)
+		}
+		for _, note := range project.NoteData {
+			add(note.ID, "note", note.Title, note.Content)
+		}
+		fingerprints := make(map[string]string, len(entries))
+		for _, e := range entries {
+			fingerprints[e.item.ID] = e.fingerprint
+		}
+		return entries, fingerprints
+	}
+	snapshotEntries, snapshotPrints := collect(snapshot)
+	currentEntries, currentPrints := collect(current)
+
+	changes := &dto.SnapshotChangesDTO{
+		Added:    []dto.SnapshotChangeItemDTO{},
+		Removed:  []dto.SnapshotChangeItemDTO{},
+		Modified: []dto.SnapshotChangeItemDTO{},
+		Sections: []string{},
+	}
+	for _, e := range snapshotEntries {
+		if fingerprint, ok := currentPrints[e.item.ID]; !ok {
+			changes.Added = append(changes.Added, e.item)
+		} else if fingerprint != e.fingerprint {
+			changes.Modified = append(changes.Modified, e.item)
+		}
+	}
+	for _, e := range currentEntries {
+		if _, ok := snapshotPrints[e.item.ID]; !ok {
+			changes.Removed = append(changes.Removed, e.item)
+		}
+	}
+
+	sections := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"metadata", snapshot.Metadata, current.Metadata},
+		{"settingsData", snapshot.SettingsData, current.SettingsData},
+		{"plotCustomData", snapshot.PlotCustomData, current.PlotCustomData},
+		{"analysisCustomData", snapshot.AnalysisCustomData, current.AnalysisCustomData},
+		{"othersCustomData", snapshot.OthersCustomData, current.OthersCustomData},
+	}
+	for _, section := range sections {
+		oldJSON, _ := json.Marshal(section.old)
+		newJSON, _ := json.Marshal(section.new)
+		if !bytes.Equal(oldJSON, newJSON) {
+			changes.Sections = append(changes.Sections, section.name)
+		}
+	}
+	return changes
+}
+
+func encodeSnapshotData(project *dto.NovelProjectDTO) ([]byte, int, error) {
+	raw, err := json.Marshal(project)
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), len(raw), nil
+}
+
+func decodeSnapshotData(data []byte) (*dto.NovelProjectDTO, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("snapshot data is corrupted")
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, errors.New("snapshot data is corrupted")
+	}
+	var project dto.NovelProjectDTO
+	if err := json.Unmarshal(raw, &project); err != nil {
+		return nil, errors.New("snapshot data is corrupted")
+	}
+	return &project, nil
+}
+
+// nonNil keeps empty lists as [] rather than null in the stored JSON.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func mapNovelSnapshotToDTO(snapshot *model.NovelSnapshot) dto.NovelSnapshotDTO {
+	return dto.NovelSnapshotDTO{
+		ID:           snapshot.ID.String(),
+		NovelID:      snapshot.NovelID.String(),
+		UserID:       snapshot.UserID,
+		Name:         snapshot.Name,
+		Description:  snapshot.Description,
+		Automatic:    snapshot.Automatic,
+		VolumeCount:  snapshot.VolumeCount,
+		ChapterCount: snapshot.ChapterCount,
+		WordCount:    snapshot.WordCount,
+		Size:         snapshot.Size,
+		CreatedAt:    snapshot.CreatedAt.Format(time.RFC3339),
+	}
+}
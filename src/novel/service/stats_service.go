@@ -0,0 +1,376 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"log"
+	"sort"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+	"strconv"
+	"time"
+)
+
+const (
+	statsDateLayout  = "2006-01-02"
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+)
+
+// chapterLengthBuckets 为章节字数分布的区间下限，最后一个区间不设上限
+var chapterLengthBuckets = []int{0, 1000, 2000, 3000, 5000, 10000}
+
+// recordChapterSave adds a save of chapter that changed its word count from
+// oldCount to chapter.WordCount to today's statistics and to the writing session
+// log.
+func recordChapterSave(userID uint, chapter *model.Chapter, oldCount int) {
+	added, removed := 0, 0
+	if chapter.WordCount > oldCount {
+		added = chapter.WordCount - oldCount
+	} else {
+		removed = oldCount - chapter.WordCount
+	}
+	now := time.Now()
+	if err := dao.AddDailyWordStat(userID, chapter.NovelID, now.Format(statsDateLayout), added, removed); err != nil {
+		log.Printf("[stats_service] Failed to record word count change for novel %s: %v", chapter.NovelID, err)
+	}
+	if err := dao.RecordWritingSave(userID, chapter.NovelID, chapter.ID, added, removed, now); err != nil {
+		log.Printf("[stats_service] Failed to record writing session for chapter %s: %v", chapter.ID, err)
+	}
+}
+
+// BackfillChapterWordCounts counts the words of chapters saved before word counts
+// were kept, so that their next save only counts the words it adds.
+func BackfillChapterWordCounts() {
+	const pageSize = 200
+	afterID, filled := "", 0
+	for {
+		chapters, err := dao.GetChaptersWithoutWordCount(afterID, pageSize)
+		if err != nil {
+			log.Printf("[stats_service] Failed to load chapters without word count: %v", err)
+			return
+		}
+		for i := range chapters {
+			if count := countWordsFromHTML(chapters[i].Content); count > 0 {
+				if err := dao.SetChapterWordCount(chapters[i].ID, count); err != nil {
+					log.Printf("[stats_service] Failed to store word count of chapter %s: %v", chapters[i].ID, err)
+					continue
+				}
+				filled++
+			}
+		}
+		if len(chapters) < pageSize {
+			break
+		}
+		afterID = chapters[len(chapters)-1].ID.String()
+	}
+	if filled > 0 {
+		log.Printf("[stats_service] Backfilled word counts of %d chapters", filled)
+	}
+}
+
+// GetUserWritingStats returns the statistics over all of the user's novels for the
+// last days days.
+func GetUserWritingStats(userID uint, days int) (*dto.WritingStatsDTO, error) {
+	novels, err := dao.GetNovelsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := buildWritingStats(userID, nil, days)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Novels = []dto.NovelWordsDTO{}
+	if len(novels) > 0 {
+		novelIDs := make([]uuid.UUID, len(novels))
+		for i, novel := range novels {
+			novelIDs[i] = novel.ID
+		}
+		totals, err := dao.GetWordTotalsForNovels(novelIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, novel := range novels {
+			total := totals[novel.ID]
+			stats.Novels = append(stats.Novels, dto.NovelWordsDTO{
+				ID:         novel.ID.String(),
+				Title:      novel.Title,
+				TotalWords: total.Words,
+				Chapters:   total.Chapters,
+			})
+		}
+	}
+
+	goals, err := getGoalProgress(userID, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats.Goals = goals
+	return stats, nil
+}
+
+// GetNovelWritingStats returns the statistics of one novel for the last days days.
+func GetNovelWritingStats(novelID string, userID uint, days int) (*dto.WritingStatsDTO, error) {
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
+	if err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	stats, err := buildWritingStats(userID, &novel.ID, days)
+	if err != nil {
+		return nil, err
+	}
+	goals, err := getGoalProgress(userID, &novel.ID)
+	if err != nil {
+		return nil, err
+	}
+	stats.Goals = goals
+	return stats, nil
+}
+
+func buildWritingStats(userID uint, novelID *uuid.UUID, days int) (*dto.WritingStatsDTO, error) {
+	if days <= 0 {
+		days = defaultStatsDays
+	} else if days > maxStatsDays {
+		days = maxStatsDays
+	}
+	today := time.Now()
+	since := today.AddDate(0, 0, -(days - 1))
+
+	totals, err := dao.GetDailyWordTotals(userID, novelID, since.Format(statsDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]dao.DailyWordTotal, len(totals))
+	for _, total := range totals {
+		byDate[total.Date] = total
+	}
+
+	stats := &dto.WritingStatsDTO{Daily: make([]dto.DailyWordsDTO, 0, days)}
+	// 没有保存记录的日期也输出，便于前端直接绘制折线图
+	for day := since; !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format(statsDateLayout)
+		total := byDate[date]
+		stats.Daily = append(stats.Daily, dto.DailyWordsDTO{
+			Date:         date,
+			WordsAdded:   total.WordsAdded,
+			WordsRemoved: total.WordsRemoved,
+			NetWords:     total.WordsAdded - total.WordsRemoved,
+			Saves:        total.Saves,
+		})
+	}
+	stats.TodayWords = byDate[today.Format(statsDateLayout)].WordsAdded
+
+	dates, err := dao.GetWritingDates(userID, novelID)
+	if err != nil {
+		return nil, err
+	}
+	stats.CurrentStreak, stats.LongestStreak = writingStreaks(dates, today)
+
+	counts, err := dao.GetChapterWordCounts(userID, novelID)
+	if err != nil {
+		return nil, err
+	}
+	stats.ChapterCount = len(counts)
+	stats.Distribution = chapterLengthDistribution(counts)
+	if len(counts) > 0 {
+		sort.Ints(counts)
+		for _, count := range counts {
+			stats.TotalWords += int64(count)
+		}
+		stats.ShortestChapterWords = counts[0]
+		stats.LongestChapterWords = counts[len(counts)-1]
+		stats.AverageChapterWords = int(stats.TotalWords / int64(len(counts)))
+	}
+	return stats, nil
+}
+
+// writingStreaks returns the current and the longest run of consecutive writing
+// days. dates are sorted newest first. The current streak is not broken before the
+// end of today, so it may end yesterday.
+func writingStreaks(dates []string, today time.Time) (int, int) {
+	current, longest, run := 0, 0, 0
+	inCurrent := false
+	expected := "" // 若连续，下一条（更早的）记录应为该日期
+	for i, date := range dates {
+		day, err := time.ParseInLocation(statsDateLayout, date, today.Location())
+		if err != nil {
+			continue
+		}
+		if run > 0 && date == expected {
+			run++
+		} else {
+			run = 1
+			inCurrent = false
+		}
+		if i == 0 {
+			inCurrent = date == today.Format(statsDateLayout) || date == today.AddDate(0, 0, -1).Format(statsDateLayout)
+		}
+		if inCurrent {
+			current = run
+		}
+		if run > longest {
+			longest = run
+		}
+		expected = day.AddDate(0, 0, -1).Format(statsDateLayout)
+	}
+	return current, longest
+}
+
+func chapterLengthDistribution(counts []int) []dto.ChapterLengthBucketDTO {
+	buckets := make([]dto.ChapterLengthBucketDTO, len(chapterLengthBuckets))
+	for i, min := range chapterLengthBuckets {
+		buckets[i] = dto.ChapterLengthBucketDTO{Min: min}
+		if i+1 < len(chapterLengthBuckets) {
+			buckets[i].Max = chapterLengthBuckets[i+1]
+			buckets[i].Label = strconv.Itoa(min) + "-" + strconv.Itoa(buckets[i].Max)
+		} else {
+			buckets[i].Label = strconv.Itoa(min) + "+"
+		}
+	}
+	for _, count := range counts {
+		i := sort.Search(len(chapterLengthBuckets), func(i int) bool { return chapterLengthBuckets[i] > count }) - 1
+		if i < 0 {
+			i = 0
+		}
+		buckets[i].Count++
+	}
+	return buckets
+}
+
+// GetWritingGoals returns all of the user's goals with their progress.
+func GetWritingGoals(userID uint) ([]dto.WritingGoalDTO, error) {
+	return getGoalProgress(userID, nil)
+}
+
+// SetWritingGoal creates the goal, or replaces the target and deadline of the goal
+// with the same novel and type.
+func SetWritingGoal(userID uint, payload dto.SetWritingGoalPayload) (*dto.WritingGoalDTO, error) {
+	goal := &model.WritingGoal{
+		UserID:      userID,
+		Type:        payload.Type,
+		TargetWords: payload.TargetWords,
+	}
+	if payload.NovelID != "" {
+		novel, err := dao.FindNovelWithRole(payload.NovelID, userID, model.RoleViewer)
+		if err != nil {
+			return nil, errors.New("novel not found or permission denied")
+		}
+		goal.NovelID = novel.ID
+	}
+	if payload.Deadline != "" {
+		if payload.Type != model.WritingGoalProject {
+			return nil, errors.New("only project goals can have a deadline")
+		}
+		deadline, err := time.ParseInLocation(statsDateLayout, payload.Deadline, time.Local)
+		if err != nil {
+			return nil, errors.New("invalid deadline, expected YYYY-MM-DD")
+		}
+		goal.Deadline = &deadline
+	}
+	if err := dao.SaveWritingGoal(goal); err != nil {
+		return nil, err
+	}
+
+	var novelID *uuid.UUID
+	if goal.NovelID != uuid.Nil {
+		novelID = &goal.NovelID
+	}
+	goals, err := getGoalProgress(userID, novelID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range goals {
+		if goals[i].ID == goal.ID.String() {
+			return &goals[i], nil
+		}
+	}
+	return nil, errors.New("goal not found after saving")
+}
+
+func DeleteWritingGoal(goalID string, userID uint) error {
+	deleted, err := dao.DeleteWritingGoal(goalID, userID)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.New("goal not found or permission denied")
+	}
+	return nil
+}
+
+// getGoalProgress returns the user's goals with their progress. With a novelID only
+// the goals of that novel are returned.
+func getGoalProgress(userID uint, novelID *uuid.UUID) ([]dto.WritingGoalDTO, error) {
+	goals, err := dao.GetWritingGoals(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	todayDate := now.Format(statsDateLayout)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	goalDTOs := []dto.WritingGoalDTO{}
+	for _, goal := range goals {
+		if novelID != nil && goal.NovelID != *novelID {
+			continue
+		}
+		var scope *uuid.UUID
+		goalDTO := dto.WritingGoalDTO{
+			ID:          goal.ID.String(),
+			Type:        goal.Type,
+			TargetWords: goal.TargetWords,
+		}
+		if goal.NovelID != uuid.Nil {
+			scope = &goal.NovelID
+			goalDTO.NovelID = goal.NovelID.String()
+		}
+
+		switch goal.Type {
+		case model.WritingGoalDaily:
+			totals, err := dao.GetDailyWordTotals(userID, scope, todayDate)
+			if err != nil {
+				return nil, err
+			}
+			for _, total := range totals {
+				goalDTO.Current += int64(total.WordsAdded)
+			}
+		default:
+			// 已失去访问权限的小说不再统计字数
+			if scope != nil {
+				if _, err := dao.FindNovelWithRole(scope.String(), userID, model.RoleViewer); err != nil {
+					break
+				}
+			}
+			counts, err := dao.GetChapterWordCounts(userID, scope)
+			if err != nil {
+				return nil, err
+			}
+			for _, count := range counts {
+				goalDTO.Current += int64(count)
+			}
+		}
+
+		target := int64(goal.TargetWords)
+		goalDTO.Percent = float64(goalDTO.Current) * 100 / float64(target)
+		if goalDTO.Percent > 100 {
+			goalDTO.Percent = 100
+		}
+		goalDTO.Achieved = goalDTO.Current >= target
+		if !goalDTO.Achieved {
+			goalDTO.RemainingWords = target - goalDTO.Current
+		}
+		if goal.Deadline != nil {
+			goalDTO.Deadline = goal.Deadline.Format(statsDateLayout)
+			// 截止日期当天也算在内
+			daysLeft := int(goal.Deadline.Sub(today).Hours()/24) + 1
+			if daysLeft > 0 {
+				goalDTO.DaysLeft = daysLeft
+				goalDTO.WordsPerDayNeeded = (goalDTO.RemainingWords + int64(daysLeft) - 1) / int64(daysLeft)
+			}
+		}
+		goalDTOs = append(goalDTOs, goalDTO)
+	}
+	return goalDTOs, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWritingStreaks(t *testing.T) {
+	today := time.Date(2024, 3, 10, 15, 0, 0, 0, time.Local)
+	cases := []struct {
+		name             string
+		dates            []string
+		current, longest int
+	}{
+		{"no writing", nil, 0, 0},
+		{"today only", []string{"2024-03-10"}, 1, 1},
+		{"streak ending yesterday", []string{"2024-03-09", "2024-03-08"}, 2, 2},
+		{"streak broken two days ago", []string{"2024-03-08", "2024-03-07"}, 0, 2},
+		{"current and longer past streak", []string{"2024-03-10", "2024-03-09", "2024-03-05", "2024-03-04", "2024-03-03"}, 2, 3},
+		{"across a month boundary", []string{"2024-03-02", "2024-03-01", "2024-02-29", "2024-02-28"}, 0, 4},
+		{"invalid dates are skipped", []string{"2024-03-10", "bad", "2024-03-09"}, 2, 2},
+	}
+	for _, tc := range cases {
+		current, longest := writingStreaks(tc.dates, today)
+		if current != tc.current || longest != tc.longest {
+			t.Errorf("%s: writingStreaks = %d, %d, want %d, %d", tc.name, current, longest, tc.current, tc.longest)
+		}
+	}
+}
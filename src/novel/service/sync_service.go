@@ -0,0 +1,256 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"st-novel-go/src/novel/dao"
+	"st-novel-go/src/novel/dto"
+	"st-novel-go/src/novel/model"
+)
+
+const (
+	defaultUpdatesLimit = 500
+	maxUpdatesLimit     = 1000
+)
+
+// updateKeys maps change log entity types to the keys of NovelUpdatesDTO.
+var updateKeys = map[string]string{
+	model.ChangeEntityNovel:          "metadata",
+	model.ChangeEntityVolume:         "volumes",
+	model.ChangeEntityChapter:        "chapters",
+	model.ChangeEntityDerivedContent: "derived_content",
+	model.ChangeEntityNote:           "notes",
+	model.ChangeEntityNode:           "nodes",
+}
+
+// GetNovelUpdates returns the changes of a novel after cursor, at most limit change
+// log entries at a time. Several changes of one entity within a page are folded
+// into its latest state. Without a cursor, or with one the log does not know or no
+// longer keeps, the novel's full state is returned with Reset set.
+func GetNovelUpdates(novelID string, cursor uint64, limit int, userID uint) (*dto.NovelUpdatesDTO, error) {
+	if limit <= 0 {
+		limit = defaultUpdatesLimit
+	} else if limit > maxUpdatesLimit {
+		limit = maxUpdatesLimit
+	}
+
+	// 先取游标上限，本页只下发不超过上限的变更，且所有数据都在取上限之后读取：
+	// 期间新发生的变更已反映在数据中，并会在下一页重复下发，不会遗漏
+	latest, err := dao.GetLatestNovelChangeSeq(novelID)
+	if err != nil {
+		return nil, err
+	}
+	// 早于保留范围的游标之后的条目可能已被清理，无法增量同步
+	horizon, err := dao.GetNovelChangeHorizon(novelID)
+	if err != nil {
+		return nil, err
+	}
+	if horizon > latest {
+		latest = horizon
+	}
+	novel, err := dao.FindNovelWithRole(novelID, userID, model.RoleViewer)
+	if err != nil {
+		return nil, errors.New("novel not found or permission denied")
+	}
+	if cursor == 0 || cursor > latest || cursor < horizon {
+		return getFullNovelUpdates(&novel, latest)
+	}
+
+	changes, err := dao.GetNovelChanges(novelID, cursor, latest, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	result := newNovelUpdates(cursor)
+	if len(changes) > limit {
+		changes, result.HasMore = changes[:limit], true
+	}
+	if len(changes) == 0 {
+		return result, nil
+	}
+	result.Cursor = changes[len(changes)-1].Seq
+
+	// 同一页内每个实体只保留最后一次变更
+	latestOps := make(map[string]string)
+	var order []model.NovelChange
+	for _, change := range changes {
+		key := change.EntityType + "/" + change.EntityID
+		if _, seen := latestOps[key]; !seen {
+			order = append(order, change)
+		}
+		latestOps[key] = change.Op
+	}
+	upserted := make(map[string][]string)
+	for _, change := range order {
+		if latestOps[change.EntityType+"/"+change.EntityID] == model.ChangeOpDelete {
+			key := updateKeys[change.EntityType]
+			result.Deletes[key] = append(result.Deletes[key], change.EntityID)
+			continue
+		}
+		upserted[change.EntityType] = append(upserted[change.EntityType], change.EntityID)
+	}
+
+	if len(upserted[model.ChangeEntityNovel]) > 0 {
+		result.Updates["metadata"] = []interface{}{novelMetadataUpdate(&novel)}
+	}
+	if err := addRowUpdates(result, novelID, model.ChangeEntityVolume, upserted, &[]model.Volume{}); err != nil {
+		return nil, err
+	}
+	if err := addRowUpdates(result, novelID, model.ChangeEntityChapter, upserted, &[]model.Chapter{}); err != nil {
+		return nil, err
+	}
+	if err := addRowUpdates(result, novelID, model.ChangeEntityDerivedContent, upserted, &[]model.DerivedContent{}); err != nil {
+		return nil, err
+	}
+	if err := addRowUpdates(result, novelID, model.ChangeEntityNote, upserted, &[]model.Note{}); err != nil {
+		return nil, err
+	}
+	if ids := upserted[model.ChangeEntityNode]; len(ids) > 0 {
+		wanted := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			wanted[id] = true
+		}
+		// 之后又被删除的节点在树中已不存在，其删除记录在后续页中
+		for _, update := range novelNodeUpdates(&novel) {
+			if wanted[update.ID] {
+				result.Updates["nodes"] = append(result.Updates["nodes"], update)
+			}
+		}
+	}
+	return result, nil
+}
+
+func newNovelUpdates(cursor uint64) *dto.NovelUpdatesDTO {
+	return &dto.NovelUpdatesDTO{
+		Updates: make(map[string][]interface{}),
+		Deletes: make(map[string][]string),
+		Cursor:  cursor,
+	}
+}
+
+// addRowUpdates loads the upserted rows of one entity type into rows, a pointer to
+// a slice of the type's model, and adds them to the result. Rows deleted since
+// are left out; their deletion follows in a later page.
+func addRowUpdates(result *dto.NovelUpdatesDTO, novelID, entityType string, upserted map[string][]string, rows interface{}) error {
+	ids := upserted[entityType]
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := dao.FindNovelRowsByID(novelID, ids, rows); err != nil {
+		return err
+	}
+	key := updateKeys[entityType]
+	switch items := rows.(type) {
+	case *[]model.Volume:
+		for _, item := range *items {
+			result.Updates[key] = append(result.Updates[key], item)
+		}
+	case *[]model.Chapter:
+		for _, item := range *items {
+			result.Updates[key] = append(result.Updates[key], item)
+		}
+	case *[]model.DerivedContent:
+		for _, item := range *items {
+			result.Updates[key] = append(result.Updates[key], item)
+		}
+	case *[]model.Note:
+		for _, item := range *items {
+			result.Updates[key] = append(result.Updates[key], item)
+		}
+	}
+	return nil
+}
+
+// getFullNovelUpdates returns everything of a novel as updates, with cursor as the
+// position to continue from.
+func getFullNovelUpdates(novel *model.Novel, cursor uint64) (*dto.NovelUpdatesDTO, error) {
+	novelID := novel.ID.String()
+	result := newNovelUpdates(cursor)
+	result.Reset = true
+	result.Updates["metadata"] = []interface{}{novelMetadataUpdate(novel)}
+
+	volumes, err := dao.GetVolumesByNovelID(novelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		result.Updates["volumes"] = append(result.Updates["volumes"], v)
+	}
+	chapters, err := dao.GetChaptersByNovelID(novelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range chapters {
+		result.Updates["chapters"] = append(result.Updates["chapters"], ch)
+	}
+	derived, err := dao.GetDerivedContentForNovel(novelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range derived {
+		result.Updates["derived_content"] = append(result.Updates["derived_content"], d)
+	}
+	notes, err := dao.GetNotesForNovel(novelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		result.Updates["notes"] = append(result.Updates["notes"], n)
+	}
+	for _, update := range novelNodeUpdates(novel) {
+		result.Updates["nodes"] = append(result.Updates["nodes"], update)
+	}
+	return result, nil
+}
+
+func novelMetadataUpdate(novel *model.Novel) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          novel.ID.String(),
+		"title":       novel.Title,
+		"description": novel.Description,
+		"cover":       novel.Cover,
+		"tags":        novel.Tags,
+		"status":      novel.Status,
+		"category":    novel.Category,
+	}
+}
+
+// novelNodeUpdates lists every node of a novel's settings trees and custom data
+// lists, parents before their children.
+func novelNodeUpdates(novel *model.Novel) []dto.NodeUpdateDTO {
+	var updates []dto.NodeUpdateDTO
+	for nodeType, field := range nodeFields {
+		var tree []dto.TreeNodeDTO
+		if data := novelJSONFieldData(novel, field); len(data) > 0 {
+			_ = json.Unmarshal(data, &tree)
+		}
+		var walk func(nodes []map[string]interface{}, parentID string)
+		walk = func(nodes []map[string]interface{}, parentID string) {
+			for i, node := range nodes {
+				id := nodeID(node)
+				if id == "" {
+					continue
+				}
+				stored := make(dto.TreeNodeDTO, len(node))
+				for key, value := range node {
+					if key != "children" {
+						stored[key] = value
+					}
+				}
+				updates = append(updates, dto.NodeUpdateDTO{
+					ID:       nodeType + ":" + id,
+					Type:     nodeType,
+					ParentID: parentID,
+					Index:    i,
+					Node:     stored,
+				})
+				walk(childNodes(node), id)
+			}
+		}
+		top := make([]map[string]interface{}, len(tree))
+		for i := range tree {
+			top[i] = tree[i]
+		}
+		walk(top, "")
+	}
+	return updates
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	aiRouter "st-novel-go/src/ai/router"
 	"st-novel-go/src/config"
+	"st-novel-go/src/middleware"
 	novelRouter "st-novel-go/src/novel/router"
 	settingsRouter "st-novel-go/src/settings/router"
 	userRouter "st-novel-go/src/user/router"
@@ -18,7 +19,7 @@ func SetupRouter() *gin.Engine {
 	}
 
 	r := gin.New()
-	r.Use(gin.Logger())
+	r.Use(middleware.Logger())
 	r.Use(gin.Recovery())
 
 	// CORS configuration
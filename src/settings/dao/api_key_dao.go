@@ -1,6 +1,7 @@
 package dao
 
 import (
+	"gorm.io/gorm"
 	"st-novel-go/src/database"
 	"st-novel-go/src/settings/model"
 )
@@ -30,3 +31,8 @@ func DeleteAPIKey(id uint, userID uint) error {
 	// Ensure the user owns the key before deleting
 	return database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&model.APIKey{}).Error
 }
+
+// IncrementAPIKeyCalls counts one call made with the key.
+func IncrementAPIKeyCalls(id uint) error {
+	return database.DB.Model(&model.APIKey{}).Where("id = ?", id).UpdateColumn("calls", gorm.Expr("calls + 1")).Error
+}
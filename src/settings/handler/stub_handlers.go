@@ -1,4 +1,4 @@
-// stub_handlers.go — 系统设置、使用日志、数据隐私等 stub 端点
+// stub_handlers.go — 系统设置、数据隐私等 stub 端点
 package handler
 
 import (
@@ -37,16 +37,6 @@ func UpdateSystemSettingsHandler(c *gin.Context) {
 	utils.Success(c, payload)
 }
 
-// --- Usage Logs Stubs ---
-
-func GetUsageLogsHandler(c *gin.Context) {
-	logs := []map[string]interface{}{
-		{"id": "1", "action": "AI任务-续写", "timestamp": "2026-05-03T10:00:00Z", "details": "续写第3章"},
-		{"id": "2", "action": "导出", "timestamp": "2026-05-02T15:30:00Z", "details": "导出为TXT"},
-	}
-	utils.Success(c, logs)
-}
-
 // --- Data Privacy Stubs ---
 
 func GetPrivacySettingsHandler(c *gin.Context) {
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"st-novel-go/src/settings/service"
+	"st-novel-go/src/utils"
+	"strconv"
+)
+
+// GetUsageLogsHandler GET /api/usage-logs?page=&pageSize=
+func GetUsageLogsHandler(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.Query("page"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+
+	logs, err := service.GetUsageLogs(userID, page, pageSize)
+	if err != nil {
+		utils.Fail(c, "Failed to get usage logs: "+err.Error())
+		return
+	}
+	utils.Success(c, logs)
+}
+
+// GetUsageSummaryHandler GET /api/usage-logs/summary — 今日、本月、累计的调用量与费用
+func GetUsageSummaryHandler(c *gin.Context) {
+	userID, ok := getUserID(c)
+	if !ok {
+		return
+	}
+	summary, err := service.GetUsageSummary(userID)
+	if err != nil {
+		utils.Fail(c, "Failed to get usage summary: "+err.Error())
+		return
+	}
+	utils.Success(c, summary)
+}
@@ -2,12 +2,14 @@ package model
 
 // ApiProvider represents detailed information about a supported API provider for the main list view.
 type ApiProvider struct {
-	Name        string `json:"name"`
-	ShortName   string `json:"shortName"`
-	Description string `json:"description"`
-	StatusText  string `json:"statusText"`
-	ActiveKeys  int    `json:"activeKeys"`
-	TotalCalls  string `json:"totalCalls"`
+	Name        string  `json:"name"`
+	ShortName   string  `json:"shortName"`
+	Description string  `json:"description"`
+	StatusText  string  `json:"statusText"`
+	ActiveKeys  int     `json:"activeKeys"`
+	TotalCalls  string  `json:"totalCalls"`
+	TotalTokens int64   `json:"totalTokens"`
+	TotalCost   float64 `json:"totalCost"` // 累计估算费用（美元）
 }
 
 // ModalProvider represents simplified provider information for the selection modal.
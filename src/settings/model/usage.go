@@ -0,0 +1,31 @@
+package model
+
+// UsageLogEntry is one AI call in the usage log.
+type UsageLogEntry struct {
+	ID               string  `json:"id"`
+	Action           string  `json:"action"`
+	Timestamp        string  `json:"timestamp"`
+	Details          string  `json:"details"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+	Estimated        bool    `json:"estimated"`
+	CacheHit         bool    `json:"cacheHit"`
+}
+
+type UsageTotals struct {
+	Requests  int64   `json:"requests"`
+	CacheHits int64   `json:"cacheHits"`
+	Tokens    int64   `json:"tokens"`
+	Cost      float64 `json:"cost"`
+}
+
+// UsageSummary holds cost totals of the usage log.
+type UsageSummary struct {
+	Today      UsageTotals            `json:"today"`
+	ThisMonth  UsageTotals            `json:"thisMonth"`
+	AllTime    UsageTotals            `json:"allTime"`
+	ByProvider map[string]UsageTotals `json:"byProvider"`
+}
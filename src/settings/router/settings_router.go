@@ -39,11 +39,12 @@ func RegisterSettingsRoutes(router *gin.RouterGroup) {
 		systemGroup.PATCH("/settings", handler.UpdateSystemSettingsHandler)
 	}
 
-	// Usage logs routes (stub)
+	// Usage logs routes
 	usageGroup := router.Group("/usage-logs")
 	usageGroup.Use(middleware.AuthMiddleware())
 	{
 		usageGroup.GET("", handler.GetUsageLogsHandler)
+		usageGroup.GET("/summary", handler.GetUsageSummaryHandler)
 	}
 
 	// Data privacy routes (stubs)
@@ -1,6 +1,7 @@
 package service
 
 import (
+	aiDao "st-novel-go/src/ai/dao"
 	"st-novel-go/src/settings/dao"
 	"st-novel-go/src/settings/model"
 	"strconv"
@@ -36,11 +37,17 @@ func GetAPIProviders(userID uint) ([]model.ApiProvider, error) {
 		providerStats[key.Provider] = stats
 	}
 
+	usageByProvider, err := aiDao.SumUsageByProvider(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	modalProviders := GetModalProviders()
 	apiProviders := make([]model.ApiProvider, len(modalProviders))
 
 	for i, p := range modalProviders {
 		stats := providerStats[model.ProviderType(p.Name)]
+		usage := usageByProvider[p.Name]
 		statusText := "未配置"
 		if stats.ActiveKeys > 0 {
 			statusText = strconv.Itoa(stats.ActiveKeys) + "个密钥"
@@ -53,6 +60,8 @@ func GetAPIProviders(userID uint) ([]model.ApiProvider, error) {
 			StatusText:  statusText,
 			ActiveKeys:  stats.ActiveKeys,
 			TotalCalls:  formatCalls(stats.TotalCalls), // Formatting calls
+			TotalTokens: usage.PromptTokens + usage.CompletionTokens,
+			TotalCost:   usage.Cost,
 		}
 	}
 
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	aiDao "st-novel-go/src/ai/dao"
+	"st-novel-go/src/settings/model"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultUsageLogPageSize = 50
+	maxUsageLogPageSize     = 200
+)
+
+// GetUsageLogs returns one page of the user's AI calls, newest first.
+func GetUsageLogs(userID uint, page, pageSize int) ([]model.UsageLogEntry, error) {
+	if pageSize <= 0 {
+		pageSize = defaultUsageLogPageSize
+	} else if pageSize > maxUsageLogPageSize {
+		pageSize = maxUsageLogPageSize
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	records, err := aiDao.GetUsageRecords(userID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]model.UsageLogEntry, len(records))
+	for i, record := range records {
+		action := "AI调用"
+		details := fmt.Sprintf("%s · %s · %d tokens", record.Provider, record.Model, record.PromptTokens+record.CompletionTokens)
+		if record.CacheHit {
+			action = "AI调用（缓存命中）"
+			details = fmt.Sprintf("%s · %s · 复用缓存结果", record.Provider, record.Model)
+		}
+		entries[i] = model.UsageLogEntry{
+			ID:               strconv.FormatUint(uint64(record.ID), 10),
+			Action:           action,
+			Timestamp:        record.CreatedAt.Format(time.RFC3339),
+			Details:          details,
+			Provider:         record.Provider,
+			Model:            record.Model,
+			PromptTokens:     record.PromptTokens,
+			CompletionTokens: record.CompletionTokens,
+			Cost:             record.Cost,
+			Estimated:        record.Estimated,
+			CacheHit:         record.CacheHit,
+		}
+	}
+	return entries, nil
+}
+
+// GetUsageSummary returns the user's AI cost totals for today, this month, all
+// time and per provider.
+func GetUsageSummary(userID uint) (*model.UsageSummary, error) {
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	summary := &model.UsageSummary{ByProvider: make(map[string]model.UsageTotals)}
+	for _, period := range []struct {
+		since  time.Time
+		target *model.UsageTotals
+	}{
+		{dayStart, &summary.Today},
+		{monthStart, &summary.ThisMonth},
+		{time.Time{}, &summary.AllTime},
+	} {
+		totals, err := aiDao.SumUsageSince(userID, period.since)
+		if err != nil {
+			return nil, err
+		}
+		*period.target = toUsageTotals(*totals)
+	}
+
+	byProvider, err := aiDao.SumUsageByProvider(userID)
+	if err != nil {
+		return nil, err
+	}
+	for provider, totals := range byProvider {
+		summary.ByProvider[provider] = toUsageTotals(totals)
+	}
+	return summary, nil
+}
+
+func toUsageTotals(totals aiDao.UsageTotals) model.UsageTotals {
+	return model.UsageTotals{
+		Requests:  totals.Requests,
+		CacheHits: totals.CacheHits,
+		Tokens:    totals.PromptTokens + totals.CompletionTokens,
+		Cost:      totals.Cost,
+	}
+}
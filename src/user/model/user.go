@@ -25,6 +25,7 @@ type User struct {
 	Region    string         `gorm:"type:varchar(100)" json:"region"`
 	Timezone  string         `gorm:"type:varchar(100)" json:"timezone"`
 	Plan      PlanType       `gorm:"type:varchar(50);default:'免费版'" json:"plan"`
+	IsAdmin   bool           `gorm:"default:false" json:"is_admin"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
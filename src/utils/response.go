@@ -56,3 +56,21 @@ func FailWithUnauthorized(c *gin.Context, message string) {
 		Data: nil,
 	})
 }
+
+// FailWithForbidden sends a 403 Forbidden response.
+func FailWithForbidden(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, Response{
+		Code: -1,
+		Msg:  message,
+		Data: nil,
+	})
+}
+
+// FailWithConflict sends a 409 Conflict response with data describing the conflict.
+func FailWithConflict(c *gin.Context, message string, data interface{}) {
+	c.JSON(http.StatusConflict, Response{
+		Code: -1,
+		Msg:  message,
+		Data: data,
+	})
+}